@@ -0,0 +1,327 @@
+// Package assembler translates 6502 assembly source into relocatable objects
+// for the linker, in a subset of the ca65 syntax:
+//
+//	        .import print
+//	        .export main
+//	        .zeropage
+//	ptr:    .res 2
+//	        .code
+//	main:   lda #<message
+//	        sta ptr
+//	        lda #>message
+//	        sta ptr+1
+//	        jsr print
+//	@loop:  jmp @loop
+//	        .segment "RODATA"
+//	message: .byte "HI", 0
+//
+// Labels end with a colon, and those starting with @ are local to the label
+// before them. NAME = expression defines a constant. Numbers are decimal,
+// $hex or %binary, 'c' is a character and * is the current address.
+// Expressions take the operators of C, with < and > for the low and high
+// byte of a value.
+//
+// Code goes into the CODE segment until a .segment, .code, .rodata, .data,
+// .bss or .zeropage directive picks another. Other directives are .byte,
+// .word, .asciiz, .res, .export, .exportzp, .import and .importzp.
+package assembler
+
+import (
+	"fmt"
+	"strings"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+	linker "izzudinhafiz.com/go-6502/linker"
+)
+
+// Kinds of symbol
+const (
+	SYM_LABEL byte = iota
+	SYM_CONSTANT
+	SYM_IMPORT
+)
+
+type symbol struct {
+	kind  byte
+	value value
+	line  int // Where it was defined or imported
+}
+
+// section collects the bytes of one segment
+type section struct {
+	segment     string
+	data        []byte
+	initialised bool // Holds bytes other than .res reservations
+	relocations []linker.Relocation
+}
+
+// line is a source line split into its parts
+type line struct {
+	num      int
+	label    string
+	constant string // Name defined by NAME = operand
+	op       string
+	operand  string
+}
+
+type export struct {
+	name string
+	line int
+}
+
+type assembler struct {
+	name    string
+	opcodes map[string]map[byte]byte // Mnemonic to addressing mode to opcode
+	lines   []line
+	modes   map[int]byte // Addressing mode picked for each instruction line in the first pass
+
+	pass     int
+	symbols  map[string]*symbol
+	sections []*section
+	current  *section
+	scope    string // Last label not starting with @
+
+	imports []string
+	exports []export
+}
+
+// Assemble translates source into an object for a CPU variant. name
+// prefixes error messages and becomes the object's name.
+func Assemble(name string, source []byte, variant byte) (*linker.Object, error) {
+	a := &assembler{
+		name:    name,
+		opcodes: opcodeTable(variant),
+		modes:   map[int]byte{},
+		symbols: map[string]*symbol{},
+	}
+	for i, text := range strings.Split(string(source), "\n") {
+		ln, err := splitLine(i+1, text)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%d: %w", name, i+1, err)
+		}
+		a.lines = append(a.lines, ln)
+	}
+
+	for a.pass = 1; a.pass <= 2; a.pass++ {
+		for _, sec := range a.sections {
+			sec.data, sec.initialised, sec.relocations = nil, false, nil
+		}
+		a.current = a.section(linker.SEG_CODE)
+		a.scope = ""
+		for _, ln := range a.lines {
+			if err := a.assembleLine(ln); err != nil {
+				return nil, fmt.Errorf("%v:%d: %w", name, ln.num, err)
+			}
+		}
+	}
+	return a.object()
+}
+
+// opcodeTable indexes the documented opcodes of a variant by mnemonic
+func opcodeTable(variant byte) map[string]map[byte]byte {
+	table := map[string]map[byte]byte{}
+	add := func(code byte, op cpu.Opcode) {
+		if table[op.FriendlyName] == nil {
+			table[op.FriendlyName] = map[byte]byte{}
+		}
+		table[op.FriendlyName][op.AddressingMode] = code
+	}
+	for code, op := range cpu.Opcodes {
+		add(code, op)
+	}
+	if variant == cpu.VARIANT_65C02 {
+		for code, op := range cpu.Opcodes65C02 {
+			// The undefined opcodes are NOPs of other sizes, only $EA is the real one
+			if op.Code != cpu.OP_NOP {
+				add(code, op)
+			}
+		}
+	}
+	return table
+}
+
+// splitLine separates the label, operation and operand of a line
+func splitLine(num int, text string) (line, error) {
+	ln := line{num: num}
+	text = strings.TrimSpace(stripComment(text))
+
+	if end := identEnd(text); end > 0 {
+		rest := strings.TrimSpace(text[end:])
+		switch {
+		case strings.HasPrefix(rest, ":"):
+			ln.label = text[:end]
+			text = strings.TrimSpace(rest[1:])
+		case strings.HasPrefix(rest, "=") && !strings.HasPrefix(rest, "=="):
+			ln.constant = text[:end]
+			ln.operand = strings.TrimSpace(rest[1:])
+			if ln.operand == "" {
+				return ln, fmt.Errorf("missing value for %v", ln.constant)
+			}
+			return ln, nil
+		}
+	}
+
+	if text == "" {
+		return ln, nil
+	}
+	op := text
+	if i := strings.IndexAny(text, " \t"); i >= 0 {
+		op, ln.operand = text[:i], strings.TrimSpace(text[i:])
+	}
+	ln.op = strings.ToUpper(op)
+	return ln, nil
+}
+
+// stripComment removes a ; comment, leaving ; inside quotes alone
+func stripComment(text string) string {
+	quote := byte(0)
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ';':
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// identEnd returns the length of the identifier text starts with
+func identEnd(text string) int {
+	if text == "" || !isIdentStart(text[0]) {
+		return 0
+	}
+	end := 1
+	for end < len(text) && isIdentChar(text[end]) {
+		end++
+	}
+	return end
+}
+
+func (a *assembler) assembleLine(ln line) error {
+	if ln.label != "" {
+		if err := a.defineLabel(ln); err != nil {
+			return err
+		}
+	}
+	if ln.constant != "" {
+		v, err := a.eval(ln.operand)
+		if err != nil {
+			return err
+		}
+		return a.define(ln.constant, SYM_CONSTANT, v, ln.num)
+	}
+
+	switch {
+	case ln.op == "":
+		return nil
+	case strings.HasPrefix(ln.op, "."):
+		return a.directive(ln)
+	}
+	return a.instruction(ln)
+}
+
+func (a *assembler) defineLabel(ln line) error {
+	name := ln.label
+	if strings.HasPrefix(name, "@") {
+		if a.scope == "" {
+			return fmt.Errorf("local label %v before any other label", name)
+		}
+		name = a.scope + name
+	} else {
+		a.scope = name
+	}
+	return a.define(name, SYM_LABEL, a.here(), ln.num)
+}
+
+// define records a symbol, which the second pass defines again with the
+// same value
+func (a *assembler) define(name string, kind byte, v value, num int) error {
+	if sym, exists := a.symbols[name]; exists && (a.pass == 1 || sym.line != num) {
+		return fmt.Errorf("%v is already defined on line %d", name, sym.line)
+	}
+	if a.pass == 2 && v.unknown {
+		return fmt.Errorf("%v depends on a symbol defined after it", name)
+	}
+	a.symbols[name] = &symbol{kind, v, num}
+	return nil
+}
+
+// lookup finds a symbol's value. In the first pass symbols defined further
+// on are unknown, in the second they are all known.
+func (a *assembler) lookup(name string) (value, error) {
+	if strings.HasPrefix(name, "@") {
+		name = a.scope + name
+	}
+	sym, exists := a.symbols[name]
+	switch {
+	case exists && !sym.value.unknown:
+		return sym.value, nil
+	case a.pass == 1:
+		return value{unknown: true, section: -1}, nil
+	case exists:
+		return value{}, fmt.Errorf("%v is used before its value is known", name)
+	}
+	return value{}, fmt.Errorf("undefined symbol %v", name)
+}
+
+// here is the current address, relative to the start of the section
+func (a *assembler) here() value {
+	return value{
+		n:       len(a.current.data),
+		section: a.sectionIndex(a.current),
+		zp:      a.current.segment == linker.SEG_ZEROPAGE,
+	}
+}
+
+func (a *assembler) section(segment string) *section {
+	for _, sec := range a.sections {
+		if sec.segment == segment {
+			return sec
+		}
+	}
+	sec := &section{segment: segment}
+	a.sections = append(a.sections, sec)
+	return sec
+}
+
+func (a *assembler) sectionIndex(sec *section) int {
+	for i, s := range a.sections {
+		if s == sec {
+			return i
+		}
+	}
+	return -1
+}
+
+// object builds the linker object once both passes are done
+func (a *assembler) object() (*linker.Object, error) {
+	o := &linker.Object{Name: a.name, Imports: a.imports}
+	for _, sec := range a.sections {
+		s := linker.Section{Segment: sec.segment, Relocations: sec.relocations}
+		if sec.initialised {
+			s.Data = sec.data
+		} else {
+			s.Size = len(sec.data)
+		}
+		o.Sections = append(o.Sections, s)
+	}
+
+	for _, e := range a.exports {
+		sym, exists := a.symbols[e.name]
+		switch {
+		case !exists:
+			return nil, fmt.Errorf("%v:%d: exported symbol %v is not defined", a.name, e.line, e.name)
+		case sym.kind == SYM_IMPORT:
+			return nil, fmt.Errorf("%v:%d: %v is imported, it cannot be exported", a.name, e.line, e.name)
+		case sym.value.sym != "" || sym.value.part != PART_FULL:
+			return nil, fmt.Errorf("%v:%d: %v is not an address or a number", a.name, e.line, e.name)
+		}
+		o.Exports = append(o.Exports, linker.Export{Name: e.name, Section: sym.value.section, Value: sym.value.n})
+	}
+	return o, o.Validate()
+}
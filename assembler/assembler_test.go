@@ -0,0 +1,191 @@
+package assembler
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+	linker "izzudinhafiz.com/go-6502/linker"
+)
+
+func TestEncoding(t *testing.T) {
+	tests := []struct {
+		variant byte
+		source  string
+		want    []byte
+	}{
+		{cpu.VARIANT_NMOS, "lda #$10", []byte{0xA9, 0x10}},
+		{cpu.VARIANT_NMOS, "LDA #'A'", []byte{0xA9, 0x41}},
+		{cpu.VARIANT_NMOS, "lda #<$1234", []byte{0xA9, 0x34}},
+		{cpu.VARIANT_NMOS, "lda #>$1234", []byte{0xA9, 0x12}},
+		{cpu.VARIANT_NMOS, "lda $10", []byte{0xA5, 0x10}},
+		{cpu.VARIANT_NMOS, "lda $1234", []byte{0xAD, 0x34, 0x12}},
+		{cpu.VARIANT_NMOS, "lda $10,x", []byte{0xB5, 0x10}},
+		{cpu.VARIANT_NMOS, "lda $1234,X", []byte{0xBD, 0x34, 0x12}},
+		{cpu.VARIANT_NMOS, "lda $10,y", []byte{0xB9, 0x10, 0x00}}, // No zp,Y for LDA
+		{cpu.VARIANT_NMOS, "ldx $10,y", []byte{0xB6, 0x10}},
+		{cpu.VARIANT_NMOS, "lda ($10,x)", []byte{0xA1, 0x10}},
+		{cpu.VARIANT_NMOS, "lda ($10),y", []byte{0xB1, 0x10}},
+		{cpu.VARIANT_NMOS, "jmp ($1234)", []byte{0x6C, 0x34, 0x12}},
+		{cpu.VARIANT_NMOS, "lda (2+3)*4", []byte{0xA5, 0x14}},
+		{cpu.VARIANT_NMOS, "asl", []byte{0x0A}},
+		{cpu.VARIANT_NMOS, "asl a", []byte{0x0A}},
+		{cpu.VARIANT_NMOS, "nop", []byte{0xEA}},
+		{cpu.VARIANT_NMOS, "N = %1010 | 1 << 4\n lda #N", []byte{0xA9, 0x1A}},
+		{cpu.VARIANT_NMOS, "lda fwd\nfwd = $10", []byte{0xAD, 0x10, 0x00}}, // Not known to be zero page yet
+		{cpu.VARIANT_NMOS, "loop: bne loop", []byte{0xD0, 0xFE}},
+		{cpu.VARIANT_NMOS, " beq done\n nop\ndone:", []byte{0xF0, 0x01, 0xEA}},
+		{cpu.VARIANT_NMOS, ".byte 1, \"AB\", -1 ; comment; more", []byte{0x01, 0x41, 0x42, 0xFF}},
+		{cpu.VARIANT_NMOS, ".word $1234, 5", []byte{0x34, 0x12, 0x05, 0x00}},
+		{cpu.VARIANT_NMOS, ".asciiz \"A;B\"", []byte{0x41, 0x3B, 0x42, 0x00}},
+		{cpu.VARIANT_NMOS, "nop\n.res 2, $FF\nnop", []byte{0xEA, 0xFF, 0xFF, 0xEA}},
+		{cpu.VARIANT_65C02, "lda ($10)", []byte{0xB2, 0x10}},
+		{cpu.VARIANT_65C02, "jmp ($1234,x)", []byte{0x7C, 0x34, 0x12}},
+		{cpu.VARIANT_65C02, "stz $10", []byte{0x64, 0x10}},
+		{cpu.VARIANT_65C02, "inc", []byte{0x1A}},
+		{cpu.VARIANT_65C02, "nop", []byte{0xEA}},
+		{cpu.VARIANT_65C02, "top: bbr3 $10, top", []byte{0x3F, 0x10, 0xFD}},
+	}
+
+	for _, tt := range tests {
+		obj, err := Assemble("test.s", []byte(tt.source), tt.variant)
+		if err != nil {
+			t.Errorf("%q: %v", tt.source, err)
+			continue
+		}
+		if got := obj.Sections[0].Data; !bytes.Equal(got, tt.want) {
+			t.Errorf("%q assembled to % X, want % X", tt.source, got, tt.want)
+		}
+	}
+}
+
+const testSource = `
+        .import print
+        .export main, ANSWER
+ANSWER = 42
+
+        .zeropage
+ptr:    .res 2
+
+        .code
+main:   lda #<message
+        sta ptr
+        lda #>message
+        sta ptr+1
+        jsr print
+@loop:  bne @loop
+        jmp main
+
+        .data
+message: .byte "HI", 0
+
+        .bss
+buffer: .res 16
+
+        .segment "VECTORS"
+        .word 0, main, 0
+`
+
+const testConfig = `
+MEMORY {
+    ZP:  start = $0000, size = $0100, type = rw;
+    RAM: start = $0200, size = $7E00, type = rw;
+    ROM: start = $8000, size = $8000, type = ro, fill = yes, fillval = $FF;
+}
+SEGMENTS {
+    ZEROPAGE: load = ZP, type = zp;
+    CODE:     load = ROM, type = ro;
+    DATA:     load = ROM, run = RAM, type = rw, define = yes;
+    BSS:      load = RAM, type = bss;
+    VECTORS:  load = ROM, type = ro, start = $FFFA;
+}
+`
+
+func TestAssembleAndLink(t *testing.T) {
+	mainObj, err := Assemble("main.s", []byte(testSource), cpu.VARIANT_NMOS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	printObj, err := Assemble("print.s", []byte(".export print\nprint: rts\n"), cpu.VARIANT_NMOS)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Objects survive the file format
+	var buf bytes.Buffer
+	if err := linker.WriteObject(&buf, mainObj); err != nil {
+		t.Fatal(err)
+	}
+	if mainObj, err = linker.ReadObject(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := linker.ParseConfig(strings.NewReader(testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := linker.Link([]*linker.Object{mainObj, printObj}, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{
+		0xA9, 0x00, // lda #<message
+		0x85, 0x00, // sta ptr
+		0xA9, 0x02, // lda #>message
+		0x85, 0x01, // sta ptr+1
+		0x20, 0x10, 0x80, // jsr print
+		0xD0, 0xFE, // bne @loop
+		0x4C, 0x00, 0x80, // jmp main
+		0x60,           // print: rts
+		'H', 'I', 0x00, // message, loaded in ROM to be copied to RAM
+	}
+	rom := img.Area("ROM")
+	if !bytes.Equal(rom[:len(want)], want) {
+		t.Errorf("ROM starts % X, want % X", rom[:len(want)], want)
+	}
+	if vector := rom[0x7FFC:0x7FFE]; !bytes.Equal(vector, []byte{0x00, 0x80}) {
+		t.Errorf("reset vector % X, want 00 80", vector)
+	}
+	if img.Symbols["main"] != 0x8000 || img.Symbols["ANSWER"] != 42 || img.Symbols["print"] != 0x8010 {
+		t.Errorf("symbols %v", img.Symbols)
+	}
+	if mainObj.Sections[3].Segment != linker.SEG_BSS || mainObj.Sections[3].Data != nil || mainObj.Sections[3].Size != 16 {
+		t.Errorf("BSS section %+v, want 16 bytes reserved without data", mainObj.Sections[3])
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		variant byte
+		source  string
+		want    string
+	}{
+		{cpu.VARIANT_NMOS, "lda missing", "test.s:1: undefined symbol missing"},
+		{cpu.VARIANT_NMOS, "a: nop\na: nop", "test.s:2: a is already defined on line 1"},
+		{cpu.VARIANT_NMOS, "nop\nfoo $10", "test.s:2: unknown instruction FOO"},
+		{cpu.VARIANT_NMOS, "stz $10", "unknown instruction STZ"},
+		{cpu.VARIANT_NMOS, "lda ($10)", "LDA does not take the operand ($10)"},
+		{cpu.VARIANT_NMOS, "lda #$100", "$100 does not fit in a byte"},
+		{cpu.VARIANT_NMOS, "stx $1234,y", "$1234 is not a zero page address"},
+		{cpu.VARIANT_NMOS, "x: lda #x", "use < or >"},
+		{cpu.VARIANT_NMOS, "x: .res 200\n.res 200\nbne x", "branch is out of range"},
+		{cpu.VARIANT_NMOS, "bne $1234", "branch target must be a label"},
+		{cpu.VARIANT_NMOS, ".export nowhere", "exported symbol nowhere is not defined"},
+		{cpu.VARIANT_NMOS, ".res count\ncount = 2", ".res needs a count known where it is used"},
+		{cpu.VARIANT_NMOS, ".res $7FFFFFFF", ".res of $7FFFFFFF bytes does not fit, $10000 are left"},
+		{cpu.VARIANT_NMOS, "nop\n.res $10000", ".res of $10000 bytes does not fit, $FFFF are left"},
+		{cpu.VARIANT_NMOS, "@loop: nop", "local label @loop before any other label"},
+		{cpu.VARIANT_NMOS, ".org $1000", "unknown directive .org"},
+		{cpu.VARIANT_NMOS, "a: b: nop", "unknown instruction B:"},
+		{cpu.VARIANT_NMOS, ".import x\nx: nop", "x is already defined on line 1"},
+	}
+
+	for _, tt := range tests {
+		_, err := Assemble("test.s", []byte(tt.source), tt.variant)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: error %v, want %q", tt.source, err, tt.want)
+		}
+	}
+}
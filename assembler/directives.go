@@ -0,0 +1,149 @@
+package assembler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	linker "izzudinhafiz.com/go-6502/linker"
+)
+
+// Directives that switch to a well known segment
+var segmentDirectives = map[string]string{
+	".CODE":     linker.SEG_CODE,
+	".RODATA":   "RODATA",
+	".DATA":     linker.SEG_DATA,
+	".BSS":      linker.SEG_BSS,
+	".ZEROPAGE": linker.SEG_ZEROPAGE,
+}
+
+func (a *assembler) directive(ln line) error {
+	if segment, ok := segmentDirectives[ln.op]; ok {
+		a.current = a.section(segment)
+		return nil
+	}
+
+	args := splitArgs(ln.operand)
+	switch ln.op {
+	case ".SEGMENT":
+		name, err := strconv.Unquote(ln.operand)
+		if err != nil || name == "" {
+			return fmt.Errorf(".segment takes a quoted segment name")
+		}
+		a.current = a.section(name)
+	case ".BYTE", ".BYT", ".DB", ".ASCIIZ":
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "\"") {
+				text, err := strconv.Unquote(arg)
+				if err != nil {
+					return fmt.Errorf("bad string %v", arg)
+				}
+				a.emit([]byte(text)...)
+				continue
+			}
+			if err := a.emitExpr(arg, a.emitByte); err != nil {
+				return err
+			}
+		}
+		if ln.op == ".ASCIIZ" {
+			a.emit(0)
+		}
+	case ".WORD", ".ADDR", ".DW":
+		for _, arg := range args {
+			if err := a.emitExpr(arg, a.emitWord); err != nil {
+				return err
+			}
+		}
+	case ".RES", ".DS":
+		return a.reserve(args)
+	case ".EXPORT", ".EXPORTZP":
+		for _, name := range args {
+			if identEnd(name) != len(name) {
+				return fmt.Errorf("cannot export %q", name)
+			}
+			if a.pass == 1 {
+				a.exports = append(a.exports, export{name, ln.num})
+			}
+		}
+	case ".IMPORT", ".IMPORTZP":
+		for _, name := range args {
+			if identEnd(name) != len(name) || strings.HasPrefix(name, "@") {
+				return fmt.Errorf("cannot import %q", name)
+			}
+			v := value{section: -1, sym: name, zp: ln.op == ".IMPORTZP"}
+			if err := a.define(name, SYM_IMPORT, v, ln.num); err != nil {
+				return err
+			}
+			if a.pass == 1 {
+				a.imports = append(a.imports, name)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown directive %v", strings.ToLower(ln.op))
+	}
+	return nil
+}
+
+// reserve handles .res COUNT[, FILL], leaving room the linker does not load
+// unless the section holds other data
+func (a *assembler) reserve(args []string) error {
+	if len(args) < 1 || len(args) > 2 {
+		return fmt.Errorf(".res takes a count and an optional fill byte")
+	}
+	count, err := a.eval(args[0])
+	if err != nil {
+		return err
+	}
+	if count.unknown || count.relocatable() || count.n < 0 {
+		return fmt.Errorf(".res needs a count known where it is used")
+	}
+	// A section cannot be larger than the address space it is linked into
+	if left := 0x10000 - len(a.current.data); count.n > left {
+		return fmt.Errorf(".res of $%X bytes does not fit, $%X are left in the address space", count.n, left)
+	}
+	fill := 0
+	if len(args) == 2 {
+		v, err := a.eval(args[1])
+		if err != nil {
+			return err
+		}
+		if a.pass == 2 && (v.relocatable() || v.n < -128 || v.n > 0xFF) {
+			return fmt.Errorf(".res fill must be a byte")
+		}
+		fill = v.n
+	}
+	for i := 0; i < count.n; i++ {
+		a.current.data = append(a.current.data, byte(fill))
+	}
+	return nil
+}
+
+// splitArgs splits a comma separated list, leaving commas inside quotes and
+// parentheses alone
+func splitArgs(text string) []string {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	var args []string
+	depth, quote, start := 0, byte(0), 0
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	return append(args, strings.TrimSpace(text[start:]))
+}
@@ -0,0 +1,269 @@
+package assembler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Which part of an address an expression takes
+const (
+	PART_FULL byte = iota
+	PART_LOW       // <expr
+	PART_HIGH      // >expr
+)
+
+// value is the result of an expression: a number, or an address relative to
+// the start of a section or to an import, which the linker fills in
+type value struct {
+	n       int
+	section int    // Section the address is in, -1 when there is none
+	sym     string // Import the address is relative to
+	part    byte   // PART_*, only for relocatable values
+	zp      bool   // Relocatable, but known to land in zero page
+	unknown bool   // Refers to a symbol not defined yet, only in the first pass
+}
+
+func absolute(n int) value {
+	return value{n: n, section: -1}
+}
+
+func (v value) relocatable() bool {
+	return v.section >= 0 || v.sym != ""
+}
+
+// sameBase reports whether two values are relative to the same thing
+func (v value) sameBase(o value) bool {
+	return v.section == o.section && v.sym == o.sym
+}
+
+// exprParser evaluates expressions with the usual C precedence:
+// | ^ & << >> + - * / %, then unary - ~ < > and parentheses
+type exprParser struct {
+	a    *assembler
+	text string
+	pos  int
+}
+
+func (a *assembler) eval(text string) (value, error) {
+	p := &exprParser{a: a, text: text}
+	v, err := p.binary(0)
+	if err != nil {
+		return value{}, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.text) {
+		return value{}, fmt.Errorf("unexpected %q in expression", p.text[p.pos:])
+	}
+	return v, nil
+}
+
+var binaryOps = [][]string{
+	{"|"},
+	{"^"},
+	{"&"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.text) && (p.text[p.pos] == ' ' || p.text[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+func (p *exprParser) binary(level int) (value, error) {
+	if level == len(binaryOps) {
+		return p.unary()
+	}
+	left, err := p.binary(level + 1)
+	if err != nil {
+		return value{}, err
+	}
+	for {
+		p.skipSpace()
+		op := ""
+		for _, candidate := range binaryOps[level] {
+			if strings.HasPrefix(p.text[p.pos:], candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return left, nil
+		}
+		p.pos += len(op)
+		right, err := p.binary(level + 1)
+		if err != nil {
+			return value{}, err
+		}
+		if left, err = combine(op, left, right); err != nil {
+			return value{}, err
+		}
+	}
+}
+
+// combine applies a binary operator. Addresses the linker has yet to place
+// can only be offset by a number, or subtracted from another address in the
+// same section.
+func combine(op string, l, r value) (value, error) {
+	if l.unknown || r.unknown {
+		return value{unknown: true, section: -1}, nil
+	}
+	if l.relocatable() || r.relocatable() {
+		if l.part != PART_FULL || r.part != PART_FULL {
+			return value{}, fmt.Errorf("cannot use %v on a byte of a relocatable address", op)
+		}
+		switch {
+		case op == "+" && !r.relocatable():
+			l.n += r.n
+			return l, nil
+		case op == "+" && !l.relocatable():
+			r.n += l.n
+			return r, nil
+		case op == "-" && !r.relocatable():
+			l.n -= r.n
+			return l, nil
+		case op == "-" && l.sameBase(r):
+			return absolute(l.n - r.n), nil
+		}
+		return value{}, fmt.Errorf("cannot use %v on relocatable addresses", op)
+	}
+
+	a, b := l.n, r.n
+	switch op {
+	case "|":
+		return absolute(a | b), nil
+	case "^":
+		return absolute(a ^ b), nil
+	case "&":
+		return absolute(a & b), nil
+	case "<<":
+		return absolute(a << uint(b)), nil
+	case ">>":
+		return absolute(a >> uint(b)), nil
+	case "+":
+		return absolute(a + b), nil
+	case "-":
+		return absolute(a - b), nil
+	case "*":
+		return absolute(a * b), nil
+	}
+	if b == 0 {
+		return value{}, fmt.Errorf("division by zero")
+	}
+	if op == "/" {
+		return absolute(a / b), nil
+	}
+	return absolute(a % b), nil
+}
+
+func (p *exprParser) unary() (value, error) {
+	p.skipSpace()
+	if p.pos >= len(p.text) {
+		return value{}, fmt.Errorf("missing operand")
+	}
+	op := p.text[p.pos]
+	switch op {
+	case '-', '~', '<', '>':
+		p.pos++
+		v, err := p.unary()
+		if err != nil || v.unknown {
+			return v, err
+		}
+		if v.relocatable() {
+			if op == '-' || op == '~' || v.part != PART_FULL {
+				return value{}, fmt.Errorf("cannot use %c on a relocatable address", op)
+			}
+			v.part = PART_LOW
+			if op == '>' {
+				v.part = PART_HIGH
+			}
+			return v, nil
+		}
+		switch op {
+		case '-':
+			return absolute(-v.n), nil
+		case '~':
+			return absolute(^v.n), nil
+		case '<':
+			return absolute(v.n & 0xFF), nil
+		}
+		return absolute(v.n >> 8 & 0xFF), nil
+	case '(':
+		p.pos++
+		v, err := p.binary(0)
+		if err != nil {
+			return value{}, err
+		}
+		p.skipSpace()
+		if p.pos >= len(p.text) || p.text[p.pos] != ')' {
+			return value{}, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return v, nil
+	}
+	return p.primary()
+}
+
+func (p *exprParser) primary() (value, error) {
+	text := p.text[p.pos:]
+	switch {
+	case text[0] == '*':
+		p.pos++
+		return p.a.here(), nil
+	case text[0] == '\'':
+		if len(text) < 3 || text[2] != '\'' {
+			return value{}, fmt.Errorf("bad character constant %v", text)
+		}
+		p.pos += 3
+		return absolute(int(text[1])), nil
+	case text[0] == '$' || text[0] == '%' || isDigit(text[0]):
+		end := 1
+		for end < len(text) && isIdentChar(text[end]) {
+			end++
+		}
+		p.pos += end
+		n, err := parseNumber(text[:end])
+		return absolute(n), err
+	case isIdentStart(text[0]):
+		end := 1
+		for end < len(text) && isIdentChar(text[end]) {
+			end++
+		}
+		p.pos += end
+		return p.a.lookup(text[:end])
+	}
+	return value{}, fmt.Errorf("unexpected %q in expression", text)
+}
+
+// parseNumber reads $hex, %binary and decimal numbers
+func parseNumber(text string) (int, error) {
+	var n int64
+	var err error
+	switch text[0] {
+	case '$':
+		n, err = strconv.ParseInt(text[1:], 16, 32)
+	case '%':
+		n, err = strconv.ParseInt(text[1:], 2, 32)
+	default:
+		n, err = strconv.ParseInt(text, 10, 32)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("bad number %v", text)
+	}
+	return int(n), nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '@' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || isDigit(c)
+}
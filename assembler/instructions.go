@@ -0,0 +1,274 @@
+package assembler
+
+import (
+	"fmt"
+	"strings"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+	linker "izzudinhafiz.com/go-6502/linker"
+)
+
+// How an operand is written
+const (
+	syntaxNone      byte = iota
+	syntaxA              // A
+	syntaxImmediate      // #expr
+	syntaxPlain          // expr
+	syntaxX              // expr,X
+	syntaxY              // expr,Y
+	syntaxIndirect       // (expr)
+	syntaxIndirectX      // (expr,X)
+	syntaxIndirectY      // (expr),Y
+	syntaxTwo            // expr,expr for BBR and BBS
+)
+
+// Addressing modes that can take an operand written a given way, with the
+// zero page mode first where there is one
+var syntaxModes = map[byte][]byte{
+	syntaxNone:      {cpu.ADR_IMPLICIT, cpu.ADR_ACCUMULATOR},
+	syntaxA:         {cpu.ADR_ACCUMULATOR},
+	syntaxImmediate: {cpu.ADR_IMMEDIATE},
+	syntaxPlain:     {cpu.ADR_RELATIVE, cpu.ADR_ZEROPAGE, cpu.ADR_ABSOLUTE},
+	syntaxX:         {cpu.ADR_ZEROPAGEX, cpu.ADR_ABSOLUTEX},
+	syntaxY:         {cpu.ADR_ZEROPAGEY, cpu.ADR_ABSOLUTEY},
+	syntaxIndirect:  {cpu.ADR_ZEROPAGE_INDIRECT, cpu.ADR_INDIRECT},
+	syntaxIndirectX: {cpu.ADR_INDIRECTX, cpu.ADR_ABSOLUTE_INDIRECTX},
+	syntaxIndirectY: {cpu.ADR_INDIRECTY},
+	syntaxTwo:       {cpu.ADR_ZEROPAGE_RELATIVE},
+}
+
+// Zero page modes that have an absolute mode to fall back on
+var absoluteModes = map[byte]byte{
+	cpu.ADR_ZEROPAGE:          cpu.ADR_ABSOLUTE,
+	cpu.ADR_ZEROPAGEX:         cpu.ADR_ABSOLUTEX,
+	cpu.ADR_ZEROPAGEY:         cpu.ADR_ABSOLUTEY,
+	cpu.ADR_ZEROPAGE_INDIRECT: cpu.ADR_INDIRECT,
+	cpu.ADR_INDIRECTX:         cpu.ADR_ABSOLUTE_INDIRECTX,
+}
+
+// parseOperand works out how an operand is written and returns the
+// expressions in it
+func parseOperand(text string) (byte, []string) {
+	upper := strings.ToUpper(strings.ReplaceAll(text, " ", ""))
+	switch {
+	case text == "":
+		return syntaxNone, nil
+	case upper == "A":
+		return syntaxA, nil
+	case strings.HasPrefix(text, "#"):
+		return syntaxImmediate, []string{text[1:]}
+	case strings.HasPrefix(text, "(") && strings.HasSuffix(upper, ",X)"):
+		return syntaxIndirectX, []string{text[1:strings.LastIndex(text, ",")]}
+	case strings.HasPrefix(text, "(") && strings.HasSuffix(upper, "),Y"):
+		return syntaxIndirectY, []string{text[1:strings.LastIndex(text, ")")]}
+	case strings.HasPrefix(text, "(") && closingParen(text) == len(text)-1:
+		return syntaxIndirect, []string{text[1 : len(text)-1]}
+	}
+
+	args := splitArgs(text)
+	if len(args) == 2 {
+		switch strings.ToUpper(args[1]) {
+		case "X":
+			return syntaxX, args[:1]
+		case "Y":
+			return syntaxY, args[:1]
+		}
+		return syntaxTwo, args
+	}
+	return syntaxPlain, args
+}
+
+// closingParen finds the parenthesis that closes the one text starts with
+func closingParen(text string) int {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func (a *assembler) instruction(ln line) error {
+	modes, exists := a.opcodes[ln.op]
+	if !exists {
+		return fmt.Errorf("unknown instruction %v", ln.op)
+	}
+	syntax, exprs := parseOperand(ln.operand)
+	if len(exprs) > 2 || syntax == syntaxPlain && len(exprs) != 1 {
+		return fmt.Errorf("bad operand %v", ln.operand)
+	}
+
+	values := make([]value, len(exprs))
+	for i, text := range exprs {
+		v, err := a.eval(text)
+		if err != nil {
+			return err
+		}
+		values[i] = v
+	}
+
+	mode, ok := a.modes[ln.num]
+	if a.pass == 1 {
+		if mode, ok = pickMode(modes, syntax, values); !ok {
+			return fmt.Errorf("%v does not take the operand %v", ln.op, ln.operand)
+		}
+		a.modes[ln.num] = mode
+	}
+
+	a.emit(modes[mode])
+	switch mode {
+	case cpu.ADR_IMPLICIT, cpu.ADR_ACCUMULATOR:
+		return nil
+	case cpu.ADR_IMMEDIATE:
+		return a.emitByte(values[0])
+	case cpu.ADR_ABSOLUTE, cpu.ADR_ABSOLUTEX, cpu.ADR_ABSOLUTEY, cpu.ADR_INDIRECT, cpu.ADR_ABSOLUTE_INDIRECTX:
+		return a.emitWord(values[0])
+	case cpu.ADR_RELATIVE:
+		return a.emitBranch(values[0])
+	case cpu.ADR_ZEROPAGE_RELATIVE:
+		if err := a.emitZeroPage(values[0]); err != nil {
+			return err
+		}
+		return a.emitBranch(values[1])
+	}
+	return a.emitZeroPage(values[0])
+}
+
+// pickMode chooses the addressing mode, using zero page when the operand is
+// known to be there
+func pickMode(modes map[byte]byte, syntax byte, values []value) (byte, bool) {
+	for _, mode := range syntaxModes[syntax] {
+		if _, exists := modes[mode]; !exists {
+			continue
+		}
+		if abs, hasAbs := absoluteModes[mode]; hasAbs {
+			if _, exists := modes[abs]; exists && !fitsZeroPage(values[0]) {
+				return abs, true
+			}
+		}
+		return mode, true
+	}
+	return 0, false
+}
+
+func fitsZeroPage(v value) bool {
+	if v.unknown {
+		return false
+	}
+	if v.relocatable() {
+		return v.zp && v.part == PART_FULL || v.part != PART_FULL
+	}
+	return v.n >= 0 && v.n <= 0xFF
+}
+
+// emit adds initialised bytes to the current section
+func (a *assembler) emit(b ...byte) {
+	a.current.data = append(a.current.data, b...)
+	a.current.initialised = true
+}
+
+// emitExpr evaluates an expression and emits it with f
+func (a *assembler) emitExpr(text string, f func(value) error) error {
+	v, err := a.eval(text)
+	if err != nil {
+		return err
+	}
+	return f(v)
+}
+
+// relocate records that the bytes about to be emitted hold v
+func (a *assembler) relocate(v value, kind byte) {
+	r := linker.Relocation{Offset: len(a.current.data), Kind: kind, TargetKind: linker.TARGET_SECTION, Target: v.section, Addend: v.n}
+	if v.sym != "" {
+		r.TargetKind = linker.TARGET_IMPORT
+		for i, name := range a.imports {
+			if name == v.sym {
+				r.Target = i
+			}
+		}
+	}
+	a.current.relocations = append(a.current.relocations, r)
+}
+
+// emitByte emits a data or immediate byte
+func (a *assembler) emitByte(v value) error {
+	if a.pass == 2 {
+		switch {
+		case v.part == PART_LOW:
+			a.relocate(v, linker.RELOC_LOW)
+		case v.part == PART_HIGH:
+			a.relocate(v, linker.RELOC_HIGH)
+		case v.relocatable() && v.zp:
+			a.relocate(v, linker.RELOC_ZEROPAGE)
+		case v.relocatable():
+			return fmt.Errorf("an address does not fit in a byte, use < or > to take one of its bytes")
+		case v.n < -128 || v.n > 0xFF:
+			return fmt.Errorf("$%X does not fit in a byte", v.n)
+		}
+	}
+	a.emit(byte(v.n))
+	return nil
+}
+
+// emitZeroPage emits a zero page address
+func (a *assembler) emitZeroPage(v value) error {
+	if a.pass == 2 {
+		switch {
+		case v.relocatable() && v.part == PART_FULL:
+			a.relocate(v, linker.RELOC_ZEROPAGE)
+		case v.relocatable():
+			return a.emitByte(v)
+		case v.n < 0 || v.n > 0xFF:
+			return fmt.Errorf("$%X is not a zero page address", v.n)
+		}
+	}
+	a.emit(byte(v.n))
+	return nil
+}
+
+// emitWord emits a little endian address or number
+func (a *assembler) emitWord(v value) error {
+	if a.pass == 2 {
+		switch {
+		case v.relocatable() && v.part != PART_FULL:
+			return fmt.Errorf("a byte of an address does not make a word")
+		case v.relocatable():
+			a.relocate(v, linker.RELOC_WORD)
+		case v.n < -0x8000 || v.n > 0xFFFF:
+			return fmt.Errorf("$%X does not fit in a word", v.n)
+		}
+	}
+	a.emit(byte(v.n), byte(v.n>>8))
+	return nil
+}
+
+// emitBranch emits the offset from the next instruction to a branch target
+func (a *assembler) emitBranch(v value) error {
+	next := len(a.current.data) + 1
+	if a.pass == 1 {
+		a.emit(0)
+		return nil
+	}
+
+	switch {
+	case !v.relocatable() || v.part != PART_FULL:
+		return fmt.Errorf("branch target must be a label")
+	case v.sym == "" && v.section == a.sectionIndex(a.current):
+		distance := v.n - next
+		if distance < -128 || distance > 127 {
+			return fmt.Errorf("branch is out of range (%d bytes)", distance)
+		}
+		a.emit(byte(distance))
+	default:
+		a.relocate(v, linker.RELOC_BRANCH)
+		a.emit(0)
+	}
+	return nil
+}
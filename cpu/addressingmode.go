@@ -1,11 +1,20 @@
 package cpu6502
 
 func accumulator(c *Cpu6502) int {
+	// Single byte instructions read the next byte anyway and ignore it
+	c.read(c.Registers.PC)
 	c.Fetched = c.Registers.A
 	return 0
 }
 
 func implicit(c *Cpu6502) int {
+	c.read(c.Registers.PC)
+	return 0
+}
+
+// The 65C02's one cycle NOPs are over once the opcode is fetched, there is
+// no cycle left for a dummy read
+func onecycle(c *Cpu6502) int {
 	return 0
 }
 
@@ -22,12 +31,16 @@ func zeropage(c *Cpu6502) int {
 }
 
 func zeropagex(c *Cpu6502) int {
-	c.AbsoluteAddr = word(c.fetchByte() + c.Registers.X)
+	base := c.fetchByte()
+	c.read(word(base)) // Read while X is added
+	c.AbsoluteAddr = word(base + c.Registers.X)
 	return 0
 }
 
 func zeropagey(c *Cpu6502) int {
-	c.AbsoluteAddr = word(c.fetchByte() + c.Registers.Y)
+	base := c.fetchByte()
+	c.read(word(base)) // Read while Y is added
+	c.AbsoluteAddr = word(base + c.Registers.Y)
 	return 0
 }
 
@@ -36,47 +49,76 @@ func absolute(c *Cpu6502) int {
 	return 0
 }
 
+// JSR reads the low byte of its target, pushes the return address and only
+// then reads the high byte, see jsr
+func absolutelow(c *Cpu6502) int {
+	c.AbsoluteAddr = word(c.fetchByte())
+	return 0
+}
+
 func absolutex(c *Cpu6502) int {
 	addr := c.fetchWord()
 	c.AbsoluteAddr = addr + word(c.Registers.X)
-
-	// Extra cycle if we cross page boundaries
-	if c.AbsoluteAddr & 0xFF00 != addr & 0xFF00 {
-		return 1
-	}
-
-	return 0
+	return c.fixPage(addr)
 }
 
 func absolutey(c *Cpu6502) int {
 	addr := c.fetchWord()
 	c.AbsoluteAddr = addr + word(c.Registers.Y)
+	return c.fixPage(addr)
+}
+
+// Indexing adds to the low byte of the address first and carries into the
+// high byte a cycle later. The NMOS 6502 reads from the address it has before
+// the carry, the 65C02 reads the last byte of the instruction again instead.
+// Reads skip that cycle unless the index crosses a page, stores and most
+// read-modify-write operations always spend it.
+// Returns the extra cycle a page crossing costs.
+func (c *Cpu6502) fixPage(base word) int {
+	crossed := c.AbsoluteAddr & 0xFF00 != base & 0xFF00
+	always := NoPageCrossPenalty[c.Opcode.Code]
+	if c.Variant == VARIANT_65C02 {
+		// The 65C02 shifts and rotates only spend it on a page crossing
+		switch c.Opcode.Code {
+		case OP_ASL, OP_LSR, OP_ROL, OP_ROR:
+			always = false
+		}
+	}
+
+	if crossed || always {
+		if c.Variant == VARIANT_65C02 {
+			c.read(c.Registers.PC - 1)
+		} else {
+			c.read(base & 0xFF00 | c.AbsoluteAddr & 0x00FF)
+		}
+	}
 
 	// Extra cycle if we cross page boundaries
-	if c.AbsoluteAddr & 0xFF00 != addr & 0xFF00 {
+	if crossed {
 		return 1
 	}
-
 	return 0
 }
 
 func indirect(c *Cpu6502) int {
 	addr := c.fetchWord()
 
-	if addr & 0XFF == 0XFF {
-		// Simulate a page boundary hardware bug
-		// See https://www.youtube.com/watch?v=8XmxKPJDGU0
-		addr &= 0XFF00
-	}
-	c.AbsoluteAddr = c.ReadWord(addr)
+	// Simulate a page boundary hardware bug, the high byte is read
+	// from the start of the same page instead of the next page
+	// See https://www.youtube.com/watch?v=8XmxKPJDGU0
+	hi_addr := (addr & 0xFF00) | ((addr + 1) & 0x00FF)
+	lo_byte := c.read(addr)
+	c.AbsoluteAddr = word(c.read(hi_addr)) << 8 | word(lo_byte)
 
 	return 0
 }
 
 func indirectx(c *Cpu6502) int {
-	pointer := c.fetchByte() + c.Registers.X
-	lo_byte := c.Memory[pointer & 0xFF]
-	hi_byte := c.Memory[(pointer + 1) & 0xFF]
+	vector := c.fetchByte()
+	c.read(word(vector)) // Read while X is added
+	pointer := vector + c.Registers.X
+	lo_byte := c.read(word(pointer))
+	hi_byte := c.read(word(pointer + 1))
 	c.AbsoluteAddr = word(hi_byte) << 8 | word(lo_byte)
 
 	return 0
@@ -85,17 +127,13 @@ func indirectx(c *Cpu6502) int {
 func indirecty(c *Cpu6502) int {
 	// See https://stackoverflow.com/questions/46262435/indirect-y-indexed-addressing-mode-in-mos-6502
 	// Also https://www.c64-wiki.com/wiki/Indirect-indexed_addressing
+	// The pointer wraps around within the zero page
 	vector := c.fetchByte()
-	pointer := c.ReadWord(word(vector))
+	lo_byte := c.read(word(vector))
+	pointer := word(c.read(word(vector + 1))) << 8 | word(lo_byte)
 
 	c.AbsoluteAddr = pointer + word(c.Registers.Y)
-
-	// Extra cycle if we cross page boundaries
-	if c.AbsoluteAddr & 0xFF00 != pointer & 0xFF00 {
-		return 1
-	}
-
-	return 0
+	return c.fixPage(pointer)
 }
 
 func relative(c *Cpu6502) int {
@@ -105,4 +143,35 @@ func relative(c *Cpu6502) int {
 		c.RelativeAddr |= 0xFF00
 	}
 	return 0
+}
+
+// 65C02 (zp), the pointer wraps around within the zero page like (zp),Y
+func zeropageindirect(c *Cpu6502) int {
+	vector := c.fetchByte()
+	lo_byte := c.read(word(vector))
+	c.AbsoluteAddr = word(c.read(word(vector + 1))) << 8 | word(lo_byte)
+
+	return 0
+}
+
+// 65C02 JMP (abs), which reads the high byte from the next page
+func indirectfixed(c *Cpu6502) int {
+	addr := c.fetchWord()
+	c.AbsoluteAddr = c.ReadWord(addr)
+
+	return 0
+}
+
+// 65C02 JMP (abs,X)
+func absoluteindirectx(c *Cpu6502) int {
+	addr := c.fetchWord() + word(c.Registers.X)
+	c.AbsoluteAddr = c.ReadWord(addr)
+
+	return 0
+}
+
+// BBR and BBS, a zero page address to test followed by a branch offset
+func zeropagerelative(c *Cpu6502) int {
+	c.AbsoluteAddr = word(c.fetchByte())
+	return relative(c)
 }
\ No newline at end of file
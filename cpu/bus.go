@@ -0,0 +1,112 @@
+package cpu6502
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Bus lets the address space be provided by something other than the flat
+// Memory slice, such as a cartridge mapper or memory mapped devices.
+type Bus interface {
+	Read(addr uint16) byte
+	Write(addr uint16, value byte)
+}
+
+// Peeker is implemented by buses and devices that can return what Read would
+// without its side effects, such as clearing a device's interrupt flags, so
+// debuggers and tracers can look at memory without changing what the program sees
+type Peeker interface {
+	Peek(addr uint16) byte
+}
+
+// Loader is implemented by buses that can place program images anywhere in
+// the address space, including memory the CPU cannot write to
+type Loader interface {
+	Load(addr int, data []byte)
+}
+
+// Idler is implemented by buses whose devices only catch up with the CPU when
+// it accesses the bus. The CPU calls Idle on the cycles it spends in WAI or
+// STP, which make no access, so timers and other devices keep running.
+type Idler interface {
+	Idle()
+}
+
+// CPU variants
+const (
+	VARIANT_NMOS byte = iota // Original NMOS 6502
+	VARIANT_2A03             // Ricoh 2A03 used in the NES, which has no decimal mode
+	VARIANT_65C02            // WDC 65C02, with the CMOS instructions and fixes
+)
+
+// VariantNames maps the names accepted on the command line and in machine
+// configs to variants
+var VariantNames = map[string]byte{
+	"nmos": VARIANT_NMOS,
+	"6502": VARIANT_NMOS,
+	"2a03": VARIANT_2A03,
+	"65c02": VARIANT_65C02,
+	"cmos":  VARIANT_65C02,
+}
+
+// ParseVariant looks up a variant by name, an empty name is VARIANT_NMOS
+func ParseVariant(name string) (byte, error) {
+	if name == "" {
+		return VARIANT_NMOS, nil
+	}
+	variant, exists := VariantNames[strings.ToLower(name)]
+	if !exists {
+		return 0, fmt.Errorf("unknown CPU variant %q", name)
+	}
+	return variant, nil
+}
+
+// Tells an Idler bus about a cycle spent without touching the bus
+func (c *Cpu6502) idle() {
+	if i, ok := c.Bus.(Idler); ok {
+		i.Idle()
+	}
+}
+
+// Peek reads memory without running the memory hooks. A bus that is not a
+// Peeker is read with Read, side effects and all.
+func (c *Cpu6502) Peek(addr word) byte {
+	if p, ok := c.Bus.(Peeker); ok {
+		return p.Peek(addr)
+	}
+	if c.Bus != nil {
+		return c.Bus.Read(addr)
+	}
+	return c.Memory[addr]
+}
+
+func (c *Cpu6502) read(addr word) byte {
+	var value byte
+	if c.Bus != nil {
+		value = c.Bus.Read(addr)
+	} else {
+		value = c.Memory[addr]
+	}
+
+	if len(c.hooks) > 0 {
+		c.runMemoryRead(addr, value)
+	}
+	return value
+}
+
+func (c *Cpu6502) write(addr word, value byte) {
+	if len(c.hooks) > 0 {
+		c.runMemoryWrite(addr, value)
+	}
+
+	if c.Bus != nil {
+		c.Bus.Write(addr, value)
+		return
+	}
+	c.Memory[addr] = value
+}
+
+// decimalMode reports whether ADC and SBC should use BCD arithmetic
+func (c *Cpu6502) decimalMode() bool {
+	return c.Flags.D == 1 && c.Variant != VARIANT_2A03
+}
@@ -0,0 +1,158 @@
+package cpu6502
+
+import "testing"
+
+// newCMOSCPU returns a 65C02 running program from $0200
+func newCMOSCPU(program ...byte) *Cpu6502 {
+	c := newHookCPU(program...)
+	c.Variant = VARIANT_65C02
+	return c
+}
+
+// cycles runs one whole instruction and returns how many cycles it took
+func cycles(c *Cpu6502) int {
+	start := c.Tick
+	step(c)
+	return c.Tick - start
+}
+
+func TestLookupOpcode(t *testing.T) {
+	for _, op := range []byte{0x12, 0x80, 0xCB} {
+		if _, ok := LookupOpcode(VARIANT_NMOS, op); ok {
+			t.Errorf("$%02X decodes on the NMOS 6502", op)
+		}
+		if _, ok := LookupOpcode(VARIANT_65C02, op); !ok {
+			t.Errorf("$%02X does not decode on the 65C02", op)
+		}
+	}
+	if opcode, _ := LookupOpcode(VARIANT_65C02, 0xA9); opcode.Code != OP_LDA {
+		t.Errorf("$A9 is %v on the 65C02, want LDA", opcode.FriendlyName)
+	}
+}
+
+func TestCMOSInstructions(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte
+		setup   func(c *Cpu6502)
+		check   func(c *Cpu6502) bool
+		cycles  int
+	}{
+		{"BRA", []byte{0x80, 0x10}, nil,
+			func(c *Cpu6502) bool { return c.Registers.PC == 0x0212 }, 3},
+		{"STZ zp", []byte{0x64, 0x10}, func(c *Cpu6502) { c.Memory[0x10] = 0xFF },
+			func(c *Cpu6502) bool { return c.Memory[0x10] == 0 }, 3},
+		{"LDA (zp)", []byte{0xB2, 0x10}, func(c *Cpu6502) {
+			c.Memory[0x10], c.Memory[0x11], c.Memory[0x1234] = 0x34, 0x12, 0x42
+		}, func(c *Cpu6502) bool { return c.Registers.A == 0x42 }, 5},
+		{"JMP (abs) across a page", []byte{0x6C, 0xFF, 0x10}, func(c *Cpu6502) {
+			c.Memory[0x10FF], c.Memory[0x1100], c.Memory[0x1000] = 0x34, 0x12, 0x56
+		}, func(c *Cpu6502) bool { return c.Registers.PC == 0x1234 }, 6},
+		{"JMP (abs,X)", []byte{0x7C, 0x00, 0x10}, func(c *Cpu6502) {
+			c.Registers.X = 2
+			c.Memory[0x1002], c.Memory[0x1003] = 0x34, 0x12
+		}, func(c *Cpu6502) bool { return c.Registers.PC == 0x1234 }, 6},
+		{"BBS taken", []byte{0x8F, 0x10, 0x10}, func(c *Cpu6502) { c.Memory[0x10] = 0x01 },
+			func(c *Cpu6502) bool { return c.Registers.PC == 0x0213 }, 6},
+		{"BBR not taken", []byte{0x0F, 0x10, 0x10}, func(c *Cpu6502) { c.Memory[0x10] = 0x01 },
+			func(c *Cpu6502) bool { return c.Registers.PC == 0x0203 }, 5},
+		{"SMB7", []byte{0xF7, 0x10}, func(c *Cpu6502) { c.Memory[0x10] = 0x01 },
+			func(c *Cpu6502) bool { return c.Memory[0x10] == 0x81 }, 5},
+		{"TSB", []byte{0x04, 0x10}, func(c *Cpu6502) { c.Registers.A, c.Memory[0x10] = 0x0F, 0xF0 },
+			func(c *Cpu6502) bool { return c.Memory[0x10] == 0xFF && c.Flags.Z == 1 }, 5},
+		{"TRB", []byte{0x14, 0x10}, func(c *Cpu6502) { c.Registers.A, c.Memory[0x10] = 0x0F, 0xFF },
+			func(c *Cpu6502) bool { return c.Memory[0x10] == 0xF0 && c.Flags.Z == 0 }, 5},
+		{"INC A", []byte{0x1A}, func(c *Cpu6502) { c.Registers.A = 0xFF },
+			func(c *Cpu6502) bool { return c.Registers.A == 0 && c.Flags.Z == 1 }, 2},
+		{"BIT # leaves N and V", []byte{0x89, 0xC0}, func(c *Cpu6502) { c.Registers.A, c.Flags.N, c.Flags.V = 0x01, 0, 0 },
+			func(c *Cpu6502) bool { return c.Flags.Z == 1 && c.Flags.N == 0 && c.Flags.V == 0 }, 2},
+		{"PHX", []byte{0xDA}, func(c *Cpu6502) { c.Registers.X, c.Registers.SP = 0x42, 0xFF },
+			func(c *Cpu6502) bool { return c.Memory[0x01FF] == 0x42 && c.Registers.SP == 0xFE }, 3},
+		{"ASL abs,X without a page crossing", []byte{0x1E, 0x00, 0x10}, nil,
+			func(c *Cpu6502) bool { return true }, 6},
+		{"ASL abs,X across a page", []byte{0x1E, 0xFF, 0x10}, func(c *Cpu6502) { c.Registers.X = 1 },
+			func(c *Cpu6502) bool { return true }, 7},
+		{"decimal ADC sets Z from the result", []byte{0x69, 0x01}, func(c *Cpu6502) {
+			c.Registers.A, c.Flags.D, c.Flags.C = 0x99, 1, 0
+		}, func(c *Cpu6502) bool { return c.Registers.A == 0 && c.Flags.Z == 1 && c.Flags.C == 1 }, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newCMOSCPU(tt.program...)
+			if tt.setup != nil {
+				tt.setup(c)
+			}
+			if got := cycles(c); got != tt.cycles {
+				t.Errorf("took %d cycles, want %d", got, tt.cycles)
+			}
+			if !tt.check(c) {
+				t.Errorf("wrong result: A $%02X PC $%04X", c.Registers.A, c.Registers.PC)
+			}
+		})
+	}
+}
+
+func TestCMOSInterruptClearsDecimal(t *testing.T) {
+	c := newCMOSCPU(0x00) // BRK
+	c.Flags.D = 1
+	step(c)
+	if c.Flags.D != 0 || c.Registers.PC != 0x0300 {
+		t.Errorf("BRK left D %d, PC $%04X", c.Flags.D, c.Registers.PC)
+	}
+
+	c = newHookCPU(0x00)
+	c.Flags.D = 1
+	step(c)
+	if c.Flags.D != 1 {
+		t.Errorf("NMOS BRK cleared D")
+	}
+}
+
+func TestWAI(t *testing.T) {
+	c := newCMOSCPU(0xCB, 0xEA) // WAI; NOP
+	c.Flags.I = 0
+	step(c)
+	for i := 0; i < 10; i++ {
+		step(c)
+	}
+	if c.Registers.PC != 0x0201 {
+		t.Fatalf("WAI ran on to $%04X without an interrupt", c.Registers.PC)
+	}
+
+	c.IRQLine = true
+	step(c)
+	if c.Registers.PC != 0x0300 {
+		t.Errorf("IRQ did not wake WAI, PC $%04X", c.Registers.PC)
+	}
+
+	// With interrupts disabled an IRQ wakes WAI without being taken
+	c = newCMOSCPU(0xCB, 0xEA)
+	c.Flags.I = 1
+	step(c)
+	step(c)
+	c.IRQLine = true
+	step(c)
+	if c.Registers.PC != 0x0202 {
+		t.Errorf("masked IRQ left PC at $%04X, want the NOP run", c.Registers.PC)
+	}
+}
+
+func TestSTP(t *testing.T) {
+	c := newCMOSCPU(0xDB, 0xEA) // STP; NOP
+	c.SetResetVector(0x0201)
+	step(c)
+	c.IRQLine = true
+	for i := 0; i < 10; i++ {
+		step(c)
+	}
+	if c.Registers.PC != 0x0201 {
+		t.Fatalf("STP ran on to $%04X", c.Registers.PC)
+	}
+
+	c.Reset()
+	step(c)
+	if c.Registers.PC == 0x0201 {
+		t.Errorf("reset did not restart the CPU")
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"fmt"
 )
 
-type word uint16
+type word = uint16
 type CpuFlags struct {
 	N byte
 	Z byte
@@ -33,6 +33,14 @@ type Cpu6502 struct {
 	Opcode Opcode
 	Memory []byte
 	Tick int
+	Bus Bus
+	Variant byte
+	IRQLine bool // Level of the IRQ input, serviced between instructions while the I flag is clear
+	nmiLine bool
+	nmiPending bool
+	waiting bool // A 65C02 WAI is waiting for an interrupt
+	stopped bool // A 65C02 STP has stopped the clock until the next reset
+	hooks []*Hooks
 }
 
 func New() *Cpu6502 {
@@ -55,42 +63,107 @@ func (c *Cpu6502) Reset() {
 	c.Flags.N = 0
 	c.Flags.Z = 0
 	c.Flags.C = 0
-	c.Flags.I = 0
+	c.Flags.I = 1 // Interrupts stay disabled until the program is ready for them
 	c.Flags.D = 0
 	c.Flags.B = 0
 	c.Flags.V = 0
 
-	c.Registers.PC = word(c.Memory[0xFFFD]) << 8 | word(c.Memory[0xFFFC])
+	c.Registers.PC = c.ReadWord(0xFFFC)
 	c.Clock = 0
 	c.Tick = 0
+	c.nmiPending = false
+	c.waiting = false
+	c.stopped = false
 }
 
+// Points the reset vector at addr, see WriteMemory
 func (c *Cpu6502) SetResetVector(addr word){
-	c.Memory[0xFFFD] = byte(addr >> 8)
-	c.Memory[0xFFFC] = byte(addr)
+	c.WriteMemory(0xFFFC, []byte{byte(addr), byte(addr >> 8)})
 }
 
 // Runs one clock cycle of the CPU, returns true when an operation has just been completed
 func (c *Cpu6502) SingleStep() bool {
 	c.Tick += 1
 	if c.Clock == 0 {
-		current_byte := c.fetchByte()
-		current_op, key_exists := Opcodes[current_byte]
-		if !key_exists {
-			panic("UNKNOWN OPCODE READ")
+		if c.stopped {
+			c.idle()
+			c.Clock = 1
+		} else if c.nmiPending {
+			c.nmiPending = false
+			c.waiting = false
+			c.Clock += NMI(c)
+		} else if c.IRQLine && c.Flags.I == 0 {
+			c.waiting = false
+			c.Clock += IRQ(c)
+		} else if c.waiting && !c.IRQLine {
+			// Idle a cycle at a time, each one counts as an operation
+			c.idle()
+			c.Clock = 1
+		} else {
+			// WAI with interrupts disabled carries on after an IRQ without taking it
+			c.waiting = false
+			c.execute()
 		}
+	}
+
+	// The operation takes effect on its first cycle, the remaining cycles are spent idle
+	c.Clock -= 1
+	return c.Clock == 0
+}
 
-		c.Opcode = current_op
-		c.Clock += c.Opcode.NumCycle
+// The value the CPU panics with when it fetches an opcode it does not
+// implement and no UnknownOpcode hook handles it
+const UNKNOWN_OPCODE_PANIC = "UNKNOWN OPCODE READ"
 
-		c.Clock += c.Opcode.Address(c)
-		c.Clock += c.Opcode.Op(c)
+// Fetches and runs a whole instruction, leaving its cycle count in Clock
+func (c *Cpu6502) execute() {
+	pc := c.Registers.PC
+	current_byte := c.fetchByte()
+	current_op, key_exists := c.Lookup(current_byte)
+
+	if len(c.hooks) == 0 {
+		if !key_exists {
+			panic(UNKNOWN_OPCODE_PANIC)
+		}
+		c.runOpcode(current_op)
+		return
+	}
+
+	c.runBeforeInstruction(pc, current_byte)
+	if key_exists {
+		c.runOpcode(current_op)
 	} else {
-		c.Clock -= 1
+		cycles, handled := c.runUnknownOpcode(pc, current_byte)
+		if !handled {
+			panic(UNKNOWN_OPCODE_PANIC)
+		}
+		// Every instruction takes at least a cycle, else Clock never returns to zero
+		if cycles < 1 {
+			cycles = 1
+		}
+		c.Clock += cycles
 	}
+	c.runAfterInstruction(pc, c.Clock)
+}
+
+func (c *Cpu6502) runOpcode(op Opcode) {
+	c.Opcode = op
+	c.Clock += c.Opcode.NumCycle
 
-	if c.Clock > 0 { return true }
-	return false
+	penalty := c.Opcode.Address(c)
+	if !NoPageCrossPenalty[c.Opcode.Code] {
+		c.Clock += penalty
+	}
+	c.Clock += c.Opcode.Op(c)
+}
+
+// Sets the level of the NMI input. The NMI is edge triggered, so it is
+// serviced once each time the line goes from released to asserted
+func (c *Cpu6502) SetNMILine(asserted bool) {
+	if asserted && !c.nmiLine {
+		c.nmiPending = true
+	}
+	c.nmiLine = asserted
 }
 
 // Runs a single opcode to completion
@@ -177,7 +250,7 @@ func (c *Cpu6502) setNZFlag(val byte){
 }
 
 func (c *Cpu6502) fetchByte() byte {
-	value := c.Memory[c.Registers.PC]
+	value := c.read(c.Registers.PC)
 	c.Registers.PC += 1
 	return value
 }
@@ -189,38 +262,65 @@ func (c *Cpu6502) fetchWord() word {
 }
 
 func (c *Cpu6502) WriteWord(data word, addr word){
-	c.Memory[addr] = byte(data | 0xFF)
-	c.Memory[addr + 1] = byte(data >> 8)
+	c.write(addr, byte(data))
+	c.write(addr + 1, byte(data >> 8))
 }
 
 func (c *Cpu6502) ReadWord(addr word) word {
-	lo_byte := word(c.Memory[addr])
-	hi_byte := word(c.Memory[addr + 1]) << 8
+	lo_byte := word(c.read(addr))
+	hi_byte := word(c.read(addr + 1)) << 8
 	return hi_byte | lo_byte
 }
 
+// Reads a byte through the bus, exactly as the CPU would
+func (c *Cpu6502) Read(addr word) byte {
+	return c.read(addr)
+}
+
+// Writes a byte through the bus, exactly as the CPU would
+func (c *Cpu6502) Write(addr word, value byte) {
+	c.write(addr, value)
+}
+
+// Copies data into the address space without running hooks. A bus that is a
+// Loader places it itself, so program images can go into ROM, any other bus
+// gets the bytes written to it, and without a bus they go into Memory.
 func (c *Cpu6502) WriteMemory(startAddr int, data []byte){
+	if loader, ok := c.Bus.(Loader); ok {
+		loader.Load(startAddr, data)
+		return
+	}
 	for i, _byte := range data {
-		c.Memory[startAddr + i] = _byte
+		if c.Bus != nil {
+			c.Bus.Write(word(startAddr + i), _byte)
+		} else {
+			c.Memory[startAddr + i] = _byte
+		}
 	}
 }
 
 func (c *Cpu6502) fetch() byte {
 	if c.Opcode.AddressingMode != ADR_ACCUMULATOR{
-		c.Fetched = c.Memory[c.AbsoluteAddr]
+		c.Fetched = c.read(c.AbsoluteAddr)
 	}
 
 	return c.Fetched
 }
 
 func (c *Cpu6502) stackPush(value byte){
-	c.Memory[0x0100 + uint16(c.Registers.SP)] = value
+	c.write(0x0100 + word(c.Registers.SP), value)
 	c.Registers.SP = (c.Registers.SP - 1) & 0xFF
 }
 
+// Reads the top of the stack without pulling it, which pulls and JSR do on
+// the cycle they spend moving the stack pointer
+func (c *Cpu6502) stackPeek() {
+	c.read(0x0100 + word(c.Registers.SP))
+}
+
 func (c *Cpu6502) stackPull() byte {
 	c.Registers.SP = (c.Registers.SP + 1) & 0xFF
-	return c.Memory[0x0100 + uint16(c.Registers.SP)]
+	return c.read(0x0100 + word(c.Registers.SP))
 }
 
 func (c *Cpu6502) Print() {
@@ -15,6 +15,9 @@ const (
 	ADR_INDIRECTX
 	ADR_INDIRECTY
 	ADR_RELATIVE
+	ADR_ZEROPAGE_INDIRECT  // 65C02 (zp)
+	ADR_ABSOLUTE_INDIRECTX // 65C02 JMP (abs,X)
+	ADR_ZEROPAGE_RELATIVE  // 65C02 BBR and BBS: zero page address, then branch offset
 )
 
 const (
@@ -76,4 +79,20 @@ const (
 	OP_PLP
 	OP_STX
 	OP_STY
+
+	// 65C02 additions
+	OP_BRA
+	OP_PHX
+	OP_PHY
+	OP_PLX
+	OP_PLY
+	OP_STZ
+	OP_TRB
+	OP_TSB
+	OP_RMB
+	OP_SMB
+	OP_BBR
+	OP_BBS
+	OP_WAI
+	OP_STP
 )
\ No newline at end of file
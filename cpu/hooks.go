@@ -0,0 +1,99 @@
+package cpu6502
+
+// Interrupt kinds reported to Hooks.Interrupt
+const (
+	INTERRUPT_IRQ byte = iota
+	INTERRUPT_NMI
+)
+
+// Hooks are callbacks into an embedding application. Any field may be left nil.
+// Memory hooks see every bus access, including opcode and operand fetches.
+// The CPU runs a whole instruction on its first cycle, so every access is
+// reported with the Tick that instruction started on.
+type Hooks struct {
+	BeforeInstruction func(c *Cpu6502, pc word, opcode byte)
+	AfterInstruction  func(c *Cpu6502, pc word, cycles int)
+	MemoryRead        func(c *Cpu6502, addr word, value byte, cycle int)
+	MemoryWrite       func(c *Cpu6502, addr word, value byte, cycle int)
+	Interrupt         func(c *Cpu6502, kind byte, returnAddr word)
+	Break             func(c *Cpu6502, pc word)
+
+	// UnknownOpcode may emulate an opcode the CPU does not implement, by updating
+	// the CPU state itself and reporting how many cycles it took, counted as at
+	// least one. When no hook handles the opcode the CPU panics.
+	UnknownOpcode func(c *Cpu6502, pc word, opcode byte) (cycles int, handled bool)
+}
+
+// AddHooks registers a set of callbacks, they run in the order they were added
+func (c *Cpu6502) AddHooks(h *Hooks) {
+	c.hooks = append(c.hooks, h)
+}
+
+// RemoveHooks unregisters a set of callbacks previously passed to AddHooks
+func (c *Cpu6502) RemoveHooks(h *Hooks) {
+	for i, registered := range c.hooks {
+		if registered == h {
+			c.hooks = append(c.hooks[:i:i], c.hooks[i+1:]...)
+			return
+		}
+	}
+}
+
+func (c *Cpu6502) runBeforeInstruction(pc word, opcode byte) {
+	for _, h := range c.hooks {
+		if h.BeforeInstruction != nil {
+			h.BeforeInstruction(c, pc, opcode)
+		}
+	}
+}
+
+func (c *Cpu6502) runAfterInstruction(pc word, cycles int) {
+	for _, h := range c.hooks {
+		if h.AfterInstruction != nil {
+			h.AfterInstruction(c, pc, cycles)
+		}
+	}
+}
+
+func (c *Cpu6502) runMemoryRead(addr word, value byte) {
+	for _, h := range c.hooks {
+		if h.MemoryRead != nil {
+			h.MemoryRead(c, addr, value, c.Tick)
+		}
+	}
+}
+
+func (c *Cpu6502) runMemoryWrite(addr word, value byte) {
+	for _, h := range c.hooks {
+		if h.MemoryWrite != nil {
+			h.MemoryWrite(c, addr, value, c.Tick)
+		}
+	}
+}
+
+func (c *Cpu6502) runInterrupt(kind byte, returnAddr word) {
+	for _, h := range c.hooks {
+		if h.Interrupt != nil {
+			h.Interrupt(c, kind, returnAddr)
+		}
+	}
+}
+
+func (c *Cpu6502) runBreak(pc word) {
+	for _, h := range c.hooks {
+		if h.Break != nil {
+			h.Break(c, pc)
+		}
+	}
+}
+
+func (c *Cpu6502) runUnknownOpcode(pc word, opcode byte) (int, bool) {
+	for _, h := range c.hooks {
+		if h.UnknownOpcode != nil {
+			if cycles, handled := h.UnknownOpcode(c, pc, opcode); handled {
+				return cycles, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,203 @@
+package cpu6502
+
+import (
+	"reflect"
+	"testing"
+)
+
+// newHookCPU returns a CPU running program from $0200, with the IRQ vector at $0300
+func newHookCPU(program ...byte) *Cpu6502 {
+	c := New()
+	copy(c.Memory[0x0200:], program)
+	c.Memory[0xFFFE], c.Memory[0xFFFF] = 0x00, 0x03
+	c.Registers.PC = 0x0200
+	return c
+}
+
+// step runs one whole instruction
+func step(c *Cpu6502) {
+	for !c.SingleStep() {
+	}
+}
+
+func TestInstructionHooks(t *testing.T) {
+	// LDA $10; STA $11
+	c := newHookCPU(0xA5, 0x10, 0x85, 0x11)
+	c.Memory[0x10] = 0x42
+
+	var events []string
+	var reads, writes []word
+	var afterCycles []int
+	c.AddHooks(&Hooks{
+		BeforeInstruction: func(c *Cpu6502, pc word, opcode byte) {
+			events = append(events, "before")
+		},
+		AfterInstruction: func(c *Cpu6502, pc word, cycles int) {
+			events = append(events, "after")
+			afterCycles = append(afterCycles, cycles)
+		},
+		MemoryRead: func(c *Cpu6502, addr word, value byte, cycle int) {
+			reads = append(reads, addr)
+		},
+		MemoryWrite: func(c *Cpu6502, addr word, value byte, cycle int) {
+			writes = append(writes, addr)
+			if value != 0x42 {
+				t.Errorf("wrote $%02X, want $42", value)
+			}
+		},
+	})
+	step(c)
+	step(c)
+
+	if want := []string{"before", "after", "before", "after"}; !reflect.DeepEqual(events, want) {
+		t.Errorf("events %v, want %v", events, want)
+	}
+	if want := []int{3, 3}; !reflect.DeepEqual(afterCycles, want) {
+		t.Errorf("cycles %v, want %v", afterCycles, want)
+	}
+	if want := []word{0x0200, 0x0201, 0x0010, 0x0202, 0x0203}; !reflect.DeepEqual(reads, want) {
+		t.Errorf("reads %04X, want %04X", reads, want)
+	}
+	if want := []word{0x0011}; !reflect.DeepEqual(writes, want) {
+		t.Errorf("writes %04X, want %04X", writes, want)
+	}
+}
+
+// Every access of an instruction carries the Tick the instruction started on
+func TestMemoryHookCycle(t *testing.T) {
+	// NOP; LDA $10
+	c := newHookCPU(0xEA, 0xA5, 0x10)
+	var cycles []int
+	c.AddHooks(&Hooks{
+		MemoryRead: func(c *Cpu6502, addr word, value byte, cycle int) {
+			cycles = append(cycles, cycle)
+		},
+	})
+	step(c)
+	step(c)
+
+	// NOP reads the byte after it and ignores it
+	if want := []int{1, 1, 3, 3, 3}; !reflect.DeepEqual(cycles, want) {
+		t.Errorf("cycles %v, want %v", cycles, want)
+	}
+}
+
+// The 65C02's one cycle NOPs only fetch their opcode
+func TestOneCycleNOPReads(t *testing.T) {
+	// NOP ($03); NOP ($FB); NOP
+	c := newHookCPU(0x03, 0xFB, 0xEA)
+	c.Variant = VARIANT_65C02
+	var reads []word
+	c.AddHooks(&Hooks{
+		MemoryRead: func(c *Cpu6502, addr word, value byte, cycle int) {
+			reads = append(reads, addr)
+		},
+	})
+	step(c)
+	step(c)
+	step(c)
+
+	if want := []word{0x0200, 0x0201, 0x0202, 0x0203}; !reflect.DeepEqual(reads, want) {
+		t.Errorf("reads %04X, want %04X", reads, want)
+	}
+	if c.Tick != 4 {
+		t.Errorf("took %d cycles, want 4", c.Tick)
+	}
+}
+
+func TestUnknownOpcodeHook(t *testing.T) {
+	// $02 is a JAM on the NMOS part and not implemented
+	for _, cycles := range []int{0, -3, 1, 4} {
+		c := newHookCPU(0x02, 0xEA)
+		c.AddHooks(&Hooks{
+			UnknownOpcode: func(c *Cpu6502, pc word, opcode byte) (int, bool) {
+				return cycles, opcode == 0x02
+			},
+		})
+
+		want := cycles
+		if want < 1 {
+			want = 1
+		}
+		steps := 1
+		for !c.SingleStep() {
+			steps += 1
+			if steps > 16 {
+				t.Fatalf("%d cycles: instruction never completed", cycles)
+			}
+		}
+		if steps != want {
+			t.Errorf("%d cycles: took %d steps, want %d", cycles, steps, want)
+		}
+		if c.Registers.PC != 0x0201 {
+			t.Errorf("%d cycles: PC $%04X, want $0201", cycles, c.Registers.PC)
+		}
+	}
+}
+
+func TestUnhandledOpcodePanics(t *testing.T) {
+	c := newHookCPU(0x02)
+	c.AddHooks(&Hooks{
+		UnknownOpcode: func(c *Cpu6502, pc word, opcode byte) (int, bool) {
+			return 2, false
+		},
+	})
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("unhandled opcode did not panic")
+		}
+	}()
+	step(c)
+}
+
+func TestInterruptAndBreakHooks(t *testing.T) {
+	// CLI; NOP, then BRK at the IRQ handler
+	c := newHookCPU(0x58, 0xEA)
+	c.Memory[0x0300] = 0x00
+
+	var kinds []byte
+	var returns []word
+	var breaks []word
+	c.AddHooks(&Hooks{
+		Interrupt: func(c *Cpu6502, kind byte, returnAddr word) {
+			kinds = append(kinds, kind)
+			returns = append(returns, returnAddr)
+		},
+		Break: func(c *Cpu6502, pc word) {
+			breaks = append(breaks, pc)
+		},
+	})
+
+	step(c)
+	c.IRQLine = true
+	step(c)
+	c.IRQLine = false
+	step(c)
+	c.SetNMILine(true)
+	step(c)
+
+	if want := []byte{INTERRUPT_IRQ, INTERRUPT_NMI}; !reflect.DeepEqual(kinds, want) {
+		t.Errorf("interrupts %v, want %v", kinds, want)
+	}
+	if len(returns) != 2 || returns[0] != 0x0201 {
+		t.Errorf("return addresses %04X, want $0201 first", returns)
+	}
+	if want := []word{0x0300}; !reflect.DeepEqual(breaks, want) {
+		t.Errorf("breaks %04X, want %04X", breaks, want)
+	}
+}
+
+func TestRemoveHooks(t *testing.T) {
+	c := newHookCPU(0xEA, 0xEA)
+	count := 0
+	h := &Hooks{BeforeInstruction: func(c *Cpu6502, pc word, opcode byte) { count += 1 }}
+	c.AddHooks(h)
+	step(c)
+	c.RemoveHooks(h)
+	step(c)
+
+	if count != 1 {
+		t.Errorf("hook ran %d times, want 1", count)
+	}
+}
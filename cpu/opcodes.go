@@ -12,6 +12,21 @@ type Opcode struct {
 	Address Addressing
 }
 
+// Stores and read-modify-write operations always spend the cycle an indexed
+// read only needs on a page crossing, so it is already part of NumCycle
+var NoPageCrossPenalty = map[byte]bool{
+	OP_STA: true,
+	OP_STX: true,
+	OP_STY: true,
+	OP_ASL: true,
+	OP_LSR: true,
+	OP_ROL: true,
+	OP_ROR: true,
+	OP_INC: true,
+	OP_DEC: true,
+	OP_STZ: true,
+}
+
 var Opcodes = map[uint8]Opcode{
 	// ADC Opcodes (Add with Carry)
 	0x69: {2,"ADC", OP_ADC, ADR_IMMEDIATE, adc, immediate },
@@ -85,7 +100,7 @@ var Opcodes = map[uint8]Opcode{
 	0xFE: {7,"INC", OP_INC, ADR_ABSOLUTEX, inc, absolutex },
 	0x4C: {3,"JMP", OP_JMP, ADR_ABSOLUTE, jmp, absolute },
 	0x6C: {5,"JMP", OP_JMP, ADR_INDIRECT, jmp, indirect },
-	0x20: {6,"JSR", OP_JSR, ADR_ABSOLUTE, jsr, absolute },
+	0x20: {6,"JSR", OP_JSR, ADR_ABSOLUTE, jsr, absolutelow },
 	0xA9: {2,"LDA", OP_LDA, ADR_IMMEDIATE, lda, immediate },
 	0xA5: {3,"LDA", OP_LDA, ADR_ZEROPAGE, lda, zeropage },
 	0xB5: {4,"LDA", OP_LDA, ADR_ZEROPAGEX, lda, zeropagex },
@@ -165,4 +180,139 @@ var Opcodes = map[uint8]Opcode{
 	0x84: {3,"STY", OP_STY, ADR_ZEROPAGE, sty, zeropage },
 	0x94: {4,"STY", OP_STY, ADR_ZEROPAGEX, sty, zeropagex },
 	0x8C: {4,"STY", OP_STY, ADR_ABSOLUTE, sty, absolute },
-}
\ No newline at end of file
+}
+
+// Opcodes65C02 holds the opcodes the WDC 65C02 adds to or changes from the
+// NMOS 6502. Every opcode the NMOS 6502 leaves undefined is a NOP of some
+// size on the 65C02, so together with Opcodes it covers all 256.
+var Opcodes65C02 = map[uint8]Opcode{
+	0x12: {5,"ORA", OP_ORA, ADR_ZEROPAGE_INDIRECT, ora, zeropageindirect },
+	0x32: {5,"AND", OP_AND, ADR_ZEROPAGE_INDIRECT, and, zeropageindirect },
+	0x52: {5,"EOR", OP_EOR, ADR_ZEROPAGE_INDIRECT, eor, zeropageindirect },
+	0x72: {5,"ADC", OP_ADC, ADR_ZEROPAGE_INDIRECT, adc, zeropageindirect },
+	0x92: {5,"STA", OP_STA, ADR_ZEROPAGE_INDIRECT, sta, zeropageindirect },
+	0xB2: {5,"LDA", OP_LDA, ADR_ZEROPAGE_INDIRECT, lda, zeropageindirect },
+	0xD2: {5,"CMP", OP_CMP, ADR_ZEROPAGE_INDIRECT, cmp, zeropageindirect },
+	0xF2: {5,"SBC", OP_SBC, ADR_ZEROPAGE_INDIRECT, sbc, zeropageindirect },
+	0x89: {2,"BIT", OP_BIT, ADR_IMMEDIATE, bit, immediate },
+	0x34: {4,"BIT", OP_BIT, ADR_ZEROPAGEX, bit, zeropagex },
+	0x3C: {4,"BIT", OP_BIT, ADR_ABSOLUTEX, bit, absolutex },
+	0x1A: {2,"INC", OP_INC, ADR_ACCUMULATOR, inc, accumulator },
+	0x3A: {2,"DEC", OP_DEC, ADR_ACCUMULATOR, dec, accumulator },
+	0x04: {5,"TSB", OP_TSB, ADR_ZEROPAGE, tsb, zeropage },
+	0x0C: {6,"TSB", OP_TSB, ADR_ABSOLUTE, tsb, absolute },
+	0x14: {5,"TRB", OP_TRB, ADR_ZEROPAGE, trb, zeropage },
+	0x1C: {6,"TRB", OP_TRB, ADR_ABSOLUTE, trb, absolute },
+	0x64: {3,"STZ", OP_STZ, ADR_ZEROPAGE, stz, zeropage },
+	0x74: {4,"STZ", OP_STZ, ADR_ZEROPAGEX, stz, zeropagex },
+	0x9C: {4,"STZ", OP_STZ, ADR_ABSOLUTE, stz, absolute },
+	0x9E: {5,"STZ", OP_STZ, ADR_ABSOLUTEX, stz, absolutex },
+	0xDA: {3,"PHX", OP_PHX, ADR_IMPLICIT, phx, implicit },
+	0x5A: {3,"PHY", OP_PHY, ADR_IMPLICIT, phy, implicit },
+	0xFA: {4,"PLX", OP_PLX, ADR_IMPLICIT, plx, implicit },
+	0x7A: {4,"PLY", OP_PLY, ADR_IMPLICIT, ply, implicit },
+	0x80: {2,"BRA", OP_BRA, ADR_RELATIVE, bra, relative },  // Branch Always
+	0x6C: {6,"JMP", OP_JMP, ADR_INDIRECT, jmp, indirectfixed },  // Without the NMOS page wrap bug
+	0x7C: {6,"JMP", OP_JMP, ADR_ABSOLUTE_INDIRECTX, jmp, absoluteindirectx },
+	// Shifts and rotates on abs,X only spend the extra cycle on a page crossing
+	0x1E: {6,"ASL", OP_ASL, ADR_ABSOLUTEX, pageCrossPenalty(asl), absolutex },
+	0x3E: {6,"ROL", OP_ROL, ADR_ABSOLUTEX, pageCrossPenalty(rol), absolutex },
+	0x5E: {6,"LSR", OP_LSR, ADR_ABSOLUTEX, pageCrossPenalty(lsr), absolutex },
+	0x7E: {6,"ROR", OP_ROR, ADR_ABSOLUTEX, pageCrossPenalty(ror), absolutex },
+	// WDC and Rockwell bit instructions
+	0x07: {5,"RMB0", OP_RMB, ADR_ZEROPAGE, rmb(0), zeropage },
+	0x17: {5,"RMB1", OP_RMB, ADR_ZEROPAGE, rmb(1), zeropage },
+	0x27: {5,"RMB2", OP_RMB, ADR_ZEROPAGE, rmb(2), zeropage },
+	0x37: {5,"RMB3", OP_RMB, ADR_ZEROPAGE, rmb(3), zeropage },
+	0x47: {5,"RMB4", OP_RMB, ADR_ZEROPAGE, rmb(4), zeropage },
+	0x57: {5,"RMB5", OP_RMB, ADR_ZEROPAGE, rmb(5), zeropage },
+	0x67: {5,"RMB6", OP_RMB, ADR_ZEROPAGE, rmb(6), zeropage },
+	0x77: {5,"RMB7", OP_RMB, ADR_ZEROPAGE, rmb(7), zeropage },
+	0x87: {5,"SMB0", OP_SMB, ADR_ZEROPAGE, smb(0), zeropage },
+	0x97: {5,"SMB1", OP_SMB, ADR_ZEROPAGE, smb(1), zeropage },
+	0xA7: {5,"SMB2", OP_SMB, ADR_ZEROPAGE, smb(2), zeropage },
+	0xB7: {5,"SMB3", OP_SMB, ADR_ZEROPAGE, smb(3), zeropage },
+	0xC7: {5,"SMB4", OP_SMB, ADR_ZEROPAGE, smb(4), zeropage },
+	0xD7: {5,"SMB5", OP_SMB, ADR_ZEROPAGE, smb(5), zeropage },
+	0xE7: {5,"SMB6", OP_SMB, ADR_ZEROPAGE, smb(6), zeropage },
+	0xF7: {5,"SMB7", OP_SMB, ADR_ZEROPAGE, smb(7), zeropage },
+	0x0F: {5,"BBR0", OP_BBR, ADR_ZEROPAGE_RELATIVE, bbr(0), zeropagerelative },
+	0x1F: {5,"BBR1", OP_BBR, ADR_ZEROPAGE_RELATIVE, bbr(1), zeropagerelative },
+	0x2F: {5,"BBR2", OP_BBR, ADR_ZEROPAGE_RELATIVE, bbr(2), zeropagerelative },
+	0x3F: {5,"BBR3", OP_BBR, ADR_ZEROPAGE_RELATIVE, bbr(3), zeropagerelative },
+	0x4F: {5,"BBR4", OP_BBR, ADR_ZEROPAGE_RELATIVE, bbr(4), zeropagerelative },
+	0x5F: {5,"BBR5", OP_BBR, ADR_ZEROPAGE_RELATIVE, bbr(5), zeropagerelative },
+	0x6F: {5,"BBR6", OP_BBR, ADR_ZEROPAGE_RELATIVE, bbr(6), zeropagerelative },
+	0x7F: {5,"BBR7", OP_BBR, ADR_ZEROPAGE_RELATIVE, bbr(7), zeropagerelative },
+	0x8F: {5,"BBS0", OP_BBS, ADR_ZEROPAGE_RELATIVE, bbs(0), zeropagerelative },
+	0x9F: {5,"BBS1", OP_BBS, ADR_ZEROPAGE_RELATIVE, bbs(1), zeropagerelative },
+	0xAF: {5,"BBS2", OP_BBS, ADR_ZEROPAGE_RELATIVE, bbs(2), zeropagerelative },
+	0xBF: {5,"BBS3", OP_BBS, ADR_ZEROPAGE_RELATIVE, bbs(3), zeropagerelative },
+	0xCF: {5,"BBS4", OP_BBS, ADR_ZEROPAGE_RELATIVE, bbs(4), zeropagerelative },
+	0xDF: {5,"BBS5", OP_BBS, ADR_ZEROPAGE_RELATIVE, bbs(5), zeropagerelative },
+	0xEF: {5,"BBS6", OP_BBS, ADR_ZEROPAGE_RELATIVE, bbs(6), zeropagerelative },
+	0xFF: {5,"BBS7", OP_BBS, ADR_ZEROPAGE_RELATIVE, bbs(7), zeropagerelative },
+	0xCB: {3,"WAI", OP_WAI, ADR_IMPLICIT, wai, implicit },  // Wait for interrupt
+	0xDB: {3,"STP", OP_STP, ADR_IMPLICIT, stp, implicit },  // Stop until reset
+	// Undefined opcodes, which skip their operands
+	0x02: {2,"NOP", OP_NOP, ADR_IMMEDIATE, nop, immediate },
+	0x22: {2,"NOP", OP_NOP, ADR_IMMEDIATE, nop, immediate },
+	0x42: {2,"NOP", OP_NOP, ADR_IMMEDIATE, nop, immediate },
+	0x62: {2,"NOP", OP_NOP, ADR_IMMEDIATE, nop, immediate },
+	0x82: {2,"NOP", OP_NOP, ADR_IMMEDIATE, nop, immediate },
+	0xC2: {2,"NOP", OP_NOP, ADR_IMMEDIATE, nop, immediate },
+	0xE2: {2,"NOP", OP_NOP, ADR_IMMEDIATE, nop, immediate },
+	0x44: {3,"NOP", OP_NOP, ADR_ZEROPAGE, nop, zeropage },
+	0x54: {4,"NOP", OP_NOP, ADR_ZEROPAGEX, nop, zeropagex },
+	0xD4: {4,"NOP", OP_NOP, ADR_ZEROPAGEX, nop, zeropagex },
+	0xF4: {4,"NOP", OP_NOP, ADR_ZEROPAGEX, nop, zeropagex },
+	0x5C: {8,"NOP", OP_NOP, ADR_ABSOLUTE, nop, absolute },
+	0xDC: {4,"NOP", OP_NOP, ADR_ABSOLUTE, nop, absolute },
+	0xFC: {4,"NOP", OP_NOP, ADR_ABSOLUTE, nop, absolute },
+	0x03: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x13: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x23: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x33: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x43: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x53: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x63: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x73: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x83: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x93: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0xA3: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0xB3: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0xC3: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0xD3: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0xE3: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0xF3: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x0B: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x1B: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x2B: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x3B: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x4B: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x5B: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x6B: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x7B: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x8B: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0x9B: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0xAB: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0xBB: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0xEB: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+	0xFB: {1,"NOP", OP_NOP, ADR_IMPLICIT, nop, onecycle },
+}
+
+// LookupOpcode finds what op does on a CPU variant
+func LookupOpcode(variant byte, op byte) (Opcode, bool) {
+	if variant == VARIANT_65C02 {
+		if opcode, ok := Opcodes65C02[op]; ok {
+			return opcode, true
+		}
+	}
+	opcode, ok := Opcodes[op]
+	return opcode, ok
+}
+
+// Lookup finds what op does on this CPU's variant
+func (c *Cpu6502) Lookup(op byte) (Opcode, bool) {
+	return LookupOpcode(c.Variant, op)
+}
@@ -8,29 +8,45 @@ func twos_comp(val int) int {
 	return val
 }
 
+// Services an interrupt request, unless interrupts are disabled
 func IRQ(c *Cpu6502) int {
 	if c.Flags.I == 0 {
+		if len(c.hooks) > 0 {
+			c.runInterrupt(INTERRUPT_IRQ, c.Registers.PC)
+		}
+		// The opcode fetch is thrown away and PC is not incremented
+		c.read(c.Registers.PC)
+		c.read(c.Registers.PC)
 		c.stackPush(byte(c.Registers.PC >> 8))
 		c.stackPush(byte(c.Registers.PC))
 
-		c.Flags.I = 1
+		// The status is pushed with the I flag as it was before the interrupt
 		c.stackPush(c.getStatusFlagsByte("interrupt"))
+		c.Flags.I = 1
+		c.clearDecimalOnInterrupt()
 
-		c.Registers.PC = (word(c.Memory[0xFFFF]) << 8) | word(c.Memory[0xFFFE])
+		c.Registers.PC = c.ReadWord(0xFFFE)
 
 		return 7
 	}
 	return 0
 }
 
+// Services a non maskable interrupt
 func NMI(c *Cpu6502) int {
+	if len(c.hooks) > 0 {
+		c.runInterrupt(INTERRUPT_NMI, c.Registers.PC)
+	}
+	c.read(c.Registers.PC)
+	c.read(c.Registers.PC)
 	c.stackPush(byte(c.Registers.PC >> 8))
 	c.stackPush(byte(c.Registers.PC))
 
-	c.Flags.I = 1
 	c.stackPush(c.getStatusFlagsByte("interrupt"))
-	c.Registers.PC = (word(c.Memory[0xFFFB]) << 8) | word(c.Memory[0xFFFA])
-	return 8
+	c.Flags.I = 1
+	c.clearDecimalOnInterrupt()
+	c.Registers.PC = c.ReadWord(0xFFFA)
+	return 7
 }
 
 func nop(c *Cpu6502) int {
@@ -39,11 +55,12 @@ func nop(c *Cpu6502) int {
 
 func adc(c *Cpu6502) int {
 	// Add with carry operation
-	// Decimal mode: N, V, Z flags are invalid
-	val := c.fetchByte()
+	// Decimal mode: N, V, Z flags are undocumented, and follow what the NMOS 6502 does.
+	// The 65C02 sets N and Z from the decimal result, and takes a cycle longer.
+	val := c.fetch()
 
 	// Binary mode
-	if c.Flags.D == 0 {
+	if !c.decimalMode() {
 		total := word(c.Registers.A) + word(val) + word(c.Flags.C)
 
 		// Overflow check
@@ -65,7 +82,8 @@ func adc(c *Cpu6502) int {
 
 		return 0
 	} else {
-		// Decimal mode
+		// Decimal mode, following Bruce Clark's description of the NMOS 6502
+		// See http://www.6502.org/tutorials/decimal_mode.html#A
 		a := int(c.Registers.A)
 		b := int(val)
 		temp := (a & 0x0F) + (b & 0x0F) + int(c.Flags.C) // Add 1s place of decimal
@@ -74,19 +92,18 @@ func adc(c *Cpu6502) int {
 			temp = ((temp + 0x06) & 0x0F) + 0x10 // Add 6 to skip 10 -> 15, keep the 1s place and carry to 10s place
 		}
 
-		a = (a & 0xF0) + (b & 0xF0) + temp // Add the 10s place in decimal
+		// N and V are taken before the 10s place is adjusted, treating the 10s places as signed
+		signed := twos_comp(a & 0xF0) + twos_comp(b & 0xF0) + temp
+		c.Flags.N = 0
+		if signed & 0x80 > 0 { c.Flags.N = 1 }
+		c.Flags.V = 0
+		if signed < -128 || signed > 127 { c.Flags.V = 1 }
 
-		if (a&0xFF)&(1<<7) > 0 { // N set if 7th bit is set
-			c.Flags.N = 1
-		} else {
-			c.Flags.N = 0
-		}
+		// Z is the same as in binary mode
+		c.Flags.Z = 0
+		if (a + b + int(c.Flags.C)) & 0xFF == 0 { c.Flags.Z = 1 }
 
-		if -128 <= twos_comp(a&0xFF) && twos_comp(a&0xFF) <= 127 {
-			c.Flags.V = 0
-		} else {
-			c.Flags.V = 1
-		}
+		a = (a & 0xF0) + (b & 0xF0) + temp // Add the 10s place in decimal
 
 		if a >= 0xA0 { // If bigger than 100
 			a = a + 0x60 // skip 1xx -> 5xx, keeps the 10s and 1s place
@@ -99,6 +116,10 @@ func adc(c *Cpu6502) int {
 			c.Flags.C = 0
 		}
 
+		if c.Variant == VARIANT_65C02 {
+			c.setNZFlag(c.Registers.A)
+			return 1
+		}
 		return 0
 	}
 }
@@ -117,8 +138,9 @@ func asl(c *Cpu6502) int {
 		val = word(c.Registers.A) << 1
 		c.Registers.A = byte(val)
 	} else {
-		val = word(c.fetch()) << 1
-		c.Memory[c.AbsoluteAddr] = byte(val)
+		old := c.fetch()
+		val = word(old) << 1
+		c.writeBack(old, byte(val))
 	}
 
 	c.Flags.C = 0
@@ -131,48 +153,21 @@ func asl(c *Cpu6502) int {
 
 func bcc(c *Cpu6502) int {
 	if c.Flags.C == 0 {
-		cycles := 1
-		c.AbsoluteAddr = (c.Registers.PC + c.RelativeAddr)
-
-		// If branch to new page, add a cycle
-		if c.AbsoluteAddr&0xFF00 != c.Registers.PC&0xFF00 {
-			cycles += 1
-		}
-		c.Registers.PC = c.AbsoluteAddr
-
-		return cycles
+		return takeBranch(c)
 	}
 	return 0
 }
 
 func bcs(c *Cpu6502) int {
 	if c.Flags.C == 1 {
-		cycles := 1
-		c.AbsoluteAddr = (c.Registers.PC + c.RelativeAddr)
-
-		// If branch to new page, add a cycle
-		if c.AbsoluteAddr&0xFF00 != c.Registers.PC&0xFF00 {
-			cycles += 1
-		}
-		c.Registers.PC = c.AbsoluteAddr
-
-		return cycles
+		return takeBranch(c)
 	}
 	return 0
 }
 
 func beq(c *Cpu6502) int {
 	if c.Flags.Z == 1 {
-		cycles := 1
-		c.AbsoluteAddr = (c.Registers.PC + c.RelativeAddr)
-
-		// If branch to new page, add a cycle
-		if c.AbsoluteAddr&0xFF00 != c.Registers.PC&0xFF00 {
-			cycles += 1
-		}
-		c.Registers.PC = c.AbsoluteAddr
-
-		return cycles
+		return takeBranch(c)
 	}
 	return 0
 }
@@ -180,12 +175,17 @@ func beq(c *Cpu6502) int {
 func bit(c *Cpu6502) int {
 	val := c.fetch()
 	c.Flags.Z = 0
-	c.Flags.N = 0
-	c.Flags.V = 0
-
 	if c.Registers.A&val == 0 {
 		c.Flags.Z = 1
 	}
+
+	// The 65C02's BIT # only sets Z
+	if c.Opcode.AddressingMode == ADR_IMMEDIATE {
+		return 0
+	}
+
+	c.Flags.N = 0
+	c.Flags.V = 0
 	if val&(1<<7) > 0 {
 		c.Flags.N = 1
 	}
@@ -198,53 +198,29 @@ func bit(c *Cpu6502) int {
 
 func bmi(c *Cpu6502) int {
 	if c.Flags.N == 1 {
-		cycles := 1
-		c.AbsoluteAddr = (c.Registers.PC + c.RelativeAddr)
-
-		// If branch to new page, add a cycle
-		if c.AbsoluteAddr&0xFF00 != c.Registers.PC&0xFF00 {
-			cycles += 1
-		}
-		c.Registers.PC = c.AbsoluteAddr
-
-		return cycles
+		return takeBranch(c)
 	}
 	return 0
 }
 
 func bne(c *Cpu6502) int {
 	if c.Flags.Z == 0 {
-		cycles := 1
-		c.AbsoluteAddr = (c.Registers.PC + c.RelativeAddr)
-
-		// If branch to new page, add a cycle
-		if c.AbsoluteAddr&0xFF00 != c.Registers.PC&0xFF00 {
-			cycles += 1
-		}
-		c.Registers.PC = c.AbsoluteAddr
-
-		return cycles
+		return takeBranch(c)
 	}
 	return 0
 }
 
 func bpl(c *Cpu6502) int {
 	if c.Flags.N == 0 {
-		cycles := 1
-		c.AbsoluteAddr = (c.Registers.PC + c.RelativeAddr)
-
-		// If branch to new page, add a cycle
-		if c.AbsoluteAddr&0xFF00 != c.Registers.PC&0xFF00 {
-			cycles += 1
-		}
-		c.Registers.PC = c.AbsoluteAddr
-
-		return cycles
+		return takeBranch(c)
 	}
 	return 0
 }
 
 func brk(c *Cpu6502) int {
+	if len(c.hooks) > 0 {
+		c.runBreak(c.Registers.PC - 1)
+	}
 	c.Registers.PC += 1
 	c.stackPush(byte(c.Registers.PC >> 8)) // write high byte
 	c.stackPush(byte(c.Registers.PC))      // write low byte
@@ -253,40 +229,23 @@ func brk(c *Cpu6502) int {
 	// but sets bit #4 (B flag) IN THE COPY of the status register that is saved on the stack.
 	c.stackPush(c.getStatusFlagsByte("instruction"))
 	c.Flags.I = 1
+	c.clearDecimalOnInterrupt()
 
-	c.Registers.PC = word(c.Memory[0xFFFF])<<8 | word(c.Memory[0xFFFE])
+	c.Registers.PC = c.ReadWord(0xFFFE)
 
 	return 0
 }
 
 func bvc(c *Cpu6502) int {
 	if c.Flags.V == 0 {
-		cycles := 1
-		c.AbsoluteAddr = (c.Registers.PC + c.RelativeAddr)
-
-		// If branch to new page, add a cycle
-		if c.AbsoluteAddr&0xFF00 != c.Registers.PC&0xFF00 {
-			cycles += 1
-		}
-		c.Registers.PC = c.AbsoluteAddr
-
-		return cycles
+		return takeBranch(c)
 	}
 	return 0
 }
 
 func bvs(c *Cpu6502) int {
 	if c.Flags.V == 1 {
-		cycles := 1
-		c.AbsoluteAddr = (c.Registers.PC + c.RelativeAddr)
-
-		// If branch to new page, add a cycle
-		if c.AbsoluteAddr&0xFF00 != c.Registers.PC&0xFF00 {
-			cycles += 1
-		}
-		c.Registers.PC = c.AbsoluteAddr
-
-		return cycles
+		return takeBranch(c)
 	}
 	return 0
 }
@@ -345,8 +304,13 @@ func cpy(c *Cpu6502) int {
 }
 
 func dec(c *Cpu6502) int {
-	val := c.fetch() - 1
-	c.Memory[c.AbsoluteAddr] = val
+	old := c.fetch()
+	val := old - 1
+	if c.Opcode.AddressingMode == ADR_ACCUMULATOR {
+		c.Registers.A = val
+	} else {
+		c.writeBack(old, val)
+	}
 	c.setNZFlag(val)
 	return 0
 }
@@ -370,8 +334,13 @@ func eor(c *Cpu6502) int {
 }
 
 func inc(c *Cpu6502) int {
-	val := c.fetch() + 1
-	c.Memory[c.AbsoluteAddr] = val
+	old := c.fetch()
+	val := old + 1
+	if c.Opcode.AddressingMode == ADR_ACCUMULATOR {
+		c.Registers.A = val
+	} else {
+		c.writeBack(old, val)
+	}
 	c.setNZFlag(val)
 	return 0
 }
@@ -394,10 +363,12 @@ func jmp(c *Cpu6502) int {
 }
 
 func jsr(c *Cpu6502) int {
-	c.Registers.PC -= 1
+	// PC is left on the high byte of the target, which is read last
+	c.stackPeek()
 	c.stackPush(byte(c.Registers.PC >> 8)) // Write high byte
 	c.stackPush(byte(c.Registers.PC))      // write low byte
 
+	c.AbsoluteAddr |= word(c.read(c.Registers.PC)) << 8
 	c.Registers.PC = c.AbsoluteAddr
 	return 0
 }
@@ -424,16 +395,17 @@ func lsr(c *Cpu6502) int {
 	var val byte
 	if c.Opcode.AddressingMode == ADR_ACCUMULATOR {
 		val = c.Registers.A
+		c.Registers.A = val >> 1
 	} else {
 		val = c.fetch()
+		c.writeBack(val, val >> 1)
 	}
-	c.Memory[c.AbsoluteAddr] = val >> 1
 
 	c.Flags.C = 0
 	if val&0x01 > 0 {
 		c.Flags.C = 1
 	}
-	c.setNZFlag(c.Flags.C)
+	c.setNZFlag(val >> 1)
 	return 0
 }
 
@@ -449,6 +421,7 @@ func pha(c *Cpu6502) int {
 }
 
 func pla(c *Cpu6502) int {
+	c.stackPeek()
 	c.Registers.A = c.stackPull()
 	c.setNZFlag(c.Registers.A)
 	return 0
@@ -461,6 +434,7 @@ func php(c *Cpu6502) int {
 }
 
 func plp(c *Cpu6502) int {
+	c.stackPeek()
 	c.setStatusFlags(c.stackPull())
 	c.Flags.B = 0
 	return 0
@@ -471,16 +445,16 @@ func rol(c *Cpu6502) int {
 	var temp byte
 	if c.Opcode.AddressingMode == ADR_ACCUMULATOR {
 		val = word(c.Registers.A)
-		temp := byte(val << 1) | c.Flags.C
+		temp = byte(val << 1) | c.Flags.C
 		c.Registers.A = temp
 	} else {
 		val = word(c.fetch())
-		temp := byte(val << 1) | c.Flags.C
-		c.Memory[c.AbsoluteAddr] = temp
+		temp = byte(val << 1) | c.Flags.C
+		c.writeBack(byte(val), temp)
 	}
 
 	c.Flags.C = 0
-	if val & 0x01 > 0 { c.Flags.C = 1}
+	if val & 0x80 > 0 { c.Flags.C = 1}
 	c.setNZFlag(temp)
 	return 0
 }
@@ -490,12 +464,12 @@ func ror(c *Cpu6502) int {
 	var temp byte
 	if c.Opcode.AddressingMode == ADR_ACCUMULATOR {
 		val = word(c.Registers.A)
-		temp := byte(val >> 1) | (c.Flags.C << 7)
+		temp = byte(val >> 1) | (c.Flags.C << 7)
 		c.Registers.A = temp
 	} else {
 		val = word(c.fetch())
-		temp := byte(val >> 1) | (c.Flags.C << 7)
-		c.Memory[c.AbsoluteAddr] = temp
+		temp = byte(val >> 1) | (c.Flags.C << 7)
+		c.writeBack(byte(val), temp)
 	}
 
 	c.Flags.C = 0
@@ -505,6 +479,7 @@ func ror(c *Cpu6502) int {
 }
 
 func rti(c *Cpu6502) int {
+	c.stackPeek()
 	c.setStatusFlags(c.stackPull())
 	c.Flags.B = 0
 
@@ -516,35 +491,59 @@ func rti(c *Cpu6502) int {
 }
 
 func rts(c *Cpu6502) int {
+	c.stackPeek()
 	lo_byte := c.stackPull()
 	hi_byte := c.stackPull()
 
-	c.Registers.PC = (word(hi_byte) << 8 | word(lo_byte)) + 1
+	// The return address points at the last byte of the JSR, which is read again while PC is incremented
+	c.Registers.PC = word(hi_byte) << 8 | word(lo_byte)
+	c.read(c.Registers.PC)
+	c.Registers.PC += 1
 	return 0
 }
 
 func sbc(c *Cpu6502) int {
 	val := word(c.fetch())
 
-	if c.Flags.D == 0 {
+	// See http://www.righto.com/2012/12/the-6502-overflow-flag-explained.html
+	// val is converted to ones complement and hence we can use ADC logic.
+	// The NMOS 6502 sets every flag from the binary result, even in decimal mode
+	inverted := val ^ 0x00FF
+	total := word(c.Registers.A) + inverted + word(c.Flags.C)
+
+	// Overflow check
+	// See http://www.righto.com/2012/12/the-6502-overflow-flag-explained.html
+	c.Flags.V = 0
+	if ((inverted ^ total) & (word(c.Registers.A) ^ total) & 0x80) != 0 {
+		c.Flags.V = 1
+	}
+	c.setNZFlag(byte(total))
+
+	cycles := 0
+	if !c.decimalMode() {
 		// Binary mode
-		// See http://www.righto.com/2012/12/the-6502-overflow-flag-explained.html
-		// val is converted to ones complement and hence we can use ADC logic
-		val = val ^ 0x00FF
-		total := word(c.Registers.A) + val + word(c.Flags.C)
+		c.Registers.A = byte(total)
+	} else if c.Variant == VARIANT_65C02 {
+		// The 65C02 adjusts the whole result and sets N and Z from it, taking a cycle longer
+		// See http://www.6502.org/tutorials/decimal_mode.html#A
+		a := int(c.Registers.A)
+		b := int(val)
+		low := (a & 0x0F) - (b & 0x0F) + int(c.Flags.C) - 1
+		a = a - b + int(c.Flags.C) - 1
 
-		// Overflow check
-		// See http://www.righto.com/2012/12/the-6502-overflow-flag-explained.html
-		c.Flags.V = 0
-		if ((val ^ total) & (word(c.Registers.A) ^ total) & 0x80) != 0 {
-			c.Flags.V = 1
+		if a < 0 {
+			a = a - 0x60
+		}
+		if low < 0 {
+			a = a - 0x06
 		}
-		c.Registers.A = byte(total)
-		c.Flags.C = 0
 
-		if total > 0xFF { c.Flags.C = 1 }
+		c.Registers.A = byte(a)
+		c.setNZFlag(c.Registers.A)
+		cycles = 1
 	} else {
 		// Decimal mode
+		// See http://www.6502.org/tutorials/decimal_mode.html#A
 		a := int(c.Registers.A)
 		b := int(val)
 		temp := (a & 0x0F) - (b & 0x0F) + int(c.Flags.C) - 1
@@ -559,21 +558,12 @@ func sbc(c *Cpu6502) int {
 			a = a - 0x60
 		}
 
-		val = val ^ 0x00FF
-		var total word = word(c.Registers.A) + val + word(c.Flags.C)
-
-		c.Flags.V = 0
-		if ((val ^ total) & (word(c.Registers.A) ^ total) & 0x80) != 0 {
-			c.Flags.V = 1
-		}
-
 		c.Registers.A = byte(a)
-		c.Flags.C = 1
-		if a < 0 { c.Flags.C = 0}
 	}
 
-	c.setNZFlag(c.Registers.A)
-	return 0
+	c.Flags.C = 0
+	if total > 0xFF { c.Flags.C = 1 }
+	return cycles
 }
 
 func sec(c *Cpu6502) int {
@@ -592,16 +582,16 @@ func sei(c *Cpu6502) int {
 }
 
 func sta(c *Cpu6502) int {
-	c.Memory[c.AbsoluteAddr] = c.Registers.A
+	c.write(c.AbsoluteAddr, c.Registers.A)
 	return 0
 }
 func stx(c *Cpu6502) int {
-	c.Memory[c.AbsoluteAddr] = c.Registers.X
+	c.write(c.AbsoluteAddr, c.Registers.X)
 	return 0
 }
 
 func sty(c *Cpu6502) int {
-	c.Memory[c.AbsoluteAddr] = c.Registers.Y
+	c.write(c.AbsoluteAddr, c.Registers.Y)
 	return 0
 }
 
@@ -638,4 +628,158 @@ func tya(c *Cpu6502) int {
 	c.Registers.A = c.Registers.Y
 	c.setNZFlag(c.Registers.A)
 	return 0
+}
+
+// writeBack stores the result of a read-modify-write operation. The NMOS 6502
+// writes the unmodified value back while it works out the new one, the 65C02
+// reads it again instead
+func (c *Cpu6502) writeBack(old byte, val byte) {
+	if c.Variant == VARIANT_65C02 {
+		c.read(c.AbsoluteAddr)
+	} else {
+		c.write(c.AbsoluteAddr, old)
+	}
+	c.write(c.AbsoluteAddr, val)
+}
+
+// clearDecimalOnInterrupt clears D on entering an interrupt handler, which
+// the 65C02 does and the NMOS 6502 leaves to the handler
+func (c *Cpu6502) clearDecimalOnInterrupt() {
+	if c.Variant == VARIANT_65C02 {
+		c.Flags.D = 0
+	}
+}
+
+// takeBranch moves PC by the relative address, returning the extra cycles
+func takeBranch(c *Cpu6502) int {
+	cycles := 1
+	c.read(c.Registers.PC) // The next opcode is read while the offset is added
+	c.AbsoluteAddr = (c.Registers.PC + c.RelativeAddr)
+
+	// If branch to new page, add a cycle, spent reading the target's offset on the old page
+	if c.AbsoluteAddr&0xFF00 != c.Registers.PC&0xFF00 {
+		c.read(c.Registers.PC&0xFF00 | c.AbsoluteAddr&0x00FF)
+		cycles += 1
+	}
+	c.Registers.PC = c.AbsoluteAddr
+
+	return cycles
+}
+
+func bra(c *Cpu6502) int {
+	return takeBranch(c)
+}
+
+// bbr branches when a bit of a zero page byte is clear
+func bbr(bit byte) Operation {
+	return func(c *Cpu6502) int {
+		if c.fetch()&(1<<bit) == 0 {
+			return takeBranch(c)
+		}
+		return 0
+	}
+}
+
+// bbs branches when a bit of a zero page byte is set
+func bbs(bit byte) Operation {
+	return func(c *Cpu6502) int {
+		if c.fetch()&(1<<bit) != 0 {
+			return takeBranch(c)
+		}
+		return 0
+	}
+}
+
+// rmb clears a bit of a zero page byte
+func rmb(bit byte) Operation {
+	return func(c *Cpu6502) int {
+		val := c.fetch()
+		c.writeBack(val, val&^(1<<bit))
+		return 0
+	}
+}
+
+// smb sets a bit of a zero page byte
+func smb(bit byte) Operation {
+	return func(c *Cpu6502) int {
+		val := c.fetch()
+		c.writeBack(val, val|(1<<bit))
+		return 0
+	}
+}
+
+func phx(c *Cpu6502) int {
+	c.stackPush(c.Registers.X)
+	return 0
+}
+
+func phy(c *Cpu6502) int {
+	c.stackPush(c.Registers.Y)
+	return 0
+}
+
+func plx(c *Cpu6502) int {
+	c.stackPeek()
+	c.Registers.X = c.stackPull()
+	c.setNZFlag(c.Registers.X)
+	return 0
+}
+
+func ply(c *Cpu6502) int {
+	c.stackPeek()
+	c.Registers.Y = c.stackPull()
+	c.setNZFlag(c.Registers.Y)
+	return 0
+}
+
+func stz(c *Cpu6502) int {
+	c.write(c.AbsoluteAddr, 0)
+	return 0
+}
+
+// trb clears the bits set in A, setting Z from A AND memory like BIT
+func trb(c *Cpu6502) int {
+	val := c.fetch()
+	c.Flags.Z = 0
+	if c.Registers.A&val == 0 {
+		c.Flags.Z = 1
+	}
+	c.writeBack(val, val&^c.Registers.A)
+	return 0
+}
+
+// tsb sets the bits set in A, setting Z from A AND memory like BIT
+func tsb(c *Cpu6502) int {
+	val := c.fetch()
+	c.Flags.Z = 0
+	if c.Registers.A&val == 0 {
+		c.Flags.Z = 1
+	}
+	c.writeBack(val, val|c.Registers.A)
+	return 0
+}
+
+// wai idles until an interrupt comes in
+func wai(c *Cpu6502) int {
+	c.waiting = true
+	return 0
+}
+
+// stp idles until the next reset
+func stp(c *Cpu6502) int {
+	c.stopped = true
+	return 0
+}
+
+// pageCrossPenalty charges a cycle when abs,X crosses a page, which the
+// 65C02 does for the shifts and rotates the NMOS 6502 always spends it on
+func pageCrossPenalty(op Operation) Operation {
+	return func(c *Cpu6502) int {
+		base := c.AbsoluteAddr - word(c.Registers.X)
+		cycles := op(c)
+		if base&0xFF00 != c.AbsoluteAddr&0xFF00 {
+			cycles += 1
+		}
+		return cycles
+	}
 }
\ No newline at end of file
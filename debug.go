@@ -0,0 +1,118 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	debugger "izzudinhafiz.com/go-6502/debugger"
+	remote "izzudinhafiz.com/go-6502/remote"
+	tui "izzudinhafiz.com/go-6502/tui"
+)
+
+// debug [program flags] IMAGE
+func debugCommand(args []string) error {
+	flags := flag.NewFlagSet("debug", flag.ContinueOnError)
+	program := addProgramFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	path, err := program.image(flags, "debug [flags] IMAGE")
+	if err != nil {
+		return err
+	}
+
+	d, _, err := program.load(path)
+	if err != nil {
+		return err
+	}
+	defer closeMachine(d.CPU())()
+	return tui.New(d, os.Stdin, os.Stdout).Run()
+}
+
+// serve [-listen HOST:PORT] [-token TOKEN] [-allow-origin ORIGINS] [-load-dir DIR] [program flags] [IMAGE]
+func serveCommand(args []string) error {
+	flags := flag.NewFlagSet("serve", flag.ContinueOnError)
+	listen := flags.String("listen", "127.0.0.1:6502", "address to serve the debugger on")
+	token := flags.String("token", "", "token clients must present, generated when listening beyond loopback")
+	origins := flags.String("allow-origin", "", "comma separated origins of other web pages allowed to connect, * for any")
+	loadDir := flags.String("load-dir", "", "directory clients may load files from, none when empty")
+	program := addProgramFlags(flags)
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() > 1 {
+		return usageError("serve [-listen HOST:PORT] [-token TOKEN] [-allow-origin ORIGINS] [-load-dir DIR] [flags] [IMAGE]")
+	}
+	host, _, err := net.SplitHostPort(*listen)
+	if err != nil {
+		return usageError("-listen: %v", err)
+	}
+	if *token == "" && !isLoopback(host) {
+		// Anyone who can reach the port could otherwise load and run code
+		if *token, err = randomToken(); err != nil {
+			return err
+		}
+	}
+
+	// Without an image or machine the CPU starts empty, waiting for a load call
+	d, _, err := program.load(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer closeMachine(d.CPU())()
+
+	session := remote.NewSession(d)
+	session.Token = *token
+	session.LoadDir = *loadDir
+	if host != "" {
+		session.Hosts = []string{host}
+	}
+	if *origins != "" {
+		session.AllowOrigins = strings.Split(*origins, ",")
+	}
+	if *token != "" {
+		fmt.Printf("debugger at http://%v/?token=%v\n", *listen, url.QueryEscape(*token))
+	} else {
+		fmt.Printf("debugger at http://%v/\n", *listen)
+	}
+	return http.ListenAndServe(*listen, session.Handler())
+}
+
+func isLoopback(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func loadSymbols(d *debugger.Debugger6502, path string) error {
+	if path == "" {
+		return nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := d.Symbols.ReadSymbols(f); err != nil {
+		return fmt.Errorf("%v: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package c6502debugger
+
+import (
+	"fmt"
+	"strings"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+)
+
+// Kinds of call frame
+const (
+	FRAME_JSR byte = iota
+	FRAME_IRQ
+	FRAME_NMI
+	FRAME_BRK
+)
+
+var frameNames = [...]string{"JSR", "IRQ", "NMI", "BRK"}
+
+// Number of anomalies kept, older ones are dropped
+const MAX_ANOMALIES = 32
+
+// Frame is one entry of the shadow call stack
+type Frame struct {
+	Kind   byte
+	Caller word // Address of the JSR or BRK, or of the instruction an interrupt arrived before
+	Target word // Entry point of the subroutine or handler
+	Return word // Address execution resumes at when the frame returns
+	SP     byte // Stack pointer once the return address was pushed
+	Cycle  int
+}
+
+// Number of bytes the frame occupies on the hardware stack
+func (f Frame) size() int {
+	if f.Kind == FRAME_JSR {
+		return 2
+	}
+	return 3
+}
+
+// StackAnomaly records a point where the program used the stack in a way that
+// does not match the shadow call stack, such as discarding a return address,
+// jumping through RTS or changing SP with TXS.
+type StackAnomaly struct {
+	PC      word
+	Cycle   int
+	Message string
+}
+
+func (a StackAnomaly) String() string {
+	return fmt.Sprintf("$%04X cycle %d: %v", a.PC, a.Cycle, a.Message)
+}
+
+// CallStack follows JSR/RTS, interrupts and RTI through CPU hooks to keep a
+// shadow of the program's call chain
+type CallStack struct {
+	Frames    []Frame
+	Anomalies []StackAnomaly
+	OnAnomaly func(a StackAnomaly) // Called as each anomaly is found
+
+	hooks         cpu.Hooks
+	pc            word
+	code          byte
+	pendingTarget bool
+}
+
+func newCallStack() *CallStack {
+	cs := &CallStack{}
+	cs.hooks = cpu.Hooks{
+		BeforeInstruction: cs.before,
+		AfterInstruction:  cs.after,
+		Interrupt:         cs.interrupt,
+	}
+	return cs
+}
+
+// Reset empties the call stack, for use after the CPU is reset
+func (cs *CallStack) Reset() {
+	cs.Frames = cs.Frames[:0]
+	cs.Anomalies = cs.Anomalies[:0]
+	cs.pendingTarget = false
+}
+
+// Depth returns the number of frames on the stack
+func (cs *CallStack) Depth() int {
+	return len(cs.Frames)
+}
+
+func (cs *CallStack) before(c *cpu.Cpu6502, pc word, opcode byte) {
+	if cs.pendingTarget {
+		cs.Frames[len(cs.Frames)-1].Target = pc
+		cs.pendingTarget = false
+	}
+	cs.pc = pc
+	cs.code = opcode
+}
+
+func (cs *CallStack) after(c *cpu.Cpu6502, pc word, cycles int) {
+	op, key_exists := c.Lookup(cs.code)
+	if key_exists {
+		switch op.Code {
+		case cpu.OP_JSR:
+			cs.push(Frame{FRAME_JSR, pc, c.Registers.PC, pc + 3, c.Registers.SP, c.Tick})
+		case cpu.OP_BRK:
+			cs.push(Frame{FRAME_BRK, pc, c.Registers.PC, pc + 2, c.Registers.SP, c.Tick})
+		case cpu.OP_RTS:
+			cs.unwind(c, 2)
+		case cpu.OP_RTI:
+			cs.unwind(c, 3)
+		}
+	}
+
+	// Anything that moves SP above a frame's return address releases it
+	for len(cs.Frames) > 0 {
+		top := cs.Frames[len(cs.Frames)-1]
+		if int(c.Registers.SP) <= int(top.SP)+top.size() {
+			break
+		}
+		cs.anomaly(c, fmt.Sprintf("%v frame from $%04X discarded without returning", frameNames[top.Kind], top.Caller))
+		cs.Frames = cs.Frames[:len(cs.Frames)-1]
+	}
+}
+
+func (cs *CallStack) interrupt(c *cpu.Cpu6502, kind byte, returnAddr word) {
+	frameKind := FRAME_IRQ
+	if kind == cpu.INTERRUPT_NMI {
+		frameKind = FRAME_NMI
+	}
+	cs.push(Frame{frameKind, returnAddr, 0, returnAddr, c.Registers.SP - 3, c.Tick})
+	cs.pendingTarget = true
+}
+
+func (cs *CallStack) push(f Frame) {
+	cs.Frames = append(cs.Frames, f)
+}
+
+// unwind pops the frame released by an RTS or RTI, which pulled size bytes
+func (cs *CallStack) unwind(c *cpu.Cpu6502, size int) {
+	name := "RTS"
+	if size == 3 {
+		name = "RTI"
+	}
+
+	sp := int(c.Registers.SP)
+	match := -1
+	for i := len(cs.Frames) - 1; i >= 0; i-- {
+		if int(cs.Frames[i].SP)+size == sp {
+			match = i
+			break
+		}
+	}
+
+	if match < 0 {
+		cs.anomaly(c, fmt.Sprintf("%v to $%04X has no matching call", name, c.Registers.PC))
+		return
+	}
+
+	f := cs.Frames[match]
+	if skipped := len(cs.Frames) - 1 - match; skipped > 0 {
+		cs.anomaly(c, fmt.Sprintf("%v unwound %d frames", name, skipped))
+	}
+	if f.size() != size {
+		cs.anomaly(c, fmt.Sprintf("%v returned from a %v frame", name, frameNames[f.Kind]))
+	}
+	if c.Registers.PC != f.Return {
+		cs.anomaly(c, fmt.Sprintf("%v to $%04X, expected $%04X", name, c.Registers.PC, f.Return))
+	}
+	cs.Frames = cs.Frames[:match]
+}
+
+func (cs *CallStack) anomaly(c *cpu.Cpu6502, message string) {
+	a := StackAnomaly{cs.pc, c.Tick, message}
+	if len(cs.Anomalies) == MAX_ANOMALIES {
+		copy(cs.Anomalies, cs.Anomalies[1:])
+		cs.Anomalies = cs.Anomalies[:MAX_ANOMALIES-1]
+	}
+	cs.Anomalies = append(cs.Anomalies, a)
+
+	if cs.OnAnomaly != nil {
+		cs.OnAnomaly(a)
+	}
+}
+
+// Backtrace formats the call chain, innermost first, starting at the current PC:
+//
+//	#0  $C012  print+$5
+//	#1  $C105  main+$12      JSR
+func (d *Debugger6502) Backtrace() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#0  $%04X  %v\n", d.cpu.Registers.PC, d.Symbols.Format(d.cpu.Registers.PC))
+
+	frames := d.Calls.Frames
+	for i := len(frames) - 1; i >= 0; i-- {
+		f := frames[i]
+		fmt.Fprintf(&b, "#%-2d $%04X  %-20v %v\n", len(frames)-i, f.Caller, d.Symbols.Format(f.Caller), frameNames[f.Kind])
+	}
+	return b.String()
+}
@@ -0,0 +1,122 @@
+package c6502debugger
+
+import (
+	"strings"
+	"testing"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+)
+
+func TestCallStackJSR(t *testing.T) {
+	d := newRunDebugger()
+	d.Step() // JSR $0210
+	d.Step() // LDA
+	d.Step() // JSR $0220
+
+	want := []Frame{
+		{FRAME_JSR, 0x0200, 0x0210, 0x0203, 0xFB, 1},
+		{FRAME_JSR, 0x0212, 0x0220, 0x0215, 0xF9, 9},
+	}
+	if !framesEqual(d.Calls.Frames, want) {
+		t.Errorf("frames %+v, want %+v", d.Calls.Frames, want)
+	}
+
+	d.Symbols = SymbolsFromMap(map[string]int{"main": 0x0200, "sub": 0x0210, "inner": 0x0220})
+	backtrace := "#0  $0220  inner\n" +
+		"#1  $0212  sub+$2               JSR\n" +
+		"#2  $0200  main                 JSR\n"
+	if got := d.Backtrace(); got != backtrace {
+		t.Errorf("backtrace\n%vwant\n%v", got, backtrace)
+	}
+
+	d.RunTo(0x0203)
+	if d.Calls.Depth() != 0 || len(d.Calls.Anomalies) != 0 {
+		t.Errorf("after returning: frames %+v, anomalies %v", d.Calls.Frames, d.Calls.Anomalies)
+	}
+}
+
+func framesEqual(got []Frame, want []Frame) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Interrupts and BRK push three byte frames that RTI pops
+func TestCallStackInterrupts(t *testing.T) {
+	d := newRunDebugger()
+	c := d.cpu
+	copy(c.Memory[0x0400:], []byte{0xEA, 0x40}) // NOP; RTI
+	copy(c.Memory[0x0500:], []byte{0x00, 0xFF}) // BRK and its padding byte
+	c.SetResetVector(0x0200)
+	c.WriteMemory(0xFFFE, []byte{0x00, 0x04})
+
+	c.Flags.I = 0
+	c.IRQLine = true
+	d.Step() // IRQ entry
+	c.IRQLine = false
+	d.Step() // NOP, which fills in the handler address
+	want := []Frame{{FRAME_IRQ, 0x0200, 0x0400, 0x0200, 0xFA, 1}}
+	if !framesEqual(d.Calls.Frames, want) {
+		t.Errorf("IRQ frames %+v, want %+v", d.Calls.Frames, want)
+	}
+	d.Step() // RTI
+	if d.Calls.Depth() != 0 || c.Registers.PC != 0x0200 {
+		t.Errorf("after RTI at $%04X: frames %+v", c.Registers.PC, d.Calls.Frames)
+	}
+
+	c.Registers.PC = 0x0500
+	d.Step()
+	if f := d.Calls.Frames; len(f) != 1 || f[0].Kind != FRAME_BRK || f[0].Caller != 0x0500 || f[0].Target != 0x0400 || f[0].Return != 0x0502 {
+		t.Errorf("BRK frames %+v", f)
+	}
+	d.Step() // NOP
+	d.Step() // RTI
+	if d.Calls.Depth() != 0 || c.Registers.PC != 0x0502 || len(d.Calls.Anomalies) != 0 {
+		t.Errorf("after RTI at $%04X: frames %+v, anomalies %v", c.Registers.PC, d.Calls.Frames, d.Calls.Anomalies)
+	}
+}
+
+// Programs that juggle the stack are followed and reported
+func TestCallStackAnomalies(t *testing.T) {
+	c := cpu.New()
+	copy(c.Memory[0x0300:], []byte{
+		0x20, 0x10, 0x03, // JSR $0310
+	})
+	copy(c.Memory[0x0310:], []byte{
+		0x68, 0x68, // PLA; PLA, dropping the return address
+		0x60, // RTS, which pulls past the frame
+	})
+	c.Registers.PC = 0x0300
+	c.Registers.SP = 0xFD
+	d := New(c)
+
+	var reported []string
+	d.Calls.OnAnomaly = func(a StackAnomaly) {
+		reported = append(reported, a.String())
+	}
+	for i := 0; i < 4; i++ {
+		d.Step()
+	}
+
+	want := []string{
+		"$0312 cycle 15: RTS to $0001 has no matching call",
+		"$0312 cycle 15: JSR frame from $0300 discarded without returning",
+	}
+	if strings.Join(reported, "\n") != strings.Join(want, "\n") {
+		t.Errorf("anomalies\n%v\nwant\n%v", strings.Join(reported, "\n"), strings.Join(want, "\n"))
+	}
+	if len(d.Calls.Anomalies) != 2 || d.Calls.Depth() != 0 {
+		t.Errorf("kept %d anomalies and %d frames", len(d.Calls.Anomalies), d.Calls.Depth())
+	}
+
+	d.Calls.Reset()
+	if len(d.Calls.Anomalies) != 0 {
+		t.Errorf("Reset kept %d anomalies", len(d.Calls.Anomalies))
+	}
+}
@@ -6,7 +6,7 @@ import (
 	cpu "izzudinhafiz.com/go-6502/cpu"
 )
 
-type word uint16
+type word = uint16
 
 type instructionPair struct {
 	name string
@@ -14,6 +14,8 @@ type instructionPair struct {
 }
 
 type Trace struct {
+	PC word // Address of the instruction
+	Code byte // Opcode byte of the instruction
 	Op string
 	Registers cpu.CpuRegisters
 	Flags cpu.CpuFlags
@@ -26,8 +28,17 @@ type Trace struct {
 
 type Debugger6502 struct {
 	cpu *cpu.Cpu6502
-	TraceStack []Trace
+	Sinks []TraceSink
+	Symbols *Symbols
+	Calls *CallStack // Shadow call stack, kept up to date however the CPU is run
+	Watches []*Watch
+	breakpoints map[word]*Breakpoint
+	paused int32
 	NumOperations int
+
+	// RecentWrite has never been filled in.
+	//
+	// Deprecated: watch writes with a cpu.Hooks MemoryWrite callback.
 	RecentWrite [][2]int
 }
 
@@ -45,30 +56,80 @@ var INSTRUCTION_MAP = map[byte]instructionPair {
 	cpu.ADR_INDIRECTX: {"INX", 1},
 	cpu.ADR_INDIRECTY: {"INY", 1},
 	cpu.ADR_RELATIVE: {"REL", 1},
+	cpu.ADR_ZEROPAGE_INDIRECT: {"ZPI", 1},
+	cpu.ADR_ABSOLUTE_INDIRECTX: {"IAX", 2},
+	cpu.ADR_ZEROPAGE_RELATIVE: {"ZPR", 2},
 }
 
 func New(c *cpu.Cpu6502) *Debugger6502 {
-	d := Debugger6502{cpu: c}
+	d := Debugger6502{cpu: c, Symbols: NewSymbols(), Calls: newCallStack()}
+	c.AddHooks(&d.Calls.hooks)
 	return &d
 }
 
+// Adds a sink that receives every instruction run through Trace
+func (d *Debugger6502) AddSink(s TraceSink) {
+	d.Sinks = append(d.Sinks, s)
+}
+
+// Runs a single instruction, passing its trace to every sink
 func (d *Debugger6502) Trace() {
-	op := d.DisassembleLine(int(d.cpu.Registers.PC))
-	cycles := 0
+	pc := d.cpu.Registers.PC
+	code := d.peek(pc)
+	var op string
+	if len(d.Sinks) > 0 {
+		op = d.Disassemble(pc).Text
+	}
+	cycles := 1
 
 	for !d.cpu.SingleStep() {
 		cycles += 1
 	}
 
 	d.NumOperations += 1
-	trace := Trace{op, d.cpu.Registers, d.cpu.Flags, d.cpu.Tick, cycles, d.getCPUStack(), d.NumOperations}
-	d.TraceStack = append(d.TraceStack, trace)
+	if len(d.Sinks) == 0 {
+		return
+	}
+
+	trace := Trace{
+		PC: pc,
+		Code: code,
+		Op: op,
+		Registers: d.cpu.Registers,
+		Flags: d.cpu.Flags,
+		Clock: d.cpu.Tick,
+		LastCycle: cycles,
+		Stack: d.getCPUStack(),
+		NumOperations: d.NumOperations,
+	}
+	for _, s := range d.Sinks {
+		s.Record(trace)
+	}
 }
 
+// Returns a copy of the used part of the stack page, top of the stack first
 func (d *Debugger6502) getCPUStack() []byte {
-	return d.cpu.Memory[0x0101 + int(d.cpu.Registers.SP): 0x01FF + 1]
+	start := 0x0101 + int(d.cpu.Registers.SP)
+	if start > 0x01FF {
+		return []byte{}
+	}
+
+	stack := make([]byte, 0x0200 - start)
+	for i := range stack {
+		stack[i] = d.peek(word(start + i))
+	}
+	return stack
+}
+
+// Reads memory without running the CPU hooks, and without device side effects
+// on buses that are Peekers, for inspecting state
+func (d *Debugger6502) peek(addr word) byte {
+	return d.cpu.Peek(addr)
 }
 
+// DisassembleLine formats the instruction at startAddr, reading memory with Peek.
+//
+// Deprecated: use Disassemble, which also resolves symbols.
 func (d *Debugger6502) DisassembleLine(startAddr int) string {
 	var lo byte
 	var hi byte
@@ -76,10 +137,10 @@ func (d *Debugger6502) DisassembleLine(startAddr int) string {
 	addr := startAddr
 
 	ins_addr := addr
-	op := d.cpu.Memory[addr]
+	op := d.peek(word(addr))
 	addr += 1
 
-	opcode, key_exists := cpu.Opcodes[op]
+	opcode, key_exists := d.cpu.Lookup(op)
 
 	if !key_exists {
 		return fmt.Sprintf("%#04X [XXX] INVALID OP", ins_addr)
@@ -92,7 +153,7 @@ func (d *Debugger6502) DisassembleLine(startAddr int) string {
 
 	if fetchSize == 0 {
 	} else if fetchSize == 1 {
-		lo = d.cpu.Memory[addr]
+		lo = d.peek(word(addr))
 		addr += 1
 		hi = 0
 
@@ -109,9 +170,9 @@ func (d *Debugger6502) DisassembleLine(startAddr int) string {
 			line += fmt.Sprintf("[$%#04X]", (word(addr) + rel))
 		}
 	} else {
-		lo = d.cpu.Memory[addr]
+		lo = d.peek(word(addr))
 		addr += 1
-		hi = d.cpu.Memory[addr]
+		hi = d.peek(word(addr))
 		fullAddr := word(hi) << 8 | word(lo)
 		line += fmt.Sprintf("$%#04X", fullAddr)
 	}
@@ -0,0 +1,137 @@
+package c6502debugger
+
+import (
+	"fmt"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+)
+
+// Instruction is one disassembled instruction
+type Instruction struct {
+	Addr  word
+	Bytes []byte
+	Text  string // Assembler syntax, with symbols in place of addresses that have one
+}
+
+// Disassemble decodes the instruction at addr without touching the bus hooks,
+// so it is safe to use on memory mapped devices
+func (d *Debugger6502) Disassemble(addr word) Instruction {
+	op := d.peek(addr)
+	opcode, key_exists := d.cpu.Lookup(op)
+	if !key_exists {
+		return Instruction{addr, []byte{op}, fmt.Sprintf(".byte $%02X", op)}
+	}
+
+	size := INSTRUCTION_MAP[opcode.AddressingMode].fetchSize
+	raw := d.ReadMemory(addr, size+1)
+	var lo, hi byte
+	if size >= 1 {
+		lo = raw[1]
+	}
+	if size == 2 {
+		hi = raw[2]
+	}
+	full := word(hi)<<8 | word(lo)
+	name := opcode.FriendlyName
+
+	var text string
+	switch opcode.AddressingMode {
+	case cpu.ADR_IMPLICIT:
+		text = name
+	case cpu.ADR_ACCUMULATOR:
+		text = name + " A"
+	case cpu.ADR_IMMEDIATE:
+		text = fmt.Sprintf("%v #$%02X", name, lo)
+	case cpu.ADR_ZEROPAGE:
+		text = fmt.Sprintf("%v %v", name, d.operand(word(lo), 2))
+	case cpu.ADR_ZEROPAGEX:
+		text = fmt.Sprintf("%v %v,X", name, d.operand(word(lo), 2))
+	case cpu.ADR_ZEROPAGEY:
+		text = fmt.Sprintf("%v %v,Y", name, d.operand(word(lo), 2))
+	case cpu.ADR_ABSOLUTE:
+		text = fmt.Sprintf("%v %v", name, d.operand(full, 4))
+	case cpu.ADR_ABSOLUTEX:
+		text = fmt.Sprintf("%v %v,X", name, d.operand(full, 4))
+	case cpu.ADR_ABSOLUTEY:
+		text = fmt.Sprintf("%v %v,Y", name, d.operand(full, 4))
+	case cpu.ADR_INDIRECT:
+		text = fmt.Sprintf("%v (%v)", name, d.operand(full, 4))
+	case cpu.ADR_INDIRECTX:
+		text = fmt.Sprintf("%v (%v,X)", name, d.operand(word(lo), 2))
+	case cpu.ADR_INDIRECTY:
+		text = fmt.Sprintf("%v (%v),Y", name, d.operand(word(lo), 2))
+	case cpu.ADR_RELATIVE:
+		rel := word(lo)
+		if lo&0x80 > 0 {
+			rel |= 0xFF00
+		}
+		text = fmt.Sprintf("%v %v", name, d.operand(addr+2+rel, 4))
+	case cpu.ADR_ZEROPAGE_INDIRECT:
+		text = fmt.Sprintf("%v (%v)", name, d.operand(word(lo), 2))
+	case cpu.ADR_ABSOLUTE_INDIRECTX:
+		text = fmt.Sprintf("%v (%v,X)", name, d.operand(full, 4))
+	case cpu.ADR_ZEROPAGE_RELATIVE:
+		rel := word(hi)
+		if hi&0x80 > 0 {
+			rel |= 0xFF00
+		}
+		text = fmt.Sprintf("%v %v,%v", name, d.operand(word(lo), 2), d.operand(addr+3+rel, 4))
+	}
+
+	return Instruction{addr, raw, text}
+}
+
+// DisassemblyStart finds an address before instructions before addr, such
+// that disassembling from it lands exactly on addr. Code can't be decoded
+// backwards reliably, so this is a best guess, and addr itself when none is found.
+func (d *Debugger6502) DisassemblyStart(addr word, before int) word {
+	for back := before * 3; back > 0; back-- {
+		start := addr - word(back)
+		var starts []word
+		offset := 0
+		for offset < back {
+			starts = append(starts, start+word(offset))
+			offset += len(d.Disassemble(start + word(offset)).Bytes)
+		}
+		if offset == back && len(starts) >= before {
+			return starts[len(starts)-before]
+		}
+	}
+	return addr
+}
+
+// operand formats an address as its symbol, or as hex with the given number of digits
+func (d *Debugger6502) operand(addr word, digits int) string {
+	if name, ok := d.Symbols.Name(addr); ok {
+		return name
+	}
+	return fmt.Sprintf("$%0*X", digits, addr)
+}
+
+// ReadMemory copies n bytes starting at addr, wrapping at the top of memory,
+// without touching the bus hooks
+func (d *Debugger6502) ReadMemory(addr word, n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = d.peek(addr + word(i))
+	}
+	return data
+}
+
+// WriteMemory stores data starting at addr, wrapping at the top of memory,
+// without touching the bus hooks
+func (d *Debugger6502) WriteMemory(addr word, data []byte) {
+	for i, b := range data {
+		a := addr + word(i)
+		if d.cpu.Bus != nil {
+			d.cpu.Bus.Write(a, b)
+		} else {
+			d.cpu.Memory[a] = b
+		}
+	}
+}
+
+// CPU returns the CPU being debugged
+func (d *Debugger6502) CPU() *cpu.Cpu6502 {
+	return d.cpu
+}
@@ -0,0 +1,38 @@
+package c6502debugger
+
+import (
+	"testing"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+)
+
+func TestDisassemble65C02(t *testing.T) {
+	tests := []struct {
+		variant byte
+		code    []byte
+		want    string
+	}{
+		{cpu.VARIANT_NMOS, []byte{0xB1, 0x10}, "LDA ($10),Y"},
+		{cpu.VARIANT_NMOS, []byte{0xB2, 0x10}, ".byte $B2"},
+		{cpu.VARIANT_65C02, []byte{0xB2, 0x10}, "LDA ($10)"},
+		{cpu.VARIANT_65C02, []byte{0x7C, 0x34, 0x12}, "JMP ($1234,X)"},
+		{cpu.VARIANT_65C02, []byte{0x80, 0xFE}, "BRA $0200"},
+		{cpu.VARIANT_65C02, []byte{0x8F, 0x10, 0x05}, "BBS0 $10,$0208"},
+		{cpu.VARIANT_65C02, []byte{0x1A}, "INC A"},
+	}
+
+	for _, tt := range tests {
+		c := cpu.New()
+		c.Variant = tt.variant
+		copy(c.Memory[0x0200:], tt.code)
+		d := New(c)
+
+		ins := d.Disassemble(0x0200)
+		if ins.Text != tt.want {
+			t.Errorf("% X disassembled to %q, want %q", tt.code, ins.Text, tt.want)
+		}
+		if tt.want[0] != '.' && len(ins.Bytes) != len(tt.code) {
+			t.Errorf("% X decoded as %d bytes", tt.code, len(ins.Bytes))
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package c6502debugger
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr is a compiled debugger expression, used for breakpoint conditions,
+// watches and memory commands. Expressions follow C precedence and understand:
+//
+//	A X Y SP PC P          registers, P is the status byte
+//	N V B D I Z C          individual flags
+//	[addr]  w[addr]        byte and little endian word at addr
+//	name                   symbols, looked up when evaluated
+//	$FF 0xFF 255 %1010 0b1010 'A'
+//	+ - * / % << >> & | ^ ~ ! && || == != < <= > >=
+//	<expr  >expr           low and high byte
+//
+// Register and flag names are not case sensitive and hide symbols of the same name.
+type Expr struct {
+	Source string
+	root   exprNode
+}
+
+type exprNode func(d *Debugger6502) int
+
+type exprError struct {
+	err error
+}
+
+// CompileExpr parses src
+func CompileExpr(src string) (*Expr, error) {
+	p := &exprParser{src: src}
+	root, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &Expr{src, root}, nil
+}
+
+// Eval evaluates the expression against the debugged CPU
+func (e *Expr) Eval(d *Debugger6502) (value int, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ee, ok := r.(exprError)
+			if !ok {
+				panic(r)
+			}
+			err = ee.err
+		}
+	}()
+	return e.root(d), nil
+}
+
+func (e *Expr) String() string {
+	return e.Source
+}
+
+// Evaluate compiles and evaluates src in one go
+func (d *Debugger6502) Evaluate(src string) (int, error) {
+	e, err := CompileExpr(src)
+	if err != nil {
+		return 0, err
+	}
+	return e.Eval(d)
+}
+
+type exprParser struct {
+	src string
+	pos int
+}
+
+func (p *exprParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%v at column %d: %v", p.src, p.pos+1, fmt.Sprintf(format, args...))
+}
+
+func (p *exprParser) parse() (node exprNode, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			ee, ok := r.(exprError)
+			if !ok {
+				panic(r)
+			}
+			node, err = nil, ee.err
+		}
+	}()
+
+	node = p.binary(0)
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		panic(exprError{p.errorf("unexpected %q", p.src[p.pos:])})
+	}
+	return node, nil
+}
+
+func (p *exprParser) skipSpace() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos += 1
+	}
+}
+
+// Binary operators from lowest to highest precedence
+var exprLevels = [][]string{
+	{"||"},
+	{"&&"},
+	{"|"},
+	{"^"},
+	{"&"},
+	{"==", "!="},
+	{"<=", ">=", "<", ">"},
+	{"<<", ">>"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) operator(level int) string {
+	p.skipSpace()
+	rest := p.src[p.pos:]
+	for _, op := range exprLevels[level] {
+		if !strings.HasPrefix(rest, op) {
+			continue
+		}
+		// Don't take the first half of a longer operator, such as & from &&
+		if len(op) == 1 && len(rest) > 1 {
+			two := rest[:2]
+			if two == "&&" || two == "||" || two == "<<" || two == ">>" || two == "<=" || two == ">=" || two == "==" || two == "!=" {
+				continue
+			}
+		}
+		p.pos += len(op)
+		return op
+	}
+	return ""
+}
+
+func (p *exprParser) binary(level int) exprNode {
+	if level == len(exprLevels) {
+		return p.unary()
+	}
+
+	left := p.binary(level + 1)
+	for {
+		op := p.operator(level)
+		if op == "" {
+			return left
+		}
+		left = binaryNode(op, left, p.binary(level+1))
+	}
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func binaryNode(op string, l exprNode, r exprNode) exprNode {
+	switch op {
+	case "||":
+		return func(d *Debugger6502) int { return boolInt(l(d) != 0 || r(d) != 0) }
+	case "&&":
+		return func(d *Debugger6502) int { return boolInt(l(d) != 0 && r(d) != 0) }
+	case "|":
+		return func(d *Debugger6502) int { return l(d) | r(d) }
+	case "^":
+		return func(d *Debugger6502) int { return l(d) ^ r(d) }
+	case "&":
+		return func(d *Debugger6502) int { return l(d) & r(d) }
+	case "==":
+		return func(d *Debugger6502) int { return boolInt(l(d) == r(d)) }
+	case "!=":
+		return func(d *Debugger6502) int { return boolInt(l(d) != r(d)) }
+	case "<":
+		return func(d *Debugger6502) int { return boolInt(l(d) < r(d)) }
+	case "<=":
+		return func(d *Debugger6502) int { return boolInt(l(d) <= r(d)) }
+	case ">":
+		return func(d *Debugger6502) int { return boolInt(l(d) > r(d)) }
+	case ">=":
+		return func(d *Debugger6502) int { return boolInt(l(d) >= r(d)) }
+	case "<<":
+		return func(d *Debugger6502) int { return l(d) << uint(r(d)&63) }
+	case ">>":
+		return func(d *Debugger6502) int { return l(d) >> uint(r(d)&63) }
+	case "+":
+		return func(d *Debugger6502) int { return l(d) + r(d) }
+	case "-":
+		return func(d *Debugger6502) int { return l(d) - r(d) }
+	case "*":
+		return func(d *Debugger6502) int { return l(d) * r(d) }
+	case "/", "%":
+		return func(d *Debugger6502) int {
+			divisor := r(d)
+			if divisor == 0 {
+				panic(exprError{fmt.Errorf("division by zero")})
+			}
+			if op == "/" {
+				return l(d) / divisor
+			}
+			return l(d) % divisor
+		}
+	}
+	panic("unhandled operator " + op)
+}
+
+func (p *exprParser) unary() exprNode {
+	p.skipSpace()
+	if p.pos >= len(p.src) {
+		panic(exprError{p.errorf("unexpected end of expression")})
+	}
+
+	switch p.src[p.pos] {
+	case '-':
+		p.pos += 1
+		operand := p.unary()
+		return func(d *Debugger6502) int { return -operand(d) }
+	case '~':
+		p.pos += 1
+		operand := p.unary()
+		return func(d *Debugger6502) int { return ^operand(d) }
+	case '!':
+		p.pos += 1
+		operand := p.unary()
+		return func(d *Debugger6502) int { return boolInt(operand(d) == 0) }
+	case '<':
+		p.pos += 1
+		operand := p.unary()
+		return func(d *Debugger6502) int { return operand(d) & 0xFF }
+	case '>':
+		p.pos += 1
+		operand := p.unary()
+		return func(d *Debugger6502) int { return (operand(d) >> 8) & 0xFF }
+	}
+	return p.primary()
+}
+
+func (p *exprParser) expect(c byte) {
+	p.skipSpace()
+	if p.pos >= len(p.src) || p.src[p.pos] != c {
+		panic(exprError{p.errorf("expected %q", c)})
+	}
+	p.pos += 1
+}
+
+func (p *exprParser) primary() exprNode {
+	c := p.src[p.pos]
+	switch {
+	case c == '(':
+		p.pos += 1
+		inner := p.binary(0)
+		p.expect(')')
+		return inner
+
+	case c == '[':
+		p.pos += 1
+		addr := p.binary(0)
+		p.expect(']')
+		return func(d *Debugger6502) int { return int(d.peek(word(addr(d)))) }
+
+	case c == '\'':
+		if p.pos+2 >= len(p.src) || p.src[p.pos+2] != '\'' {
+			panic(exprError{p.errorf("bad character literal")})
+		}
+		value := int(p.src[p.pos+1])
+		p.pos += 3
+		return func(d *Debugger6502) int { return value }
+
+	case c == '$' || c == '%' || (c >= '0' && c <= '9'):
+		value := p.number()
+		return func(d *Debugger6502) int { return value }
+
+	case isIdentStart(c):
+		start := p.pos
+		for p.pos < len(p.src) && isIdentChar(p.src[p.pos]) {
+			p.pos += 1
+		}
+		name := p.src[start:p.pos]
+
+		if strings.EqualFold(name, "w") && p.pos < len(p.src) && p.src[p.pos] == '[' {
+			p.pos += 1
+			addr := p.binary(0)
+			p.expect(']')
+			return func(d *Debugger6502) int {
+				a := word(addr(d))
+				return int(d.peek(a)) | int(d.peek(a+1))<<8
+			}
+		}
+		return identNode(name)
+	}
+
+	panic(exprError{p.errorf("unexpected %q", c)})
+}
+
+func (p *exprParser) number() int {
+	start := p.pos
+	base := 10
+	switch {
+	case p.src[p.pos] == '$':
+		base = 16
+		p.pos += 1
+	case p.src[p.pos] == '%':
+		base = 2
+		p.pos += 1
+	case strings.HasPrefix(p.src[p.pos:], "0x") || strings.HasPrefix(p.src[p.pos:], "0X"):
+		base = 16
+		p.pos += 2
+	case strings.HasPrefix(p.src[p.pos:], "0b") || strings.HasPrefix(p.src[p.pos:], "0B"):
+		base = 2
+		p.pos += 2
+	}
+
+	digits := p.pos
+	for p.pos < len(p.src) && isIdentChar(p.src[p.pos]) {
+		p.pos += 1
+	}
+	value, err := strconv.ParseInt(p.src[digits:p.pos], base, 64)
+	if err != nil {
+		text := p.src[start:p.pos]
+		p.pos = start
+		panic(exprError{p.errorf("bad number %q", text)})
+	}
+	return int(value)
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '.' || c == '@' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentChar(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9')
+}
+
+func identNode(name string) exprNode {
+	switch strings.ToUpper(name) {
+	case "A":
+		return func(d *Debugger6502) int { return int(d.cpu.Registers.A) }
+	case "X":
+		return func(d *Debugger6502) int { return int(d.cpu.Registers.X) }
+	case "Y":
+		return func(d *Debugger6502) int { return int(d.cpu.Registers.Y) }
+	case "SP":
+		return func(d *Debugger6502) int { return int(d.cpu.Registers.SP) }
+	case "PC":
+		return func(d *Debugger6502) int { return int(d.cpu.Registers.PC) }
+	case "P":
+		return func(d *Debugger6502) int {
+			f := d.cpu.Flags
+			return int(f.C | f.Z<<1 | f.I<<2 | f.D<<3 | f.B<<4 | 1<<5 | f.V<<6 | f.N<<7)
+		}
+	case "N":
+		return func(d *Debugger6502) int { return int(d.cpu.Flags.N) }
+	case "V":
+		return func(d *Debugger6502) int { return int(d.cpu.Flags.V) }
+	case "B":
+		return func(d *Debugger6502) int { return int(d.cpu.Flags.B) }
+	case "D":
+		return func(d *Debugger6502) int { return int(d.cpu.Flags.D) }
+	case "I":
+		return func(d *Debugger6502) int { return int(d.cpu.Flags.I) }
+	case "Z":
+		return func(d *Debugger6502) int { return int(d.cpu.Flags.Z) }
+	case "C":
+		return func(d *Debugger6502) int { return int(d.cpu.Flags.C) }
+	}
+
+	return func(d *Debugger6502) int {
+		addr, ok := d.Symbols.Lookup(name)
+		if !ok {
+			panic(exprError{fmt.Errorf("unknown symbol %q", name)})
+		}
+		return int(addr)
+	}
+}
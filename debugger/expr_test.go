@@ -0,0 +1,157 @@
+package c6502debugger
+
+import (
+	"strings"
+	"testing"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+)
+
+func newExprDebugger() *Debugger6502 {
+	c := cpu.New()
+	c.Registers = cpu.CpuRegisters{A: 0x12, X: 0x34, Y: 0x56, SP: 0xFD, PC: 0x8000}
+	c.Flags = cpu.CpuFlags{N: 1, C: 1}
+	c.Memory[0x0010] = 0x34
+	c.Memory[0x0011] = 0x12
+	d := New(c)
+	d.Symbols.Add("reset", 0x8000)
+	d.Symbols.Add("buffer", 0x0010)
+	d.Symbols.Add("SP", 0x1234) // Hidden by the register
+	return d
+}
+
+func TestEvalExpr(t *testing.T) {
+	tests := []struct {
+		src  string
+		want int
+	}{
+		// Numbers
+		{"255", 255},
+		{"$FF", 0xFF},
+		{"0xff", 0xFF},
+		{"0XFF", 0xFF},
+		{"%1010", 10},
+		{"0b1010", 10},
+		{"'A'", 0x41},
+
+		// Registers, flags and symbols
+		{"a", 0x12},
+		{"X", 0x34},
+		{"y", 0x56},
+		{"SP", 0xFD},
+		{"pc", 0x8000},
+		{"P", 0xA1},
+		{"N", 1},
+		{"c", 1},
+		{"Z", 0},
+		{"reset", 0x8000},
+		{"reset+3", 0x8003},
+		{"pc == reset", 1},
+
+		// Memory
+		{"[$10]", 0x34},
+		{"[buffer+1]", 0x12},
+		{"w[$10]", 0x1234},
+		{"W[ buffer ]", 0x1234},
+		{"[$10] == x", 1},
+
+		// Operators and precedence
+		{"1+2*3", 7},
+		{"(1+2)*3", 9},
+		{"10 - 2 - 3", 5},
+		{"7/2", 3},
+		{"7%3", 1},
+		{"1<<4|1", 17},
+		{"a>>1", 9},
+		{"6&3", 2},
+		{"6^3", 5},
+		{"2+3==5", 1},
+		{"1 < 2 == 1", 1},
+		{"x > y", 0},
+		{"x <= $34", 1},
+		{"x >= $35", 0},
+		{"x != y", 1},
+		{"n && c", 1},
+		{"z || 0", 0},
+		{"z || a", 1},
+		{"-1", -1},
+		{"~0", -1},
+		{"!0", 1},
+		{"!a", 0},
+		{"<$1234", 0x34},
+		{">$1234", 0x12},
+		{">w[$10]", 0x12},
+	}
+
+	d := newExprDebugger()
+	for _, tt := range tests {
+		got, err := d.Evaluate(tt.src)
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q = %d, want %d", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestCompileExprErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"", "column 1: unexpected end of expression"},
+		{"1 +", "column 4: unexpected end of expression"},
+		{"(1", "column 3: expected ')'"},
+		{"[1", "column 3: expected ']'"},
+		{"w[1", "column 4: expected ']'"},
+		{"'A", "column 1: bad character literal"},
+		{"$G", "column 1: bad number \"$G\""},
+		{"0b12", "column 1: bad number \"0b12\""},
+		{"1 2", "column 3: unexpected \"2\""},
+		{"#1", "column 1: unexpected '#'"},
+		{"1 === 2", "column 5: unexpected '='"},
+		{"a)", "column 2: unexpected \")\""},
+	}
+
+	for _, tt := range tests {
+		e, err := CompileExpr(tt.src)
+		if err == nil {
+			t.Errorf("%q compiled to %v", tt.src, e)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: error %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+// Errors found while evaluating are returned, not panicked
+func TestEvalExprErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"1/0", "division by zero"},
+		{"1 % (x - $34)", "division by zero"},
+		{"missing + 1", "unknown symbol \"missing\""},
+		{"z && missing", ""}, // Not evaluated
+	}
+
+	d := newExprDebugger()
+	for _, tt := range tests {
+		e, err := CompileExpr(tt.src)
+		if err != nil {
+			t.Errorf("%q: %v", tt.src, err)
+			continue
+		}
+		_, err = e.Eval(d)
+		switch {
+		case tt.want == "" && err != nil:
+			t.Errorf("%q: %v", tt.src, err)
+		case tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)):
+			t.Errorf("%q: error %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,320 @@
+package c6502debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+)
+
+// Cycles the reset sequence takes before the first instruction
+const nestestResetCycles = 7
+
+// NestestLine formats the instruction at PC together with the current CPU state
+// in the layout of nestest.log, the reference log of the nestest ROM:
+//
+//	C000  4C F5 C5  JMP $C5F5                       A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7
+//
+// The CYC column counts from 7, the length of the reset sequence, as
+// nestest.log does, where c.Tick counts from 0. The PPU column is derived
+// from it, three dots per CPU cycle. Memory is read with Peek, so writing the
+// log does not disturb devices.
+func (d *Debugger6502) NestestLine() string {
+	c := d.cpu
+	pc := c.Registers.PC
+	raw, text := d.nestestDisassembly(pc)
+
+	hexBytes := make([]string, len(raw))
+	for i, b := range raw {
+		hexBytes[i] = fmt.Sprintf("%02X", b)
+	}
+
+	status := c.Flags.C | c.Flags.Z<<1 | c.Flags.I<<2 | c.Flags.D<<3 | 1<<5 | c.Flags.V<<6 | c.Flags.N<<7
+	cycles := c.Tick + nestestResetCycles
+	dots := cycles * 3
+	return fmt.Sprintf("%04X  %-8s  %-32sA:%02X X:%02X Y:%02X P:%02X SP:%02X PPU:%3d,%3d CYC:%d",
+		pc, strings.Join(hexBytes, " "), text, c.Registers.A, c.Registers.X, c.Registers.Y,
+		status, c.Registers.SP, (dots/341)%262, dots%341, cycles)
+}
+
+// WriteNestestLog runs count instructions, writing a nestest.log line before each one
+func (d *Debugger6502) WriteNestestLog(w io.Writer, count int) error {
+	bw := bufio.NewWriter(w)
+	for i := 0; i < count; i++ {
+		if _, err := fmt.Fprintln(bw, d.NestestLine()); err != nil {
+			return err
+		}
+		d.cpu.SingleOperation()
+		d.NumOperations += 1
+	}
+	return bw.Flush()
+}
+
+// nestestDisassembly returns the bytes of the instruction at addr and its text,
+// annotated with the effective address and the value it currently holds
+func (d *Debugger6502) nestestDisassembly(addr word) ([]byte, string) {
+	c := d.cpu
+	op := c.Peek(addr)
+	opcode, key_exists := c.Lookup(op)
+	if !key_exists {
+		return []byte{op}, fmt.Sprintf("*??? $%02X", op)
+	}
+
+	size := INSTRUCTION_MAP[opcode.AddressingMode].fetchSize
+	raw := []byte{op}
+	for i := 1; i <= size; i++ {
+		raw = append(raw, c.Peek(addr+word(i)))
+	}
+
+	var lo, hi byte
+	if size >= 1 {
+		lo = raw[1]
+	}
+	if size == 2 {
+		hi = raw[2]
+	}
+	full := word(hi)<<8 | word(lo)
+	name := opcode.FriendlyName
+	isJump := opcode.Code == cpu.OP_JMP || opcode.Code == cpu.OP_JSR
+
+	var text string
+	switch opcode.AddressingMode {
+	case cpu.ADR_IMPLICIT:
+		text = name
+	case cpu.ADR_ACCUMULATOR:
+		text = name + " A"
+	case cpu.ADR_IMMEDIATE:
+		text = fmt.Sprintf("%v #$%02X", name, lo)
+	case cpu.ADR_ZEROPAGE:
+		text = fmt.Sprintf("%v $%02X = %02X", name, lo, c.Peek(word(lo)))
+	case cpu.ADR_ZEROPAGEX:
+		effective := word(lo + c.Registers.X)
+		text = fmt.Sprintf("%v $%02X,X @ %02X = %02X", name, lo, effective, c.Peek(effective))
+	case cpu.ADR_ZEROPAGEY:
+		effective := word(lo + c.Registers.Y)
+		text = fmt.Sprintf("%v $%02X,Y @ %02X = %02X", name, lo, effective, c.Peek(effective))
+	case cpu.ADR_ABSOLUTE:
+		if isJump {
+			text = fmt.Sprintf("%v $%04X", name, full)
+		} else {
+			text = fmt.Sprintf("%v $%04X = %02X", name, full, c.Peek(full))
+		}
+	case cpu.ADR_ABSOLUTEX:
+		effective := full + word(c.Registers.X)
+		text = fmt.Sprintf("%v $%04X,X @ %04X = %02X", name, full, effective, c.Peek(effective))
+	case cpu.ADR_ABSOLUTEY:
+		effective := full + word(c.Registers.Y)
+		text = fmt.Sprintf("%v $%04X,Y @ %04X = %02X", name, full, effective, c.Peek(effective))
+	case cpu.ADR_INDIRECT:
+		// Same page wrap as the CPU
+		target := word(c.Peek((full&0xFF00)|((full+1)&0x00FF)))<<8 | word(c.Peek(full))
+		text = fmt.Sprintf("%v ($%04X) = %04X", name, full, target)
+	case cpu.ADR_INDIRECTX:
+		pointer := lo + c.Registers.X
+		effective := word(c.Peek(word(pointer+1)))<<8 | word(c.Peek(word(pointer)))
+		text = fmt.Sprintf("%v ($%02X,X) @ %02X = %04X = %02X", name, lo, pointer, effective, c.Peek(effective))
+	case cpu.ADR_INDIRECTY:
+		base := word(c.Peek(word(lo+1)))<<8 | word(c.Peek(word(lo)))
+		effective := base + word(c.Registers.Y)
+		text = fmt.Sprintf("%v ($%02X),Y = %04X @ %04X = %02X", name, lo, base, effective, c.Peek(effective))
+	case cpu.ADR_RELATIVE:
+		rel := word(lo)
+		if lo&0x80 > 0 {
+			rel |= 0xFF00
+		}
+		text = fmt.Sprintf("%v $%04X", name, addr+2+rel)
+	default:
+		// 65C02 modes, which nestest.log never shows
+		text = d.Disassemble(addr).Text
+	}
+
+	return raw, text
+}
+
+// NestestRecord is one parsed nestest.log line
+type NestestRecord struct {
+	Line        int
+	Text        string
+	PC          uint16
+	Bytes       string
+	Disassembly string
+	A           byte
+	X           byte
+	Y           byte
+	P           byte
+	SP          byte
+	PPU         string
+	Cycle       int
+}
+
+// ParseNestestLine splits a nestest.log line into its fields
+func ParseNestestLine(line string) (NestestRecord, error) {
+	rec := NestestRecord{Text: line}
+	regsAt := strings.Index(line, "A:")
+	if len(line) < 16 || regsAt < 16 {
+		return rec, fmt.Errorf("not a nestest line: %q", line)
+	}
+
+	pc, err := strconv.ParseUint(strings.TrimSpace(line[:4]), 16, 16)
+	if err != nil {
+		return rec, fmt.Errorf("bad PC in %q", line)
+	}
+	rec.PC = uint16(pc)
+	rec.Bytes = strings.TrimSpace(line[6:15])
+	rec.Disassembly = strings.TrimSpace(line[15:regsAt])
+
+	registers := map[string]*byte{"A": &rec.A, "X": &rec.X, "Y": &rec.Y, "P": &rec.P, "SP": &rec.SP}
+	fields := strings.Fields(line[regsAt:])
+	for i := 0; i < len(fields); i++ {
+		parts := strings.SplitN(fields[i], ":", 2)
+		key, value := parts[0], ""
+		if len(parts) == 2 {
+			value = parts[1]
+		}
+		switch key {
+		case "PPU":
+			// "PPU:  0, 21" is split by the padding
+			rec.PPU = value
+			for i+1 < len(fields) && !strings.Contains(fields[i+1], ":") {
+				i += 1
+				rec.PPU += fields[i]
+			}
+		case "CYC":
+			rec.Cycle, err = strconv.Atoi(value)
+		default:
+			if reg, ok := registers[key]; ok {
+				var v uint64
+				v, err = strconv.ParseUint(value, 16, 8)
+				*reg = byte(v)
+			}
+		}
+		if err != nil {
+			return rec, fmt.Errorf("bad %v field in %q", key, line)
+		}
+	}
+	return rec, nil
+}
+
+// CompareOptions chooses which nestest.log fields take part in a comparison
+type CompareOptions struct {
+	Disassembly bool // Compare the disassembly text
+	Cycles      bool // Compare the CYC column
+	PPU         bool // Compare the PPU column
+	Context     int  // Number of matching lines to show before a divergence
+}
+
+// Divergence describes the first line where two logs disagree
+type Divergence struct {
+	GotLine  NestestRecord
+	WantLine NestestRecord
+	Fields   []string
+	Context  []string // Matching lines leading up to the divergence
+	Ended    bool     // Our log ended before the reference, GotLine and Fields are empty
+}
+
+func (d *Divergence) String() string {
+	var b strings.Builder
+	for _, line := range d.Context {
+		fmt.Fprintf(&b, "        %v\n", line)
+	}
+	if d.Ended {
+		fmt.Fprintf(&b, "got       end of log\n")
+		fmt.Fprintf(&b, "want %4d %v\n", d.WantLine.Line, d.WantLine.Text)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "got  %4d %v\n", d.GotLine.Line, d.GotLine.Text)
+	fmt.Fprintf(&b, "want %4d %v\n", d.WantLine.Line, d.WantLine.Text)
+	fmt.Fprintf(&b, "differs in %v\n", strings.Join(d.Fields, ", "))
+	return b.String()
+}
+
+// CompareNestest aligns our log with a reference log, starting both at the first
+// reference line with the same PC as our first line, and returns the first
+// divergence, or nil when the logs agree. Our log may run on past the end of
+// the reference, but ending before it is a divergence.
+func CompareNestest(got io.Reader, want io.Reader, opts CompareOptions) (*Divergence, error) {
+	gotLines, err := readNestest(got)
+	if err != nil {
+		return nil, err
+	}
+	wantLines, err := readNestest(want)
+	if err != nil {
+		return nil, err
+	}
+	if len(gotLines) == 0 {
+		return nil, fmt.Errorf("log is empty")
+	}
+
+	start := -1
+	for i, rec := range wantLines {
+		if rec.PC == gotLines[0].PC {
+			start = i
+			break
+		}
+	}
+	if start < 0 {
+		return nil, fmt.Errorf("reference log never reaches $%04X", gotLines[0].PC)
+	}
+	wantLines = wantLines[start:]
+
+	var context []string
+	for i := 0; i < len(gotLines) && i < len(wantLines); i++ {
+		g, w := gotLines[i], wantLines[i]
+		if fields := diffNestest(g, w, opts); len(fields) > 0 {
+			return &Divergence{GotLine: g, WantLine: w, Fields: fields, Context: context}, nil
+		}
+
+		context = append(context, g.Text)
+		if len(context) > opts.Context {
+			context = context[1:]
+		}
+	}
+
+	if len(gotLines) < len(wantLines) {
+		return &Divergence{WantLine: wantLines[len(gotLines)], Context: context, Ended: true}, nil
+	}
+	return nil, nil
+}
+
+func diffNestest(g NestestRecord, w NestestRecord, opts CompareOptions) []string {
+	var fields []string
+	add := func(name string, differs bool) {
+		if differs {
+			fields = append(fields, name)
+		}
+	}
+
+	add("PC", g.PC != w.PC)
+	add("bytes", g.Bytes != w.Bytes)
+	add("A", g.A != w.A)
+	add("X", g.X != w.X)
+	add("Y", g.Y != w.Y)
+	add("P", g.P != w.P)
+	add("SP", g.SP != w.SP)
+	add("disassembly", opts.Disassembly && g.Disassembly != w.Disassembly)
+	add("CYC", opts.Cycles && g.Cycle != w.Cycle)
+	add("PPU", opts.PPU && g.PPU != w.PPU)
+	return fields
+}
+
+func readNestest(r io.Reader) ([]NestestRecord, error) {
+	var records []NestestRecord
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum += 1
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		rec, err := ParseNestestLine(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		rec.Line = lineNum
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,108 @@
+package c6502debugger
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The first lines of nestest.log
+var nestestLines = []string{
+	"C000  4C F5 C5  JMP $C5F5                       A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 21 CYC:7",
+	"C5F5  A2 00     LDX #$00                        A:00 X:00 Y:00 P:24 SP:FD PPU:  0, 30 CYC:10",
+	"C5F7  86 00     STX $00 = 00                    A:00 X:00 Y:00 P:26 SP:FD PPU:  0, 36 CYC:12",
+	"C5F9  86 10     STX $10 = 00                    A:00 X:00 Y:00 P:26 SP:FD PPU:  0, 45 CYC:15",
+}
+
+func TestParseNestestLine(t *testing.T) {
+	tests := []struct {
+		line    string
+		want    NestestRecord
+		wantErr string
+	}{
+		{line: nestestLines[0], want: NestestRecord{
+			PC: 0xC000, Bytes: "4C F5 C5", Disassembly: "JMP $C5F5",
+			A: 0x00, X: 0x00, Y: 0x00, P: 0x24, SP: 0xFD, PPU: "0,21", Cycle: 7,
+		}},
+		{line: "C72A  E0 40     CPX #$40                        A:40 X:3F Y:80 P:A5 SP:FB PPU:123,456 CYC:1234", want: NestestRecord{
+			PC: 0xC72A, Bytes: "E0 40", Disassembly: "CPX #$40",
+			A: 0x40, X: 0x3F, Y: 0x80, P: 0xA5, SP: 0xFB, PPU: "123,456", Cycle: 1234,
+		}},
+		{line: "C000  4C", wantErr: "not a nestest line"},
+		{line: "XYZW  4C F5 C5  JMP $C5F5                       A:00 X:00 Y:00 P:24 SP:FD CYC:7", wantErr: "bad PC"},
+		{line: "C000  4C F5 C5  JMP $C5F5                       A:GG X:00 Y:00 P:24 SP:FD CYC:7", wantErr: "bad A field"},
+		{line: "C000  4C F5 C5  JMP $C5F5                       A:00 X:00 Y:00 P:24 SP:FD CYC:x", wantErr: "bad CYC field"},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseNestestLine(tt.line)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: error %v, want %q", tt.line, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.line, err)
+			continue
+		}
+		tt.want.Text = tt.line
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q parsed to %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestCompareNestest(t *testing.T) {
+	reference := strings.Join(nestestLines, "\n") + "\n"
+	changed := func(i int, old, new string) []string {
+		lines := append([]string(nil), nestestLines...)
+		lines[i] = strings.Replace(lines[i], old, new, 1)
+		return lines
+	}
+
+	tests := []struct {
+		name       string
+		got        []string
+		opts       CompareOptions
+		wantFields []string // nil when the logs should match
+		wantLine   int
+		ended      bool
+		wantErr    string
+	}{
+		{name: "match", got: nestestLines},
+		{name: "later start", got: nestestLines[1:]},
+		{name: "longer than the reference", got: append(append([]string(nil), nestestLines...), nestestLines[3])},
+		{name: "register", got: changed(2, "P:26", "P:27"), wantFields: []string{"P"}, wantLine: 3},
+		{name: "several fields", got: changed(1, "A:00 X:00", "A:01 X:02"), wantFields: []string{"A", "X"}, wantLine: 2},
+		{name: "cycles ignored", got: changed(1, "CYC:10", "CYC:11")},
+		{name: "cycles", got: changed(1, "CYC:10", "CYC:11"), opts: CompareOptions{Cycles: true}, wantFields: []string{"CYC"}, wantLine: 2},
+		{name: "PPU", got: changed(3, "0, 45", "0, 46"), opts: CompareOptions{PPU: true}, wantFields: []string{"PPU"}, wantLine: 4},
+		{name: "truncated", got: nestestLines[:2], wantLine: 3, ended: true},
+		{name: "empty", got: nil, wantErr: "log is empty"},
+		{name: "unknown start", got: changed(0, "C000", "D000")[:1], wantErr: "never reaches $D000"},
+	}
+
+	for _, tt := range tests {
+		got := strings.Join(tt.got, "\n")
+		d, err := CompareNestest(strings.NewReader(got), strings.NewReader(reference), tt.opts)
+		switch {
+		case tt.wantErr != "":
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%v: error %v, want %q", tt.name, err, tt.wantErr)
+			}
+		case err != nil:
+			t.Errorf("%v: %v", tt.name, err)
+		case tt.wantFields == nil && !tt.ended:
+			if d != nil {
+				t.Errorf("%v: unexpected divergence\n%v", tt.name, d)
+			}
+		case d == nil:
+			t.Errorf("%v: no divergence", tt.name)
+		default:
+			if !reflect.DeepEqual(d.Fields, tt.wantFields) || d.WantLine.Line != tt.wantLine || d.Ended != tt.ended {
+				t.Errorf("%v: divergence at reference line %d in %v, ended %v", tt.name, d.WantLine.Line, d.Fields, d.Ended)
+			}
+		}
+	}
+}
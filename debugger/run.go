@@ -0,0 +1,261 @@
+package c6502debugger
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+)
+
+// Reasons execution stopped
+const (
+	STOP_STEP           byte = iota // A single step completed
+	STOP_BREAKPOINT                 // PC reached an enabled breakpoint
+	STOP_TARGET                     // PC reached the address given to RunTo
+	STOP_RETURN                     // The subroutine or interrupt handler returned
+	STOP_CYCLES                     // The cycle budget given to RunFor ran out
+	STOP_PAUSED                     // Pause was called
+	STOP_NO_FRAME                   // StepOut was called outside any subroutine
+	STOP_UNKNOWN_OPCODE             // The CPU hit an opcode it does not implement
+	STOP_TRAP                       // The program jumped or branched to itself
+)
+
+var stopNames = [...]string{"step", "breakpoint", "reached target", "returned", "cycle limit", "paused", "no frame to step out of", "unknown opcode", "trapped"}
+
+// Stop describes why and where a run ended
+type Stop struct {
+	Reason       byte
+	PC           word
+	Instructions int // Instructions run, including interrupt entries
+	Cycles       int
+	Breakpoint   *Breakpoint
+	Panic        interface{}
+}
+
+// ReasonName returns a short name for the stop reason, such as "breakpoint"
+func (s Stop) ReasonName() string {
+	return stopNames[s.Reason]
+}
+
+func (s Stop) String() string {
+	switch s.Reason {
+	case STOP_BREAKPOINT:
+		return fmt.Sprintf("breakpoint at $%04X after %d instructions (%d cycles)", s.PC, s.Instructions, s.Cycles)
+	case STOP_UNKNOWN_OPCODE:
+		return fmt.Sprintf("unknown opcode at $%04X after %d instructions: %v", s.PC, s.Instructions, s.Panic)
+	}
+	return fmt.Sprintf("%v at $%04X after %d instructions (%d cycles)", stopNames[s.Reason], s.PC, s.Instructions, s.Cycles)
+}
+
+type Breakpoint struct {
+	Addr      word
+	Enabled   bool
+	Condition *Expr // Only break when this is non zero, a failing condition always breaks
+	Hits      int
+}
+
+// SetCondition compiles src as the breakpoint's condition, an empty src removes it
+func (bp *Breakpoint) SetCondition(src string) error {
+	if strings.TrimSpace(src) == "" {
+		bp.Condition = nil
+		return nil
+	}
+
+	e, err := CompileExpr(src)
+	if err != nil {
+		return err
+	}
+	bp.Condition = e
+	return nil
+}
+
+func (bp *Breakpoint) triggered(d *Debugger6502) bool {
+	if !bp.Enabled {
+		return false
+	}
+	if bp.Condition == nil {
+		return true
+	}
+	value, err := bp.Condition.Eval(d)
+	return err != nil || value != 0
+}
+
+// Watch is an expression shown each time execution stops
+type Watch struct {
+	Expr  *Expr
+	Value int
+	Err   error
+}
+
+// AddWatch compiles src and adds it to the watch list
+func (d *Debugger6502) AddWatch(src string) (*Watch, error) {
+	e, err := CompileExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	w := &Watch{Expr: e}
+	w.Value, w.Err = e.Eval(d)
+	d.Watches = append(d.Watches, w)
+	return w, nil
+}
+
+func (d *Debugger6502) RemoveWatch(w *Watch) {
+	for i, watch := range d.Watches {
+		if watch == w {
+			d.Watches = append(d.Watches[:i:i], d.Watches[i+1:]...)
+			return
+		}
+	}
+}
+
+// UpdateWatches re-evaluates every watch, runs do this when they stop
+func (d *Debugger6502) UpdateWatches() {
+	for _, w := range d.Watches {
+		w.Value, w.Err = w.Expr.Eval(d)
+	}
+}
+
+// AddBreakpoint sets an enabled breakpoint at addr, or returns the one already there
+func (d *Debugger6502) AddBreakpoint(addr word) *Breakpoint {
+	if d.breakpoints == nil {
+		d.breakpoints = map[word]*Breakpoint{}
+	}
+	if bp, exists := d.breakpoints[addr]; exists {
+		return bp
+	}
+	bp := &Breakpoint{Addr: addr, Enabled: true}
+	d.breakpoints[addr] = bp
+	return bp
+}
+
+func (d *Debugger6502) RemoveBreakpoint(addr word) {
+	delete(d.breakpoints, addr)
+}
+
+// Breakpoints returns every breakpoint ordered by address
+func (d *Debugger6502) Breakpoints() []*Breakpoint {
+	bps := make([]*Breakpoint, 0, len(d.breakpoints))
+	for _, bp := range d.breakpoints {
+		bps = append(bps, bp)
+	}
+	sort.Slice(bps, func(i, j int) bool { return bps[i].Addr < bps[j].Addr })
+	return bps
+}
+
+// CheckBreakpoint returns the breakpoint at PC if it is enabled and its condition
+// holds, counting the hit. Front ends that run the CPU in slices call this
+// between slices, since each run ignores the breakpoint it starts on.
+func (d *Debugger6502) CheckBreakpoint() *Breakpoint {
+	bp, exists := d.breakpoints[d.cpu.Registers.PC]
+	if !exists || !bp.triggered(d) {
+		return nil
+	}
+	bp.Hits += 1
+	return bp
+}
+
+// Pause makes the current run stop before its next instruction. It is safe to
+// call from another goroutine.
+func (d *Debugger6502) Pause() {
+	atomic.StoreInt32(&d.paused, 1)
+}
+
+// Step runs a single instruction
+func (d *Debugger6502) Step() Stop {
+	return d.run(func() bool { return true }, STOP_STEP, 0)
+}
+
+// StepOver runs a JSR through to its return, any other instruction is a single step
+func (d *Debugger6502) StepOver() Stop {
+	c := d.cpu
+	op, key_exists := c.Lookup(d.peek(c.Registers.PC))
+	if !key_exists || op.Code != cpu.OP_JSR {
+		return d.Step()
+	}
+
+	ret := c.Registers.PC + 3
+	sp := c.Registers.SP
+	return d.run(func() bool {
+		return c.Registers.PC == ret && c.Registers.SP == sp
+	}, STOP_RETURN, 0)
+}
+
+// StepOut runs until the innermost subroutine or interrupt handler returns
+func (d *Debugger6502) StepOut() Stop {
+	depth := d.Calls.Depth()
+	if depth == 0 {
+		return Stop{Reason: STOP_NO_FRAME, PC: d.cpu.Registers.PC}
+	}
+	return d.run(func() bool { return d.Calls.Depth() < depth }, STOP_RETURN, 0)
+}
+
+// RunTo runs until PC reaches addr, always running at least one instruction
+func (d *Debugger6502) RunTo(addr word) Stop {
+	return d.run(func() bool { return d.cpu.Registers.PC == addr }, STOP_TARGET, 0)
+}
+
+// RunFor runs whole instructions until at least cycles have passed, or until a
+// breakpoint when cycles is zero
+func (d *Debugger6502) RunFor(cycles int) Stop {
+	return d.run(func() bool { return false }, STOP_CYCLES, cycles)
+}
+
+// RunUntilTrap runs until the program jumps or branches to itself, the way test
+// programs signal they have finished, or until cycles have passed when non zero
+func (d *Debugger6502) RunUntilTrap(cycles int) Stop {
+	last := d.cpu.Registers.PC
+	return d.run(func() bool {
+		pc := d.cpu.Registers.PC
+		trapped := pc == last
+		last = pc
+		return trapped
+	}, STOP_TRAP, cycles)
+}
+
+// Continue runs until a breakpoint is hit or Pause is called
+func (d *Debugger6502) Continue() Stop {
+	return d.run(func() bool { return false }, STOP_PAUSED, 0)
+}
+
+// run traces instructions until done reports true, a breakpoint is reached or
+// the cycle budget runs out. The breakpoint at the starting PC is ignored so
+// that a run can continue from a breakpoint.
+func (d *Debugger6502) run(done func() bool, reason byte, cycles int) (stop Stop) {
+	c := d.cpu
+	start := c.Tick
+	atomic.StoreInt32(&d.paused, 0)
+
+	defer func() {
+		if r := recover(); r != nil {
+			// Only an unknown opcode is a reason to stop, anything else is a bug
+			if r != cpu.UNKNOWN_OPCODE_PANIC {
+				panic(r)
+			}
+			stop = Stop{STOP_UNKNOWN_OPCODE, c.Registers.PC - 1, stop.Instructions, c.Tick - start, nil, r}
+		}
+		d.UpdateWatches()
+	}()
+
+	for {
+		if stop.Instructions > 0 {
+			if atomic.LoadInt32(&d.paused) != 0 {
+				return Stop{STOP_PAUSED, c.Registers.PC, stop.Instructions, c.Tick - start, nil, nil}
+			}
+			if bp := d.CheckBreakpoint(); bp != nil {
+				return Stop{STOP_BREAKPOINT, c.Registers.PC, stop.Instructions, c.Tick - start, bp, nil}
+			}
+		}
+
+		d.Trace()
+		stop.Instructions += 1
+
+		if done() {
+			return Stop{reason, c.Registers.PC, stop.Instructions, c.Tick - start, nil, nil}
+		}
+		if cycles > 0 && c.Tick-start >= cycles {
+			return Stop{STOP_CYCLES, c.Registers.PC, stop.Instructions, c.Tick - start, nil, nil}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package c6502debugger
+
+import (
+	"testing"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+)
+
+// A main program calling a subroutine that calls another, then counting down
+// and trapping, with an unknown opcode out of the way at $0230
+var runProgram = map[word][]byte{
+	0x0200: {0x20, 0x10, 0x02}, // JSR $0210
+	0x0203: {0xA2, 0x05},       // LDX #$05
+	0x0205: {0xCA},             // DEX
+	0x0206: {0xD0, 0xFD},       // BNE $0205
+	0x0208: {0x4C, 0x08, 0x02}, // JMP $0208
+	0x0210: {0xA9, 0x01},       // LDA #$01
+	0x0212: {0x20, 0x20, 0x02}, // JSR $0220
+	0x0215: {0x60},             // RTS
+	0x0220: {0xC8},             // INY
+	0x0221: {0x60},             // RTS
+	0x0230: {0x02},             // Not implemented
+}
+
+func newRunDebugger() *Debugger6502 {
+	c := cpu.New()
+	for addr, code := range runProgram {
+		copy(c.Memory[addr:], code)
+	}
+	c.Registers.PC = 0x0200
+	c.Registers.SP = 0xFD
+	return New(c)
+}
+
+func checkStop(t *testing.T, name string, got Stop, reason byte, pc word, instructions int) {
+	t.Helper()
+	if got.Reason != reason || got.PC != pc || got.Instructions != instructions {
+		t.Errorf("%v stopped with %v at $%04X after %d instructions, want %v at $%04X after %d",
+			name, got.ReasonName(), got.PC, got.Instructions, stopNames[reason], pc, instructions)
+	}
+}
+
+func TestStep(t *testing.T) {
+	d := newRunDebugger()
+	stop := d.Step()
+	checkStop(t, "Step", stop, STOP_STEP, 0x0210, 1)
+	if stop.Cycles != 6 {
+		t.Errorf("JSR took %d cycles, want 6", stop.Cycles)
+	}
+
+	// A breakpoint at the starting PC does not stop a step
+	d.AddBreakpoint(0x0210)
+	checkStop(t, "Step from a breakpoint", d.Step(), STOP_STEP, 0x0212, 1)
+}
+
+func TestStepOver(t *testing.T) {
+	d := newRunDebugger()
+	checkStop(t, "StepOver JSR", d.StepOver(), STOP_RETURN, 0x0203, 6)
+	if d.cpu.Registers.Y != 1 {
+		t.Errorf("Y=%d, the nested subroutine did not run", d.cpu.Registers.Y)
+	}
+	checkStop(t, "StepOver LDX", d.StepOver(), STOP_STEP, 0x0205, 1)
+
+	// A breakpoint inside the subroutine stops it
+	d = newRunDebugger()
+	d.AddBreakpoint(0x0220)
+	checkStop(t, "StepOver to a breakpoint", d.StepOver(), STOP_BREAKPOINT, 0x0220, 3)
+}
+
+func TestStepOut(t *testing.T) {
+	d := newRunDebugger()
+	checkStop(t, "StepOut of main", d.StepOut(), STOP_NO_FRAME, 0x0200, 0)
+
+	d.Step() // JSR $0210
+	d.Step() // LDA
+	d.Step() // JSR $0220
+	if depth := d.Calls.Depth(); depth != 2 {
+		t.Fatalf("call depth %d, want 2", depth)
+	}
+	checkStop(t, "StepOut of the inner subroutine", d.StepOut(), STOP_RETURN, 0x0215, 2)
+	checkStop(t, "StepOut of the outer subroutine", d.StepOut(), STOP_RETURN, 0x0203, 1)
+}
+
+func TestRunTo(t *testing.T) {
+	d := newRunDebugger()
+	// JSR, LDA, JSR, INY, RTS, RTS, LDX then five DEX and BNE
+	checkStop(t, "RunTo", d.RunTo(0x0208), STOP_TARGET, 0x0208, 17)
+	if d.cpu.Registers.X != 0 {
+		t.Errorf("X=%d, want 0", d.cpu.Registers.X)
+	}
+
+	// Running to where PC already is goes round the trap once
+	checkStop(t, "RunTo the trap", d.RunTo(0x0208), STOP_TARGET, 0x0208, 1)
+}
+
+func TestRunFor(t *testing.T) {
+	d := newRunDebugger()
+	// JSR and LDA take 8 cycles, the second JSR takes it past 10
+	stop := d.RunFor(10)
+	checkStop(t, "RunFor", stop, STOP_CYCLES, 0x0220, 3)
+	if stop.Cycles != 14 {
+		t.Errorf("ran %d cycles, want 14", stop.Cycles)
+	}
+
+	d = newRunDebugger()
+	d.AddBreakpoint(0x0205).SetCondition("x == 3")
+	checkStop(t, "RunFor to a conditional breakpoint", d.RunFor(0), STOP_BREAKPOINT, 0x0205, 11)
+}
+
+func TestRunUnknownOpcode(t *testing.T) {
+	d := newRunDebugger()
+	d.cpu.Registers.PC = 0x0230
+	stop := d.Step()
+	// The opcode is not counted, it never ran
+	checkStop(t, "Step", stop, STOP_UNKNOWN_OPCODE, 0x0230, 0)
+	if stop.Panic != cpu.UNKNOWN_OPCODE_PANIC {
+		t.Errorf("panic %v", stop.Panic)
+	}
+}
+
+// Panics other than an unknown opcode are bugs and are not turned into stops
+func TestRunRepanics(t *testing.T) {
+	d := newRunDebugger()
+	d.cpu.AddHooks(&cpu.Hooks{
+		BeforeInstruction: func(c *cpu.Cpu6502, pc uint16, opcode byte) {
+			panic("hook failed")
+		},
+	})
+
+	defer func() {
+		if r := recover(); r != "hook failed" {
+			t.Errorf("recovered %v, want the hook's panic", r)
+		}
+	}()
+	stop := d.Step()
+	t.Errorf("Step returned %v", stop)
+}
@@ -0,0 +1,173 @@
+package c6502debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+)
+
+// TraceSink receives the trace of each instruction run by the debugger. Sinks
+// own the Trace they are given, it is never modified after Record returns.
+type TraceSink interface {
+	Record(t Trace)
+}
+
+// String formats the trace as a single line
+func (t Trace) String() string {
+	status := t.Flags.C | t.Flags.Z<<1 | t.Flags.I<<2 | t.Flags.D<<3 | 1<<5 | t.Flags.V<<6 | t.Flags.N<<7
+	return fmt.Sprintf("%8d $%04X  %-16s A:%02X X:%02X Y:%02X SP:%02X P:%02X CYC:%d",
+		t.NumOperations, t.PC, t.Op, t.Registers.A, t.Registers.X, t.Registers.Y, t.Registers.SP, status, t.Clock)
+}
+
+// RingBuffer keeps the most recent traces, dropping the oldest once full
+type RingBuffer struct {
+	traces []Trace
+	next   int
+	full   bool
+}
+
+func NewRingBuffer(size int) *RingBuffer {
+	if size < 1 {
+		size = 1
+	}
+	return &RingBuffer{traces: make([]Trace, size)}
+}
+
+func (r *RingBuffer) Record(t Trace) {
+	r.traces[r.next] = t
+	r.next += 1
+	if r.next == len(r.traces) {
+		r.next = 0
+		r.full = true
+	}
+}
+
+// Len returns the number of traces currently held
+func (r *RingBuffer) Len() int {
+	if r.full {
+		return len(r.traces)
+	}
+	return r.next
+}
+
+// Traces returns the held traces, oldest first
+func (r *RingBuffer) Traces() []Trace {
+	if !r.full {
+		return append([]Trace(nil), r.traces[:r.next]...)
+	}
+	out := make([]Trace, 0, len(r.traces))
+	out = append(out, r.traces[r.next:]...)
+	return append(out, r.traces[:r.next]...)
+}
+
+// Reset empties the buffer
+func (r *RingBuffer) Reset() {
+	r.next = 0
+	r.full = false
+}
+
+// TraceWriter writes one line per trace. Write errors are kept and returned by
+// Flush, after which further traces are dropped.
+type TraceWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+func NewTraceWriter(w io.Writer) *TraceWriter {
+	return &TraceWriter{w: bufio.NewWriter(w)}
+}
+
+func (tw *TraceWriter) Record(t Trace) {
+	if tw.err != nil {
+		return
+	}
+	_, tw.err = fmt.Fprintln(tw.w, t.String())
+}
+
+// Flush writes out any buffered lines and reports the first write error
+func (tw *TraceWriter) Flush() error {
+	if tw.err != nil {
+		return tw.err
+	}
+	return tw.w.Flush()
+}
+
+// ChannelSink sends traces on C. When Block is false, traces that don't fit in
+// the channel buffer are dropped and counted instead of stalling the CPU.
+type ChannelSink struct {
+	C       chan Trace
+	Block   bool
+	Dropped int
+}
+
+func NewChannelSink(buffer int, block bool) *ChannelSink {
+	return &ChannelSink{C: make(chan Trace, buffer), Block: block}
+}
+
+func (cs *ChannelSink) Record(t Trace) {
+	if cs.Block {
+		cs.C <- t
+		return
+	}
+
+	select {
+	case cs.C <- t:
+	default:
+		cs.Dropped += 1
+	}
+}
+
+// TraceFilter decides whether a trace is passed on
+type TraceFilter func(t Trace) bool
+
+type filteredSink struct {
+	sink    TraceSink
+	filters []TraceFilter
+}
+
+// Filter returns a sink that only passes traces accepted by every filter on to sink
+func Filter(sink TraceSink, filters ...TraceFilter) TraceSink {
+	return &filteredSink{sink, filters}
+}
+
+func (f *filteredSink) Record(t Trace) {
+	for _, accept := range f.filters {
+		if !accept(t) {
+			return
+		}
+	}
+	f.sink.Record(t)
+}
+
+// AddressRange accepts instructions located between lo and hi inclusive
+func AddressRange(lo word, hi word) TraceFilter {
+	return func(t Trace) bool {
+		return t.PC >= lo && t.PC <= hi
+	}
+}
+
+// Opcodes accepts instructions with one of the given operations, such as
+// cpu.OP_LDA, on any CPU variant
+func Opcodes(ops ...byte) TraceFilter {
+	var accepted [256]bool
+	for _, table := range []map[uint8]cpu.Opcode{cpu.Opcodes, cpu.Opcodes65C02} {
+		for code, opcode := range table {
+			for _, op := range ops {
+				if opcode.Code == op {
+					accepted[code] = true
+				}
+			}
+		}
+	}
+
+	return func(t Trace) bool {
+		return accepted[t.Code]
+	}
+}
+
+// Subroutines accepts only JSR and RTS
+func Subroutines() TraceFilter {
+	return Opcodes(cpu.OP_JSR, cpu.OP_RTS)
+}
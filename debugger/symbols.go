@@ -0,0 +1,151 @@
+package c6502debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Symbols maps names to addresses and back
+type Symbols struct {
+	byName map[string]word
+	byAddr map[word]string
+	sorted []word
+}
+
+func NewSymbols() *Symbols {
+	return &Symbols{byName: map[string]word{}, byAddr: map[word]string{}}
+}
+
+// SymbolsFromMap builds a table from a name to value map, such as a linked image's symbols
+func SymbolsFromMap(m map[string]int) *Symbols {
+	s := NewSymbols()
+	for name, value := range m {
+		s.Add(name, word(value))
+	}
+	return s
+}
+
+// Add defines name at addr. When several names share an address the
+// alphabetically first one is used to label it.
+func (s *Symbols) Add(name string, addr word) {
+	old, exists := s.byName[name]
+	s.byName[name] = addr
+	if exists && s.byAddr[old] == name {
+		// The name moved, so the old address goes to the next name there, if any
+		s.relabel(old)
+	}
+	if current, exists := s.byAddr[addr]; !exists || name < current {
+		s.byAddr[addr] = name
+	}
+	s.sorted = nil
+}
+
+// relabel picks the alphabetically first name left at addr
+func (s *Symbols) relabel(addr word) {
+	delete(s.byAddr, addr)
+	for name, a := range s.byName {
+		if current, exists := s.byAddr[addr]; a == addr && (!exists || name < current) {
+			s.byAddr[addr] = name
+		}
+	}
+}
+
+// Lookup returns the address of name
+func (s *Symbols) Lookup(name string) (word, bool) {
+	addr, ok := s.byName[name]
+	return addr, ok
+}
+
+// Name returns the symbol at exactly addr
+func (s *Symbols) Name(addr word) (string, bool) {
+	name, ok := s.byAddr[addr]
+	return name, ok
+}
+
+// Len returns the number of names defined
+func (s *Symbols) Len() int {
+	return len(s.byName)
+}
+
+// Format labels addr with the closest symbol at or below it, such as "print+$3".
+// Addresses with no symbol below them are shown as "$ABCD".
+func (s *Symbols) Format(addr word) string {
+	if s == nil || len(s.byAddr) == 0 {
+		return fmt.Sprintf("$%04X", addr)
+	}
+	if s.sorted == nil {
+		for a := range s.byAddr {
+			s.sorted = append(s.sorted, a)
+		}
+		sort.Slice(s.sorted, func(i, j int) bool { return s.sorted[i] < s.sorted[j] })
+	}
+
+	i := sort.Search(len(s.sorted), func(i int) bool { return s.sorted[i] > addr }) - 1
+	if i < 0 {
+		return fmt.Sprintf("$%04X", addr)
+	}
+	base := s.sorted[i]
+	if base == addr {
+		return s.byAddr[base]
+	}
+	return fmt.Sprintf("%v+$%X", s.byAddr[base], addr-base)
+}
+
+// ReadSymbols adds the symbols of a label file. Each line is one of
+//
+//	al C:1234 .name      VICE label file, as written by ld65 -Ln
+//	name = $1234
+//	$1234 name
+//
+// Blank lines and lines starting with ';' or '#' are skipped.
+func (s *Symbols) ReadSymbols(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	line_num := 0
+	for scanner.Scan() {
+		line_num += 1
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		var name, value string
+		fields := strings.Fields(line)
+		switch {
+		case fields[0] == "al" && len(fields) == 3:
+			value = strings.TrimPrefix(fields[1], "C:")
+			name = strings.TrimPrefix(fields[2], ".")
+			value = "$" + value
+		case len(fields) == 3 && fields[1] == "=":
+			name, value = fields[0], fields[2]
+		case len(fields) == 2:
+			value, name = fields[0], fields[1]
+		default:
+			return fmt.Errorf("line %d: unrecognised symbol %q", line_num, line)
+		}
+
+		addr, err := parseSymbolValue(value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", line_num, err)
+		}
+		s.Add(name, addr)
+	}
+	return scanner.Err()
+}
+
+func parseSymbolValue(value string) (word, error) {
+	var n uint64
+	var err error
+	if strings.HasPrefix(value, "$") {
+		n, err = strconv.ParseUint(value[1:], 16, 16)
+	} else {
+		n, err = strconv.ParseUint(value, 0, 16)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("bad address %q", value)
+	}
+	return word(n), nil
+}
@@ -0,0 +1,127 @@
+package c6502debugger
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSymbolsAdd(t *testing.T) {
+	s := NewSymbols()
+	s.Add("start", 0x8000)
+	s.Add("reset", 0x8000)
+	s.Add("loop", 0x8010)
+
+	// The alphabetically first name labels a shared address
+	if name, _ := s.Name(0x8000); name != "reset" {
+		t.Errorf("$8000 is labelled %q, want reset", name)
+	}
+
+	// Moving the label of an address hands it to the next name there
+	s.Add("reset", 0x9000)
+	if name, ok := s.Name(0x8000); name != "start" || !ok {
+		t.Errorf("after moving reset, $8000 is labelled %q, want start", name)
+	}
+	if name, _ := s.Name(0x9000); name != "reset" {
+		t.Errorf("$9000 is labelled %q, want reset", name)
+	}
+
+	// Moving the only name leaves the address unlabelled
+	s.Add("loop", 0x8020)
+	if name, ok := s.Name(0x8010); ok {
+		t.Errorf("$8010 is still labelled %q", name)
+	}
+
+	// Moving a name that does not label its address leaves the label alone
+	s.Add("end", 0x9000)
+	s.Add("reset", 0x9010)
+	if name, _ := s.Name(0x9000); name != "end" {
+		t.Errorf("$9000 is labelled %q, want end", name)
+	}
+	s.Add("zzz", 0x9000)
+	s.Add("zzz", 0xA000)
+	if name, _ := s.Name(0x9000); name != "end" {
+		t.Errorf("after moving zzz, $9000 is labelled %q, want end", name)
+	}
+
+	// Adding a name again at the same address keeps it
+	s.Add("start", 0x8000)
+	if name, _ := s.Name(0x8000); name != "start" {
+		t.Errorf("$8000 is labelled %q, want start", name)
+	}
+
+	if addr, ok := s.Lookup("reset"); addr != 0x9010 || !ok {
+		t.Errorf("reset is at $%04X, %v", addr, ok)
+	}
+	if _, ok := s.Lookup("missing"); ok {
+		t.Errorf("found a symbol that was never added")
+	}
+	if s.Len() != 5 {
+		t.Errorf("%d names, want 5", s.Len())
+	}
+}
+
+func TestSymbolsFormat(t *testing.T) {
+	var none *Symbols
+	if got := none.Format(0x1234); got != "$1234" {
+		t.Errorf("no symbols formatted $1234 as %q", got)
+	}
+
+	s := SymbolsFromMap(map[string]int{"print": 0xC000, "main": 0xC100})
+	tests := []struct {
+		addr word
+		want string
+	}{
+		{0xBFFF, "$BFFF"},
+		{0xC000, "print"},
+		{0xC005, "print+$5"},
+		{0xC100, "main"},
+		{0xC1FF, "main+$FF"},
+	}
+	for _, tt := range tests {
+		if got := s.Format(tt.addr); got != tt.want {
+			t.Errorf("$%04X formatted as %q, want %q", tt.addr, got, tt.want)
+		}
+	}
+
+	// Adding a name is seen by the next Format
+	s.Add("loop", 0xC004)
+	if got := s.Format(0xC005); got != "loop+$1" {
+		t.Errorf("$C005 formatted as %q after adding loop, want loop+$1", got)
+	}
+}
+
+func TestReadSymbols(t *testing.T) {
+	s := NewSymbols()
+	err := s.ReadSymbols(strings.NewReader(`; comment
+# another
+al C:C000 .print
+main = $C100
+buffer = 512
+
+$0010 ptr
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]word{"print": 0xC000, "main": 0xC100, "buffer": 0x0200, "ptr": 0x0010}
+	for name, addr := range want {
+		if got, ok := s.Lookup(name); got != addr || !ok {
+			t.Errorf("%v is $%04X, want $%04X", name, got, addr)
+		}
+	}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"one two three four", "line 1: unrecognised symbol"},
+		{"\nname = $10000", "line 2: bad address \"$10000\""},
+		{"$XYZ name", "line 1: bad address \"$XYZ\""},
+	}
+	for _, tt := range tests {
+		err := NewSymbols().ReadSymbols(strings.NewReader(tt.text))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%q: error %v, want %q", tt.text, err, tt.want)
+		}
+	}
+}
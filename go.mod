@@ -1,3 +1,3 @@
 module izzudinhafiz.com/go-6502
 
-go 1.17
+go 1.18
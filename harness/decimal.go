@@ -0,0 +1,238 @@
+package harness
+
+import (
+	"fmt"
+
+	cpu6502 "izzudinhafiz.com/go-6502/cpu"
+	loader "izzudinhafiz.com/go-6502/loader"
+)
+
+// DecimalTest describes a build of Bruce Clark's decimal mode test, as adapted
+// in Klaus Dormann's 6502_decimal_test. The test ends by trapping or by executing
+// an opcode the NMOS 6502 does not have, and leaves 0 in ErrorAddr when it passed.
+type DecimalTest struct {
+	Path      string
+	LoadAddr  int
+	StartAddr uint16
+	ErrorAddr uint16
+	Limit     int
+}
+
+var DefaultDecimalTest = DecimalTest{
+	Path:      "6502_decimal_test.bin",
+	LoadAddr:  0x0200,
+	StartAddr: 0x0200,
+	ErrorAddr: 0x000B,
+	Limit:     100_000_000,
+}
+
+// DecimalResult is the outcome of a decimal test run
+type DecimalResult struct {
+	Passed bool
+	Error  byte
+	Stop   Stop
+}
+
+func (r DecimalResult) String() string {
+	if r.Passed {
+		return fmt.Sprintf("passed after %d instructions (%d cycles)", r.Stop.Instructions, r.Stop.Cycles)
+	}
+	switch r.Stop.Reason {
+	case STOP_LIMIT:
+		return fmt.Sprintf("did not finish within %d instructions, PC $%04X", r.Stop.Instructions, r.Stop.PC)
+	case STOP_UNKNOWN_OPCODE:
+		return fmt.Sprintf("unknown opcode at $%04X: %v", r.Stop.PC, r.Stop.Panic)
+	}
+	return fmt.Sprintf("failed with error byte $%02X, stopped at $%04X", r.Error, r.Stop.PC)
+}
+
+func (t DecimalTest) Run() (DecimalResult, error) {
+	img, err := loader.LoadFile(t.Path, loader.Options{Format: loader.FORMAT_RAW, Addr: t.LoadAddr})
+	if err != nil {
+		return DecimalResult{}, err
+	}
+
+	c := cpu6502.New()
+	if err := img.LoadInto(c); err != nil {
+		return DecimalResult{}, err
+	}
+	c.Registers.PC = t.StartAddr
+
+	stop := RunUntilTrap(c, t.Limit)
+	errorByte := c.Read(t.ErrorAddr)
+	return DecimalResult{
+		Passed: stop.Reason == STOP_TRAP && errorByte == 0,
+		Error:  errorByte,
+		Stop:   stop,
+	}, nil
+}
+
+// DecimalMismatch records an ADC or SBC that disagreed with the reference model
+type DecimalMismatch struct {
+	Op       string
+	A        byte
+	Operand  byte
+	Carry    byte
+	Got      DecimalOutcome
+	Expected DecimalOutcome
+}
+
+// DecimalOutcome is the accumulator and flags after a decimal mode ADC or SBC
+type DecimalOutcome struct {
+	A byte
+	N byte
+	V byte
+	Z byte
+	C byte
+}
+
+func (m DecimalMismatch) String() string {
+	return fmt.Sprintf("%v A=$%02X operand=$%02X C=%d: got %+v, expected %+v", m.Op, m.A, m.Operand, m.Carry, m.Got, m.Expected)
+}
+
+// CheckDecimalMode runs ADC and SBC in decimal mode for every accumulator,
+// operand and carry combination, the same ground Bruce Clark's test covers,
+// and compares the results against his description of the NMOS 6502 or,
+// for VARIANT_65C02, of the 65C02.
+func CheckDecimalMode(variant byte) []DecimalMismatch {
+	var mismatches []DecimalMismatch
+	c := cpu6502.New()
+	c.Variant = variant
+
+	adcReference, sbcReference := referenceDecimalADC, referenceDecimalSBC
+	if variant == cpu6502.VARIANT_65C02 {
+		adcReference, sbcReference = referenceDecimalADC65C02, referenceDecimalSBC65C02
+	}
+	for _, op := range []struct {
+		name      string
+		opcode    byte
+		reference func(a, b, carry byte) DecimalOutcome
+	}{{"ADC", 0x69, adcReference}, {"SBC", 0xE9, sbcReference}} {
+		for carry := 0; carry < 2; carry++ {
+			for a := 0; a < 256; a++ {
+				for b := 0; b < 256; b++ {
+					c.Memory[0x0200] = op.opcode
+					c.Memory[0x0201] = byte(b)
+					c.Registers.PC = 0x0200
+					c.Registers.A = byte(a)
+					c.Flags.C = byte(carry)
+					c.Flags.D = 1
+					c.SingleOperation()
+
+					got := DecimalOutcome{c.Registers.A, c.Flags.N, c.Flags.V, c.Flags.Z, c.Flags.C}
+					expected := op.reference(byte(a), byte(b), byte(carry))
+					if variant == cpu6502.VARIANT_2A03 {
+						expected = referenceBinary(op.opcode, byte(a), byte(b), byte(carry))
+					}
+					if got != expected {
+						mismatches = append(mismatches, DecimalMismatch{op.name, byte(a), byte(b), byte(carry), got, expected})
+					}
+				}
+			}
+		}
+	}
+
+	return mismatches
+}
+
+// referenceDecimalADC follows sequences 1 and 2 of Appendix A in
+// http://www.6502.org/tutorials/decimal_mode.html
+func referenceDecimalADC(a, b, carry byte) DecimalOutcome {
+	var out DecimalOutcome
+
+	al := int(a&0x0F) + int(b&0x0F) + int(carry)
+	if al >= 0x0A {
+		al = ((al + 0x06) & 0x0F) + 0x10
+	}
+
+	sum := int(a&0xF0) + int(b&0xF0) + al
+	signed := int(int8(a&0xF0)) + int(int8(b&0xF0)) + al
+	if signed&0x80 != 0 {
+		out.N = 1
+	}
+	if signed < -128 || signed > 127 {
+		out.V = 1
+	}
+	if (int(a)+int(b)+int(carry))&0xFF == 0 {
+		out.Z = 1
+	}
+
+	if sum >= 0xA0 {
+		sum += 0x60
+	}
+	out.A = byte(sum)
+	if sum >= 0x100 {
+		out.C = 1
+	}
+	return out
+}
+
+// referenceDecimalSBC follows sequence 3 of Appendix A, with the flags taken from binary subtraction
+func referenceDecimalSBC(a, b, carry byte) DecimalOutcome {
+	out := referenceBinary(0xE9, a, b, carry)
+
+	al := int(a&0x0F) - int(b&0x0F) + int(carry) - 1
+	if al < 0 {
+		al = ((al - 0x06) & 0x0F) - 0x10
+	}
+	result := int(a&0xF0) - int(b&0xF0) + al
+	if result < 0 {
+		result -= 0x60
+	}
+	out.A = byte(result)
+	return out
+}
+
+// referenceDecimalADC65C02 is the NMOS result with N and Z taken from the
+// accumulator, as the 65C02 sets them
+func referenceDecimalADC65C02(a, b, carry byte) DecimalOutcome {
+	out := referenceDecimalADC(a, b, carry)
+	out.N, out.Z = nzOf(out.A)
+	return out
+}
+
+// referenceDecimalSBC65C02 follows sequence 4 of Appendix A, with C and V
+// taken from binary subtraction and N and Z from the accumulator
+func referenceDecimalSBC65C02(a, b, carry byte) DecimalOutcome {
+	out := referenceBinary(0xE9, a, b, carry)
+
+	al := int(a&0x0F) - int(b&0x0F) + int(carry) - 1
+	result := int(a) - int(b) + int(carry) - 1
+	if result < 0 {
+		result -= 0x60
+	}
+	if al < 0 {
+		result -= 0x06
+	}
+	out.A = byte(result)
+	out.N, out.Z = nzOf(out.A)
+	return out
+}
+
+func nzOf(value byte) (byte, byte) {
+	if value == 0 {
+		return 0, 1
+	}
+	return value >> 7, 0
+}
+
+func referenceBinary(opcode byte, a, b, carry byte) DecimalOutcome {
+	var out DecimalOutcome
+	if opcode == 0xE9 {
+		b = ^b
+	}
+
+	total := int(a) + int(b) + int(carry)
+	out.A = byte(total)
+	if total > 0xFF {
+		out.C = 1
+	}
+	if (a^out.A)&(b^out.A)&0x80 != 0 {
+		out.V = 1
+	}
+	if out.A == 0 {
+		out.Z = 1
+	}
+	out.N = out.A >> 7
+	return out
+}
@@ -0,0 +1,254 @@
+package harness
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	cpu6502 "izzudinhafiz.com/go-6502/cpu"
+)
+
+func TestDecimalMode(t *testing.T) {
+	for _, variant := range []byte{cpu6502.VARIANT_NMOS, cpu6502.VARIANT_2A03, cpu6502.VARIANT_65C02} {
+		mismatches := CheckDecimalMode(variant)
+		for i, m := range mismatches {
+			if i == 10 {
+				t.Errorf("... and %d more", len(mismatches)-i)
+				break
+			}
+			t.Errorf("variant %d: %v", variant, m)
+		}
+	}
+}
+
+type decimalExample struct {
+	op      string
+	a, b, c byte
+	want    DecimalOutcome
+}
+
+// Results measured on an NMOS 6502, from the examples in Appendix A of
+// http://www.6502.org/tutorials/decimal_mode.html. They pin both the CPU and
+// the reference model CheckDecimalMode uses to real hardware.
+var nmosDecimalExamples = []decimalExample{
+	{"ADC", 0x00, 0x00, 0, DecimalOutcome{A: 0x00, Z: 1}},
+	{"ADC", 0x79, 0x00, 1, DecimalOutcome{A: 0x80, N: 1, V: 1}},
+	{"ADC", 0x24, 0x56, 0, DecimalOutcome{A: 0x80, N: 1, V: 1}},
+	{"ADC", 0x93, 0x82, 0, DecimalOutcome{A: 0x75, V: 1, C: 1}},
+	{"ADC", 0x89, 0x76, 0, DecimalOutcome{A: 0x65, C: 1}},
+	{"ADC", 0x89, 0x76, 1, DecimalOutcome{A: 0x66, Z: 1, C: 1}},
+	{"ADC", 0x80, 0xF0, 0, DecimalOutcome{A: 0xD0, V: 1, C: 1}},
+	{"ADC", 0x80, 0xFA, 0, DecimalOutcome{A: 0xE0, N: 1, C: 1}},
+	{"ADC", 0x2F, 0x4F, 0, DecimalOutcome{A: 0x74}},
+	{"ADC", 0x6F, 0x00, 1, DecimalOutcome{A: 0x76}},
+	{"SBC", 0x00, 0x00, 0, DecimalOutcome{A: 0x99, N: 1}},
+	{"SBC", 0x00, 0x00, 1, DecimalOutcome{A: 0x00, Z: 1, C: 1}},
+	{"SBC", 0x00, 0x01, 1, DecimalOutcome{A: 0x99, N: 1}},
+	{"SBC", 0x0A, 0x00, 1, DecimalOutcome{A: 0x0A, C: 1}},
+	{"SBC", 0x0B, 0x00, 0, DecimalOutcome{A: 0x0A, C: 1}},
+	{"SBC", 0x9A, 0x00, 1, DecimalOutcome{A: 0x9A, N: 1, C: 1}},
+	{"SBC", 0x9B, 0x00, 0, DecimalOutcome{A: 0x9A, N: 1, C: 1}},
+}
+
+func TestDecimalHardwareExamples(t *testing.T) {
+	for _, ex := range nmosDecimalExamples {
+		reference := referenceDecimalADC
+		if ex.op == "SBC" {
+			reference = referenceDecimalSBC
+		}
+		if got := reference(ex.a, ex.b, ex.c); got != ex.want {
+			t.Errorf("reference %v $%02X $%02X C=%d: got %+v, want %+v", ex.op, ex.a, ex.b, ex.c, got, ex.want)
+		}
+	}
+}
+
+// decimalExampleProgram checks every hardware example in 6502 code the way
+// Bruce Clark's test does, leaving 0 in ErrorAddr and trapping when they all
+// pass and trapping with 1 there on the first difference
+func decimalExampleProgram(test DecimalTest, examples []decimalExample) []byte {
+	errorAddr := byte(test.ErrorAddr)
+	code := []byte{
+		0xD8,       // cld
+		0xA9, 0x01, // lda #1
+		0x85, errorAddr, // sta error
+		0xF8, // sed
+	}
+	for _, ex := range examples {
+		setCarry, op := byte(0x18), byte(0x69) // clc, adc
+		if ex.c == 1 {
+			setCarry = 0x38 // sec
+		}
+		if ex.op == "SBC" {
+			op = 0xE9
+		}
+		flags := ex.want.N<<7 | ex.want.V<<6 | ex.want.Z<<1 | ex.want.C
+		code = append(code,
+			setCarry,
+			0xA9, ex.a, // lda #a
+			op, ex.b, // adc/sbc #b
+			0x08,            // php
+			0xC9, ex.want.A, // cmp #result
+			0xD0, 0x00, // bne fail
+			0x68,       // pla
+			0x29, 0xC3, // and #NV----ZC
+			0xC9, flags, // cmp #flags
+			0xD0, 0x00, // bne fail
+		)
+	}
+	code = append(code, 0xA9, 0x00, 0x85, errorAddr) // lda #0, sta error
+	fail := len(code)
+	code = append(code, 0x4C, 0, 0) // jmp *, both when done and on failure
+
+	// Point every bne at the trap
+	for i := 0; i+1 < fail; i++ {
+		if code[i] == 0xD0 && code[i+1] == 0x00 {
+			code[i+1] = byte(fail - (i + 2))
+		}
+	}
+	trap := int(test.StartAddr) + fail
+	code[fail+1], code[fail+2] = byte(trap), byte(trap>>8)
+	return code
+}
+
+// writeTestBinary writes a raw image the way the suites are distributed,
+// code at its address in a file loaded at LoadAddr
+func writeTestBinary(t *testing.T, name string, loadAddr int, parts map[int][]byte) string {
+	t.Helper()
+	image := make([]byte, 0x10000-loadAddr)
+	for addr, code := range parts {
+		copy(image[addr-loadAddr:], code)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, image, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// The runner and its default addresses are exercised with a program of the
+// hardware examples, so the test runs without the suite binary
+func TestDecimalRunner(t *testing.T) {
+	test := DefaultDecimalTest
+	code := decimalExampleProgram(test, nmosDecimalExamples)
+	test.Path = writeTestBinary(t, DefaultDecimalTest.Path, test.LoadAddr, map[int][]byte{int(test.StartAddr): code})
+
+	result, err := test.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Passed {
+		t.Fatal(result)
+	}
+
+	// 99 + 01 leaves Z clear on the NMOS part, so expecting it set must fail
+	wrong := []decimalExample{{"ADC", 0x99, 0x01, 0, DecimalOutcome{A: 0x00, N: 1, Z: 1, C: 1}}}
+	code = decimalExampleProgram(test, wrong)
+	test.Path = writeTestBinary(t, DefaultDecimalTest.Path, test.LoadAddr, map[int][]byte{int(test.StartAddr): code})
+	if result, err := test.Run(); err != nil || result.Passed || result.Error != 1 {
+		t.Errorf("broken example passed: %v %v", result, err)
+	}
+}
+
+// interruptProgram raises an IRQ and then an NMI through the feedback
+// register, counting each in TestCaseAddr, and finishes at SuccessAddr the way
+// Klaus Dormann's interrupt test does
+func interruptProgram(test InterruptTest) map[int][]byte {
+	release, irq, nmi := byte(0), test.IRQMask, test.NMIMask
+	if test.ActiveLow {
+		release, irq, nmi = ^release, ^irq, ^nmi
+	}
+	fbLo, fbHi := byte(test.FeedbackAddr), byte(test.FeedbackAddr>>8)
+	tcLo, tcHi := byte(test.TestCaseAddr), byte(test.TestCaseAddr>>8)
+	okLo, okHi := byte(test.SuccessAddr), byte(test.SuccessAddr>>8)
+	start := int(test.StartAddr)
+
+	main := []byte{
+		0xA2, 0xFF, 0x9A, // ldx #$FF, txs
+		0xA9, 0x00, 0x8D, tcLo, tcHi, // lda #0, sta count
+		0x58,                        // cli
+		0xA9, irq, 0x8D, fbLo, fbHi, // assert IRQ
+		0xAD, tcLo, tcHi, 0xC9, 0x01, 0xD0, 0x0F, // lda count, cmp #1, bne fail
+		0xA9, nmi, 0x8D, fbLo, fbHi, // pulse NMI
+		0xAD, tcLo, tcHi, 0xC9, 0x03, 0xD0, 0x03, // lda count, cmp #3, bne fail
+		0x4C, okLo, okHi, // jmp success
+	}
+	fail := start + len(main)
+	main = append(main, 0x4C, byte(fail), byte(fail>>8)) // fail: jmp fail
+
+	irqHandler := []byte{
+		0xEE, tcLo, tcHi, // inc count
+		0xA9, release, 0x8D, fbLo, fbHi, // release the line
+		0x40, // rti
+	}
+	nmiHandler := []byte{
+		0xEE, tcLo, tcHi, 0xEE, tcLo, tcHi, // count two
+		0xA9, release, 0x8D, fbLo, fbHi,
+		0x40,
+	}
+	return map[int][]byte{
+		start:                 main,
+		start + 0x100:         irqHandler,
+		start + 0x180:         nmiHandler,
+		int(test.SuccessAddr): {0x4C, okLo, okHi},
+		0xFFFA:                {byte(start + 0x180), byte((start + 0x180) >> 8), 0, 0, byte(start + 0x100), byte((start + 0x100) >> 8)},
+	}
+}
+
+func TestInterruptRunner(t *testing.T) {
+	for _, activeLow := range []bool{false, true} {
+		test := DefaultInterruptTest
+		test.ActiveLow = activeLow
+		test.Path = writeTestBinary(t, test.Path, test.LoadAddr, interruptProgram(test))
+
+		result, err := test.Run()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Passed || result.TestCase != 3 {
+			t.Errorf("active low %v: %v, count %d", activeLow, result, result.TestCase)
+		}
+	}
+
+	// With the IRQ input wired to the wrong bit the program fails
+	test := DefaultInterruptTest
+	test.Path = writeTestBinary(t, test.Path, test.LoadAddr, interruptProgram(test))
+	test.IRQMask = 0x04
+	if result, err := test.Run(); err != nil || result.Passed || result.TestCase != 0 {
+		t.Errorf("miswired IRQ passed: %v %v", result, err)
+	}
+}
+
+// The suite binaries are not distributed with the repository, drop them into testdata to run them
+func testdataPath(t *testing.T, name string) string {
+	path := "testdata/" + name
+	if _, err := os.Stat(path); err != nil {
+		t.Skipf("%v not found", path)
+	}
+	return path
+}
+
+func TestDecimalSuite(t *testing.T) {
+	test := DefaultDecimalTest
+	test.Path = testdataPath(t, test.Path)
+
+	result, err := test.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Passed {
+		t.Fatal(result)
+	}
+}
+
+func TestInterruptSuite(t *testing.T) {
+	test := DefaultInterruptTest
+	test.Path = testdataPath(t, test.Path)
+
+	result, err := test.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Passed {
+		t.Fatal(result)
+	}
+}
@@ -0,0 +1,97 @@
+package harness
+
+import (
+	"fmt"
+
+	cpu6502 "izzudinhafiz.com/go-6502/cpu"
+	refcpu "izzudinhafiz.com/go-6502/refcpu"
+)
+
+// The fuzz input starts with the initial registers and a seed for the memory contents
+const differentialHeader = 7
+
+// DifferentialStart is where the instruction stream from the fuzz input is placed
+const DifferentialStart = 0x0400
+
+// Differential runs the program encoded in data on the Cpu6502 and on the
+// reference interpreter, and reports the first register, flag, cycle or memory
+// mismatch. data holds A, X, Y, SP, P and a two byte memory seed, followed by
+// the instruction stream. The rest of memory is filled from the seed so that
+// pointers and vectors lead somewhere repeatable. Execution stops after limit
+// instructions or at the first opcode neither side implements.
+func Differential(data []byte, limit int, variant byte) error {
+	if len(data) < differentialHeader {
+		return nil
+	}
+
+	c := cpu6502.New()
+	c.Variant = variant
+	ref := &refcpu.CPU{NoDecimal: variant == cpu6502.VARIANT_2A03}
+
+	// xorshift keeps the memory fill cheap and identical on both sides
+	state := uint32(data[5])<<8 | uint32(data[6]) | 1<<16
+	for i := range ref.Mem {
+		state ^= state << 13
+		state ^= state >> 17
+		state ^= state << 5
+		ref.Mem[i] = byte(state)
+	}
+	copy(ref.Mem[DifferentialStart:], data[differentialHeader:])
+	copy(c.Memory, ref.Mem[:])
+
+	ref.A, ref.X, ref.Y, ref.S = data[0], data[1], data[2], data[3]
+	ref.P = data[4] &^ (refcpu.FLAG_B | refcpu.FLAG_U)
+	ref.PC = DifferentialStart
+	c.Registers = cpu6502.CpuRegisters{PC: ref.PC, SP: ref.S, A: ref.A, X: ref.X, Y: ref.Y}
+	c.Flags = flagsFromByte(ref.P)
+
+	for i := 0; i < limit; i++ {
+		pc := ref.PC
+		op := ref.Mem[pc]
+		_, implemented := cpu6502.Opcodes[op]
+		if implemented != refcpu.Implemented(op) {
+			return fmt.Errorf("opcode $%02X: cpu implements it %v, reference %v", op, implemented, !implemented)
+		}
+		if !implemented {
+			break
+		}
+
+		expectedCycles, _ := ref.Step()
+		cycles := 1
+		for !c.SingleStep() {
+			cycles += 1
+		}
+
+		if err := compareWithReference(c, ref, cycles, expectedCycles); err != nil {
+			return fmt.Errorf("instruction %d, $%02X at $%04X: %w", i, op, pc, err)
+		}
+	}
+
+	for addr := range ref.Mem {
+		if c.Memory[addr] != ref.Mem[addr] {
+			return fmt.Errorf("memory $%04X is $%02X, reference has $%02X", addr, c.Memory[addr], ref.Mem[addr])
+		}
+	}
+	return nil
+}
+
+func compareWithReference(c *cpu6502.Cpu6502, ref *refcpu.CPU, cycles int, expectedCycles int) error {
+	status := flagsToByte(c.Flags) & statusMask
+	switch {
+	case c.Registers.PC != ref.PC:
+		return fmt.Errorf("PC $%04X, reference $%04X", c.Registers.PC, ref.PC)
+	case c.Registers.A != ref.A:
+		return fmt.Errorf("A $%02X, reference $%02X", c.Registers.A, ref.A)
+	case c.Registers.X != ref.X:
+		return fmt.Errorf("X $%02X, reference $%02X", c.Registers.X, ref.X)
+	case c.Registers.Y != ref.Y:
+		return fmt.Errorf("Y $%02X, reference $%02X", c.Registers.Y, ref.Y)
+	case c.Registers.SP != ref.S:
+		return fmt.Errorf("SP $%02X, reference $%02X", c.Registers.SP, ref.S)
+	case status != ref.P&statusMask:
+		return fmt.Errorf("P $%02X, reference $%02X", status, ref.P&statusMask)
+	case cycles != expectedCycles:
+		return fmt.Errorf("%d cycles, reference %d", cycles, expectedCycles)
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package harness
+
+import (
+	"math/rand"
+	"testing"
+
+	cpu6502 "izzudinhafiz.com/go-6502/cpu"
+)
+
+func FuzzDifferential(f *testing.F) {
+	// Decimal mode ADC/SBC, page crossing loads and stores, and a BRK/RTI round trip
+	f.Add([]byte{0x99, 0x01, 0x00, 0xFF, 0x08, 0x12, 0x34, 0x69, 0x01, 0xE9, 0x99, 0x7D, 0xFF, 0x10, 0x9D, 0xFF, 0x10})
+	f.Add([]byte{0x7F, 0xFF, 0x80, 0x40, 0x01, 0xBE, 0xEF, 0x18, 0x69, 0x01, 0x38, 0xE9, 0x80, 0xB1, 0x10, 0x91, 0x20})
+	f.Add([]byte{0x00, 0x00, 0x00, 0xFD, 0x24, 0x00, 0x01, 0x20, 0x08, 0x04, 0x00, 0xEA, 0x60, 0x40})
+	f.Add([]byte{0x50, 0x50, 0x50, 0x50, 0xC9, 0x55, 0xAA, 0xF8, 0x65, 0x30, 0x75, 0x31, 0xF5, 0x32, 0x6C, 0xFF, 0x02})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, variant := range []byte{cpu6502.VARIANT_NMOS, cpu6502.VARIANT_2A03} {
+			if err := Differential(data, 64, variant); err != nil {
+				t.Fatalf("variant %d: %v", variant, err)
+			}
+		}
+	})
+}
+
+// Random programs drawn from the implemented opcodes, so plain go test covers more than the seeds
+func TestDifferentialRandom(t *testing.T) {
+	var opcodes []byte
+	for op := 0; op < 256; op++ {
+		if _, ok := cpu6502.Opcodes[byte(op)]; ok {
+			opcodes = append(opcodes, byte(op))
+		}
+	}
+
+	rng := rand.New(rand.NewSource(6502))
+	runs := 2000
+	if testing.Short() {
+		runs = 200
+	}
+
+	for run := 0; run < runs; run++ {
+		data := make([]byte, differentialHeader+96)
+		rng.Read(data)
+		for i := differentialHeader; i < len(data); i += 3 {
+			data[i] = opcodes[rng.Intn(len(opcodes))]
+		}
+
+		if err := Differential(data, 32, cpu6502.VARIANT_NMOS); err != nil {
+			t.Fatalf("run %d: %v\ninput %#v", run, err, data)
+		}
+	}
+}
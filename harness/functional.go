@@ -0,0 +1,82 @@
+package harness
+
+import (
+	"fmt"
+
+	cpu6502 "izzudinhafiz.com/go-6502/cpu"
+	loader "izzudinhafiz.com/go-6502/loader"
+)
+
+// FunctionalTest describes a build of Klaus Dormann's 6502_functional_test.
+// The addresses depend on the assembly options the binary was built with.
+type FunctionalTest struct {
+	Path         string
+	LoadAddr     int
+	StartAddr    uint16
+	SuccessAddr  uint16
+	TestCaseAddr uint16 // Where the suite keeps the number of the test that is running
+	Limit        int    // Maximum number of instructions to run
+}
+
+// DefaultFunctionalTest matches the 6502_functional_test.bin bundled with this repository
+var DefaultFunctionalTest = FunctionalTest{
+	Path:         "6502_functional_test.bin",
+	LoadAddr:     0x0000,
+	StartAddr:    0x0400,
+	SuccessAddr:  0x3469,
+	TestCaseAddr: 0x0200,
+	Limit:        100_000_000,
+}
+
+// Result is the outcome of a test suite run
+type Result struct {
+	Passed   bool
+	TestCase byte
+	Stop     Stop
+}
+
+func (r Result) String() string {
+	switch {
+	case r.Passed:
+		return fmt.Sprintf("passed at $%04X after %d instructions (%d cycles)", r.Stop.PC, r.Stop.Instructions, r.Stop.Cycles)
+	case r.Stop.Reason == STOP_LIMIT:
+		return fmt.Sprintf("did not finish within %d instructions, test $%02X, PC $%04X", r.Stop.Instructions, r.TestCase, r.Stop.PC)
+	case r.Stop.Reason == STOP_UNKNOWN_OPCODE:
+		return fmt.Sprintf("unknown opcode at $%04X in test $%02X: %v", r.Stop.PC, r.TestCase, r.Stop.Panic)
+	}
+	return fmt.Sprintf("failed test $%02X, trapped at $%04X after %d instructions", r.TestCase, r.Stop.PC, r.Stop.Instructions)
+}
+
+// Run loads the test image into a fresh CPU and runs it until it traps
+func (t FunctionalTest) Run() (Result, error) {
+	c, err := t.Load()
+	if err != nil {
+		return Result{}, err
+	}
+	return t.RunOn(c), nil
+}
+
+// Load returns a fresh CPU with the test image loaded, ready to start
+func (t FunctionalTest) Load() (*cpu6502.Cpu6502, error) {
+	img, err := loader.LoadFile(t.Path, loader.Options{Format: loader.FORMAT_RAW, Addr: t.LoadAddr})
+	if err != nil {
+		return nil, err
+	}
+
+	c := cpu6502.New()
+	if err := img.LoadInto(c); err != nil {
+		return nil, err
+	}
+	c.Registers.PC = t.StartAddr
+	return c, nil
+}
+
+// RunOn runs an already loaded CPU from its current program counter
+func (t FunctionalTest) RunOn(c *cpu6502.Cpu6502) Result {
+	stop := RunUntilTrap(c, t.Limit)
+	return Result{
+		Passed:   stop.Reason == STOP_TRAP && stop.PC == t.SuccessAddr,
+		TestCase: c.Read(t.TestCaseAddr),
+		Stop:     stop,
+	}
+}
@@ -0,0 +1,23 @@
+package harness
+
+import (
+	"testing"
+)
+
+func TestFunctional(t *testing.T) {
+	if testing.Short() {
+		t.Skip("functional test takes a few seconds")
+	}
+
+	test := DefaultFunctionalTest
+	test.Path = "../" + test.Path
+
+	result, err := test.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Passed {
+		t.Fatal(result)
+	}
+	t.Log(result)
+}
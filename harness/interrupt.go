@@ -0,0 +1,85 @@
+package harness
+
+import (
+	cpu6502 "izzudinhafiz.com/go-6502/cpu"
+	loader "izzudinhafiz.com/go-6502/loader"
+)
+
+// InterruptTest describes a build of Klaus Dormann's 6502_interrupt_test. The
+// test raises IRQ and NMI itself by writing to a feedback register whose bits
+// are wired to the interrupt inputs.
+type InterruptTest struct {
+	Path         string
+	LoadAddr     int
+	StartAddr    uint16
+	SuccessAddr  uint16
+	TestCaseAddr uint16
+	FeedbackAddr uint16
+	IRQMask      byte
+	NMIMask      byte
+	ActiveLow    bool // Open collector wiring, where a 0 bit asserts the line
+	Limit        int
+}
+
+var DefaultInterruptTest = InterruptTest{
+	Path:         "6502_interrupt_test.bin",
+	LoadAddr:     0x0000,
+	StartAddr:    0x0400,
+	SuccessAddr:  0x06F5,
+	TestCaseAddr: 0x0200,
+	FeedbackAddr: 0xBFFC,
+	IRQMask:      0x01,
+	NMIMask:      0x02,
+	Limit:        10_000_000,
+}
+
+// feedbackBus is plain memory with the feedback register driving the CPU interrupt lines
+type feedbackBus struct {
+	cpu  *cpu6502.Cpu6502
+	test InterruptTest
+}
+
+func (b *feedbackBus) Read(addr uint16) byte {
+	return b.cpu.Memory[addr]
+}
+
+func (b *feedbackBus) Write(addr uint16, value byte) {
+	b.cpu.Memory[addr] = value
+	if addr != b.test.FeedbackAddr {
+		return
+	}
+
+	if b.test.ActiveLow {
+		value = ^value
+	}
+	b.cpu.IRQLine = value&b.test.IRQMask != 0
+	b.cpu.SetNMILine(value&b.test.NMIMask != 0)
+}
+
+func (t InterruptTest) Run() (Result, error) {
+	img, err := loader.LoadFile(t.Path, loader.Options{Format: loader.FORMAT_RAW, Addr: t.LoadAddr})
+	if err != nil {
+		return Result{}, err
+	}
+
+	c := cpu6502.New()
+	if err := img.LoadInto(c); err != nil {
+		return Result{}, err
+	}
+	c.Bus = &feedbackBus{c, t}
+	c.Registers.PC = t.StartAddr
+
+	// Start with both lines released
+	if t.ActiveLow {
+		c.Write(t.FeedbackAddr, 0xFF)
+	} else {
+		c.Write(t.FeedbackAddr, 0x00)
+	}
+
+	stop := RunUntilTrap(c, t.Limit)
+	return Result{
+		Passed:   stop.Reason == STOP_TRAP && stop.PC == t.SuccessAddr,
+		TestCase: c.Read(t.TestCaseAddr),
+		Stop:     stop,
+	}, nil
+}
@@ -0,0 +1,294 @@
+package harness
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cpu6502 "izzudinhafiz.com/go-6502/cpu"
+)
+
+// SingleStepState is a CPU snapshot in the ProcessorTests JSON format
+// See https://github.com/SingleStepTests/ProcessorTests
+type SingleStepState struct {
+	PC  uint16   `json:"pc"`
+	S   byte     `json:"s"`
+	A   byte     `json:"a"`
+	X   byte     `json:"x"`
+	Y   byte     `json:"y"`
+	P   byte     `json:"p"`
+	RAM [][2]int `json:"ram"`
+}
+
+// SingleStepVector is one test case: the state before and after a single instruction
+// and the bus activity of every cycle in between.
+type SingleStepVector struct {
+	Name    string           `json:"name"`
+	Initial SingleStepState  `json:"initial"`
+	Final   SingleStepState  `json:"final"`
+	Cycles  [][3]interface{} `json:"cycles"`
+}
+
+// OpcodeResult summarises the vectors for one opcode
+type OpcodeResult struct {
+	Opcode       byte
+	Missing      bool // No vector file for this opcode
+	Implemented  bool
+	Total        int
+	Passed       int
+	CycleErrors  int // Vectors where only the timing was wrong: the cycle count or the bus activity of the cycles
+	FirstFailure string
+}
+
+// Matrix holds the result for every opcode
+type Matrix [256]OpcodeResult
+
+// SingleStepSuite runs a directory of per opcode vector files named 00.json to ff.json
+type SingleStepSuite struct {
+	Dir     string
+	Variant byte
+	Limit   int // Maximum vectors to run per opcode, 0 runs them all
+}
+
+// the status register bits the vectors compare, B and bit 5 do not exist in the register
+const statusMask = 0xCF
+
+// Run executes every vector file it finds and returns the per opcode results
+func (s SingleStepSuite) Run() (*Matrix, error) {
+	var matrix Matrix
+	found := false
+
+	for op := 0; op < 256; op++ {
+		result := &matrix[op]
+		result.Opcode = byte(op)
+		_, result.Implemented = cpu6502.LookupOpcode(s.Variant, byte(op))
+
+		content, err := os.ReadFile(filepath.Join(s.Dir, fmt.Sprintf("%02x.json", op)))
+		if errors.Is(err, fs.ErrNotExist) {
+			result.Missing = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		found = true
+
+		var vectors []SingleStepVector
+		if err := json.Unmarshal(content, &vectors); err != nil {
+			return nil, fmt.Errorf("%02x.json: %w", op, err)
+		}
+		if !result.Implemented {
+			result.Total = len(vectors)
+			continue
+		}
+		if s.Limit > 0 && len(vectors) > s.Limit {
+			vectors = vectors[:s.Limit]
+		}
+
+		// FirstFailure prefers a wrong result over a timing difference
+		firstIsTiming := false
+		for _, v := range vectors {
+			result.Total += 1
+			problem, cycleOnly := s.runVector(v)
+			switch {
+			case problem == "":
+				result.Passed += 1
+			case cycleOnly:
+				result.CycleErrors += 1
+			}
+			if problem != "" && (result.FirstFailure == "" || firstIsTiming && !cycleOnly) {
+				result.FirstFailure = v.Name + ": " + problem
+				firstIsTiming = cycleOnly
+			}
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("no vector files in %v", s.Dir)
+	}
+	return &matrix, nil
+}
+
+// busAccess is one read or write seen on the bus
+type busAccess struct {
+	addr  uint16
+	value byte
+	write bool
+}
+
+func (a busAccess) String() string {
+	if a.write {
+		return fmt.Sprintf("write $%02X to $%04X", a.value, a.addr)
+	}
+	return fmt.Sprintf("read $%02X from $%04X", a.value, a.addr)
+}
+
+// trackingBus logs every access so it can be compared with the vector's cycles
+type trackingBus struct {
+	memory   []byte
+	accesses []busAccess
+}
+
+func (b *trackingBus) Read(addr uint16) byte {
+	b.accesses = append(b.accesses, busAccess{addr, b.memory[addr], false})
+	return b.memory[addr]
+}
+
+func (b *trackingBus) Write(addr uint16, value byte) {
+	b.memory[addr] = value
+	b.accesses = append(b.accesses, busAccess{addr, value, true})
+}
+
+// runVector returns a description of the differences, if any, and whether
+// only the timing differed. The registers and memory can be right while the
+// bus activity is not, when the CPU leaves out a dummy read or write.
+func (s SingleStepSuite) runVector(v SingleStepVector) (problem string, cycleOnly bool) {
+	c := cpu6502.New()
+	c.Variant = s.Variant
+	bus := &trackingBus{memory: c.Memory}
+	c.Bus = bus
+
+	for _, cell := range v.Initial.RAM {
+		c.Memory[cell[0]] = byte(cell[1])
+	}
+	c.Registers = cpu6502.CpuRegisters{PC: v.Initial.PC, SP: v.Initial.S, A: v.Initial.A, X: v.Initial.X, Y: v.Initial.Y}
+	c.Flags = flagsFromByte(v.Initial.P)
+
+	defer func() {
+		if r := recover(); r != nil {
+			problem, cycleOnly = fmt.Sprint(r), false
+		}
+	}()
+
+	cycles := 0
+	for {
+		cycles += 1
+		if c.SingleStep() {
+			break
+		}
+	}
+
+	var diffs []string
+	check := func(name string, got, expected int) {
+		if got != expected {
+			diffs = append(diffs, fmt.Sprintf("%v=$%02X want $%02X", name, got, expected))
+		}
+	}
+	check("PC", int(c.Registers.PC), int(v.Final.PC))
+	check("S", int(c.Registers.SP), int(v.Final.S))
+	check("A", int(c.Registers.A), int(v.Final.A))
+	check("X", int(c.Registers.X), int(v.Final.X))
+	check("Y", int(c.Registers.Y), int(v.Final.Y))
+	check("P", int(flagsToByte(c.Flags)&statusMask), int(v.Final.P&statusMask))
+
+	for _, cell := range v.Final.RAM {
+		addr := uint16(cell[0])
+		check(fmt.Sprintf("[$%04X]", addr), int(c.Memory[addr]), cell[1])
+	}
+	stateDiffs := len(diffs)
+	if problem := compareBus(bus.accesses, v.Cycles); problem != "" {
+		diffs = append(diffs, problem)
+	}
+
+	if cycles != len(v.Cycles) {
+		diffs = append(diffs, fmt.Sprintf("%d cycles want %d", cycles, len(v.Cycles)))
+	}
+
+	if len(diffs) == 0 {
+		return "", false
+	}
+	return strings.Join(diffs, ", "), stateDiffs == 0
+}
+
+// compareBus checks the accesses against the vector's cycles, one access per
+// cycle in the same order, and describes the first difference
+func compareBus(accesses []busAccess, cycles [][3]interface{}) string {
+	for i, cycle := range cycles {
+		addr, okAddr := cycle[0].(float64)
+		value, okValue := cycle[1].(float64)
+		kind, okKind := cycle[2].(string)
+		if !okAddr || !okValue || !okKind {
+			return fmt.Sprintf("cycle %d: malformed bus activity %v", i+1, cycle)
+		}
+		want := busAccess{uint16(addr), byte(value), kind == "write"}
+
+		if i >= len(accesses) {
+			return fmt.Sprintf("cycle %d: no bus access, want %v", i+1, want)
+		}
+		if accesses[i] != want {
+			return fmt.Sprintf("cycle %d: %v, want %v", i+1, accesses[i], want)
+		}
+	}
+	if len(accesses) > len(cycles) {
+		return fmt.Sprintf("cycle %d: extra %v", len(cycles)+1, accesses[len(cycles)])
+	}
+	return ""
+}
+
+func flagsFromByte(p byte) cpu6502.CpuFlags {
+	bit := func(n uint) byte { return (p >> n) & 1 }
+	return cpu6502.CpuFlags{N: bit(7), Z: bit(1), C: bit(0), I: bit(2), D: bit(3), B: bit(4), V: bit(6)}
+}
+
+func flagsToByte(f cpu6502.CpuFlags) byte {
+	return f.C | f.Z<<1 | f.I<<2 | f.D<<3 | f.B<<4 | 1<<5 | f.V<<6 | f.N<<7
+}
+
+// Failed lists the implemented opcodes that did not pass every vector
+func (m *Matrix) Failed() []OpcodeResult {
+	var failed []OpcodeResult
+	for _, r := range m {
+		if r.Implemented && !r.Missing && r.Passed != r.Total {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+// Wrong lists the implemented opcodes that left the registers or memory
+// different from a vector, ignoring timing
+func (m *Matrix) Wrong() []OpcodeResult {
+	var wrong []OpcodeResult
+	for _, r := range m.Failed() {
+		if r.Passed+r.CycleErrors != r.Total {
+			wrong = append(wrong, r)
+		}
+	}
+	return wrong
+}
+
+// String renders the matrix as a 16x16 grid indexed by the opcode's high and low nibble.
+// "ok" passed, "cy" failed only on timing, "XX" failed, "--" not implemented, ".." no vectors.
+func (m *Matrix) String() string {
+	var b strings.Builder
+	b.WriteString("   ")
+	for lo := 0; lo < 16; lo++ {
+		fmt.Fprintf(&b, " %X ", lo)
+	}
+	b.WriteString("\n")
+
+	for hi := 0; hi < 16; hi++ {
+		fmt.Fprintf(&b, "%X_ ", hi)
+		for lo := 0; lo < 16; lo++ {
+			r := m[hi<<4|lo]
+			cell := "XX"
+			switch {
+			case r.Missing:
+				cell = ".."
+			case !r.Implemented:
+				cell = "--"
+			case r.Passed == r.Total:
+				cell = "ok"
+			case r.Passed+r.CycleErrors == r.Total:
+				cell = "cy"
+			}
+			b.WriteString(cell + " ")
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
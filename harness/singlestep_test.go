@@ -0,0 +1,104 @@
+package harness
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	cpu6502 "izzudinhafiz.com/go-6502/cpu"
+)
+
+// runSingleStep runs a suite and fails on every opcode that did not pass all
+// of its vectors, whether it got the result or only the timing wrong
+func runSingleStep(t *testing.T, suite SingleStepSuite) *Matrix {
+	matrix, err := suite.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(matrix.Failed()) > 0 {
+		t.Log("\n" + matrix.String())
+	}
+	for _, r := range matrix.Failed() {
+		if r.Passed+r.CycleErrors == r.Total {
+			t.Errorf("opcode $%02X timing: %v", r.Opcode, r.FirstFailure)
+		} else {
+			t.Errorf("opcode $%02X passed %d of %d: %v", r.Opcode, r.Passed, r.Total, r.FirstFailure)
+		}
+	}
+	return matrix
+}
+
+// A handful of vectors worked out from the documented cycle tables, covering
+// page crossing penalties, branch timing, decimal flags, the stack and the
+// dummy reads and writes, checked cycle by cycle
+func TestSingleStep(t *testing.T) {
+	runSingleStep(t, SingleStepSuite{Dir: "testdata/singlestep"})
+}
+
+// Opcodes only the 65C02 has are looked up for the suite's variant and run
+func TestSingleStep65C02(t *testing.T) {
+	matrix := runSingleStep(t, SingleStepSuite{Dir: "testdata/singlestep65c02", Variant: cpu6502.VARIANT_65C02})
+
+	for _, op := range []byte{0x03, 0x1A, 0x64, 0x80, 0xB2, 0xDA, 0xFA} {
+		r := matrix[op]
+		if !r.Implemented || r.Total == 0 || r.Passed != r.Total {
+			t.Errorf("opcode $%02X implemented %v, passed %d of %d: %v", op, r.Implemented, r.Passed, r.Total, r.FirstFailure)
+		}
+	}
+}
+
+// A vector that only differs in its bus activity is caught and counted as a timing error
+func TestSingleStepBusActivity(t *testing.T) {
+	v := SingleStepVector{
+		Name:    "85 42",
+		Initial: SingleStepState{PC: 0x0300, S: 0xFD, A: 0x37, P: 0x24, RAM: [][2]int{{0x0300, 0x85}, {0x0301, 0x42}}},
+		Final:   SingleStepState{PC: 0x0302, S: 0xFD, A: 0x37, P: 0x24, RAM: [][2]int{{0x0042, 0x37}}},
+		Cycles:  [][3]interface{}{{768.0, 133.0, "read"}, {769.0, 66.0, "read"}, {66.0, 55.0, "write"}},
+	}
+	suite := SingleStepSuite{}
+	if problem, _ := suite.runVector(v); problem != "" {
+		t.Fatalf("matching vector failed: %v", problem)
+	}
+
+	tests := []struct {
+		name   string
+		cycles [][3]interface{}
+		want   string
+	}{
+		{"read for write", [][3]interface{}{{768.0, 133.0, "read"}, {769.0, 66.0, "read"}, {66.0, 55.0, "read"}}, "cycle 3: write $37 to $0042, want read $37 from $0042"},
+		{"address", [][3]interface{}{{768.0, 133.0, "read"}, {770.0, 66.0, "read"}, {66.0, 55.0, "write"}}, "cycle 2: read $42 from $0301, want read $42 from $0302"},
+		{"missing dummy", [][3]interface{}{{768.0, 133.0, "read"}, {769.0, 66.0, "read"}, {66.0, 0.0, "read"}, {66.0, 55.0, "write"}}, "cycle 3"},
+		{"extra access", [][3]interface{}{{768.0, 133.0, "read"}, {769.0, 66.0, "read"}}, "cycle 3: extra write"},
+	}
+	for _, test := range tests {
+		v.Cycles = test.cycles
+		problem, cycleOnly := suite.runVector(v)
+		if !strings.Contains(problem, test.want) || !cycleOnly {
+			t.Errorf("%v: got %q timing only %v, want %q", test.name, problem, cycleOnly, test.want)
+		}
+	}
+
+	// A wrong result is not a timing error
+	v.Cycles = [][3]interface{}{{768.0, 133.0, "read"}, {769.0, 66.0, "read"}, {66.0, 55.0, "write"}}
+	v.Final.A = 0x38
+	if problem, cycleOnly := suite.runVector(v); problem == "" || cycleOnly {
+		t.Errorf("wrong A: got %q timing only %v", problem, cycleOnly)
+	}
+}
+
+// Set GO6502_PROCESSOR_TESTS to the 6502/v1 directory of the ProcessorTests
+// repository to run the full set. It is not vendored because it is over 100MB;
+// TestSingleStep runs the same code over the vectors in testdata.
+func TestProcessorTests(t *testing.T) {
+	dir := os.Getenv("GO6502_PROCESSOR_TESTS")
+	if dir == "" {
+		t.Skip("GO6502_PROCESSOR_TESTS is not set")
+	}
+
+	limit := 0
+	if testing.Short() {
+		limit = 500
+	}
+	runSingleStep(t, SingleStepSuite{Dir: dir, Limit: limit})
+}
@@ -0,0 +1,50 @@
+// Package harness runs the well known 6502 test suites against a Cpu6502 and
+// reports whether they pass.
+package harness
+
+import (
+	cpu6502 "izzudinhafiz.com/go-6502/cpu"
+)
+
+// Reasons a run stopped
+const (
+	STOP_TRAP           byte = iota // The program jumped or branched to itself
+	STOP_LIMIT                      // The instruction limit was reached
+	STOP_UNKNOWN_OPCODE             // The CPU fetched an opcode it does not implement
+)
+
+// Stop describes where and why a run stopped
+type Stop struct {
+	Reason       byte
+	PC           uint16
+	Instructions int
+	Cycles       int
+	Panic        interface{}
+}
+
+// RunUntilTrap executes whole instructions until the program counter stops
+// moving, which is how the test suites signal both success and failure.
+// A limit of zero or less means run forever. Only the CPU's unknown opcode
+// panic is turned into a stop, anything else is a bug and panics again.
+func RunUntilTrap(c *cpu6502.Cpu6502, limit int) (stop Stop) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r != cpu6502.UNKNOWN_OPCODE_PANIC {
+				panic(r)
+			}
+			stop = Stop{STOP_UNKNOWN_OPCODE, c.Registers.PC - 1, stop.Instructions, c.Tick, r}
+		}
+	}()
+
+	for limit <= 0 || stop.Instructions < limit {
+		pc := c.Registers.PC
+		c.SingleOperation()
+		stop.Instructions += 1
+
+		if c.Registers.PC == pc {
+			return Stop{STOP_TRAP, pc, stop.Instructions, c.Tick, nil}
+		}
+	}
+
+	return Stop{STOP_LIMIT, c.Registers.PC, stop.Instructions, c.Tick, nil}
+}
@@ -0,0 +1,47 @@
+package harness
+
+import (
+	"testing"
+
+	cpu6502 "izzudinhafiz.com/go-6502/cpu"
+)
+
+func TestRunUntilTrap(t *testing.T) {
+	c := cpu6502.New()
+	// LDX #$03; DEX; BNE *-1; JMP *
+	c.WriteMemory(0x0200, []byte{0xA2, 0x03, 0xCA, 0xD0, 0xFD, 0x4C, 0x05, 0x02})
+	c.Registers.PC = 0x0200
+	if stop := RunUntilTrap(c, 0); stop.Reason != STOP_TRAP || stop.PC != 0x0205 || stop.Instructions != 8 {
+		t.Errorf("stopped %+v, want a trap at $0205 after 8 instructions", stop)
+	}
+
+	c.Registers.PC = 0x0200
+	if stop := RunUntilTrap(c, 3); stop.Reason != STOP_LIMIT || stop.Instructions != 3 {
+		t.Errorf("stopped %+v, want the limit after 3 instructions", stop)
+	}
+
+	c.Memory[0x0300] = 0x02 // Not implemented
+	c.Registers.PC = 0x0300
+	if stop := RunUntilTrap(c, 0); stop.Reason != STOP_UNKNOWN_OPCODE || stop.PC != 0x0300 {
+		t.Errorf("stopped %+v, want an unknown opcode at $0300", stop)
+	}
+}
+
+// Panics other than an unknown opcode are bugs, not failed tests
+func TestRunUntilTrapRepanics(t *testing.T) {
+	c := cpu6502.New()
+	c.Registers.PC = 0x0200
+	c.AddHooks(&cpu6502.Hooks{
+		BeforeInstruction: func(c *cpu6502.Cpu6502, pc uint16, opcode byte) {
+			panic("hook failed")
+		},
+	})
+
+	defer func() {
+		if r := recover(); r != "hook failed" {
+			t.Errorf("recovered %v, want the hook's panic", r)
+		}
+	}()
+	stop := RunUntilTrap(c, 0)
+	t.Errorf("RunUntilTrap returned %+v", stop)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	assembler "izzudinhafiz.com/go-6502/assembler"
+	cpu "izzudinhafiz.com/go-6502/cpu"
+	linker "izzudinhafiz.com/go-6502/linker"
+	loader "izzudinhafiz.com/go-6502/loader"
+)
+
+// Output formats for images the tools write
+var outputFormats = []string{"raw", "ihex", "srec"}
+
+// asm [-variant V] [-o FILE] SOURCE
+func asmCommand(args []string) error {
+	flags := flag.NewFlagSet("asm", flag.ContinueOnError)
+	variantName := flags.String("variant", "nmos", "CPU variant whose instructions are accepted: nmos, 2a03 or 65c02")
+	out := flags.String("o", "", "output object, the source with a .o extension when empty")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return usageError("asm [-variant V] [-o FILE] SOURCE")
+	}
+	variant, err := cpu.ParseVariant(*variantName)
+	if err != nil {
+		return usageError("%v", err)
+	}
+
+	path := flags.Arg(0)
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	obj, err := assembler.Assemble(filepath.Base(path), source, variant)
+	if err != nil {
+		return err
+	}
+
+	if *out == "" {
+		*out = strings.TrimSuffix(path, filepath.Ext(path)) + ".o"
+	}
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if err := linker.WriteObject(f, obj); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// link [flags] OBJECT...
+func linkCommand(args []string) error {
+	flags := flag.NewFlagSet("link", flag.ContinueOnError)
+	config := flags.String("config", "", "memory configuration in ld65 syntax")
+	out := flags.String("o", "", "output image")
+	format := flags.String("format", "raw", "output format: raw, ihex or srec")
+	start := flags.String("start", "", "start address or symbol recorded in ihex and srec output")
+	mapFile := flags.String("map", "", "write segment placements and symbols to this file")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *config == "" || *out == "" || flags.NArg() == 0 {
+		return usageError("link -config FILE -o FILE [flags] OBJECT...")
+	}
+
+	cfg, err := readLinkerConfig(*config)
+	if err != nil {
+		return err
+	}
+	var objects []*linker.Object
+	for _, path := range flags.Args() {
+		obj, err := readObject(path)
+		if err != nil {
+			return err
+		}
+		objects = append(objects, obj)
+	}
+
+	linked, err := linker.Link(objects, cfg)
+	if err != nil {
+		return err
+	}
+
+	img := &loader.Image{}
+	for _, area := range linked.Areas {
+		img.Segments = append(img.Segments, loader.Segment{Addr: area.Start, Data: area.Data})
+	}
+	if *start != "" {
+		addr, ok := linked.Symbols[*start]
+		if !ok {
+			n, err := parseNumber(*start)
+			if err != nil || n > 0xFFFF {
+				return fmt.Errorf("-start %v is neither a symbol nor an address", *start)
+			}
+			addr = int(n)
+		}
+		img.Start, img.HasStart = addr, true
+	}
+	if err := writeImageFile(*out, img, *format); err != nil {
+		return err
+	}
+
+	if *mapFile != "" {
+		f, err := os.Create(*mapFile)
+		if err != nil {
+			return err
+		}
+		if err := linked.WriteMap(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	return nil
+}
+
+func readLinkerConfig(path string) (*linker.Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	cfg, err := linker.ParseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func readObject(path string) (*linker.Object, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	obj, err := linker.ReadObject(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return obj, nil
+}
+
+// writeImageFile writes an image in one of outputFormats. Raw output is the
+// segments one after another, the way ld65 writes memory areas to a file.
+func writeImageFile(path string, img *loader.Image, format string) error {
+	var write func(w io.Writer) error
+	switch format {
+	case "raw":
+		write = func(w io.Writer) error {
+			for _, seg := range img.Segments {
+				if _, err := w.Write(seg.Data); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case "ihex":
+		write = func(w io.Writer) error { return loader.WriteIntelHex(w, img) }
+	case "srec":
+		write = func(w io.Writer) error { return loader.WriteSRecord(w, img, loader.SREC_S19) }
+	default:
+		return usageError("-format must be one of %v", outputFormats)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	if err := write(w); err != nil {
+		f.Close()
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// convert [flags] IMAGE
+func convertCommand(args []string) error {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	as := flags.String("as", "auto", "input format: auto, raw, ihex, srec, prg or o65")
+	addr := flags.String("addr", "0", "load address for raw images")
+	out := flags.String("o", "", "output image")
+	format := flags.String("format", "ihex", "output format: raw, ihex or srec")
+	from := flags.String("from", "", "first address to export, the start of the image when empty")
+	to := flags.String("to", "", "last address to export, the end of the image when empty")
+	start := flags.String("start", "", "start address to record, else the image's own")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	if *out == "" || flags.NArg() != 1 {
+		return usageError("convert -o FILE [flags] IMAGE")
+	}
+
+	inFormat, err := loader.ParseFormat(*as)
+	if err != nil {
+		return usageError("%v", err)
+	}
+	base, err := parseNumber(*addr)
+	if err != nil || base > 0xFFFF {
+		return usageError("bad -addr %q", *addr)
+	}
+	img, err := loader.LoadFile(flags.Arg(0), loader.Options{Format: inFormat, Addr: int(base)})
+	if err != nil {
+		return err
+	}
+
+	lo, hi := uint64(0), uint64(0xFFFF)
+	if *from != "" {
+		if lo, err = parseNumber(*from); err != nil {
+			return usageError("bad -from %q", *from)
+		}
+	}
+	if *to != "" {
+		if hi, err = parseNumber(*to); err != nil {
+			return usageError("bad -to %q", *to)
+		}
+	}
+	img = img.Slice(int(lo), int(hi)+1)
+	if len(img.Segments) == 0 {
+		return fmt.Errorf("%v: nothing between $%04X and $%04X", flags.Arg(0), lo, hi)
+	}
+	if *start != "" {
+		s, err := parseNumber(*start)
+		if err != nil || s > 0xFFFF {
+			return usageError("bad -start %q", *start)
+		}
+		img.Start, img.HasStart = int(s), true
+	}
+	return writeImageFile(*out, img, *format)
+}
@@ -0,0 +1,337 @@
+package linker
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Memory area types
+const (
+	MEM_RW byte = iota
+	MEM_RO
+)
+
+// Segment types
+const (
+	SEGTYPE_RO byte = iota
+	SEGTYPE_RW
+	SEGTYPE_BSS
+	SEGTYPE_ZP
+)
+
+// MemoryArea is a region of the target address space that segments are placed in.
+type MemoryArea struct {
+	Name    string
+	Start   int
+	Size    int
+	Type    byte
+	Fill    bool // Pad the emitted image to the full size of the area
+	FillVal byte
+}
+
+// SegmentConfig describes where a segment is loaded and where it runs.
+// Run defaults to Load when it is not given.
+type SegmentConfig struct {
+	Name   string
+	Load   string
+	Run    string
+	Type   byte
+	Start  int // Fixed start address, -1 when the segment follows the previous one
+	Align  int
+	Define bool // Export __NAME_LOAD__, __NAME_RUN__ and __NAME_SIZE__
+}
+
+// Config is a parsed linker memory configuration
+type Config struct {
+	Memory   []MemoryArea
+	Segments []SegmentConfig
+	Symbols  map[string]int
+}
+
+// ParseConfig reads a configuration in a subset of the ld65 syntax:
+//
+//	MEMORY {
+//	    ZP:  start = $0000, size = $0100, type = rw;
+//	    ROM: start = $8000, size = $8000, type = ro, fill = yes, fillval = $FF;
+//	}
+//	SEGMENTS {
+//	    ZEROPAGE: load = ZP, type = zp;
+//	    CODE:     load = ROM, type = ro;
+//	    DATA:     load = ROM, run = RAM, type = rw, define = yes;
+//	    VECTORS:  load = ROM, type = ro, start = $FFFA;
+//	}
+//	SYMBOLS {
+//	    __STACKSIZE__: value = $0100;
+//	}
+//
+// Numbers may be written in decimal, $hex or %binary. Comments start with '#'.
+func ParseConfig(r io.Reader) (*Config, error) {
+	src, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	p := configParser{tokens: tokenizeConfig(string(src))}
+	cfg := &Config{Symbols: map[string]int{}}
+
+	for !p.done() {
+		block := p.next()
+		if err := p.expect("{"); err != nil {
+			return nil, err
+		}
+
+		for !p.done() && p.peek() != "}" {
+			name := p.next()
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+			attrs, err := p.attributes()
+			if err != nil {
+				return nil, fmt.Errorf("%v %v: %w", block, name, err)
+			}
+
+			switch strings.ToUpper(block) {
+			case "MEMORY":
+				area, err := memoryFromAttributes(name, attrs)
+				if err != nil {
+					return nil, err
+				}
+				cfg.Memory = append(cfg.Memory, area)
+			case "SEGMENTS":
+				seg, err := segmentFromAttributes(name, attrs)
+				if err != nil {
+					return nil, err
+				}
+				cfg.Segments = append(cfg.Segments, seg)
+			case "SYMBOLS":
+				value, err := parseNumber(attrs["value"])
+				if err != nil {
+					return nil, fmt.Errorf("symbol %v: %w", name, err)
+				}
+				cfg.Symbols[name] = value
+			default:
+				return nil, fmt.Errorf("unknown configuration block %q", block)
+			}
+		}
+		if err := p.expect("}"); err != nil {
+			return nil, err
+		}
+	}
+
+	return cfg, cfg.validate()
+}
+
+func (cfg *Config) memoryArea(name string) *MemoryArea {
+	for i := range cfg.Memory {
+		if cfg.Memory[i].Name == name {
+			return &cfg.Memory[i]
+		}
+	}
+	return nil
+}
+
+func (cfg *Config) validate() error {
+	for _, seg := range cfg.Segments {
+		if cfg.memoryArea(seg.Load) == nil {
+			return fmt.Errorf("segment %v is loaded into unknown memory area %q", seg.Name, seg.Load)
+		}
+		run := cfg.memoryArea(seg.Run)
+		if run == nil {
+			return fmt.Errorf("segment %v runs in unknown memory area %q", seg.Name, seg.Run)
+		}
+		// Only read only segments may run from ROM, the rest get written to
+		if seg.Type != SEGTYPE_RO && run.Type == MEM_RO {
+			return fmt.Errorf("segment %v is writable but runs in read only memory area %v", seg.Name, run.Name)
+		}
+	}
+	for _, area := range cfg.Memory {
+		if area.Start < 0 || area.Size <= 0 || area.Start+area.Size > 0x10000 {
+			return fmt.Errorf("memory area %v does not fit in the 64K address space", area.Name)
+		}
+	}
+	return nil
+}
+
+func memoryFromAttributes(name string, attrs map[string]string) (MemoryArea, error) {
+	area := MemoryArea{Name: name}
+	var err error
+
+	if area.Start, err = parseNumber(attrs["start"]); err != nil {
+		return area, fmt.Errorf("memory %v start: %w", name, err)
+	}
+	if area.Size, err = parseNumber(attrs["size"]); err != nil {
+		return area, fmt.Errorf("memory %v size: %w", name, err)
+	}
+
+	switch strings.ToLower(attrs["type"]) {
+	case "", "rw":
+		area.Type = MEM_RW
+	case "ro":
+		area.Type = MEM_RO
+	default:
+		return area, fmt.Errorf("memory %v: unknown type %q", name, attrs["type"])
+	}
+
+	area.Fill = parseBool(attrs["fill"])
+	if v, ok := attrs["fillval"]; ok {
+		fill, err := parseNumber(v)
+		if err != nil {
+			return area, fmt.Errorf("memory %v fillval: %w", name, err)
+		}
+		area.FillVal = byte(fill)
+	}
+
+	return area, nil
+}
+
+func segmentFromAttributes(name string, attrs map[string]string) (SegmentConfig, error) {
+	seg := SegmentConfig{Name: name, Load: attrs["load"], Run: attrs["run"], Start: -1, Align: 1}
+	if seg.Run == "" {
+		seg.Run = seg.Load
+	}
+
+	switch strings.ToLower(attrs["type"]) {
+	case "", "ro":
+		seg.Type = SEGTYPE_RO
+	case "rw":
+		seg.Type = SEGTYPE_RW
+	case "bss":
+		seg.Type = SEGTYPE_BSS
+	case "zp":
+		seg.Type = SEGTYPE_ZP
+	default:
+		return seg, fmt.Errorf("segment %v: unknown type %q", name, attrs["type"])
+	}
+
+	if v, ok := attrs["start"]; ok {
+		start, err := parseNumber(v)
+		if err != nil {
+			return seg, fmt.Errorf("segment %v start: %w", name, err)
+		}
+		seg.Start = start
+	}
+	if v, ok := attrs["align"]; ok {
+		align, err := parseNumber(v)
+		if err != nil || align <= 0 {
+			return seg, fmt.Errorf("segment %v: invalid align %q", name, v)
+		}
+		seg.Align = align
+	}
+
+	seg.Define = parseBool(attrs["define"])
+	return seg, nil
+}
+
+func parseNumber(s string) (int, error) {
+	var v int64
+	var err error
+
+	switch {
+	case s == "":
+		return 0, fmt.Errorf("missing value")
+	case s[0] == '$':
+		v, err = strconv.ParseInt(s[1:], 16, 32)
+	case s[0] == '%':
+		v, err = strconv.ParseInt(s[1:], 2, 32)
+	default:
+		v, err = strconv.ParseInt(s, 0, 32)
+	}
+
+	return int(v), err
+}
+
+func parseBool(s string) bool {
+	switch strings.ToLower(s) {
+	case "yes", "true", "1":
+		return true
+	}
+	return false
+}
+
+type configParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *configParser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *configParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *configParser) next() string {
+	tok := p.peek()
+	p.pos += 1
+	return tok
+}
+
+func (p *configParser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		return fmt.Errorf("expected %q, found %q", tok, got)
+	}
+	return nil
+}
+
+// attributes parses "key = value, key = value;"
+func (p *configParser) attributes() (map[string]string, error) {
+	attrs := map[string]string{}
+	for {
+		key := strings.ToLower(p.next())
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		attrs[key] = p.next()
+
+		switch p.next() {
+		case ",":
+			continue
+		case ";":
+			return attrs, nil
+		default:
+			return nil, fmt.Errorf("expected ',' or ';' after %v", key)
+		}
+	}
+}
+
+func tokenizeConfig(src string) []string {
+	var tokens []string
+	var current strings.Builder
+
+	flush := func() {
+		if current.Len() > 0 {
+			tokens = append(tokens, current.String())
+			current.Reset()
+		}
+	}
+
+	inComment := false
+	for _, r := range src {
+		switch {
+		case inComment:
+			if r == '\n' {
+				inComment = false
+			}
+		case r == '#':
+			flush()
+			inComment = true
+		case unicode.IsSpace(r):
+			flush()
+		case strings.ContainsRune("{}:=,;", r):
+			flush()
+			tokens = append(tokens, string(r))
+		case r == '"':
+			flush()
+		default:
+			current.WriteRune(r)
+		}
+	}
+	flush()
+
+	return tokens
+}
@@ -0,0 +1,312 @@
+package linker
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	cpu6502 "izzudinhafiz.com/go-6502/cpu"
+)
+
+// Placement records where a linked segment ended up
+type Placement struct {
+	Segment string
+	Load    int
+	Run     int
+	Size    int
+}
+
+// ImageArea holds the bytes emitted into one memory area
+type ImageArea struct {
+	Name  string
+	Start int
+	Data  []byte
+}
+
+// Image is the output of the linker, ready to be written out or loaded into a CPU
+type Image struct {
+	Areas      []ImageArea
+	Symbols    map[string]int
+	Placements []Placement
+}
+
+type placedSection struct {
+	obj     *Object
+	section *Section
+	load    int
+	run     int
+}
+
+// Link places the sections of every object according to the configuration,
+// resolves imports against exports and applies relocations.
+func Link(objects []*Object, cfg *Config) (*Image, error) {
+	for _, obj := range objects {
+		if err := obj.Validate(); err != nil {
+			return nil, err
+		}
+		for _, sec := range obj.Sections {
+			if !cfg.hasSegment(sec.Segment) {
+				return nil, fmt.Errorf("%v: segment %v is not in the linker configuration", obj.Name, sec.Segment)
+			}
+		}
+	}
+
+	image := &Image{Symbols: map[string]int{}}
+	placed := map[*Section]*placedSection{}
+	cursors := map[string]int{}
+	for _, area := range cfg.Memory {
+		cursors[area.Name] = area.Start
+	}
+
+	// Place every segment, sections keep the order of the object list
+	for _, seg := range cfg.Segments {
+		var sections []*placedSection
+		for _, obj := range objects {
+			for i := range obj.Sections {
+				if obj.Sections[i].Segment == seg.Name {
+					sections = append(sections, &placedSection{obj: obj, section: &obj.Sections[i]})
+				}
+			}
+		}
+		if len(sections) == 0 && !seg.Define {
+			continue
+		}
+
+		run, err := cfg.allocate(cursors, seg, seg.Run, seg.Start, sections, func(p *placedSection, addr int) { p.run = addr })
+		if err != nil {
+			return nil, err
+		}
+		load := run
+		if seg.Load != seg.Run {
+			load, err = cfg.allocate(cursors, seg, seg.Load, -1, sections, func(p *placedSection, addr int) { p.load = addr })
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			for _, p := range sections {
+				p.load = p.run
+			}
+		}
+
+		size := cursors[seg.Run] - run
+		if seg.Type == SEGTYPE_ZP && run+size > 0x100 {
+			return nil, fmt.Errorf("zeropage segment %v extends past $00FF", seg.Name)
+		}
+
+		for _, p := range sections {
+			placed[p.section] = p
+		}
+		image.Placements = append(image.Placements, Placement{seg.Name, load, run, size})
+
+		if seg.Define {
+			image.Symbols["__"+seg.Name+"_LOAD__"] = load
+			image.Symbols["__"+seg.Name+"_RUN__"] = run
+			image.Symbols["__"+seg.Name+"_SIZE__"] = size
+		}
+	}
+
+	// Collect the global symbol table
+	for name, value := range cfg.Symbols {
+		if _, exists := image.Symbols[name]; exists {
+			return nil, fmt.Errorf("symbol %v in the configuration is already defined for segment placement", name)
+		}
+		image.Symbols[name] = value
+	}
+	for _, obj := range objects {
+		for _, e := range obj.Exports {
+			if _, exists := image.Symbols[e.Name]; exists {
+				return nil, fmt.Errorf("%v: duplicate symbol %v", obj.Name, e.Name)
+			}
+			value := e.Value
+			if e.Section >= 0 {
+				value += placed[&obj.Sections[e.Section]].run
+			}
+			image.Symbols[e.Name] = value
+		}
+	}
+
+	// Relocate and emit bytes into the load areas
+	buffers := map[string][]byte{}
+	used := map[string]int{}
+	for _, obj := range objects {
+		for i := range obj.Sections {
+			sec := &obj.Sections[i]
+			p := placed[sec]
+			if len(sec.Data) == 0 {
+				continue
+			}
+			if seg := cfg.segment(sec.Segment); seg.Type == SEGTYPE_BSS || seg.Type == SEGTYPE_ZP {
+				return nil, fmt.Errorf("%v: segment %v cannot contain initialised data", obj.Name, sec.Segment)
+			}
+
+			data := make([]byte, len(sec.Data))
+			copy(data, sec.Data)
+			for _, r := range sec.Relocations {
+				if err := applyRelocation(data, p, r, image.Symbols, placed); err != nil {
+					return nil, fmt.Errorf("%v: %w", obj.Name, err)
+				}
+			}
+
+			area := cfg.memoryArea(cfg.segment(sec.Segment).Load)
+			buf := buffers[area.Name]
+			if buf == nil {
+				buf = make([]byte, area.Size)
+				for j := range buf {
+					buf[j] = area.FillVal
+				}
+				buffers[area.Name] = buf
+			}
+			offset := p.load - area.Start
+			copy(buf[offset:], data)
+			if end := offset + len(data); end > used[area.Name] {
+				used[area.Name] = end
+			}
+		}
+	}
+
+	for _, area := range cfg.Memory {
+		buf := buffers[area.Name]
+		if buf == nil && !area.Fill {
+			continue
+		}
+		if buf == nil {
+			buf = make([]byte, area.Size)
+			for j := range buf {
+				buf[j] = area.FillVal
+			}
+		}
+		if !area.Fill {
+			buf = buf[:used[area.Name]]
+		}
+		image.Areas = append(image.Areas, ImageArea{area.Name, area.Start, buf})
+	}
+
+	return image, nil
+}
+
+// allocate reserves room for the sections in a memory area and reports the start of the segment
+func (cfg *Config) allocate(cursors map[string]int, seg SegmentConfig, areaName string, start int, sections []*placedSection, set func(*placedSection, int)) (int, error) {
+	area := cfg.memoryArea(areaName)
+	addr := alignUp(cursors[areaName], seg.Align)
+	if start >= 0 {
+		if start < cursors[areaName] {
+			return 0, fmt.Errorf("segment %v at $%04X overlaps earlier segments in %v", seg.Name, start, areaName)
+		}
+		addr = start
+	}
+
+	segStart := addr
+	for _, p := range sections {
+		addr = alignUp(addr, p.section.Align)
+		set(p, addr)
+		addr += p.section.Len()
+	}
+
+	if addr > area.Start+area.Size {
+		return 0, fmt.Errorf("segment %v overflows memory area %v by %d bytes", seg.Name, areaName, addr-(area.Start+area.Size))
+	}
+	cursors[areaName] = addr
+	return segStart, nil
+}
+
+func (cfg *Config) hasSegment(name string) bool {
+	return cfg.segment(name) != nil
+}
+
+func (cfg *Config) segment(name string) *SegmentConfig {
+	for i := range cfg.Segments {
+		if cfg.Segments[i].Name == name {
+			return &cfg.Segments[i]
+		}
+	}
+	return nil
+}
+
+func applyRelocation(data []byte, p *placedSection, r Relocation, symbols map[string]int, placed map[*Section]*placedSection) error {
+	var value int
+	if r.TargetKind == TARGET_IMPORT {
+		name := p.obj.Imports[r.Target]
+		addr, ok := symbols[name]
+		if !ok {
+			return fmt.Errorf("unresolved import %v", name)
+		}
+		value = addr
+	} else {
+		value = placed[&p.obj.Sections[r.Target]].run
+	}
+	value += r.Addend
+
+	switch r.Kind {
+	case RELOC_WORD:
+		data[r.Offset] = byte(value)
+		data[r.Offset+1] = byte(value >> 8)
+	case RELOC_LOW:
+		data[r.Offset] = byte(value)
+	case RELOC_HIGH:
+		data[r.Offset] = byte(value >> 8)
+	case RELOC_ZEROPAGE:
+		if value < 0 || value > 0xFF {
+			return fmt.Errorf("zeropage relocation at %v+%d resolves to $%04X", p.section.Segment, r.Offset, value)
+		}
+		data[r.Offset] = byte(value)
+	case RELOC_BRANCH:
+		distance := value - (p.run + r.Offset + 1)
+		if distance < -128 || distance > 127 {
+			return fmt.Errorf("branch at %v+%d is out of range (%d bytes)", p.section.Segment, r.Offset, distance)
+		}
+		data[r.Offset] = byte(distance)
+	}
+	return nil
+}
+
+func alignUp(addr int, align int) int {
+	if align <= 1 {
+		return addr
+	}
+	return (addr + align - 1) / align * align
+}
+
+// LoadInto copies every emitted memory area into the CPU address space
+func (img *Image) LoadInto(c *cpu6502.Cpu6502) {
+	for _, area := range img.Areas {
+		c.WriteMemory(area.Start, area.Data)
+	}
+}
+
+// Area returns the emitted bytes of a memory area, or nil if nothing was emitted into it
+func (img *Image) Area(name string) []byte {
+	for _, area := range img.Areas {
+		if area.Name == name {
+			return area.Data
+		}
+	}
+	return nil
+}
+
+// WriteMap writes a human readable listing of segment placements and symbols
+func (img *Image) WriteMap(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "Segment          Load   Run    Size\n"); err != nil {
+		return err
+	}
+	for _, p := range img.Placements {
+		if _, err := fmt.Fprintf(w, "%-16v $%04X  $%04X  $%04X\n", p.Segment, p.Load, p.Run, p.Size); err != nil {
+			return err
+		}
+	}
+
+	names := make([]string, 0, len(img.Symbols))
+	for name := range img.Symbols {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	if _, err := fmt.Fprintf(w, "\nSymbols\n"); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "%-24v $%04X\n", name, img.Symbols[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,271 @@
+package linker
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testConfig = `
+# Zero page, RAM and a 32K ROM with the vectors at the top
+MEMORY {
+    ZP:  start = $0000, size = $0100, type = rw;
+    RAM: start = $0200, size = $7E00, type = rw;
+    ROM: start = $8000, size = $8000, type = ro, fill = yes, fillval = $FF;
+}
+SEGMENTS {
+    ZEROPAGE: load = ZP, type = zp;
+    CODE:     load = ROM, type = ro;
+    DATA:     load = ROM, run = RAM, type = rw, define = yes;
+    BSS:      load = RAM, type = bss;
+    VECTORS:  load = ROM, type = ro, start = $FFFA;
+}
+SYMBOLS {
+    __STACKSIZE__: value = $0100;
+}
+`
+
+func parseTestConfig(t *testing.T, src string) *Config {
+	t.Helper()
+	cfg, err := ParseConfig(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// main calls print, an import, with the address of a message in DATA
+func mainObject() *Object {
+	return &Object{
+		Name: "main.o",
+		Sections: []Section{
+			{Segment: SEG_CODE, Data: []byte{
+				0xA9, 0x00, // lda #<message
+				0x85, 0x00, // sta ptr
+				0xA9, 0x00, // lda #>message
+				0x85, 0x00, // sta ptr+1
+				0x20, 0x00, 0x00, // jsr print
+				0xD0, 0x00, // bne main
+				0x4C, 0x00, 0x00, // jmp main
+			}, Relocations: []Relocation{
+				{Offset: 1, Kind: RELOC_LOW, TargetKind: TARGET_SECTION, Target: 1},
+				{Offset: 3, Kind: RELOC_ZEROPAGE, TargetKind: TARGET_SECTION, Target: 2},
+				{Offset: 5, Kind: RELOC_HIGH, TargetKind: TARGET_SECTION, Target: 1},
+				{Offset: 7, Kind: RELOC_ZEROPAGE, TargetKind: TARGET_SECTION, Target: 2, Addend: 1},
+				{Offset: 9, Kind: RELOC_WORD, TargetKind: TARGET_IMPORT, Target: 0},
+				{Offset: 12, Kind: RELOC_BRANCH, TargetKind: TARGET_SECTION, Target: 0},
+				{Offset: 14, Kind: RELOC_WORD, TargetKind: TARGET_SECTION, Target: 0},
+			}},
+			{Segment: SEG_DATA, Data: []byte("HI\x00")},
+			{Segment: SEG_ZEROPAGE, Size: 2},
+			{Segment: SEG_BSS, Size: 16, Align: 4},
+			{Segment: "VECTORS", Data: make([]byte, 6), Relocations: []Relocation{
+				{Offset: 2, Kind: RELOC_WORD, TargetKind: TARGET_SECTION, Target: 0},
+			}},
+		},
+		Exports: []Export{{Name: "main", Section: 0}, {Name: "ANSWER", Section: -1, Value: 42}},
+		Imports: []string{"print"},
+	}
+}
+
+func printObject() *Object {
+	return &Object{
+		Name:     "print.o",
+		Sections: []Section{{Segment: SEG_CODE, Data: []byte{0x60}}}, // rts
+		Exports:  []Export{{Name: "print", Section: 0}},
+	}
+}
+
+func TestObjectRoundTrip(t *testing.T) {
+	obj := mainObject()
+	var buf bytes.Buffer
+	if err := WriteObject(&buf, obj); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadObject(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, obj) {
+		t.Errorf("round trip changed the object\n got %+v\nwant %+v", got, obj)
+	}
+}
+
+func TestReadObjectCorrupt(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteObject(&buf, mainObject()); err != nil {
+		t.Fatal(err)
+	}
+	full := buf.Bytes()
+
+	// Every truncation fails cleanly
+	for n := 0; n < len(full); n++ {
+		if _, err := ReadObject(bytes.NewReader(full[:n])); err == nil {
+			t.Errorf("object truncated to %d bytes was accepted", n)
+		}
+	}
+
+	// A section claiming 4 GiB of data must not be allocated
+	huge := append([]byte{}, objectMagic[:]...)
+	huge = append(huge, objectVersion, 0, 0) // no name
+	huge = append(huge, 1, 0)                // one section
+	huge = append(huge, 4, 0, 'C', 'O', 'D', 'E')
+	huge = append(huge, 0xFF, 0xFF, 0xFF, 0xFF) // size
+	huge = append(huge, 1, 0, 1)                // align, has data
+	if _, err := ReadObject(bytes.NewReader(huge)); err == nil {
+		t.Error("4 GiB section was accepted")
+	}
+	huge[len(huge)-1] = 0 // a reservation rather than data
+	if _, err := ReadObject(bytes.NewReader(huge)); err == nil {
+		t.Error("4 GiB reservation was accepted")
+	}
+
+	if _, err := ReadObject(strings.NewReader("ELF\x7f")); err == nil {
+		t.Error("bad magic was accepted")
+	}
+}
+
+func TestParseConfig(t *testing.T) {
+	cfg := parseTestConfig(t, testConfig)
+
+	wantMemory := []MemoryArea{
+		{Name: "ZP", Start: 0x0000, Size: 0x0100, Type: MEM_RW},
+		{Name: "RAM", Start: 0x0200, Size: 0x7E00, Type: MEM_RW},
+		{Name: "ROM", Start: 0x8000, Size: 0x8000, Type: MEM_RO, Fill: true, FillVal: 0xFF},
+	}
+	if !reflect.DeepEqual(cfg.Memory, wantMemory) {
+		t.Errorf("memory %+v, want %+v", cfg.Memory, wantMemory)
+	}
+
+	wantSegments := []SegmentConfig{
+		{Name: "ZEROPAGE", Load: "ZP", Run: "ZP", Type: SEGTYPE_ZP, Start: -1, Align: 1},
+		{Name: "CODE", Load: "ROM", Run: "ROM", Type: SEGTYPE_RO, Start: -1, Align: 1},
+		{Name: "DATA", Load: "ROM", Run: "RAM", Type: SEGTYPE_RW, Start: -1, Align: 1, Define: true},
+		{Name: "BSS", Load: "RAM", Run: "RAM", Type: SEGTYPE_BSS, Start: -1, Align: 1},
+		{Name: "VECTORS", Load: "ROM", Run: "ROM", Type: SEGTYPE_RO, Start: 0xFFFA, Align: 1},
+	}
+	if !reflect.DeepEqual(cfg.Segments, wantSegments) {
+		t.Errorf("segments %+v, want %+v", cfg.Segments, wantSegments)
+	}
+	if cfg.Symbols["__STACKSIZE__"] != 0x100 {
+		t.Errorf("__STACKSIZE__ = %v", cfg.Symbols["__STACKSIZE__"])
+	}
+}
+
+func TestParseConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{"unknown area", "MEMORY { RAM: start = 0, size = $100; } SEGMENTS { CODE: load = ROM; }", "unknown memory area"},
+		{"writable in rom", "MEMORY { ROM: start = $8000, size = $100, type = ro; } SEGMENTS { BSS: load = ROM, type = bss; }", "read only"},
+		{"data runs in rom", "MEMORY { ROM: start = $8000, size = $100, type = ro; } SEGMENTS { DATA: load = ROM, type = rw; }", "read only"},
+		{"too big", "MEMORY { RAM: start = $8000, size = $9000; }", "64K"},
+		{"bad type", "MEMORY { RAM: start = 0, size = 1, type = rx; }", "unknown type"},
+		{"bad block", "STUFF { A: b = c; }", "unknown configuration block"},
+		{"missing semicolon", "MEMORY { RAM: start = 0, size = 1 }", "expected"},
+	}
+	for _, test := range tests {
+		_, err := ParseConfig(strings.NewReader(test.src))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: got error %v, want one containing %q", test.name, err, test.want)
+		}
+	}
+}
+
+func TestLink(t *testing.T) {
+	img, err := Link([]*Object{mainObject(), printObject()}, parseTestConfig(t, testConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// CODE from both objects, then DATA's load image, at the start of ROM
+	rom := img.Area("ROM")
+	if len(rom) != 0x8000 {
+		t.Fatalf("ROM is %d bytes, want the whole area", len(rom))
+	}
+	wantCode := []byte{
+		0xA9, 0x00, // lda #<$0200
+		0x85, 0x00, // sta $00
+		0xA9, 0x02, // lda #>$0200
+		0x85, 0x01, // sta $01
+		0x20, 0x10, 0x80, // jsr print at $8010
+		0xD0, 0xF3, // bne $8000
+		0x4C, 0x00, 0x80, // jmp $8000
+		0x60,           // print: rts
+		'H', 'I', 0x00, // DATA, loaded after CODE
+	}
+	if !bytes.Equal(rom[:len(wantCode)], wantCode) {
+		t.Errorf("ROM starts % X\n          want % X", rom[:len(wantCode)], wantCode)
+	}
+	if rom[len(wantCode)] != 0xFF {
+		t.Errorf("ROM is not filled with $FF after the code")
+	}
+	if vectors := rom[0x7FFA:]; !bytes.Equal(vectors, []byte{0, 0, 0x00, 0x80, 0, 0}) {
+		t.Errorf("vectors % X", vectors)
+	}
+
+	// BSS and ZEROPAGE reserve space but emit nothing
+	if img.Area("ZP") != nil || img.Area("RAM") != nil {
+		t.Error("reservations emitted bytes")
+	}
+
+	wantSymbols := map[string]int{
+		"main":          0x8000,
+		"print":         0x8010,
+		"ANSWER":        42,
+		"__STACKSIZE__": 0x100,
+		"__DATA_LOAD__": 0x8011,
+		"__DATA_RUN__":  0x0200,
+		"__DATA_SIZE__": 3,
+	}
+	if !reflect.DeepEqual(img.Symbols, wantSymbols) {
+		t.Errorf("symbols %v, want %v", img.Symbols, wantSymbols)
+	}
+
+	// BSS follows DATA's run address in RAM, and the padding that aligns its
+	// section to 4 counts towards the segment
+	for _, p := range img.Placements {
+		if p.Segment == SEG_BSS && (p.Run != 0x0203 || p.Size != 17) {
+			t.Errorf("BSS placed at $%04X with %d bytes", p.Run, p.Size)
+		}
+	}
+}
+
+func TestLinkErrors(t *testing.T) {
+	cfg := parseTestConfig(t, testConfig)
+
+	if _, err := Link([]*Object{mainObject()}, cfg); err == nil || !strings.Contains(err.Error(), "unresolved import print") {
+		t.Errorf("missing import: %v", err)
+	}
+	if _, err := Link([]*Object{mainObject(), printObject(), printObject()}, cfg); err == nil || !strings.Contains(err.Error(), "duplicate symbol") {
+		t.Errorf("duplicate export: %v", err)
+	}
+
+	clash := parseTestConfig(t, testConfig+"SYMBOLS { __DATA_SIZE__: value = 1; }\n")
+	if _, err := Link([]*Object{mainObject(), printObject()}, clash); err == nil || !strings.Contains(err.Error(), "already defined for segment placement") {
+		t.Errorf("configuration symbol clashing with a segment symbol: %v", err)
+	}
+
+	far := printObject()
+	far.Sections = append(far.Sections, Section{Segment: SEG_CODE, Data: make([]byte, 200)}, Section{
+		Segment:     SEG_CODE,
+		Data:        []byte{0xD0, 0x00},
+		Relocations: []Relocation{{Offset: 1, Kind: RELOC_BRANCH, TargetKind: TARGET_SECTION, Target: 0}},
+	})
+	if _, err := Link([]*Object{far}, cfg); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("long branch: %v", err)
+	}
+
+	big := &Object{Name: "big.o", Sections: []Section{{Segment: SEG_ZEROPAGE, Size: 0x101}}}
+	if _, err := Link([]*Object{big}, cfg); err == nil || !strings.Contains(err.Error(), "overflows") {
+		t.Errorf("zero page overflow: %v", err)
+	}
+
+	unknown := &Object{Name: "odd.o", Sections: []Section{{Segment: "ODD", Data: []byte{0}}}}
+	if _, err := Link([]*Object{unknown}, cfg); err == nil || !strings.Contains(err.Error(), "not in the linker configuration") {
+		t.Errorf("unknown segment: %v", err)
+	}
+}
@@ -0,0 +1,320 @@
+// Package linker implements a relocatable object format for 6502 code and a
+// linker that places object segments into memory according to a memory
+// configuration file, in the spirit of the ca65/ld65 toolchain.
+//
+// Objects come from the assembler package, or are built directly from the
+// types in this file, and are read from disk with ReadObject.
+package linker
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Well known segment names
+const (
+	SEG_CODE     = "CODE"
+	SEG_DATA     = "DATA"
+	SEG_BSS      = "BSS"
+	SEG_ZEROPAGE = "ZEROPAGE"
+)
+
+// Relocation kinds
+const (
+	RELOC_WORD     byte = iota // 16 bit little endian address
+	RELOC_LOW                  // low byte of the address
+	RELOC_HIGH                 // high byte of the address
+	RELOC_ZEROPAGE             // single byte address, must resolve below $0100
+	RELOC_BRANCH               // signed 8 bit offset relative to the byte after the operand
+)
+
+// Relocation targets
+const (
+	TARGET_SECTION byte = iota // Target indexes a section in the same object
+	TARGET_IMPORT              // Target indexes the import table
+)
+
+// Section is the contribution of one object file to a named segment.
+type Section struct {
+	Segment     string
+	Data        []byte
+	Size        int // Size of the section; only used when Data is empty (BSS/ZEROPAGE reservations)
+	Align       int
+	Relocations []Relocation
+}
+
+// Relocation patches Section.Data[Offset] with the final address of a target plus Addend.
+type Relocation struct {
+	Offset     int
+	Kind       byte
+	TargetKind byte
+	Target     int
+	Addend     int
+}
+
+// Export makes a location inside a section visible to other objects.
+// When Section is -1 the symbol is absolute and Value is used as is.
+type Export struct {
+	Name    string
+	Section int
+	Value   int
+}
+
+type Object struct {
+	Name     string
+	Sections []Section
+	Exports  []Export
+	Imports  []string
+}
+
+var objectMagic = [4]byte{'G', '6', '5', 'O'}
+
+const objectVersion = 1
+
+// Len returns the number of bytes the section occupies.
+func (s *Section) Len() int {
+	if len(s.Data) > 0 {
+		return len(s.Data)
+	}
+	return s.Size
+}
+
+// Validate checks that every relocation and export refers to something that exists in the object.
+func (o *Object) Validate() error {
+	for i, sec := range o.Sections {
+		if sec.Segment == "" {
+			return fmt.Errorf("%v: section %d has no segment name", o.Name, i)
+		}
+		for _, r := range sec.Relocations {
+			width := 1
+			if r.Kind == RELOC_WORD {
+				width = 2
+			}
+			if r.Offset < 0 || r.Offset+width > len(sec.Data) {
+				return fmt.Errorf("%v: relocation at offset %d lies outside section %v", o.Name, r.Offset, sec.Segment)
+			}
+			if r.Kind > RELOC_BRANCH {
+				return fmt.Errorf("%v: unknown relocation kind %d", o.Name, r.Kind)
+			}
+			switch r.TargetKind {
+			case TARGET_SECTION:
+				if r.Target < 0 || r.Target >= len(o.Sections) {
+					return fmt.Errorf("%v: relocation refers to missing section %d", o.Name, r.Target)
+				}
+			case TARGET_IMPORT:
+				if r.Target < 0 || r.Target >= len(o.Imports) {
+					return fmt.Errorf("%v: relocation refers to missing import %d", o.Name, r.Target)
+				}
+			default:
+				return fmt.Errorf("%v: unknown relocation target kind %d", o.Name, r.TargetKind)
+			}
+		}
+	}
+	for _, e := range o.Exports {
+		if e.Section < -1 || e.Section >= len(o.Sections) {
+			return fmt.Errorf("%v: export %v refers to missing section %d", o.Name, e.Name, e.Section)
+		}
+	}
+	return nil
+}
+
+// WriteObject serialises an object file.
+func WriteObject(w io.Writer, o *Object) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	ow := objectWriter{w: bw}
+	ow.bytes(objectMagic[:])
+	ow.u8(objectVersion)
+	ow.str(o.Name)
+
+	ow.u16(len(o.Sections))
+	for _, sec := range o.Sections {
+		ow.str(sec.Segment)
+		ow.u32(sec.Len())
+		ow.u16(sec.Align)
+		if len(sec.Data) > 0 {
+			ow.u8(1)
+			ow.bytes(sec.Data)
+		} else {
+			ow.u8(0)
+		}
+		ow.u16(len(sec.Relocations))
+		for _, r := range sec.Relocations {
+			ow.u32(r.Offset)
+			ow.u8(r.Kind)
+			ow.u8(r.TargetKind)
+			ow.u16(r.Target)
+			ow.u32(int(int32(r.Addend)))
+		}
+	}
+
+	ow.u16(len(o.Exports))
+	for _, e := range o.Exports {
+		ow.str(e.Name)
+		ow.u16(e.Section + 1)
+		ow.u32(e.Value)
+	}
+
+	ow.u16(len(o.Imports))
+	for _, name := range o.Imports {
+		ow.str(name)
+	}
+
+	if ow.err != nil {
+		return ow.err
+	}
+	return bw.Flush()
+}
+
+// ReadObject parses an object file written by WriteObject. Sizes in the file
+// are checked against the bytes that follow them, so a corrupt file cannot
+// make it allocate more than the file holds.
+func ReadObject(r io.Reader) (*Object, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	or := objectReader{data: data}
+
+	var magic [4]byte
+	copy(magic[:], or.bytes(4))
+	if or.err == nil && magic != objectMagic {
+		return nil, errors.New("not a 6502 object file")
+	}
+	if version := or.u8(); or.err == nil && version != objectVersion {
+		return nil, fmt.Errorf("unsupported object version %d", version)
+	}
+
+	o := &Object{Name: or.str()}
+
+	numSections := or.u16()
+	for i := 0; i < numSections && or.err == nil; i++ {
+		sec := Section{Segment: or.str()}
+		size := or.u32()
+		sec.Align = or.u16()
+		if or.u8() == 1 {
+			sec.Data = or.bytes(size)
+		} else if size > 0x10000 {
+			or.fail(fmt.Errorf("section %v reserves %d bytes, more than the address space", sec.Segment, size))
+		} else {
+			sec.Size = size
+		}
+		numRelocs := or.u16()
+		for j := 0; j < numRelocs && or.err == nil; j++ {
+			sec.Relocations = append(sec.Relocations, Relocation{
+				Offset:     or.u32(),
+				Kind:       or.u8(),
+				TargetKind: or.u8(),
+				Target:     or.u16(),
+				Addend:     int(int32(uint32(or.u32()))),
+			})
+		}
+		o.Sections = append(o.Sections, sec)
+	}
+
+	numExports := or.u16()
+	for i := 0; i < numExports && or.err == nil; i++ {
+		o.Exports = append(o.Exports, Export{Name: or.str(), Section: or.u16() - 1, Value: or.u32()})
+	}
+
+	numImports := or.u16()
+	for i := 0; i < numImports && or.err == nil; i++ {
+		o.Imports = append(o.Imports, or.str())
+	}
+
+	if or.err != nil {
+		return nil, fmt.Errorf("reading object: %w", or.err)
+	}
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// objectWriter and objectReader keep the first error so serialisation code can stay linear
+type objectWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (ow *objectWriter) bytes(b []byte) {
+	if ow.err == nil {
+		_, ow.err = ow.w.Write(b)
+	}
+}
+
+func (ow *objectWriter) u8(v byte) { ow.bytes([]byte{v}) }
+
+func (ow *objectWriter) u16(v int) {
+	var buf [2]byte
+	binary.LittleEndian.PutUint16(buf[:], uint16(v))
+	ow.bytes(buf[:])
+}
+
+func (ow *objectWriter) u32(v int) {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], uint32(v))
+	ow.bytes(buf[:])
+}
+
+func (ow *objectWriter) str(s string) {
+	ow.u16(len(s))
+	ow.bytes([]byte(s))
+}
+
+type objectReader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (or *objectReader) fail(err error) {
+	if or.err == nil {
+		or.err = err
+	}
+}
+
+// bytes takes the next n bytes of the file, or fails when fewer are left
+func (or *objectReader) bytes(n int) []byte {
+	if or.err != nil {
+		return nil
+	}
+	if n > len(or.data)-or.pos {
+		or.fail(io.ErrUnexpectedEOF)
+		return nil
+	}
+	b := or.data[or.pos : or.pos+n]
+	or.pos += n
+	return b
+}
+
+func (or *objectReader) u8() byte {
+	if b := or.bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (or *objectReader) u16() int {
+	if b := or.bytes(2); b != nil {
+		return int(binary.LittleEndian.Uint16(b))
+	}
+	return 0
+}
+
+func (or *objectReader) u32() int {
+	if b := or.bytes(4); b != nil {
+		return int(binary.LittleEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (or *objectReader) str() string {
+	return string(or.bytes(or.u16()))
+}
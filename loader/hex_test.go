@@ -0,0 +1,152 @@
+package loader
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testImage(hasStart bool) *Image {
+	code := make([]byte, 40)
+	for i := range code {
+		code[i] = byte(i * 7)
+	}
+	img := &Image{Segments: []Segment{
+		{0x0200, code},
+		{0xFFFA, []byte{0x00, 0x02, 0x00, 0x02, 0x00, 0x02}},
+	}}
+	if hasStart {
+		img.Start, img.HasStart = 0x0200, true
+	}
+	return img
+}
+
+func TestIntelHexRoundTrip(t *testing.T) {
+	for _, hasStart := range []bool{true, false} {
+		img := testImage(hasStart)
+		var buf bytes.Buffer
+		if err := WriteIntelHex(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		got, err := ReadIntelHex(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, img) {
+			t.Errorf("start %v: round trip gave %+v, want %+v", hasStart, got, img)
+		}
+	}
+}
+
+func TestSRecordRoundTrip(t *testing.T) {
+	for _, format := range []byte{SREC_S19, SREC_S28, SREC_S37} {
+		for _, hasStart := range []bool{true, false} {
+			img := testImage(hasStart)
+			var buf bytes.Buffer
+			if err := WriteSRecord(&buf, img, format); err != nil {
+				t.Fatal(err)
+			}
+			text := buf.String()
+			got, err := ReadSRecord(&buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, img) {
+				t.Errorf("format %d start %v: round trip gave %+v, want %+v\n%v", format, hasStart, got, img, text)
+			}
+		}
+	}
+}
+
+// Records from other tools, including the S9 with a zero address that many
+// write when there is no start address
+func TestReadSRecord(t *testing.T) {
+	src := "S00600004844521B\nS1130000285F245F2212226A000424290008237C2A\nS5030001FB\nS9030000FC\n"
+	img, err := ReadSRecord(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x28, 0x5F, 0x24, 0x5F, 0x22, 0x12, 0x22, 0x6A, 0x00, 0x04, 0x24, 0x29, 0x00, 0x08, 0x23, 0x7C}
+	if len(img.Segments) != 1 || img.Segments[0].Addr != 0 || !bytes.Equal(img.Segments[0].Data, want) {
+		t.Errorf("segments %+v", img.Segments)
+	}
+	if img.HasStart {
+		t.Errorf("S9 0000 gave a start address")
+	}
+
+	bad := []struct {
+		name string
+		src  string
+	}{
+		{"checksum", "S1130000285F245F2212226A000424290008237C2B\n"},
+		{"length", "S1140000285F245F2212226A000424290008237C2A\n"},
+		{"count", "S1130000285F245F2212226A000424290008237C2A\nS5030002FA\n"},
+		{"type", "S4030000FC\n"},
+		{"not a record", "hello\n"},
+		{"no termination", "S1130000285F245F2212226A000424290008237C2A\nS5030001FB\n"},
+	}
+	for _, test := range bad {
+		if _, err := ReadSRecord(strings.NewReader(test.src)); err == nil {
+			t.Errorf("%v: bad record accepted", test.name)
+		}
+	}
+}
+
+func TestReadIntelHex(t *testing.T) {
+	// Data above 64K through an extended linear address, and a start address
+	src := ":020000040001F9\n:0400100001020304E2\n:04000005000123458E\n:00000001FF\n"
+	img, err := ReadIntelHex(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(img.Segments) != 1 || img.Segments[0].Addr != 0x10010 || !bytes.Equal(img.Segments[0].Data, []byte{1, 2, 3, 4}) {
+		t.Errorf("segments %+v", img.Segments)
+	}
+	if !img.HasStart || img.Start != 0x12345 {
+		t.Errorf("start %X %v", img.Start, img.HasStart)
+	}
+
+	bad := []struct {
+		name string
+		src  string
+	}{
+		{"checksum", ":0400100001020304E3\n:00000001FF\n"},
+		{"length", ":0500100001020304E2\n:00000001FF\n"},
+		{"no end", ":0400100001020304E2\n"},
+		{"type", ":00000009F7\n"},
+		{"not a record", "0400100001020304E2\n"},
+	}
+	for _, test := range bad {
+		if _, err := ReadIntelHex(strings.NewReader(test.src)); err == nil {
+			t.Errorf("%v: bad record accepted", test.name)
+		}
+	}
+}
+
+func TestSlice(t *testing.T) {
+	img := testImage(true).Slice(0x0210, 0xFFFC)
+	want := &Image{
+		Segments: []Segment{{0x0210, testImage(false).Segments[0].Data[0x10:]}, {0xFFFA, []byte{0x00, 0x02}}},
+		Start:    0x0200,
+		HasStart: true,
+	}
+	if !reflect.DeepEqual(img, want) {
+		t.Errorf("slice %+v, want %+v", img, want)
+	}
+	if len(testImage(true).Slice(0x0300, 0x0400).Segments) != 0 {
+		t.Error("slice between segments is not empty")
+	}
+}
+
+func TestContains(t *testing.T) {
+	img := testImage(false)
+	for _, test := range []struct {
+		addr int
+		want bool
+	}{{0x01FF, false}, {0x0200, true}, {0x0227, true}, {0x0228, false}, {0xFFFC, true}, {0xFFFF, true}} {
+		if got := img.Contains(test.addr); got != test.want {
+			t.Errorf("Contains($%04X) = %v, want %v", test.addr, got, test.want)
+		}
+	}
+}
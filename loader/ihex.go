@@ -0,0 +1,142 @@
+package loader
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Intel HEX record types
+const (
+	IHEX_DATA byte = iota
+	IHEX_EOF
+	IHEX_EXTENDED_SEGMENT_ADDR
+	IHEX_START_SEGMENT_ADDR
+	IHEX_EXTENDED_LINEAR_ADDR
+	IHEX_START_LINEAR_ADDR
+)
+
+const hexBytesPerLine = 16
+
+// ReadIntelHex parses an Intel HEX file, verifying every record checksum
+func ReadIntelHex(r io.Reader) (*Image, error) {
+	img := &Image{}
+	base := 0
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum += 1
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if line[0] != ':' {
+			return nil, fmt.Errorf("line %d: record does not start with ':'", lineNum)
+		}
+
+		record, err := hex.DecodeString(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		if len(record) < 5 || len(record) != int(record[0])+5 {
+			return nil, fmt.Errorf("line %d: record length mismatch", lineNum)
+		}
+		if checksum(record[:len(record)-1]) != record[len(record)-1] {
+			return nil, fmt.Errorf("line %d: checksum mismatch", lineNum)
+		}
+
+		addr := int(record[1])<<8 | int(record[2])
+		data := record[4 : len(record)-1]
+
+		switch record[3] {
+		case IHEX_DATA:
+			img.add(base+addr, data)
+		case IHEX_EOF:
+			return img, nil
+		case IHEX_EXTENDED_SEGMENT_ADDR:
+			if len(data) != 2 {
+				return nil, fmt.Errorf("line %d: malformed extended segment address", lineNum)
+			}
+			base = (int(data[0])<<8 | int(data[1])) << 4
+		case IHEX_EXTENDED_LINEAR_ADDR:
+			if len(data) != 2 {
+				return nil, fmt.Errorf("line %d: malformed extended linear address", lineNum)
+			}
+			base = (int(data[0])<<8 | int(data[1])) << 16
+		case IHEX_START_SEGMENT_ADDR:
+			if len(data) != 4 {
+				return nil, fmt.Errorf("line %d: malformed start segment address", lineNum)
+			}
+			cs := int(data[0])<<8 | int(data[1])
+			ip := int(data[2])<<8 | int(data[3])
+			img.Start, img.HasStart = cs<<4+ip, true
+		case IHEX_START_LINEAR_ADDR:
+			if len(data) != 4 {
+				return nil, fmt.Errorf("line %d: malformed start linear address", lineNum)
+			}
+			img.Start = int(data[0])<<24 | int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+			img.HasStart = true
+		default:
+			return nil, fmt.Errorf("line %d: unknown record type %02X", lineNum, record[3])
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("missing end of file record")
+}
+
+// WriteIntelHex writes the image as Intel HEX with 16 data bytes per record
+func WriteIntelHex(w io.Writer, img *Image) error {
+	bw := bufio.NewWriter(w)
+	upper := 0
+
+	for _, seg := range img.Segments {
+		for offset := 0; offset < len(seg.Data); {
+			addr := seg.Addr + offset
+			if addr>>16 != upper {
+				upper = addr >> 16
+				writeHexRecord(bw, 0, IHEX_EXTENDED_LINEAR_ADDR, []byte{byte(upper >> 8), byte(upper)})
+			}
+
+			// Never let a record run across a 64K boundary
+			n := hexBytesPerLine
+			if remaining := len(seg.Data) - offset; remaining < n {
+				n = remaining
+			}
+			if boundary := 0x10000 - addr&0xFFFF; boundary < n {
+				n = boundary
+			}
+
+			writeHexRecord(bw, addr&0xFFFF, IHEX_DATA, seg.Data[offset:offset+n])
+			offset += n
+		}
+	}
+
+	if img.HasStart {
+		s := img.Start
+		writeHexRecord(bw, 0, IHEX_START_LINEAR_ADDR, []byte{byte(s >> 24), byte(s >> 16), byte(s >> 8), byte(s)})
+	}
+	writeHexRecord(bw, 0, IHEX_EOF, nil)
+
+	return bw.Flush()
+}
+
+func writeHexRecord(w *bufio.Writer, addr int, recordType byte, data []byte) {
+	record := append([]byte{byte(len(data)), byte(addr >> 8), byte(addr), recordType}, data...)
+	record = append(record, checksum(record))
+	fmt.Fprintf(w, ":%s\n", strings.ToUpper(hex.EncodeToString(record)))
+}
+
+// checksum is the two's complement of the byte sum, so that a whole record sums to zero
+func checksum(record []byte) byte {
+	var sum byte
+	for _, b := range record {
+		sum += b
+	}
+	return -sum
+}
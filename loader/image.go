@@ -0,0 +1,91 @@
+// Package loader reads and writes program images in the file formats used by
+// 6502 toolchains and EEPROM programmers, and loads them into a Cpu6502.
+package loader
+
+import (
+	"fmt"
+	"sort"
+
+	cpu6502 "izzudinhafiz.com/go-6502/cpu"
+)
+
+// Segment is a contiguous run of bytes at a fixed address
+type Segment struct {
+	Addr int
+	Data []byte
+}
+
+// Image is a loaded program: a set of segments and an optional start address
+type Image struct {
+	Segments []Segment
+	Start    int
+	HasStart bool
+}
+
+// FromMemory builds an image from the CPU address range [start, end)
+func FromMemory(mem []byte, start int, end int) *Image {
+	data := make([]byte, end-start)
+	copy(data, mem[start:end])
+	return &Image{Segments: []Segment{{start, data}}}
+}
+
+// Slice returns the parts of the image within [start, end), keeping its start address
+func (img *Image) Slice(start int, end int) *Image {
+	out := &Image{Start: img.Start, HasStart: img.HasStart}
+	for _, seg := range img.Segments {
+		lo, hi := seg.Addr, seg.Addr+len(seg.Data)
+		if lo < start {
+			lo = start
+		}
+		if hi > end {
+			hi = end
+		}
+		if lo < hi {
+			out.Segments = append(out.Segments, Segment{lo, append([]byte(nil), seg.Data[lo-seg.Addr:hi-seg.Addr]...)})
+		}
+	}
+	return out
+}
+
+// Contains reports whether the image has a byte at addr
+func (img *Image) Contains(addr int) bool {
+	for _, seg := range img.Segments {
+		if addr >= seg.Addr && addr < seg.Addr+len(seg.Data) {
+			return true
+		}
+	}
+	return false
+}
+
+// add appends data at addr, extending the last segment when the data follows on directly
+func (img *Image) add(addr int, data []byte) {
+	if n := len(img.Segments); n > 0 {
+		last := &img.Segments[n-1]
+		if last.Addr+len(last.Data) == addr {
+			last.Data = append(last.Data, data...)
+			return
+		}
+	}
+	img.Segments = append(img.Segments, Segment{addr, append([]byte(nil), data...)})
+}
+
+// Sort orders the segments by address
+func (img *Image) Sort() {
+	sort.SliceStable(img.Segments, func(i, j int) bool {
+		return img.Segments[i].Addr < img.Segments[j].Addr
+	})
+}
+
+// LoadInto writes every segment at its address with Cpu6502.WriteMemory, so
+// images reach ROM on a machine bus
+func (img *Image) LoadInto(c *cpu6502.Cpu6502) error {
+	for _, seg := range img.Segments {
+		if seg.Addr < 0 || seg.Addr+len(seg.Data) > len(c.Memory) {
+			return fmt.Errorf("segment at $%X with %d bytes does not fit in the address space", seg.Addr, len(seg.Data))
+		}
+	}
+	for _, seg := range img.Segments {
+		c.WriteMemory(seg.Addr, seg.Data)
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package loader
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	cpu6502 "izzudinhafiz.com/go-6502/cpu"
+)
+
+// File formats understood by LoadFile
+const (
+	FORMAT_AUTO byte = iota
+	FORMAT_RAW
+	FORMAT_IHEX
+	FORMAT_SREC
+	FORMAT_PRG
+	FORMAT_O65
+)
+
+// How an image's start address is handed to the CPU
+const (
+	BOOT_NONE byte = iota
+	BOOT_RESET_VECTOR
+	BOOT_PC
+)
+
+// Options control how LoadFile interprets a file
+type Options struct {
+	Format byte
+	Addr   int // Load address for raw images, and text base for o65 files when positive
+}
+
+// Detect guesses the format of a file from its name and first bytes
+func Detect(name string, head []byte) byte {
+	if bytes.HasPrefix(head, o65Magic) {
+		return FORMAT_O65
+	}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".hex", ".ihx", ".ihex":
+		return FORMAT_IHEX
+	case ".s19", ".s28", ".s37", ".srec", ".mot":
+		return FORMAT_SREC
+	case ".prg":
+		return FORMAT_PRG
+	case ".o65":
+		return FORMAT_O65
+	}
+
+	trimmed := bytes.TrimLeft(head, " \t\r\n")
+	switch {
+	case len(trimmed) > 0 && trimmed[0] == ':' && isHexText(trimmed[1:]):
+		return FORMAT_IHEX
+	case len(trimmed) > 1 && trimmed[0] == 'S' && trimmed[1] >= '0' && trimmed[1] <= '9' && isHexText(trimmed[2:]):
+		return FORMAT_SREC
+	}
+	return FORMAT_RAW
+}
+
+func isHexText(b []byte) bool {
+	if len(b) > 16 {
+		b = b[:16]
+	}
+	for _, c := range b {
+		isHex := (c >= '0' && c <= '9') || (c >= 'A' && c <= 'F') || (c >= 'a' && c <= 'f')
+		if !isHex && c != '\r' && c != '\n' {
+			return false
+		}
+	}
+	return len(b) > 0
+}
+
+// Format names as accepted on the command line and in configuration files
+var FormatNames = map[string]byte{
+	"auto": FORMAT_AUTO,
+	"raw":  FORMAT_RAW,
+	"bin":  FORMAT_RAW,
+	"ihex": FORMAT_IHEX,
+	"hex":  FORMAT_IHEX,
+	"srec": FORMAT_SREC,
+	"prg":  FORMAT_PRG,
+	"o65":  FORMAT_O65,
+}
+
+// ParseFormat looks up a format by name, an empty name is FORMAT_AUTO
+func ParseFormat(name string) (byte, error) {
+	if name == "" {
+		return FORMAT_AUTO, nil
+	}
+	format, exists := FormatNames[strings.ToLower(name)]
+	if !exists {
+		return 0, fmt.Errorf("unknown image format %q", name)
+	}
+	return format, nil
+}
+
+// LoadFile reads a program image from disk in any of the supported formats
+func LoadFile(path string, opts Options) (*Image, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Load(path, content, opts)
+}
+
+// Load decodes a program image held in memory. The name is only used to
+// detect the format when opts.Format is FORMAT_AUTO.
+func Load(name string, content []byte, opts Options) (*Image, error) {
+	format := opts.Format
+	if format == FORMAT_AUTO {
+		format = Detect(name, content)
+	}
+
+	r := bytes.NewReader(content)
+	switch format {
+	case FORMAT_RAW:
+		return ReadRaw(r, opts.Addr)
+	case FORMAT_IHEX:
+		return ReadIntelHex(r)
+	case FORMAT_SREC:
+		return ReadSRecord(r)
+	case FORMAT_PRG:
+		return ReadPRG(r)
+	case FORMAT_O65:
+		text := -1
+		if opts.Addr > 0 {
+			text = opts.Addr
+		}
+		return ReadO65(r, O65Layout{Text: text, Data: -1, Bss: -1, Zero: -1})
+	}
+	return nil, fmt.Errorf("unknown format %d", format)
+}
+
+// Overlap reports the first pair of segments, within or across images, that share an address
+func Overlap(images ...*Image) error {
+	type span struct {
+		image int
+		seg   Segment
+	}
+	var spans []span
+	for i, img := range images {
+		for _, seg := range img.Segments {
+			spans = append(spans, span{i, seg})
+		}
+	}
+
+	for i := 0; i < len(spans); i++ {
+		for j := i + 1; j < len(spans); j++ {
+			a, b := spans[i].seg, spans[j].seg
+			if a.Addr < b.Addr+len(b.Data) && b.Addr < a.Addr+len(a.Data) {
+				return fmt.Errorf("image %d segment $%04X-$%04X overlaps image %d segment $%04X-$%04X",
+					spans[i].image, a.Addr, a.Addr+len(a.Data)-1, spans[j].image, b.Addr, b.Addr+len(b.Data)-1)
+			}
+		}
+	}
+	return nil
+}
+
+// LoadAll checks that the images do not overlap and then loads every one of them
+func LoadAll(c *cpu6502.Cpu6502, images ...*Image) error {
+	if err := Overlap(images...); err != nil {
+		return err
+	}
+	for _, img := range images {
+		if err := img.LoadInto(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Boot hands the start address to the CPU, either by pointing the reset vector at it
+// and resetting, or by jumping the program counter straight there.
+func (img *Image) Boot(c *cpu6502.Cpu6502, mode byte) error {
+	if mode == BOOT_NONE {
+		return nil
+	}
+	if !img.HasStart {
+		return fmt.Errorf("image has no start address")
+	}
+
+	switch mode {
+	case BOOT_RESET_VECTOR:
+		c.SetResetVector(uint16(img.Start))
+		c.Reset()
+	case BOOT_PC:
+		c.Registers.PC = uint16(img.Start)
+	default:
+		return fmt.Errorf("unknown boot mode %d", mode)
+	}
+	return nil
+}
@@ -0,0 +1,233 @@
+package loader
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	cpu6502 "izzudinhafiz.com/go-6502/cpu"
+)
+
+func TestReadPRG(t *testing.T) {
+	img, err := ReadPRG(bytes.NewReader([]byte{0x01, 0x08, 0xA9, 0x01, 0x60}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Image{Segments: []Segment{{0x0801, []byte{0xA9, 0x01, 0x60}}}}
+	if !reflect.DeepEqual(img, want) {
+		t.Errorf("prg %+v, want %+v", img, want)
+	}
+
+	if _, err := ReadPRG(bytes.NewReader([]byte{0x01})); err == nil {
+		t.Error("prg without a load address was accepted")
+	}
+	if _, err := ReadPRG(bytes.NewReader([]byte{0xFF, 0xFF, 0x00, 0x00})); err == nil {
+		t.Error("prg running past $FFFF was accepted")
+	}
+}
+
+func TestReadRaw(t *testing.T) {
+	img, err := Load("rom.bin", []byte{1, 2, 3}, Options{Addr: 0xFFFD})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Image{Segments: []Segment{{0xFFFD, []byte{1, 2, 3}}}}
+	if !reflect.DeepEqual(img, want) {
+		t.Errorf("raw %+v, want %+v", img, want)
+	}
+	if _, err := Load("rom.bin", []byte{1, 2, 3}, Options{Addr: 0xFFFE}); err == nil {
+		t.Error("raw image running past $FFFF was accepted")
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name string
+		head string
+		want byte
+	}{
+		{"a.hex", "", FORMAT_IHEX},
+		{"a.s19", "", FORMAT_SREC},
+		{"a.prg", "", FORMAT_PRG},
+		{"a.bin", string(o65Magic), FORMAT_O65},
+		{"a.txt", "\r\n:0400100001020304E2", FORMAT_IHEX},
+		{"a.txt", "S1130000285F", FORMAT_SREC},
+		{"a.bin", "\xA9\x00\x8D", FORMAT_RAW},
+		{"a.bin", "Some text", FORMAT_RAW},
+	}
+	for _, test := range tests {
+		if got := Detect(test.name, []byte(test.head)); got != test.want {
+			t.Errorf("Detect(%q, %q) = %d, want %d", test.name, test.head, got, test.want)
+		}
+	}
+}
+
+// testO65 is an executable with text at $1000 and data at $2000:
+//
+//	start: jmp next     ; 4C 03 10
+//	next:  lda table    ; AD 00 20
+//	table: .word next   ; 03 10
+func testO65() []byte {
+	f := append([]byte{}, o65Magic...)
+	f = append(f, 0x00)       // version
+	f = append(f, 0x00, 0x00) // mode
+	f = append(f,
+		0x00, 0x10, 0x06, 0x00, // text base and length
+		0x00, 0x20, 0x02, 0x00, // data
+		0x00, 0x30, 0x00, 0x00, // bss
+		0x00, 0x00, 0x00, 0x00, // zero page
+		0x00, 0x00, // stack
+		0x00, // no options
+	)
+	f = append(f, 0x4C, 0x03, 0x10, 0xAD, 0x00, 0x20) // text
+	f = append(f, 0x03, 0x10)                         // data
+	f = append(f, 0x00, 0x00)                         // no undefined references
+	f = append(f, 0x02, 0x82, 0x03, 0x83, 0x00)       // text relocations, words at offsets 1 and 4
+	f = append(f, 0x01, 0x82, 0x00)                   // data relocation, word at offset 0
+	f = append(f, 0x01, 0x00)                         // one export
+	f = append(f, 's', 't', 'a', 'r', 't', 0x00, O65_SEG_TEXT, 0x00, 0x10)
+	return f
+}
+
+func TestReadO65(t *testing.T) {
+	f, err := ParseO65(bytes.NewReader(testO65()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// In place, nothing changes
+	layout := O65Layout{Text: -1, Data: -1, Bss: -1, Zero: -1}
+	img, err := f.Relocate(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Image{
+		Segments: []Segment{{0x1000, []byte{0x4C, 0x03, 0x10, 0xAD, 0x00, 0x20}}, {0x2000, []byte{0x03, 0x10}}},
+		Start:    0x1000,
+		HasStart: true,
+	}
+	if !reflect.DeepEqual(img, want) {
+		t.Errorf("in place %+v, want %+v", img, want)
+	}
+
+	// Moved, every relocation follows its segment
+	layout = O65Layout{Text: 0xC000, Data: 0x0400, Bss: -1, Zero: -1}
+	img, err = f.Relocate(layout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = &Image{
+		Segments: []Segment{{0xC000, []byte{0x4C, 0x03, 0xC0, 0xAD, 0x00, 0x04}}, {0x0400, []byte{0x03, 0xC0}}},
+		Start:    0xC000,
+		HasStart: true,
+	}
+	if !reflect.DeepEqual(img, want) {
+		t.Errorf("relocated %+v, want %+v", img, want)
+	}
+	if addr, ok := f.ExportAddress("start", layout); !ok || addr != 0xC000 {
+		t.Errorf("start exported at $%04X %v", addr, ok)
+	}
+
+	// The original file is untouched by relocation
+	if !bytes.Equal(f.Text, testO65()[27:33]) {
+		t.Errorf("relocation changed the parsed text % X", f.Text)
+	}
+}
+
+func TestReadO65Corrupt(t *testing.T) {
+	full := testO65()
+	for n := 0; n < len(full); n++ {
+		if _, err := ParseO65(bytes.NewReader(full[:n])); err == nil {
+			t.Errorf("o65 truncated to %d bytes was accepted", n)
+		}
+	}
+
+	// A 32 bit file claiming 4 GiB of text must not be allocated
+	huge := append([]byte{}, o65Magic...)
+	huge = append(huge, 0x00, 0x00, 0x20) // version, 32 bit mode
+	huge = append(huge, 0x00, 0x10, 0x00, 0x00, 0xFF, 0xFF, 0xFF, 0xFF)
+	huge = append(huge, make([]byte, 4*7+1)...)
+	if _, err := ParseO65(bytes.NewReader(huge)); err == nil || !strings.Contains(err.Error(), "address space") {
+		t.Errorf("4 GiB text segment: %v", err)
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	a := &Image{Segments: []Segment{{0x1000, make([]byte, 0x100)}}}
+	b := &Image{Segments: []Segment{{0x1100, make([]byte, 0x100)}}}
+	if err := Overlap(a, b); err != nil {
+		t.Errorf("adjacent images overlap: %v", err)
+	}
+	c := &Image{Segments: []Segment{{0x0F00, make([]byte, 0x10)}, {0x11FF, []byte{0}}}}
+	if err := Overlap(a, b, c); err == nil || !strings.Contains(err.Error(), "image 1 segment $1100-$11FF overlaps image 2") {
+		t.Errorf("overlap: %v", err)
+	}
+	d := &Image{Segments: []Segment{{0x2000, []byte{1, 2}}, {0x2001, []byte{3}}}}
+	if err := Overlap(d); err == nil {
+		t.Error("segments overlapping within an image were accepted")
+	}
+}
+
+// romBus is a bus with ROM from $8000 that only Load can fill
+type romBus struct {
+	memory [0x10000]byte
+}
+
+func (b *romBus) Read(addr uint16) byte { return b.memory[addr] }
+
+func (b *romBus) Write(addr uint16, value byte) {
+	if addr < 0x8000 {
+		b.memory[addr] = value
+	}
+}
+
+func (b *romBus) Load(addr int, data []byte) { copy(b.memory[addr:], data) }
+
+// ramBus only has Read and Write
+type ramBus struct {
+	memory [0x10000]byte
+}
+
+func (b *ramBus) Read(addr uint16) byte         { return b.memory[addr] }
+func (b *ramBus) Write(addr uint16, value byte) { b.memory[addr] = value }
+
+func TestLoadThroughBus(t *testing.T) {
+	img := &Image{Segments: []Segment{{0xC000, []byte{0xEA, 0xEA}}}, Start: 0xC000, HasStart: true}
+
+	rom := &romBus{}
+	c := cpu6502.New()
+	c.Bus = rom
+	if err := img.LoadInto(c); err != nil {
+		t.Fatal(err)
+	}
+	if err := img.Boot(c, BOOT_RESET_VECTOR); err != nil {
+		t.Fatal(err)
+	}
+	if rom.memory[0xC000] != 0xEA || rom.memory[0xFFFC] != 0x00 || rom.memory[0xFFFD] != 0xC0 {
+		t.Errorf("image and reset vector did not reach ROM")
+	}
+	if c.Registers.PC != 0xC000 {
+		t.Errorf("booted to $%04X", c.Registers.PC)
+	}
+	if c.Memory[0xC000] != 0 || c.Memory[0xFFFD] != 0 {
+		t.Errorf("loading wrote the CPU's own memory instead of the bus")
+	}
+
+	ram := &ramBus{}
+	c = cpu6502.New()
+	c.Bus = ram
+	if err := img.LoadInto(c); err != nil {
+		t.Fatal(err)
+	}
+	if ram.memory[0xC001] != 0xEA {
+		t.Errorf("image was not written through the bus")
+	}
+	if err := img.Boot(c, BOOT_PC); err != nil || c.Registers.PC != 0xC000 {
+		t.Errorf("boot by PC: %v, PC $%04X", err, c.Registers.PC)
+	}
+
+	if err := (&Image{}).Boot(c, BOOT_RESET_VECTOR); err == nil {
+		t.Error("booted an image without a start address")
+	}
+}
@@ -0,0 +1,374 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// o65 segment ids
+const (
+	O65_SEG_UNDEF byte = iota
+	O65_SEG_ABS
+	O65_SEG_TEXT
+	O65_SEG_DATA
+	O65_SEG_BSS
+	O65_SEG_ZERO
+)
+
+// o65 relocation types, stored in the top bits of the type byte
+const (
+	O65_RELOC_WORD   byte = 0x80
+	O65_RELOC_HIGH   byte = 0x40
+	O65_RELOC_LOW    byte = 0x20
+	O65_RELOC_SEGADR byte = 0xC0
+	O65_RELOC_SEG    byte = 0xA0
+)
+
+// o65 mode bits
+const (
+	O65_MODE_65816    = 1 << 15
+	O65_MODE_PAGEWISE = 1 << 14
+	O65_MODE_SIZE32   = 1 << 13
+	O65_MODE_OBJECT   = 1 << 12
+)
+
+var o65Magic = []byte{0x01, 0x00, 'o', '6', '5'}
+
+type o65Reloc struct {
+	Offset  int // Offset into the segment
+	Type    byte
+	Segment byte
+	Undef   int  // Index into the undefined reference list when Segment is O65_SEG_UNDEF
+	Low     byte // Low byte of the address for bytewise HIGH relocations
+}
+
+// O65Export is a global symbol exported by an o65 file
+type O65Export struct {
+	Name    string
+	Segment byte
+	Value   int
+}
+
+// O65File is a parsed o65 relocatable binary, see http://www.6502.org/users/andre/o65/fileformat.html
+type O65File struct {
+	Mode       int
+	TextBase   int
+	Text       []byte
+	DataBase   int
+	Data       []byte
+	BssBase    int
+	BssLen     int
+	ZeroBase   int
+	ZeroLen    int
+	Stack      int
+	Options    map[byte][]byte
+	Undefined  []string
+	Exports    []O65Export
+	textRelocs []o65Reloc
+	dataRelocs []o65Reloc
+}
+
+// O65Layout chooses where each segment of an o65 file is placed. A negative
+// address keeps the base stored in the file. Imports resolves undefined references.
+type O65Layout struct {
+	Text    int
+	Data    int
+	Bss     int
+	Zero    int
+	Imports map[string]int
+}
+
+// ParseO65 reads an o65 file without relocating it
+func ParseO65(r io.Reader) (*O65File, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(o65Magic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, o65Magic) {
+		return nil, errors.New("not an o65 file")
+	}
+
+	or := o65Reader{r: br}
+	if version := or.u8(); version != 0 {
+		return nil, fmt.Errorf("unsupported o65 version %d", version)
+	}
+
+	f := &O65File{Options: map[byte][]byte{}}
+	f.Mode = or.u16()
+	if f.Mode&O65_MODE_65816 != 0 {
+		return nil, errors.New("65816 o65 files are not supported")
+	}
+	or.wide = f.Mode&O65_MODE_SIZE32 != 0
+
+	f.TextBase = or.size()
+	textLen := or.size()
+	f.DataBase = or.size()
+	dataLen := or.size()
+	f.BssBase = or.size()
+	f.BssLen = or.size()
+	f.ZeroBase = or.size()
+	f.ZeroLen = or.size()
+	f.Stack = or.size()
+
+	// Header options, terminated by a zero length byte
+	for {
+		optLen := int(or.u8())
+		if optLen == 0 || or.err != nil {
+			break
+		}
+		if optLen < 2 {
+			return nil, errors.New("malformed o65 header option")
+		}
+		optType := or.u8()
+		f.Options[optType] = or.bytes(optLen - 2)
+	}
+
+	f.Text = or.bytes(textLen)
+	f.Data = or.bytes(dataLen)
+
+	numUndef := or.size()
+	for i := 0; i < numUndef && or.err == nil; i++ {
+		f.Undefined = append(f.Undefined, or.str())
+	}
+
+	f.textRelocs = or.relocations(f.Mode&O65_MODE_PAGEWISE != 0)
+	f.dataRelocs = or.relocations(f.Mode&O65_MODE_PAGEWISE != 0)
+
+	numExports := or.size()
+	for i := 0; i < numExports && or.err == nil; i++ {
+		f.Exports = append(f.Exports, O65Export{Name: or.str(), Segment: or.u8(), Value: or.size()})
+	}
+
+	if or.err != nil {
+		return nil, fmt.Errorf("reading o65 file: %w", or.err)
+	}
+	return f, nil
+}
+
+// ReadO65 parses an o65 file and relocates it with the given layout
+func ReadO65(r io.Reader, layout O65Layout) (*Image, error) {
+	f, err := ParseO65(r)
+	if err != nil {
+		return nil, err
+	}
+	return f.Relocate(layout)
+}
+
+// Relocate places the text and data segments and patches every relocation entry.
+// Executables get their start address set to the relocated text base.
+func (f *O65File) Relocate(layout O65Layout) (*Image, error) {
+	bases := map[byte][2]int{
+		O65_SEG_TEXT: {f.TextBase, pick(layout.Text, f.TextBase)},
+		O65_SEG_DATA: {f.DataBase, pick(layout.Data, f.DataBase)},
+		O65_SEG_BSS:  {f.BssBase, pick(layout.Bss, f.BssBase)},
+		O65_SEG_ZERO: {f.ZeroBase, pick(layout.Zero, f.ZeroBase)},
+	}
+	if f.Mode&O65_MODE_PAGEWISE != 0 {
+		for seg, b := range bases {
+			if (b[1]-b[0])&0xFF != 0 {
+				return nil, fmt.Errorf("page-wise o65 file cannot move segment %d by a partial page", seg)
+			}
+		}
+	}
+
+	// relocate returns the value an address in a segment has after relocation
+	relocate := func(seg byte, undef int, value int) (int, error) {
+		switch seg {
+		case O65_SEG_ABS:
+			return value, nil
+		case O65_SEG_UNDEF:
+			if undef >= len(f.Undefined) {
+				return 0, fmt.Errorf("relocation refers to missing undefined reference %d", undef)
+			}
+			addr, ok := layout.Imports[f.Undefined[undef]]
+			if !ok {
+				return 0, fmt.Errorf("unresolved o65 import %v", f.Undefined[undef])
+			}
+			return value + addr, nil
+		}
+		b, ok := bases[seg]
+		if !ok {
+			return 0, fmt.Errorf("unknown o65 segment id %d", seg)
+		}
+		return value + b[1] - b[0], nil
+	}
+
+	text := append([]byte(nil), f.Text...)
+	data := append([]byte(nil), f.Data...)
+	for _, seg := range []struct {
+		bytes  []byte
+		relocs []o65Reloc
+	}{{text, f.textRelocs}, {data, f.dataRelocs}} {
+		for _, r := range seg.relocs {
+			if err := r.apply(seg.bytes, relocate); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	img := &Image{}
+	img.add(bases[O65_SEG_TEXT][1], text)
+	if len(data) > 0 {
+		img.add(bases[O65_SEG_DATA][1], data)
+	}
+	if f.Mode&O65_MODE_OBJECT == 0 {
+		img.Start, img.HasStart = bases[O65_SEG_TEXT][1], true
+	}
+	return img, img.checkBounds()
+}
+
+// ExportAddress returns the relocated address of an exported symbol
+func (f *O65File) ExportAddress(name string, layout O65Layout) (int, bool) {
+	for _, e := range f.Exports {
+		if e.Name != name {
+			continue
+		}
+		switch e.Segment {
+		case O65_SEG_TEXT:
+			return e.Value + pick(layout.Text, f.TextBase) - f.TextBase, true
+		case O65_SEG_DATA:
+			return e.Value + pick(layout.Data, f.DataBase) - f.DataBase, true
+		case O65_SEG_BSS:
+			return e.Value + pick(layout.Bss, f.BssBase) - f.BssBase, true
+		case O65_SEG_ZERO:
+			return e.Value + pick(layout.Zero, f.ZeroBase) - f.ZeroBase, true
+		}
+		return e.Value, true
+	}
+	return 0, false
+}
+
+func (r o65Reloc) apply(seg []byte, relocate func(byte, int, int) (int, error)) error {
+	width := 1
+	if r.Type == O65_RELOC_WORD {
+		width = 2
+	}
+	if r.Offset < 0 || r.Offset+width > len(seg) {
+		return fmt.Errorf("o65 relocation at offset %d is outside its segment", r.Offset)
+	}
+
+	switch r.Type {
+	case O65_RELOC_WORD:
+		value, err := relocate(r.Segment, r.Undef, int(seg[r.Offset])|int(seg[r.Offset+1])<<8)
+		if err != nil {
+			return err
+		}
+		seg[r.Offset] = byte(value)
+		seg[r.Offset+1] = byte(value >> 8)
+	case O65_RELOC_HIGH:
+		value, err := relocate(r.Segment, r.Undef, int(seg[r.Offset])<<8|int(r.Low))
+		if err != nil {
+			return err
+		}
+		seg[r.Offset] = byte(value >> 8)
+	case O65_RELOC_LOW:
+		value, err := relocate(r.Segment, r.Undef, int(seg[r.Offset]))
+		if err != nil {
+			return err
+		}
+		seg[r.Offset] = byte(value)
+	default:
+		return fmt.Errorf("o65 relocation type $%02X is only valid for 65816 files", r.Type)
+	}
+	return nil
+}
+
+func (img *Image) checkBounds() error {
+	for _, seg := range img.Segments {
+		if seg.Addr < 0 || seg.Addr+len(seg.Data) > 0x10000 {
+			return fmt.Errorf("segment at $%X does not fit in the address space", seg.Addr)
+		}
+	}
+	return nil
+}
+
+func pick(addr int, fallback int) int {
+	if addr < 0 {
+		return fallback
+	}
+	return addr
+}
+
+type o65Reader struct {
+	r    *bufio.Reader
+	wide bool
+	err  error
+}
+
+func (or *o65Reader) u8() byte {
+	if or.err != nil {
+		return 0
+	}
+	var b byte
+	b, or.err = or.r.ReadByte()
+	return b
+}
+
+func (or *o65Reader) u16() int {
+	return int(or.u8()) | int(or.u8())<<8
+}
+
+// size reads a 16 or 32 bit value depending on the file mode
+func (or *o65Reader) size() int {
+	if or.wide {
+		return or.u16() | or.u16()<<16
+	}
+	return or.u16()
+}
+
+// bytes reads n bytes. Nothing in a 6502 o65 file can be bigger than the
+// address space, so larger sizes are rejected before anything is allocated.
+func (or *o65Reader) bytes(n int) []byte {
+	if or.err == nil && n > 0x10000 {
+		or.err = fmt.Errorf("%d byte block does not fit in the address space", n)
+	}
+	if or.err != nil {
+		return nil
+	}
+	buf := make([]byte, n)
+	_, or.err = io.ReadFull(or.r, buf)
+	return buf
+}
+
+func (or *o65Reader) str() string {
+	var buf []byte
+	for {
+		b := or.u8()
+		if b == 0 || or.err != nil {
+			return string(buf)
+		}
+		buf = append(buf, b)
+	}
+}
+
+// relocations reads a relocation table. Offsets are stored as distances from the
+// previous entry, starting one byte before the segment, with 255 meaning "skip 254".
+func (or *o65Reader) relocations(pagewise bool) []o65Reloc {
+	var relocs []o65Reloc
+	offset := -1
+
+	for or.err == nil {
+		step := int(or.u8())
+		if step == 0 {
+			break
+		}
+		if step == 255 {
+			offset += 254
+			continue
+		}
+		offset += step
+
+		typeByte := or.u8()
+		r := o65Reloc{Offset: offset, Type: typeByte & 0xE0, Segment: typeByte & 0x07}
+		if r.Segment == O65_SEG_UNDEF {
+			r.Undef = or.size()
+		}
+		if r.Type == O65_RELOC_HIGH && !pagewise {
+			r.Low = or.u8()
+		}
+		relocs = append(relocs, r)
+	}
+
+	return relocs
+}
@@ -0,0 +1,42 @@
+package loader
+
+import (
+	"errors"
+	"io"
+)
+
+// ReadPRG parses a Commodore .prg file: a little endian load address followed by the program bytes.
+// The format has no start address; many programs begin with a BASIC stub at the load address.
+func ReadPRG(r io.Reader) (*Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < 2 {
+		return nil, errors.New("prg file is missing its load address")
+	}
+
+	addr := int(data[0]) | int(data[1])<<8
+	if addr+len(data)-2 > 0x10000 {
+		return nil, errors.New("prg file runs past the end of the address space")
+	}
+
+	img := &Image{}
+	img.add(addr, data[2:])
+	return img, nil
+}
+
+// ReadRaw loads a headerless binary at the given address
+func ReadRaw(r io.Reader, addr int) (*Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if addr < 0 || addr+len(data) > 0x10000 {
+		return nil, errors.New("raw image does not fit in the address space at the requested address")
+	}
+
+	img := &Image{}
+	img.add(addr, data)
+	return img, nil
+}
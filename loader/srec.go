@@ -0,0 +1,166 @@
+package loader
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// S-record flavours, named after the data and termination records they use
+const (
+	SREC_S19 byte = iota // 16 bit addresses, S1 data and S9 start records
+	SREC_S28             // 24 bit addresses, S2 data and S8 start records
+	SREC_S37             // 32 bit addresses, S3 data and S7 start records
+)
+
+const srecBytesPerLine = 16
+
+// ReadSRecord parses a Motorola S-record file (S19, S28 or S37), verifying every record checksum.
+// A termination record with a zero address leaves the image without a start address,
+// and a file without one is taken to be truncated.
+func ReadSRecord(r io.Reader) (*Image, error) {
+	img := &Image{}
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	dataRecords := 0
+
+	for scanner.Scan() {
+		lineNum += 1
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if len(line) < 4 || line[0] != 'S' {
+			return nil, fmt.Errorf("line %d: record does not start with 'S'", lineNum)
+		}
+
+		recordType := line[1]
+		record, err := hex.DecodeString(line[2:])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNum, err)
+		}
+		if len(record) < 1 || len(record) != int(record[0])+1 {
+			return nil, fmt.Errorf("line %d: record length mismatch", lineNum)
+		}
+		if srecChecksum(record[:len(record)-1]) != record[len(record)-1] {
+			return nil, fmt.Errorf("line %d: checksum mismatch", lineNum)
+		}
+
+		addrLen := 0
+		switch recordType {
+		case '0', '1', '5', '9':
+			addrLen = 2
+		case '2', '6', '8':
+			addrLen = 3
+		case '3', '7':
+			addrLen = 4
+		default:
+			return nil, fmt.Errorf("line %d: unknown record type S%c", lineNum, recordType)
+		}
+		if len(record) < addrLen+2 {
+			return nil, fmt.Errorf("line %d: record too short", lineNum)
+		}
+
+		addr := 0
+		for _, b := range record[1 : 1+addrLen] {
+			addr = addr<<8 | int(b)
+		}
+		data := record[1+addrLen : len(record)-1]
+
+		switch recordType {
+		case '0':
+			// Header, carries no data for us
+		case '1', '2', '3':
+			img.add(addr, data)
+			dataRecords += 1
+		case '5', '6':
+			if addr != dataRecords&(1<<(8*addrLen)-1) {
+				return nil, fmt.Errorf("line %d: record count %d does not match %d data records", lineNum, addr, dataRecords)
+			}
+		case '7', '8', '9':
+			// Writers without a start address put zero here
+			img.Start, img.HasStart = addr, addr != 0
+			return img, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("missing termination record")
+}
+
+// WriteSRecord writes the image as S-records in the given flavour, with a header
+// record, a record count and a termination record carrying the start address,
+// or zero when the image has none. ReadSRecord takes a start address of zero
+// to mean there is none, so a start at $0000 does not survive the trip.
+func WriteSRecord(w io.Writer, img *Image, format byte) error {
+	var dataType, endType byte
+	var addrLen int
+
+	switch format {
+	case SREC_S19:
+		dataType, endType, addrLen = '1', '9', 2
+	case SREC_S28:
+		dataType, endType, addrLen = '2', '8', 3
+	case SREC_S37:
+		dataType, endType, addrLen = '3', '7', 4
+	default:
+		return fmt.Errorf("unknown S-record format %d", format)
+	}
+
+	bw := bufio.NewWriter(w)
+	writeSRecord(bw, '0', 2, 0, []byte("go6502"))
+
+	count := 0
+	limit := 1 << (8 * addrLen)
+	for _, seg := range img.Segments {
+		if seg.Addr+len(seg.Data) > limit {
+			return fmt.Errorf("segment at $%X does not fit in %d bit S-record addresses", seg.Addr, 8*addrLen)
+		}
+		for offset := 0; offset < len(seg.Data); offset += srecBytesPerLine {
+			end := offset + srecBytesPerLine
+			if end > len(seg.Data) {
+				end = len(seg.Data)
+			}
+			writeSRecord(bw, dataType, addrLen, seg.Addr+offset, seg.Data[offset:end])
+			count += 1
+		}
+	}
+
+	// The count record is optional, and only exists for up to 24 bit counts
+	if count <= 0xFFFF {
+		writeSRecord(bw, '5', 2, count, nil)
+	} else if count <= 0xFFFFFF {
+		writeSRecord(bw, '6', 3, count, nil)
+	}
+
+	start := 0
+	if img.HasStart {
+		start = img.Start
+	}
+	writeSRecord(bw, endType, addrLen, start, nil)
+
+	return bw.Flush()
+}
+
+func writeSRecord(w *bufio.Writer, recordType byte, addrLen int, addr int, data []byte) {
+	record := []byte{byte(addrLen + len(data) + 1)}
+	for i := addrLen - 1; i >= 0; i-- {
+		record = append(record, byte(addr>>(8*i)))
+	}
+	record = append(record, data...)
+	record = append(record, srecChecksum(record))
+	fmt.Fprintf(w, "S%c%s\n", recordType, strings.ToUpper(hex.EncodeToString(record)))
+}
+
+// srecChecksum is the ones' complement of the byte sum
+func srecChecksum(record []byte) byte {
+	var sum byte
+	for _, b := range record {
+		sum += b
+	}
+	return ^sum
+}
@@ -0,0 +1,251 @@
+package machine
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// ACIA registers
+const (
+	ACIA_DATA    uint16 = iota // Received byte when read, byte to send when written
+	ACIA_STATUS                // Status when read, programmed reset when written
+	ACIA_COMMAND               // Parity, echo, transmit control, receive interrupt and DTR
+	ACIA_CONTROL               // Stop bits, word length and baud rate
+)
+
+// ACIA status bits
+const (
+	ACIA_PARITY_ERROR  byte = 0x01
+	ACIA_FRAMING_ERROR byte = 0x02
+	ACIA_OVERRUN       byte = 0x04
+	ACIA_RDRF          byte = 0x08 // Receive data register full
+	ACIA_TDRE          byte = 0x10 // Transmit data register empty
+	ACIA_DCD           byte = 0x20 // Set when there is no carrier
+	ACIA_DSR           byte = 0x40 // Set when the data set is not ready
+	ACIA_IRQ           byte = 0x80
+)
+
+// Baud rates selected by the low control bits, 0 is the external clock
+var aciaBaudRates = [16]int{0, 50, 75, 110, 135, 150, 300, 600, 1200, 1800, 2400, 3600, 4800, 7200, 9600, 19200}
+
+// ACIA emulates a MOS 6551 Asynchronous Communications Interface Adapter.
+// Bytes the program sends go to Output, and bytes given to Receive arrive one
+// at a time at the programmed baud rate. Received bytes wait for the program
+// to read the previous one, as if hardware flow control were wired up, so
+// pasting into a slow program loses nothing.
+type ACIA struct {
+	Output io.Writer // Where transmitted bytes go, dropped when nil
+	Clock  int       // CPU clock in Hz to time characters by, 0 sends them instantly
+	WDC    bool      // Emulate the W65C51N, whose TDRE bit is stuck on and never interrupts
+
+	status  byte
+	command byte
+	control byte
+	rx      byte
+
+	txData byte
+	txWait int // Cycles until the byte being sent leaves, 0 when idle
+	rxWait int // Cycles until the next byte may arrive
+
+	mu      sync.Mutex
+	pending []byte // Received from the host, not yet seen by the program
+	closer  io.Closer
+}
+
+func NewACIA() *ACIA {
+	a := &ACIA{}
+	a.Reset()
+	return a
+}
+
+// Reset is the hardware reset, which clears the control register and
+// disables the receiver
+func (a *ACIA) Reset() {
+	a.status = ACIA_TDRE
+	a.command = 0x02
+	a.control = 0
+	a.txWait = 0
+	a.rxWait = 0
+}
+
+// IRQ reports whether the ACIA is pulling its IRQ output low
+func (a *ACIA) IRQ() bool {
+	return a.status&ACIA_IRQ != 0
+}
+
+func (a *ACIA) Read(reg uint16) byte {
+	value := a.Peek(reg)
+	switch reg & 3 {
+	case ACIA_DATA:
+		a.status &^= ACIA_RDRF | ACIA_OVERRUN | ACIA_FRAMING_ERROR | ACIA_PARITY_ERROR
+	case ACIA_STATUS:
+		a.status &^= ACIA_IRQ
+	}
+	return value
+}
+
+func (a *ACIA) Peek(reg uint16) byte {
+	switch reg & 3 {
+	case ACIA_DATA:
+		return a.rx
+	case ACIA_STATUS:
+		if a.WDC {
+			return a.status | ACIA_TDRE
+		}
+		return a.status
+	case ACIA_COMMAND:
+		return a.command
+	}
+	return a.control
+}
+
+func (a *ACIA) Write(reg uint16, value byte) {
+	switch reg & 3 {
+	case ACIA_DATA:
+		a.txData = value
+		a.txWait = a.characterTime()
+		a.status &^= ACIA_TDRE
+	case ACIA_STATUS:
+		// Programmed reset, which leaves the parity mode and control alone
+		a.command &= 0xE0
+		a.command |= 0x02
+		a.status &^= ACIA_OVERRUN
+	case ACIA_COMMAND:
+		a.command = value
+	case ACIA_CONTROL:
+		a.control = value
+	}
+}
+
+// Receive queues bytes from the host for the program to read. It is safe
+// to call from any goroutine.
+func (a *ACIA) Receive(data []byte) {
+	a.mu.Lock()
+	a.pending = append(a.pending, data...)
+	a.mu.Unlock()
+}
+
+// Tick moves bytes in and out as the character times pass
+func (a *ACIA) Tick(cycles int) {
+	if a.txWait > 0 {
+		a.txWait -= cycles
+		if a.txWait <= 0 {
+			a.txWait = 0
+			a.transmit(a.txData)
+			a.status |= ACIA_TDRE
+			if a.command&0x0C == 0x04 && !a.WDC {
+				a.status |= ACIA_IRQ
+			}
+		}
+	}
+
+	if a.rxWait > 0 {
+		a.rxWait -= cycles
+	}
+	// The receiver is off until the program sets DTR
+	if a.rxWait > 0 || a.status&ACIA_RDRF != 0 || a.command&0x01 == 0 {
+		return
+	}
+
+	a.mu.Lock()
+	if len(a.pending) == 0 {
+		a.mu.Unlock()
+		return
+	}
+	value := a.pending[0]
+	a.pending = a.pending[1:]
+	a.mu.Unlock()
+
+	a.rx = value & a.wordMask()
+	a.status |= ACIA_RDRF
+	a.rxWait = a.characterTime()
+	if a.command&0x02 == 0 {
+		a.status |= ACIA_IRQ
+	}
+	// Echo mode sends received bytes straight back
+	if a.command&0x10 != 0 {
+		a.transmit(a.rx)
+	}
+}
+
+func (a *ACIA) transmit(value byte) {
+	if a.Output != nil {
+		a.Output.Write([]byte{value & a.wordMask()})
+	}
+}
+
+func (a *ACIA) wordMask() byte {
+	return 0xFF >> (a.control >> 5 & 3)
+}
+
+// characterTime returns the cycles one character takes on the line: a start
+// bit, the data bits, an optional parity bit and the stop bits
+func (a *ACIA) characterTime() int {
+	baud := aciaBaudRates[a.control&0x0F]
+	if a.Clock <= 0 || baud == 0 {
+		return 1
+	}
+
+	bits := 1 + 8 - int(a.control>>5&3) + 1
+	if a.control&0x80 != 0 {
+		bits += 1
+	}
+	if a.command&0x20 != 0 {
+		bits += 1
+	}
+	return a.Clock * bits / baud
+}
+
+// Connect bridges the ACIA to a host serial port: bytes read from it are
+// received, and transmitted bytes are written to it. Close closes it.
+func (a *ACIA) Connect(port io.ReadWriteCloser) {
+	a.Output = port
+	a.closer = port
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := port.Read(buf)
+			if n > 0 {
+				a.Receive(buf[:n])
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// Close closes the port given to Connect
+func (a *ACIA) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+func newACIADevice(m *Machine, cfg DeviceConfig) (Device, error) {
+	var opts struct {
+		Serial string `json:"serial"` // "stdio", "pty", "tcp:HOST:PORT" or empty
+		WDC    bool   `json:"wdc"`
+	}
+	if err := decodeOptions(cfg, &opts); err != nil {
+		return nil, err
+	}
+
+	a := NewACIA()
+	a.Clock = m.Clock
+	a.WDC = opts.WDC
+	if opts.Serial != "" {
+		port, where, err := OpenSerial(opts.Serial)
+		if err != nil {
+			return nil, err
+		}
+		if where != "" {
+			fmt.Fprintf(os.Stderr, "%v: serial port on %v\n", cfg.Name, where)
+		}
+		a.Connect(port)
+	}
+	return a, nil
+}
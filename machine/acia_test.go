@@ -0,0 +1,127 @@
+package machine
+
+import (
+	"bytes"
+	"testing"
+)
+
+// 9600 baud, 8 data bits, 1 stop bit at 1MHz: 10 bits of 104 cycles
+const (
+	testACIAControl = 0x1E
+	testACIAChar    = 1000000 * 10 / 9600
+)
+
+func TestACIAReceive(t *testing.T) {
+	a := NewACIA()
+	a.Receive([]byte("AB"))
+
+	// The receiver stays off until the program sets DTR
+	a.Tick(10)
+	if a.Read(ACIA_STATUS)&ACIA_RDRF != 0 {
+		t.Fatal("received with DTR off")
+	}
+
+	a.Write(ACIA_COMMAND, 0x09) // DTR, receiver interrupts on
+	a.Tick(1)
+	status := a.Read(ACIA_STATUS)
+	if status&(ACIA_RDRF|ACIA_IRQ) != ACIA_RDRF|ACIA_IRQ {
+		t.Fatalf("status $%02X after receiving, want RDRF and IRQ", status)
+	}
+	if a.IRQ() || a.Read(ACIA_STATUS)&ACIA_RDRF == 0 {
+		t.Errorf("reading the status should clear IRQ and leave RDRF")
+	}
+
+	// The next byte waits until the program has read this one
+	a.Tick(10)
+	if got := a.Read(ACIA_DATA); got != 'A' {
+		t.Errorf("received $%02X, want 'A'", got)
+	}
+	if a.Read(ACIA_STATUS)&ACIA_RDRF != 0 {
+		t.Errorf("reading the data did not clear RDRF")
+	}
+	a.Tick(1)
+	if a.Read(ACIA_STATUS)&ACIA_RDRF == 0 || a.Read(ACIA_DATA) != 'B' {
+		t.Errorf("second byte did not arrive")
+	}
+
+	// With receiver interrupts disabled RDRF is set without an IRQ
+	a.Write(ACIA_COMMAND, 0x0B)
+	a.Receive([]byte("C"))
+	a.Tick(1)
+	if a.Read(ACIA_STATUS)&ACIA_RDRF == 0 || a.IRQ() {
+		t.Errorf("status $%02X with receiver interrupts disabled", a.Read(ACIA_STATUS))
+	}
+}
+
+func TestACIATransmit(t *testing.T) {
+	var out bytes.Buffer
+	a := NewACIA()
+	a.Output = &out
+	a.Clock = 1000000
+	a.Write(ACIA_CONTROL, testACIAControl)
+	a.Write(ACIA_COMMAND, 0x05) // DTR, transmit interrupts on
+
+	if a.Read(ACIA_STATUS)&ACIA_TDRE == 0 {
+		t.Fatal("TDRE clear when idle")
+	}
+	a.Write(ACIA_DATA, 'x')
+	if a.Read(ACIA_STATUS)&ACIA_TDRE != 0 {
+		t.Errorf("TDRE set while sending")
+	}
+	a.Tick(testACIAChar - 1)
+	if out.Len() != 0 || a.Read(ACIA_STATUS)&ACIA_TDRE != 0 {
+		t.Errorf("byte left before its character time")
+	}
+	a.Tick(1)
+	if out.String() != "x" {
+		t.Errorf("sent %q, want \"x\"", out.String())
+	}
+	if !a.IRQ() {
+		t.Errorf("TDRE did not interrupt")
+	}
+	if status := a.Read(ACIA_STATUS); status&(ACIA_TDRE|ACIA_IRQ) != ACIA_TDRE|ACIA_IRQ {
+		t.Errorf("status $%02X after sending, want TDRE and IRQ", status)
+	}
+}
+
+// The W65C51N reports TDRE set all the time and never interrupts for it, so
+// programs wait out the character time themselves
+func TestACIAWDC(t *testing.T) {
+	var out bytes.Buffer
+	a := NewACIA()
+	a.Output = &out
+	a.Clock = 1000000
+	a.WDC = true
+	a.Write(ACIA_CONTROL, testACIAControl)
+	a.Write(ACIA_COMMAND, 0x05)
+
+	a.Write(ACIA_DATA, 'x')
+	if a.Read(ACIA_STATUS)&ACIA_TDRE == 0 {
+		t.Errorf("TDRE clear while sending")
+	}
+	a.Tick(testACIAChar)
+	if out.String() != "x" {
+		t.Errorf("sent %q, want \"x\"", out.String())
+	}
+	if a.IRQ() {
+		t.Errorf("TDRE interrupted")
+	}
+}
+
+// Looking at the registers from the debugger must not take the received byte
+func TestACIAPeek(t *testing.T) {
+	a := NewACIA()
+	a.Receive([]byte("A"))
+	a.Write(ACIA_COMMAND, 0x09)
+	a.Tick(1)
+
+	if a.Peek(ACIA_STATUS)&ACIA_RDRF == 0 {
+		t.Fatal("ACIA did not receive")
+	}
+	if a.Peek(ACIA_DATA) != 'A' || a.Peek(ACIA_STATUS)&ACIA_RDRF == 0 || !a.IRQ() {
+		t.Error("peeking emptied the data register or cleared the interrupt")
+	}
+	if a.Read(ACIA_DATA) != 'A' || a.Peek(ACIA_STATUS)&ACIA_RDRF != 0 {
+		t.Error("reading the data register did not empty it")
+	}
+}
@@ -0,0 +1,215 @@
+package machine
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// Apple-1 keyboard and display registers, the PIA's own
+const (
+	APPLE1_KBD   uint16 = PIA_PORTA // Key with bit 7 set
+	APPLE1_KBDCR uint16 = PIA_CRA   // Bit 7 is set when a key is waiting
+	APPLE1_DSP   uint16 = PIA_PORTB // Character to display, bit 7 reads set while the display is busy
+	APPLE1_DSPCR uint16 = PIA_CRB
+)
+
+const APPLE1_COLUMNS = 40
+
+// Apple1IO is the Apple-1's keyboard and video terminal, wired to a 6821 PIA
+// the way the board does it:
+//
+//	PA0-PA6  ASCII from the keyboard, PA7 tied high
+//	CA1      keyboard strobe
+//	PB0-PB6  character to the terminal
+//	PB7, CB1 terminal busy
+//	CB2      data available, the PIA's write handshake
+//
+// The terminal shows upper case, wraps at 40 columns and only understands
+// carriage return. Keys come from a host serial port, upper cased, with
+// newline sent as return and backspace as the underscore Wozmon erases with.
+//
+// machines/apple1.json is the whole machine. The ROMs are not included: it
+// loads Wozmon from machines/roms/apple1_wozmon.bin and, when present,
+// Integer BASIC from machines/roms/apple1_basic.bin at $E000.
+type Apple1IO struct {
+	*PIA
+
+	Output   io.Writer // Where the terminal draws
+	CharTime int       // Cycles the terminal takes per character, 0 for as fast as the program writes
+
+	key     byte
+	written bool // The program has strobed a character to the terminal
+	busy    int  // Cycles left on the character being drawn
+	column  int
+
+	closer  io.Closer
+	mu      sync.Mutex
+	pending []byte // Typed on the host, not yet seen by the program
+}
+
+func NewApple1IO() *Apple1IO {
+	a := &Apple1IO{PIA: NewPIA()}
+	a.PortA.Input = func() byte { return 0x80 | a.key }
+	a.PortB.Input = func() byte {
+		if a.busy > 0 || a.written {
+			return 0xFF
+		}
+		return 0x7F
+	}
+	a.PortB.Control = func(level bool) {
+		if !level {
+			a.written = true
+		}
+	}
+	a.Reset()
+	return a
+}
+
+// Reset resets the PIA, leaving the terminal as it is
+func (a *Apple1IO) Reset() {
+	a.PIA.Reset()
+	// The strobe and busy lines idle low, which is not an edge
+	a.a.c1, a.b.c1 = false, false
+	a.written = false
+	a.busy = 0
+}
+
+// Receive queues keys typed on the host. It is safe to call from any
+// goroutine.
+func (a *Apple1IO) Receive(data []byte) {
+	a.mu.Lock()
+	a.pending = append(a.pending, data...)
+	a.mu.Unlock()
+}
+
+// Tick draws characters the program wrote and strobes in the next key once
+// the program has read the last one
+func (a *Apple1IO) Tick(cycles int) {
+	a.PIA.Tick(cycles)
+
+	if a.written {
+		a.written = false
+		a.draw(a.PortB.pins & 0x7F)
+		a.busy = a.CharTime
+		if a.busy < 1 {
+			a.busy = 1
+		}
+		a.PIA.SetCB1(true)
+	} else if a.busy > 0 {
+		a.busy -= cycles
+		if a.busy <= 0 {
+			a.busy = 0
+			a.PIA.SetCB1(false)
+		}
+	}
+
+	if a.a.cr&PIA_IRQ1 != 0 {
+		return
+	}
+	a.mu.Lock()
+	if len(a.pending) == 0 {
+		a.mu.Unlock()
+		return
+	}
+	key := a.pending[0]
+	a.pending = a.pending[1:]
+	a.mu.Unlock()
+
+	a.key = apple1Key(key)
+	a.PIA.SetCA1(true)
+	a.PIA.SetCA1(false)
+}
+
+// apple1Key turns a host key into what the Apple-1 keyboard sends
+func apple1Key(key byte) byte {
+	switch {
+	case key == '\n':
+		return '\r'
+	case key == 0x08 || key == 0x7F:
+		return '_'
+	case key >= 'a' && key <= 'z':
+		return key - 'a' + 'A'
+	}
+	return key & 0x7F
+}
+
+// draw puts a character on the terminal, which only has upper case and no
+// control characters besides return
+func (a *Apple1IO) draw(ch byte) {
+	if a.Output == nil {
+		return
+	}
+	switch {
+	case ch == '\r':
+		a.Output.Write([]byte("\r\n"))
+		a.column = 0
+		return
+	case ch < 0x20:
+		return
+	case ch >= 0x60:
+		ch -= 0x20
+	}
+
+	if a.column == APPLE1_COLUMNS {
+		a.Output.Write([]byte("\r\n"))
+		a.column = 0
+	}
+	a.Output.Write([]byte{ch})
+	a.column++
+}
+
+// Connect takes keys from a host serial port and draws the terminal on it.
+// Close closes it.
+func (a *Apple1IO) Connect(port io.ReadWriteCloser) {
+	a.Output = port
+	a.closer = port
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := port.Read(buf)
+			if n > 0 {
+				a.Receive(buf[:n])
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// Close closes the port given to Connect
+func (a *Apple1IO) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+func newApple1Device(m *Machine, cfg DeviceConfig) (Device, error) {
+	var opts struct {
+		Serial string `json:"serial"` // Where the keyboard and terminal are, "stdio" when empty
+		Rate   int    `json:"rate"`   // Characters the terminal draws per second, 0 for no limit
+	}
+	if err := decodeOptions(cfg, &opts); err != nil {
+		return nil, err
+	}
+	if opts.Serial == "" {
+		opts.Serial = "stdio"
+	}
+
+	a := NewApple1IO()
+	if opts.Rate > 0 && m.Clock > 0 {
+		a.CharTime = m.Clock / opts.Rate
+	}
+	port, where, err := OpenSerial(opts.Serial)
+	if err != nil {
+		return nil, err
+	}
+	if where != "" {
+		fmt.Fprintf(os.Stderr, "%v: terminal on %v\n", cfg.Name, where)
+	}
+	a.Connect(port)
+	return a, nil
+}
@@ -0,0 +1,125 @@
+package machine
+
+import (
+	"bytes"
+	"testing"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+)
+
+// apple1Bus is plain RAM with an Apple1IO at $D010
+type apple1Bus struct {
+	memory [0x10000]byte
+	io     *Apple1IO
+}
+
+func (b *apple1Bus) Read(addr uint16) byte {
+	if addr&0xFFFC == 0xD010 {
+		return b.io.Read(addr & 3)
+	}
+	return b.memory[addr]
+}
+
+func (b *apple1Bus) Write(addr uint16, value byte) {
+	if addr&0xFFFC == 0xD010 {
+		b.io.Write(addr&3, value)
+		return
+	}
+	b.memory[addr] = value
+}
+
+// The keyboard and display set up and used the way Wozmon does: RESET,
+// NEXTCHAR waiting on KBDCR, and ECHO waiting on DSP bit 7
+var apple1Echo = []byte{
+	0xD8,       // 0200 CLD
+	0x58,       // 0201 CLI
+	0xA0, 0x7F, // 0202 LDY #$7F
+	0x8C, 0x12, 0xD0, // 0204 STY DSP      DDRB, PB7 is the busy input
+	0xA9, 0xA7, // 0207 LDA #$A7
+	0x8D, 0x11, 0xD0, // 0209 STA KBDCR
+	0x8D, 0x13, 0xD0, // 020C STA DSPCR
+	0xAD, 0x11, 0xD0, // 020F LDA KBDCR    NEXTCHAR
+	0x10, 0xFB, // 0212 BPL NEXTCHAR
+	0xAD, 0x10, 0xD0, // 0214 LDA KBD
+	0x20, 0x1D, 0x02, // 0217 JSR ECHO
+	0x4C, 0x0F, 0x02, // 021A JMP NEXTCHAR
+	0x2C, 0x12, 0xD0, // 021D BIT DSP      ECHO
+	0x30, 0xFB, // 0220 BMI ECHO
+	0x8D, 0x12, 0xD0, // 0222 STA DSP
+	0x60, // 0225 RTS
+}
+
+func TestApple1Echo(t *testing.T) {
+	var out bytes.Buffer
+	a := NewApple1IO()
+	a.Output = &out
+	a.CharTime = 100
+
+	bus := &apple1Bus{io: a}
+	copy(bus.memory[0x0200:], apple1Echo)
+	c := cpu.New()
+	c.Bus = bus
+	c.Registers.PC = 0x0200
+
+	a.Receive([]byte("hello\nwoz_\x7F"))
+	for i := 0; i < 20000; i++ {
+		c.SingleStep()
+		a.Tick(1)
+	}
+
+	if want := "HELLO\r\nWOZ__"; out.String() != want {
+		t.Errorf("terminal shows %q, want %q", out.String(), want)
+	}
+}
+
+func TestApple1Handshake(t *testing.T) {
+	var out bytes.Buffer
+	a := NewApple1IO()
+	a.Output = &out
+	a.CharTime = 10
+	a.Write(APPLE1_DSP, 0x7F)
+	a.Write(APPLE1_KBDCR, 0xA7)
+	a.Write(APPLE1_DSPCR, 0xA7)
+	if a.Read(APPLE1_KBDCR)&0x80 != 0 {
+		t.Fatal("key waiting after reset")
+	}
+
+	// A key sets KBDCR bit 7 until the program reads it, and the next key waits
+	a.Receive([]byte("ab"))
+	a.Tick(1)
+	if a.Read(APPLE1_KBDCR)&0x80 == 0 {
+		t.Fatal("no key waiting")
+	}
+	a.Tick(5)
+	if got := a.Read(APPLE1_KBD); got != 0x80|'A' {
+		t.Errorf("KBD $%02X, want $C1", got)
+	}
+	if a.Read(APPLE1_KBDCR)&0x80 != 0 {
+		t.Errorf("reading KBD did not clear the key flag")
+	}
+	a.Tick(1)
+	if a.Read(APPLE1_KBD) != 0x80|'B' {
+		t.Errorf("second key did not arrive")
+	}
+
+	// Writing DSP makes the display busy until the character is drawn
+	if a.Read(APPLE1_DSP)&0x80 != 0 {
+		t.Fatal("display busy before anything was written")
+	}
+	a.Write(APPLE1_DSP, 0x80|'A')
+	if a.Read(APPLE1_DSP)&0x80 == 0 {
+		t.Errorf("display not busy after a write")
+	}
+	a.Tick(1)
+	a.Tick(9)
+	if a.Read(APPLE1_DSP)&0x80 == 0 {
+		t.Errorf("display ready before its character time")
+	}
+	a.Tick(1)
+	if a.Read(APPLE1_DSP)&0x80 != 0 {
+		t.Errorf("display still busy after its character time")
+	}
+	if out.String() != "A" {
+		t.Errorf("terminal shows %q, want \"A\"", out.String())
+	}
+}
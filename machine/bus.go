@@ -0,0 +1,68 @@
+package machine
+
+// Bus decodes the address space of a machine into RAM, ROM and devices.
+// Unmapped addresses read as whatever was last loaded there and ignore writes.
+//
+// Devices are brought up to date with the CPU's Tick counter before every
+// access. Each instruction fetches its opcode through the bus, so devices are
+// never more than one instruction behind the CPU. While the CPU waits in WAI
+// or STP it calls Idle every cycle instead.
+type Bus struct {
+	m        *Machine
+	memory   [0x10000]byte
+	writable [0x10000]bool
+	devices  [0x10000]*MappedDevice
+}
+
+func (b *Bus) Read(addr uint16) byte {
+	b.m.sync()
+	if md := b.devices[addr]; md != nil {
+		value := md.Device.Read(md.register(addr))
+		b.m.updateLines()
+		return value
+	}
+	return b.memory[addr]
+}
+
+func (b *Bus) Write(addr uint16, value byte) {
+	b.m.sync()
+	if md := b.devices[addr]; md != nil {
+		md.Device.Write(md.register(addr), value)
+		b.m.updateLines()
+		return
+	}
+	if b.writable[addr] {
+		b.memory[addr] = value
+	}
+}
+
+// Idle brings devices up to date on a cycle the CPU makes no access, so a
+// device interrupt can end a WAI
+func (b *Bus) Idle() {
+	b.m.sync()
+}
+
+// Peek reads memory and device registers without side effects, for devices
+// that are Peekers. Devices are not brought up to date first, so they can be
+// up to one instruction behind.
+func (b *Bus) Peek(addr uint16) byte {
+	if md := b.devices[addr]; md != nil {
+		if p, ok := md.Device.(Peeker); ok {
+			return p.Peek(md.register(addr))
+		}
+		return md.Device.Read(md.register(addr))
+	}
+	return b.memory[addr]
+}
+
+// Machine returns the machine the bus belongs to
+func (b *Bus) Machine() *Machine {
+	return b.m
+}
+
+// Load writes data at addr regardless of ROM, bypassing devices
+func (b *Bus) Load(addr int, data []byte) {
+	for i, value := range data {
+		b.memory[(addr+i)&0xFFFF] = value
+	}
+}
@@ -0,0 +1,130 @@
+package machine
+
+import (
+	"testing"
+)
+
+const testMachineConfig = `{
+  "memory": [
+    {"type": "ram", "start": "$0000", "size": "$5000"},
+    {"type": "rom", "start": "$F000", "size": "$1000"}
+  ],
+  "devices": [
+    {"type": "6551", "name": "acia", "start": "$5000", "irq": "irq"},
+    {"type": "6522", "name": "via", "start": "$6000", "size": "$1000", "irq": "irq"}
+  ],
+  "start": "$0200"
+}`
+
+func newTestMachine(t *testing.T, src string) *Machine {
+	t.Helper()
+	cfg, err := ParseConfig([]byte(src), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestBusMemory(t *testing.T) {
+	m := newTestMachine(t, testMachineConfig)
+
+	m.Bus.Write(0x1234, 0x42)
+	m.Bus.Write(0xF000, 0x42)
+	if m.Bus.Read(0x1234) != 0x42 || m.Bus.Read(0xF000) != 0x00 {
+		t.Errorf("RAM reads $%02X and ROM $%02X after writing $42", m.Bus.Read(0x1234), m.Bus.Read(0xF000))
+	}
+
+	// Loading ignores ROM protection, and reaches the bus through the CPU
+	m.CPU.WriteMemory(0xFFFC, []byte{0x00, 0xF0})
+	if m.Bus.Peek(0xFFFC) != 0x00 || m.Bus.Peek(0xFFFD) != 0xF0 {
+		t.Errorf("WriteMemory did not load ROM")
+	}
+
+	// VIA registers repeat through its 4K
+	m.Bus.Write(0x6003, 0xA5)
+	if m.Bus.Read(0x6FF3) != 0xA5 {
+		t.Errorf("VIA DDRA is not mirrored")
+	}
+}
+
+// countingDevice counts its reads, like a status register that clears on read
+type countingDevice struct{ reads int }
+
+func (d *countingDevice) Read(reg uint16) byte         { d.reads += 1; return byte(reg) }
+func (d *countingDevice) Write(reg uint16, value byte) {}
+
+type peekingDevice struct{ countingDevice }
+
+func (d *peekingDevice) Peek(reg uint16) byte { return byte(reg) }
+
+func TestBusPeek(t *testing.T) {
+	m := newTestMachine(t, testMachineConfig)
+	plain, peeking := &countingDevice{}, &peekingDevice{}
+	if err := m.Map(&MappedDevice{Name: "plain", Start: 0x7000, End: 0x7003, Device: plain}, 4); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Map(&MappedDevice{Name: "peeking", Start: 0x7010, End: 0x7013, Device: peeking}, 4); err != nil {
+		t.Fatal(err)
+	}
+
+	m.Bus.Write(0x1234, 0x42)
+	if m.Bus.Peek(0x1234) != 0x42 || m.CPU.Peek(0x1234) != 0x42 {
+		t.Errorf("peeking at RAM gave $%02X", m.Bus.Peek(0x1234))
+	}
+	if m.Bus.Peek(0x7012) != 2 || m.CPU.Peek(0x7012) != 2 || peeking.reads != 0 {
+		t.Errorf("peeking at a Peeker read it %d times", peeking.reads)
+	}
+	if m.Bus.Peek(0x7002) != 2 || plain.reads != 1 {
+		t.Errorf("a device without Peek was read %d times, want 1", plain.reads)
+	}
+}
+
+// WAI makes no bus accesses, so the bus has to keep the VIA running for its
+// timer to end the wait
+func TestWAIWokenByVIA(t *testing.T) {
+	m := newTestMachine(t, `{
+  "cpu": {"variant": "65c02"},
+  "memory": [
+    {"type": "ram", "start": "$0000", "size": "$4000"},
+    {"type": "rom", "start": "$F000", "size": "$1000"}
+  ],
+  "devices": [
+    {"type": "6522", "name": "via", "start": "$6000", "irq": "irq"}
+  ],
+  "start": "$0200"
+}`)
+	m.CPU.WriteMemory(0x0200, []byte{
+		0xA9, 0xC0, // LDA #$C0
+		0x8D, 0x0E, 0x60, // STA IER, enabling the T1 interrupt
+		0xA9, 0x10, // LDA #$10
+		0x8D, 0x04, 0x60, // STA T1CL
+		0xA9, 0x00, // LDA #$00
+		0x8D, 0x05, 0x60, // STA T1CH, starting T1
+		0x58, // CLI
+		0xCB, // WAI
+		0xEA, // NOP
+	})
+	m.CPU.WriteMemory(0x0300, []byte{0xAD, 0x04, 0x60, 0x40}) // LDA T1CL; RTI
+	m.CPU.WriteMemory(0xFFFE, []byte{0x00, 0x03})
+
+	for i := 0; i < 1000 && m.CPU.Registers.PC != 0x0300; i++ {
+		m.CPU.SingleStep()
+	}
+	if m.CPU.Registers.PC != 0x0300 {
+		t.Fatalf("still at $%04X with IRQ %v, the timer never ended the WAI", m.CPU.Registers.PC, m.CPU.IRQLine)
+	}
+
+	// The rest of the interrupt entry, then the handler clears the interrupt
+	// and returns after the WAI
+	for i := 0; i < 3; i++ {
+		m.CPU.SingleOperation()
+	}
+	if m.CPU.Registers.PC != 0x0211 || m.CPU.IRQLine {
+		t.Errorf("returned to $%04X with IRQ %v, want $0211 with the interrupt cleared", m.CPU.Registers.PC, m.CPU.IRQLine)
+	}
+}
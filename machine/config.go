@@ -0,0 +1,136 @@
+package machine
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Config describes a machine: the CPU, what is mapped where in the address
+// space, and the symbol files that go with its ROMs. Config files are JSON,
+// with addresses and sizes given either as numbers or as "$hex", "0xhex" or
+// decimal strings. The CPU variant is one of the VariantNames: nmos, 2a03 or
+// 65c02.
+//
+//	{
+//	  "cpu": {"variant": "nmos", "clock": 1000000, "realtime": true},
+//	  "memory": [
+//	    {"type": "ram", "start": "$0000", "size": "$4000"},
+//	    {"type": "rom", "start": "$8000", "size": "$8000", "image": "rom.bin"}
+//	  ],
+//	  "devices": [
+//	    {"type": "6522", "name": "via", "start": "$6000", "irq": "irq"},
+//	    {"type": "6551", "name": "acia", "start": "$5000", "irq": "irq",
+//	     "options": {"serial": "stdio"}}
+//	  ],
+//	  "symbols": ["rom.sym"]
+//	}
+type Config struct {
+	Comment string         `json:"comment"` // Notes for people reading the file, such as how addresses are decoded
+	CPU     CPUConfig      `json:"cpu"`
+	Memory  []RegionConfig `json:"memory"`
+	Devices []DeviceConfig `json:"devices"`
+	Symbols []string       `json:"symbols"`
+	Start   *Number        `json:"start"` // Initial PC, the reset vector when missing
+
+	dir string // Relative paths are resolved against this directory
+}
+
+type CPUConfig struct {
+	Variant  string `json:"variant"`
+	Clock    int    `json:"clock"`    // Hz, 0 when it doesn't matter
+	Realtime bool   `json:"realtime"` // Run no faster than the clock
+}
+
+// RegionConfig is a block of RAM or ROM, optionally filled from an image file
+type RegionConfig struct {
+	Type     string `json:"type"` // "ram" or "rom"
+	Start    Number `json:"start"`
+	Size     Number `json:"size"`
+	Image    string `json:"image"`
+	Format   string `json:"format"`   // Image format, detected from the file when empty
+	Offset   Number `json:"offset"`   // Where the image goes relative to Start, for raw images
+	Optional bool   `json:"optional"` // Leave the region empty when the image file is missing
+}
+
+// DeviceConfig places a device from DeviceTypes in the address space. The
+// device's registers repeat through Size when it is larger than the device.
+type DeviceConfig struct {
+	Type    string          `json:"type"`
+	Name    string          `json:"name"` // Defaults to the type
+	Start   Number          `json:"start"`
+	Size    Number          `json:"size"` // Defaults to the device's own size
+	IRQ     string          `json:"irq"`  // "irq", "nmi", or empty when not wired
+	Options json.RawMessage `json:"options"`
+}
+
+// Number is an address or size that accepts JSON numbers and strings
+type Number int
+
+func (n *Number) UnmarshalJSON(data []byte) error {
+	var text string
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &text); err != nil {
+			return err
+		}
+	} else {
+		text = string(data)
+	}
+
+	value, err := ParseNumber(text)
+	if err != nil {
+		return err
+	}
+	*n = Number(value)
+	return nil
+}
+
+// ParseNumber accepts decimal, $hex and 0xhex
+func ParseNumber(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	var value int64
+	var err error
+	if strings.HasPrefix(s, "$") {
+		value, err = strconv.ParseInt(s[1:], 16, 32)
+	} else {
+		value, err = strconv.ParseInt(s, 0, 32)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("bad number %q", s)
+	}
+	return int(value), nil
+}
+
+// ParseConfig decodes a config, resolving relative paths against dir
+func ParseConfig(data []byte, dir string) (*Config, error) {
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	cfg.dir = dir
+	return &cfg, nil
+}
+
+// LoadConfig reads a config file
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ParseConfig(data, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// Path resolves a path from the config against the config's directory
+func (cfg *Config) Path(path string) string {
+	if path == "" || filepath.IsAbs(path) || cfg.dir == "" {
+		return path
+	}
+	return filepath.Join(cfg.dir, path)
+}
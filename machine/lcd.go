@@ -0,0 +1,378 @@
+package machine
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Size of the character LCD drawn for a HD44780
+const (
+	LCD_COLUMNS = 16
+	LCD_ROWS    = 2
+)
+
+// HD44780 instructions, the highest set bit picks the instruction
+const (
+	LCD_CLEAR    byte = 0x01
+	LCD_HOME     byte = 0x02
+	LCD_ENTRY    byte = 0x04 // Bit 1 increments the address, bit 0 shifts the display
+	LCD_DISPLAY  byte = 0x08 // Bit 2 turns the display on, bit 1 the cursor and bit 0 blinking
+	LCD_SHIFT    byte = 0x10 // Bit 3 shifts the display rather than the cursor, bit 2 to the right
+	LCD_FUNCTION byte = 0x20 // Bit 4 for the 8 bit interface, bit 3 for two lines
+	LCD_CGRAM    byte = 0x40 // Sets the character generator RAM address
+	LCD_DDRAM    byte = 0x80 // Sets the display RAM address
+)
+
+// How long instructions keep the controller busy, in microseconds
+const (
+	lcdClearTime   = 1520
+	lcdCommandTime = 37
+	lcdDataTime    = 41
+)
+
+// HD44780 emulates a Hitachi HD44780 character LCD controller with a 16x2
+// display. It is driven through its pins with Pins and drawn on Output with
+// ANSI escapes, redrawn in place at most 30 times a second.
+type HD44780 struct {
+	Output io.Writer
+	Clock  int // CPU clock in Hz, for the busy flag. The controller is never busy when 0.
+
+	ddram  [0x80]byte
+	cgram  [0x40]byte
+	addr   byte
+	cgMode bool // The address is in CGRAM
+
+	increment    bool
+	shiftDisplay bool
+	shift        int
+	displayOn    bool
+	cursorOn     bool
+	blinkOn      bool
+	twoLines     bool
+	fourBit      bool
+
+	rs, rw, e bool
+	data      byte
+	low       bool // The next 4 bit transfer is the low nibble
+	high      byte // High nibble of a 4 bit write
+	read      byte // Value being read
+
+	now       int
+	busyUntil int
+	dirty     bool
+	drawn     bool
+	lastDraw  int
+}
+
+func NewHD44780() *HD44780 {
+	l := &HD44780{increment: true, dirty: true}
+	for i := range l.ddram {
+		l.ddram[i] = ' '
+	}
+	return l
+}
+
+// Pins sets the levels on the register select, read/write and enable pins
+// and D0-D7. Only D4-D7 are used once the program has picked the 4 bit
+// interface.
+func (l *HD44780) Pins(rs, rw, e bool, data byte) {
+	rising, falling := e && !l.e, !e && l.e
+	l.rs, l.rw, l.e, l.data = rs, rw, e, data
+
+	switch {
+	case rising && rw && !l.low:
+		l.read = l.readRegister()
+	case falling && rw:
+		if l.fourBit && !l.low {
+			l.low = true
+			return
+		}
+		l.low = false
+		// Reading data moves the address like writing does
+		if rs {
+			l.move()
+		}
+	case falling:
+		value := data
+		if l.fourBit {
+			if !l.low {
+				l.high = data & 0xF0
+				l.low = true
+				return
+			}
+			value = l.high | data>>4
+			l.low = false
+		}
+		l.write(rs, value)
+	}
+}
+
+// Bus returns what the controller drives onto D0-D7, with undriven pins
+// high
+func (l *HD44780) Bus() byte {
+	switch {
+	case !l.e || !l.rw:
+		return 0xFF
+	case !l.fourBit:
+		return l.read
+	case l.low:
+		return l.read<<4 | 0x0F
+	}
+	return l.read | 0x0F
+}
+
+func (l *HD44780) busy() bool {
+	return l.now < l.busyUntil
+}
+
+func (l *HD44780) readRegister() byte {
+	if l.rs {
+		if l.cgMode {
+			return l.cgram[l.addr&0x3F]
+		}
+		return l.ddram[l.addr&0x7F]
+	}
+	value := l.addr & 0x7F
+	if l.busy() {
+		value |= 0x80
+	}
+	return value
+}
+
+// write runs an instruction, or stores data when rs is set. The controller
+// ignores both while it is busy.
+func (l *HD44780) write(rs bool, value byte) {
+	if l.busy() {
+		return
+	}
+	if rs {
+		if l.cgMode {
+			l.cgram[l.addr&0x3F] = value
+		} else {
+			l.ddram[l.addr&0x7F] = value
+			if l.shiftDisplay {
+				l.scroll(l.increment)
+			}
+		}
+		l.move()
+		l.setBusy(lcdDataTime)
+		l.dirty = true
+		return
+	}
+
+	switch {
+	case value&LCD_DDRAM != 0:
+		l.addr = value & 0x7F
+		l.cgMode = false
+	case value&LCD_CGRAM != 0:
+		l.addr = value & 0x3F
+		l.cgMode = true
+	case value&LCD_FUNCTION != 0:
+		l.fourBit = value&0x10 == 0
+		l.twoLines = value&0x08 != 0
+		l.low = false
+	case value&LCD_SHIFT != 0:
+		if value&0x08 != 0 {
+			l.scroll(value&0x04 == 0)
+		} else {
+			l.step(value&0x04 != 0)
+		}
+	case value&LCD_DISPLAY != 0:
+		l.displayOn = value&0x04 != 0
+		l.cursorOn = value&0x02 != 0
+		l.blinkOn = value&0x01 != 0
+	case value&LCD_ENTRY != 0:
+		l.increment = value&0x02 != 0
+		l.shiftDisplay = value&0x01 != 0
+	case value&LCD_HOME != 0:
+		l.addr, l.cgMode, l.shift = 0, false, 0
+		l.setBusy(lcdClearTime)
+		l.dirty = true
+		return
+	case value&LCD_CLEAR != 0:
+		for i := range l.ddram {
+			l.ddram[i] = ' '
+		}
+		l.addr, l.cgMode, l.shift = 0, false, 0
+		l.increment = true
+		l.setBusy(lcdClearTime)
+		l.dirty = true
+		return
+	}
+	l.setBusy(lcdCommandTime)
+	l.dirty = true
+}
+
+func (l *HD44780) setBusy(micros int) {
+	l.busyUntil = l.now + l.Clock/1000*micros/1000
+}
+
+// move steps the address after a data access
+func (l *HD44780) move() {
+	if l.cgMode {
+		if l.increment {
+			l.addr = (l.addr + 1) & 0x3F
+		} else {
+			l.addr = (l.addr - 1) & 0x3F
+		}
+		return
+	}
+	l.step(l.increment)
+}
+
+// step moves the display RAM address, which skips the gap between the lines
+// in two line mode
+func (l *HD44780) step(right bool) {
+	if !l.twoLines {
+		if right {
+			l.addr = (l.addr + 1) % 80
+		} else {
+			l.addr = (l.addr + 79) % 80
+		}
+		return
+	}
+
+	switch {
+	case right && l.addr == 0x27:
+		l.addr = 0x40
+	case right && l.addr >= 0x67:
+		l.addr = 0x00
+	case right:
+		l.addr++
+	case l.addr == 0x40:
+		l.addr = 0x27
+	case l.addr == 0x00:
+		l.addr = 0x67
+	default:
+		l.addr--
+	}
+}
+
+// scroll shifts the display window over the display RAM
+func (l *HD44780) scroll(left bool) {
+	if left {
+		l.shift++
+	} else {
+		l.shift--
+	}
+	l.dirty = true
+}
+
+// Tick keeps time for the busy flag and redraws the display when it has
+// changed
+func (l *HD44780) Tick(cycles int) {
+	l.now += cycles
+	interval := 30000
+	if l.Clock > 0 {
+		interval = l.Clock / 30
+	}
+	if l.dirty && (!l.drawn || l.now-l.lastDraw >= interval) {
+		l.draw()
+	}
+}
+
+// cell returns the display RAM address shown at a row and column
+func (l *HD44780) cell(row, column int) byte {
+	if !l.twoLines {
+		return byte(((column+l.shift)%80 + 80) % 80)
+	}
+	return byte(row*0x40 + ((column+l.shift)%40+40)%40)
+}
+
+// lcdRune is what a character from the controller's ROM looks like on the
+// host
+func lcdRune(ch byte) string {
+	switch {
+	case ch < 0x10:
+		return "▒" // User defined in CGRAM
+	case ch == 0x5C:
+		return "¥"
+	case ch == 0x7E:
+		return "→"
+	case ch == 0x7F:
+		return "←"
+	case ch == 0xDF:
+		return "°"
+	case ch >= 0x20 && ch < 0x7E:
+		return string(rune(ch))
+	}
+	return "?"
+}
+
+func (l *HD44780) draw() {
+	l.dirty = false
+	l.lastDraw = l.now
+	if l.Output == nil {
+		return
+	}
+
+	var b strings.Builder
+	if l.drawn {
+		fmt.Fprintf(&b, "\x1b[%dA", LCD_ROWS+2)
+	}
+	l.drawn = true
+	border := "+" + strings.Repeat("-", LCD_COLUMNS) + "+\r\n"
+	b.WriteString(border)
+	for row := 0; row < LCD_ROWS; row++ {
+		b.WriteString("|")
+		for column := 0; column < LCD_COLUMNS; column++ {
+			if !l.displayOn || row > 0 && !l.twoLines {
+				b.WriteString(" ")
+				continue
+			}
+			addr := l.cell(row, column)
+			text := lcdRune(l.ddram[addr])
+			switch {
+			case addr != l.addr || l.cgMode:
+			case l.blinkOn:
+				text = "\x1b[7m" + text + "\x1b[0m"
+			case l.cursorOn:
+				text = "\x1b[4m" + text + "\x1b[0m"
+			}
+			b.WriteString(text)
+		}
+		b.WriteString("|\r\n")
+	}
+	b.WriteString(border)
+	io.WriteString(l.Output, b.String())
+}
+
+// AttachVIA wires the LCD to a VIA the way the breadboard 6502 computer does.
+// In the "8bit" wiring port B is D0-D7 and PA5, PA6 and PA7 are RS, RW and E.
+// In the "4bit" wiring PB0-PB3 are D4-D7 and PB4, PB5 and PB6 are RS, RW
+// and E.
+//
+// machines/beneater.json is that computer with the LCD in the 8bit wiring,
+// and machines/beneater_serial.json adds the W65C51N serial card on a pty
+// with the LCD in the 4bit wiring. Both load the 32K ROM from
+// machines/roms/beneater.bin on a 65C02. Only $0000-$3FFF of the 32K RAM
+// chip is decoded, as on the board, where A14 selects the VIA and ACIA.
+func (l *HD44780) AttachVIA(v *VIA, wiring string) error {
+	switch wiring {
+	case "8bit":
+		var control, data byte = 0xFF, 0xFF
+		update := func() {
+			l.Pins(control&0x20 != 0, control&0x40 != 0, control&0x80 != 0, data)
+		}
+		v.PortA.Output = func(pins byte) {
+			control = pins
+			update()
+		}
+		v.PortB.Output = func(pins byte) {
+			data = pins
+			update()
+		}
+		v.PortB.Input = l.Bus
+	case "4bit":
+		v.PortB.Output = func(pins byte) {
+			l.Pins(pins&0x10 != 0, pins&0x20 != 0, pins&0x40 != 0, pins<<4)
+		}
+		v.PortB.Input = func() byte {
+			return l.Bus()>>4 | 0xF0
+		}
+	default:
+		return fmt.Errorf("unknown LCD wiring %q, expected 8bit or 4bit", wiring)
+	}
+	return nil
+}
@@ -0,0 +1,110 @@
+package machine
+
+import "testing"
+
+// pulseLCD clocks one transfer into or out of the controller on E
+func pulseLCD(l *HD44780, rs, rw bool, data byte) {
+	l.Pins(rs, rw, true, data)
+	l.Pins(rs, rw, false, data)
+}
+
+// writeLCD4 sends a byte over the 4 bit interface, high nibble first on D4-D7
+func writeLCD4(l *HD44780, rs bool, value byte) {
+	pulseLCD(l, rs, false, value&0xF0)
+	pulseLCD(l, rs, false, value<<4)
+}
+
+// readLCD4 reads a byte over the 4 bit interface, high nibble first
+func readLCD4(l *HD44780, rs bool) byte {
+	l.Pins(rs, true, true, 0xFF)
+	high := l.Bus() & 0xF0
+	l.Pins(rs, true, false, 0xFF)
+	l.Pins(rs, true, true, 0xFF)
+	low := l.Bus() >> 4
+	l.Pins(rs, true, false, 0xFF)
+	return high | low
+}
+
+func TestHD44780FourBit(t *testing.T) {
+	l := NewHD44780()
+	l.Clock = 1000000
+
+	// The controller starts on the 8 bit interface, so the function set that
+	// picks 4 bits is a single transfer
+	pulseLCD(l, false, false, LCD_FUNCTION)
+	l.Tick(lcdCommandTime)
+	writeLCD4(l, false, LCD_FUNCTION|0x08)
+	l.Tick(lcdCommandTime)
+	if !l.fourBit || !l.twoLines {
+		t.Fatalf("function set left fourBit %v and twoLines %v", l.fourBit, l.twoLines)
+	}
+
+	// Half a byte does nothing until the low nibble follows
+	pulseLCD(l, true, false, 'H'&0xF0)
+	if l.ddram[0] != ' ' || l.addr != 0 {
+		t.Fatalf("the high nibble alone wrote $%02X", l.ddram[0])
+	}
+	pulseLCD(l, true, false, 'H'&0x0F<<4)
+	if l.ddram[0] != 'H' || l.addr != 1 {
+		t.Fatalf("wrote $%02X and moved to $%02X, want 'H' and $01", l.ddram[0], l.addr)
+	}
+
+	// Reads come back in the same order, the busy flag with the address
+	if got := readLCD4(l, false); got != 0x81 {
+		t.Errorf("status $%02X right after a write, want busy at $01", got)
+	}
+	l.Tick(lcdDataTime)
+	if got := readLCD4(l, false); got != 0x01 {
+		t.Errorf("status $%02X after the write time, want idle at $01", got)
+	}
+
+	writeLCD4(l, false, LCD_DDRAM|0x00)
+	l.Tick(lcdCommandTime)
+	if got := readLCD4(l, true); got != 'H' {
+		t.Errorf("read $%02X back from display RAM, want 'H'", got)
+	}
+	if l.addr != 1 {
+		t.Errorf("reading data left the address at $%02X, want $01", l.addr)
+	}
+}
+
+func TestHD44780Busy(t *testing.T) {
+	l := NewHD44780()
+	l.Clock = 1000000
+	pulseLCD(l, false, false, LCD_FUNCTION|0x18)
+	l.Tick(lcdCommandTime)
+
+	// Writes while the controller is busy are lost
+	pulseLCD(l, true, false, 'A')
+	pulseLCD(l, true, false, 'B')
+	l.Tick(lcdDataTime - 1)
+	pulseLCD(l, true, false, 'C')
+	l.Tick(1)
+	pulseLCD(l, true, false, 'D')
+	if got := string(l.ddram[:3]); got != "AD " {
+		t.Errorf("display RAM holds %q, want \"AD \"", got)
+	}
+
+	// Clear takes much longer than other instructions
+	l.Tick(lcdDataTime)
+	pulseLCD(l, false, false, LCD_CLEAR)
+	l.Tick(lcdCommandTime)
+	l.Pins(false, true, true, 0xFF)
+	if l.Bus()&0x80 == 0 {
+		t.Errorf("busy flag clear %d cycles into a clear", lcdCommandTime)
+	}
+	l.Pins(false, true, false, 0xFF)
+	l.Tick(lcdClearTime - lcdCommandTime)
+	l.Pins(false, true, true, 0xFF)
+	if l.Bus()&0x80 != 0 {
+		t.Errorf("busy flag still set after the clear time")
+	}
+
+	// Without a clock the controller is never busy
+	l = NewHD44780()
+	pulseLCD(l, true, false, 'A')
+	pulseLCD(l, true, false, 'B')
+	if got := string(l.ddram[:2]); got != "AB" {
+		t.Errorf("display RAM holds %q without a clock, want \"AB\"", got)
+	}
+}
@@ -0,0 +1,384 @@
+// Package machine builds complete systems around a Cpu6502 from a Config:
+// RAM and ROM regions, memory mapped devices and the wiring of their
+// interrupt outputs to the CPU.
+package machine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+	loader "izzudinhafiz.com/go-6502/loader"
+)
+
+// Device is a peripheral mapped into the address space. Registers are
+// numbered from the device's start address.
+type Device interface {
+	Read(reg uint16) byte
+	Write(reg uint16, value byte)
+}
+
+// Peeker is a device whose registers can be read without side effects, such
+// as clearing interrupt flags, for debuggers. Other devices are peeked with Read.
+type Peeker interface {
+	Peek(reg uint16) byte
+}
+
+// Ticker is a device that does work as time passes, such as a timer
+type Ticker interface {
+	Tick(cycles int)
+}
+
+// Interrupter is a device with an interrupt output
+type Interrupter interface {
+	IRQ() bool // Whether the output is asserted
+}
+
+// Resetter is a device with a reset input
+type Resetter interface {
+	Reset()
+}
+
+// Where a device's interrupt output is wired
+const (
+	LINE_NONE byte = iota
+	LINE_IRQ
+	LINE_NMI
+)
+
+var lineNames = map[string]byte{"": LINE_NONE, "none": LINE_NONE, "irq": LINE_IRQ, "nmi": LINE_NMI}
+
+// DeviceType describes a kind of device that configs can name
+type DeviceType struct {
+	Size int // Number of registers
+	New  func(m *Machine, cfg DeviceConfig) (Device, error)
+}
+
+// Device types available to configs, by name
+var DeviceTypes = map[string]DeviceType{
+	"6522": {16, newVIADevice},
+	"via":  {16, newVIADevice},
+	"6551": {4, newACIADevice},
+	"acia": {4, newACIADevice},
+	"6532": {32, newRIOTDevice},
+	"riot": {32, newRIOTDevice},
+	"6520": {4, newPIADevice},
+	"6821": {4, newPIADevice},
+	"pia":  {4, newPIADevice},
+
+	"apple1": {4, newApple1Device},
+}
+
+// MappedDevice is a device placed in the address space
+type MappedDevice struct {
+	Name   string
+	Type   string
+	Start  uint16
+	End    uint16 // Last address, inclusive
+	Line   byte   // LINE_* the interrupt output drives
+	Device Device
+
+	size int
+}
+
+func (md *MappedDevice) register(addr uint16) uint16 {
+	return uint16(int(addr-md.Start) % md.size)
+}
+
+// Machine is a CPU wired to a Bus
+type Machine struct {
+	CPU     *cpu.Cpu6502
+	Bus     *Bus
+	Clock   int  // Hz, 0 when unknown
+	Paced   bool // Hold the CPU to Clock in real time
+	Devices []*MappedDevice
+	Symbols []string // Symbol files for the debugger, paths resolved
+
+	start    *Number // Initial PC from the config
+	tickers  []Ticker
+	lastTick int
+
+	paceTick int // Tick and time pacing is measured from
+	paceTime time.Time
+}
+
+// New builds the machine described by cfg and resets it
+func New(cfg *Config) (*Machine, error) {
+	variant, err := cpu.ParseVariant(cfg.CPU.Variant)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Machine{CPU: cpu.New(), Clock: cfg.CPU.Clock, Paced: cfg.CPU.Realtime, start: cfg.Start}
+	m.Bus = &Bus{m: m}
+	m.CPU.Variant = variant
+	m.CPU.Bus = m.Bus
+
+	for i, region := range cfg.Memory {
+		if err := m.addRegion(cfg, region); err != nil {
+			return nil, fmt.Errorf("memory region %d: %w", i, err)
+		}
+	}
+	for _, dev := range cfg.Devices {
+		if err := m.addDevice(dev); err != nil {
+			m.Close()
+			name := dev.Name
+			if name == "" {
+				name = dev.Type
+			}
+			return nil, fmt.Errorf("device %v: %w", name, err)
+		}
+	}
+	for _, path := range cfg.Symbols {
+		m.Symbols = append(m.Symbols, cfg.Path(path))
+	}
+
+	m.Reset()
+	return m, nil
+}
+
+func checkRange(start Number, size Number) error {
+	if size <= 0 {
+		return fmt.Errorf("size must be positive")
+	}
+	if start < 0 || int(start)+int(size) > 0x10000 {
+		return fmt.Errorf("$%X bytes at $%X do not fit in the address space", int(size), int(start))
+	}
+	return nil
+}
+
+func (m *Machine) addRegion(cfg *Config, region RegionConfig) error {
+	var writable bool
+	switch strings.ToLower(region.Type) {
+	case "ram":
+		writable = true
+	case "rom":
+	default:
+		return fmt.Errorf("unknown region type %q", region.Type)
+	}
+	if err := checkRange(region.Start, region.Size); err != nil {
+		return err
+	}
+	start, end := int(region.Start), int(region.Start+region.Size)
+	for addr := start; addr < end; addr++ {
+		m.Bus.writable[addr] = writable
+	}
+
+	if region.Image == "" {
+		return nil
+	}
+	if _, err := os.Stat(cfg.Path(region.Image)); region.Optional && errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	format, err := loader.ParseFormat(region.Format)
+	if err != nil {
+		return err
+	}
+	img, err := loader.LoadFile(cfg.Path(region.Image), loader.Options{Format: format, Addr: start + int(region.Offset)})
+	if err != nil {
+		return err
+	}
+	for _, seg := range img.Segments {
+		if seg.Addr < start || seg.Addr+len(seg.Data) > end {
+			return fmt.Errorf("%v: $%X bytes at $%X fall outside the region", region.Image, len(seg.Data), seg.Addr)
+		}
+		m.Bus.Load(seg.Addr, seg.Data)
+	}
+	return nil
+}
+
+func (m *Machine) addDevice(cfg DeviceConfig) error {
+	devType, exists := DeviceTypes[strings.ToLower(cfg.Type)]
+	if !exists {
+		return fmt.Errorf("unknown device type %q", cfg.Type)
+	}
+	line, exists := lineNames[strings.ToLower(cfg.IRQ)]
+	if !exists {
+		return fmt.Errorf("irq must be irq, nmi or empty, not %q", cfg.IRQ)
+	}
+	if cfg.Name == "" {
+		cfg.Name = cfg.Type
+	}
+	if m.Device(cfg.Name) != nil {
+		return fmt.Errorf("a device is already named %q", cfg.Name)
+	}
+	if cfg.Size == 0 {
+		cfg.Size = Number(devType.Size)
+	}
+	if err := checkRange(cfg.Start, cfg.Size); err != nil {
+		return err
+	}
+
+	device, err := devType.New(m, cfg)
+	if err != nil {
+		return err
+	}
+	return m.Map(&MappedDevice{
+		Name:   cfg.Name,
+		Type:   cfg.Type,
+		Start:  uint16(cfg.Start),
+		End:    uint16(cfg.Start + cfg.Size - 1),
+		Line:   line,
+		Device: device,
+	}, devType.Size)
+}
+
+// Map places a device in the address space, repeating its registers every
+// size bytes. Device constructors use it for chips with a second address
+// range, such as the RAM of a RIOT.
+func (m *Machine) Map(md *MappedDevice, size int) error {
+	if m.Device(md.Name) != nil {
+		return fmt.Errorf("a device is already named %q", md.Name)
+	}
+	for addr := int(md.Start); addr <= int(md.End); addr++ {
+		if other := m.Bus.devices[addr]; other != nil {
+			return fmt.Errorf("%v overlaps %v at $%04X", md.Name, other.Name, addr)
+		}
+	}
+
+	md.size = size
+	for addr := int(md.Start); addr <= int(md.End); addr++ {
+		m.Bus.devices[addr] = md
+	}
+	m.Devices = append(m.Devices, md)
+	if t, ok := md.Device.(Ticker); ok {
+		m.tickers = append(m.tickers, t)
+	}
+	return nil
+}
+
+// AddTicker gives time to hardware that is not mapped into the address
+// space, such as an LCD wired to a VIA's ports
+func (m *Machine) AddTicker(t Ticker) {
+	m.tickers = append(m.tickers, t)
+}
+
+// Device returns the device with the given name, or nil
+func (m *Machine) Device(name string) Device {
+	for _, md := range m.Devices {
+		if md.Name == name {
+			return md.Device
+		}
+	}
+	return nil
+}
+
+// Reset resets every device and then the CPU, which starts at the config's
+// start address if it has one, else at the reset vector
+func (m *Machine) Reset() {
+	for _, md := range m.Devices {
+		if r, ok := md.Device.(Resetter); ok {
+			r.Reset()
+		}
+	}
+	m.updateLines()
+	m.lastTick = m.CPU.Tick
+	m.CPU.Reset()
+	m.lastTick = m.CPU.Tick
+	if m.start != nil {
+		m.CPU.Registers.PC = uint16(*m.start)
+	}
+}
+
+// Load writes a program image into memory, including over ROM
+func (m *Machine) Load(img *loader.Image) error {
+	for _, seg := range img.Segments {
+		if seg.Addr < 0 || seg.Addr+len(seg.Data) > 0x10000 {
+			return fmt.Errorf("segment at $%X with %d bytes does not fit in the address space", seg.Addr, len(seg.Data))
+		}
+	}
+	for _, seg := range img.Segments {
+		m.Bus.Load(seg.Addr, seg.Data)
+	}
+	return nil
+}
+
+// Close closes the host connections of devices such as serial ports
+func (m *Machine) Close() error {
+	var first error
+	for _, md := range m.Devices {
+		if c, ok := md.Device.(io.Closer); ok {
+			if err := c.Close(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	return first
+}
+
+// sync advances the devices to the CPU's Tick counter
+func (m *Machine) sync() {
+	elapsed := m.CPU.Tick - m.lastTick
+	m.lastTick = m.CPU.Tick
+	if m.Paced && m.Clock > 0 {
+		m.pace()
+	}
+	if elapsed <= 0 || len(m.tickers) == 0 {
+		return
+	}
+	for _, t := range m.tickers {
+		t.Tick(elapsed)
+	}
+	m.updateLines()
+}
+
+// pace sleeps whenever the CPU gets ahead of its clock. Checking every
+// hundredth of a second of CPU time keeps the sleeps long enough to be
+// accurate. Falling far behind, such as while stopped in a debugger, starts
+// the measurement again rather than running flat out to catch up.
+func (m *Machine) pace() {
+	cycles := m.CPU.Tick - m.paceTick
+	if cycles >= 0 && cycles < m.Clock/100 {
+		return
+	}
+
+	now := time.Now()
+	if cycles < 0 || m.paceTime.IsZero() {
+		m.paceTick, m.paceTime = m.CPU.Tick, now
+		return
+	}
+	due := m.paceTime.Add(time.Duration(float64(cycles) / float64(m.Clock) * float64(time.Second)))
+	if wait := due.Sub(now); wait > 0 {
+		time.Sleep(wait)
+		now = due
+	} else if wait > -100*time.Millisecond {
+		now = due
+	}
+	m.paceTick, m.paceTime = m.CPU.Tick, now
+}
+
+// updateLines drives the CPU interrupt inputs from the device outputs, which
+// are wired together the way open collector outputs usually are
+func (m *Machine) updateLines() {
+	var irq, nmi bool
+	for _, md := range m.Devices {
+		dev, ok := md.Device.(Interrupter)
+		if !ok || md.Line == LINE_NONE || !dev.IRQ() {
+			continue
+		}
+		if md.Line == LINE_IRQ {
+			irq = true
+		} else {
+			nmi = true
+		}
+	}
+	m.CPU.IRQLine = irq
+	m.CPU.SetNMILine(nmi)
+}
+
+// decodeOptions decodes a device's options into v, leaving v alone when there are none
+func decodeOptions(cfg DeviceConfig, v interface{}) error {
+	if len(cfg.Options) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(cfg.Options, v); err != nil {
+		return fmt.Errorf("options: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package machine
+
+// PIA registers. The data direction and output registers share an address,
+// bit 2 of the port's control register chooses between them.
+const (
+	PIA_PORTA uint16 = iota // Port A data, or DDRA when CRA bit 2 is clear
+	PIA_CRA                 // Port A control
+	PIA_PORTB               // Port B data, or DDRB when CRB bit 2 is clear
+	PIA_CRB                 // Port B control
+)
+
+// Control register bits
+const (
+	PIA_C1_IRQ  byte = 0x01 // Interrupt on C1
+	PIA_C1_EDGE byte = 0x02 // C1 is active on the rising edge, else the falling edge
+	PIA_DATA    byte = 0x04 // The data register is selected, else the DDR
+	PIA_C2_IRQ  byte = 0x08 // C2 input: interrupt on C2; C2 output: pulse or manual level
+	PIA_C2_EDGE byte = 0x10 // C2 input: active on the rising edge; C2 output: manual mode
+	PIA_C2_OUT  byte = 0x20 // C2 is an output
+	PIA_IRQ2    byte = 0x40 // C2 saw its active edge
+	PIA_IRQ1    byte = 0x80 // C1 saw its active edge
+)
+
+// piaSide is one port of a PIA with its control lines
+type piaSide struct {
+	port    *Port
+	data    byte
+	ddr     byte
+	cr      byte
+	c1, c2  bool
+	c2Pulse bool // C2 goes back high on the next cycle
+	isPortB bool
+}
+
+// PIA emulates a MOS 6520 or Motorola 6821 Peripheral Interface Adapter: two
+// 8 bit ports, each with an interrupt input and a control line that can be
+// an interrupt input or a handshake output. The IRQA and IRQB outputs are
+// wired together.
+type PIA struct {
+	PortA Port
+	PortB Port
+
+	a, b piaSide
+}
+
+func NewPIA() *PIA {
+	p := &PIA{}
+	p.a = piaSide{port: &p.PortA}
+	p.b = piaSide{port: &p.PortB, isPortB: true}
+	p.Reset()
+	return p
+}
+
+// Reset clears every register, making both ports inputs
+func (p *PIA) Reset() {
+	for _, s := range []*piaSide{&p.a, &p.b} {
+		s.data, s.ddr, s.cr = 0, 0, 0
+		s.c1, s.c2 = true, true
+		s.c2Pulse = false
+		s.port.sent = false
+		s.output()
+	}
+}
+
+// IRQ reports whether either interrupt output is pulled low
+func (p *PIA) IRQ() bool {
+	return p.a.irq() || p.b.irq()
+}
+
+func (s *piaSide) irq() bool {
+	if s.cr&PIA_IRQ1 != 0 && s.cr&PIA_C1_IRQ != 0 {
+		return true
+	}
+	return s.cr&PIA_IRQ2 != 0 && s.cr&PIA_C2_IRQ != 0 && s.cr&PIA_C2_OUT == 0
+}
+
+func (p *PIA) side(reg uint16) *piaSide {
+	if reg&0x02 != 0 {
+		return &p.b
+	}
+	return &p.a
+}
+
+func (p *PIA) Read(reg uint16) byte {
+	s := p.side(reg)
+	if reg&0x01 != 0 || s.cr&PIA_DATA == 0 {
+		return p.Peek(reg)
+	}
+
+	// Reading the data clears the interrupt flags, and port A starts a
+	// read handshake
+	s.cr &^= PIA_IRQ1 | PIA_IRQ2
+	if !s.isPortB {
+		s.handshake()
+	}
+	value := p.Peek(reg)
+	s.output()
+	return value
+}
+
+func (p *PIA) Peek(reg uint16) byte {
+	s := p.side(reg)
+	if reg&0x01 != 0 {
+		return s.cr
+	}
+	if s.cr&PIA_DATA == 0 {
+		return s.ddr
+	}
+	return s.data&s.ddr | s.port.read()&^s.ddr
+}
+
+func (p *PIA) Write(reg uint16, value byte) {
+	s := p.side(reg)
+	switch {
+	case reg&0x01 != 0:
+		s.cr = s.cr&(PIA_IRQ1|PIA_IRQ2) | value&0x3F
+		if s.cr&PIA_C2_OUT != 0 {
+			s.cr &^= PIA_IRQ2
+			if s.cr&PIA_C2_EDGE != 0 {
+				s.c2 = s.cr&PIA_C2_IRQ != 0
+			}
+		}
+	case s.cr&PIA_DATA == 0:
+		s.ddr = value
+	default:
+		s.data = value
+		// Port B starts a write handshake
+		if s.isPortB {
+			s.handshake()
+		}
+	}
+	s.output()
+}
+
+// handshake drops C2 after a data access when C2 is a handshake output
+func (s *piaSide) handshake() {
+	if s.cr&(PIA_C2_OUT|PIA_C2_EDGE) != PIA_C2_OUT {
+		return
+	}
+	s.c2 = false
+	s.c2Pulse = s.cr&PIA_C2_IRQ != 0
+}
+
+func (s *piaSide) output() {
+	s.port.drive(s.data|^s.ddr, s.c2)
+}
+
+// Tick ends C2 pulses, which last one cycle
+func (p *PIA) Tick(cycles int) {
+	for _, s := range []*piaSide{&p.a, &p.b} {
+		if s.c2Pulse {
+			s.c2Pulse = false
+			s.c2 = true
+			s.output()
+		}
+	}
+}
+
+func (s *piaSide) setC1(level bool) {
+	if level != s.c1 && level == (s.cr&PIA_C1_EDGE != 0) {
+		s.cr |= PIA_IRQ1
+		// A handshake ends on the active C1 edge
+		if s.cr&(PIA_C2_OUT|PIA_C2_EDGE|PIA_C2_IRQ) == PIA_C2_OUT {
+			s.c2 = true
+			s.output()
+		}
+	}
+	s.c1 = level
+}
+
+func (s *piaSide) setC2(level bool) {
+	if s.cr&PIA_C2_OUT != 0 {
+		return
+	}
+	if level != s.c2 && level == (s.cr&PIA_C2_EDGE != 0) {
+		s.cr |= PIA_IRQ2
+	}
+	s.c2 = level
+}
+
+// SetCA1 sets the level outside hardware drives on CA1
+func (p *PIA) SetCA1(level bool) {
+	p.a.setC1(level)
+}
+
+// SetCA2 sets the level outside hardware drives on CA2 when it is an input
+func (p *PIA) SetCA2(level bool) {
+	p.a.setC2(level)
+}
+
+// SetCB1 sets the level outside hardware drives on CB1
+func (p *PIA) SetCB1(level bool) {
+	p.b.setC1(level)
+}
+
+// SetCB2 sets the level outside hardware drives on CB2 when it is an input
+func (p *PIA) SetCB2(level bool) {
+	p.b.setC2(level)
+}
+
+func newPIADevice(m *Machine, cfg DeviceConfig) (Device, error) {
+	return NewPIA(), nil
+}
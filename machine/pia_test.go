@@ -0,0 +1,111 @@
+package machine
+
+import "testing"
+
+func TestPIADataDirection(t *testing.T) {
+	p := NewPIA()
+	in := byte(0xA0)
+	var out byte
+	p.PortA.Input = func() byte { return in }
+	p.PortA.Output = func(pins byte) { out = pins }
+
+	// With CRA bit 2 clear the port address is the DDR
+	p.Write(PIA_PORTA, 0x0F)
+	if got := p.Read(PIA_PORTA); got != 0x0F {
+		t.Errorf("DDRA read $%02X, want $0F", got)
+	}
+
+	p.Write(PIA_CRA, PIA_DATA)
+	p.Write(PIA_PORTA, 0x35)
+	if got := p.Read(PIA_PORTA); got != 0xA5 {
+		t.Errorf("port A read $%02X, want $A5", got)
+	}
+	if out != 0xF5 {
+		t.Errorf("port A drove $%02X, want $F5", out)
+	}
+
+	// Clearing bit 2 again leaves the data alone
+	p.Write(PIA_CRA, 0)
+	if got := p.Read(PIA_PORTA); got != 0x0F {
+		t.Errorf("DDRA read $%02X after switching back, want $0F", got)
+	}
+	if p.Read(PIA_PORTB) != 0 {
+		t.Errorf("port B DDR changed with port A")
+	}
+}
+
+func TestPIAC1Edges(t *testing.T) {
+	p := NewPIA()
+
+	// Falling edge selected, interrupt disabled: the flag is set without an IRQ
+	p.Write(PIA_CRA, PIA_DATA)
+	p.SetCA1(false)
+	if p.Read(PIA_CRA)&PIA_IRQ1 == 0 || p.IRQ() {
+		t.Fatalf("CRA $%02X after a falling CA1 edge", p.Read(PIA_CRA))
+	}
+	p.Write(PIA_CRA, PIA_DATA|PIA_C1_IRQ)
+	if !p.IRQ() {
+		t.Errorf("enabling the CA1 interrupt did not raise IRQ for the pending flag")
+	}
+	p.Read(PIA_PORTA)
+	if p.Read(PIA_CRA)&PIA_IRQ1 != 0 || p.IRQ() {
+		t.Errorf("reading port A did not clear the CA1 flag")
+	}
+
+	// Rising edge selected
+	p.Write(PIA_CRB, PIA_DATA|PIA_C1_IRQ|PIA_C1_EDGE)
+	p.SetCB1(false)
+	if p.IRQ() {
+		t.Errorf("falling CB1 edge interrupted with the rising edge selected")
+	}
+	p.SetCB1(true)
+	if !p.IRQ() || p.Read(PIA_CRB)&PIA_IRQ1 == 0 {
+		t.Errorf("rising CB1 edge did not interrupt")
+	}
+	p.Read(PIA_PORTB)
+	if p.IRQ() {
+		t.Errorf("reading port B did not clear the CB1 flag")
+	}
+}
+
+func TestPIAC2Handshake(t *testing.T) {
+	p := NewPIA()
+
+	// CA2 as a read handshake output: low after reading port A, high on the CA1 edge
+	p.Write(PIA_CRA, PIA_DATA|PIA_C2_OUT)
+	p.Read(PIA_PORTA)
+	if p.a.c2 {
+		t.Fatal("CA2 did not drop after reading port A")
+	}
+	p.SetCA1(false)
+	if !p.a.c2 {
+		t.Errorf("CA2 did not rise on the CA1 edge")
+	}
+
+	// CB2 as a write strobe: low for a cycle after writing port B
+	var levels []bool
+	p.PortB.Control = func(level bool) { levels = append(levels, level) }
+	p.Write(PIA_CRB, PIA_DATA|PIA_C2_OUT|PIA_C2_IRQ)
+	p.Write(PIA_PORTB, 0x42)
+	p.Tick(1)
+	if len(levels) < 2 || levels[len(levels)-2] || !levels[len(levels)-1] {
+		t.Errorf("CB2 levels %v, want a low pulse", levels)
+	}
+}
+
+// Looking at the registers from the debugger must not clear the flags
+func TestPIAPeek(t *testing.T) {
+	p := NewPIA()
+	p.Write(PIA_CRA, PIA_DATA|PIA_C1_IRQ)
+	p.SetCA1(false)
+	for reg := uint16(0); reg < 4; reg++ {
+		p.Peek(reg)
+	}
+	if !p.IRQ() {
+		t.Error("peeking at port A cleared the CA1 flag")
+	}
+	p.Read(PIA_PORTA)
+	if p.IRQ() {
+		t.Error("reading port A did not clear the CA1 flag")
+	}
+}
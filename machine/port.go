@@ -0,0 +1,45 @@
+package machine
+
+// Port connects an 8 bit I/O port of a chip such as the VIA or PIA, and the
+// control line that goes with it, to the hardware outside the chip
+type Port struct {
+	// Input returns the levels outside hardware drives onto the pins. Pins
+	// nothing drives read high, which is also what a nil Input gives.
+	Input func() byte
+
+	// Output is called when the levels on the pins driven by the chip change,
+	// with input pins read as high
+	Output func(pins byte)
+
+	// Control is called when the level of the port's second control line
+	// (CA2 or CB2) changes, such as a handshake strobe after a write
+	Control func(level bool)
+
+	pins    byte
+	control bool
+	sent    bool // Whether pins and control have been reported since reset
+}
+
+func (p *Port) read() byte {
+	if p.Input == nil {
+		return 0xFF
+	}
+	return p.Input()
+}
+
+// drive reports the levels the chip drives when they change
+func (p *Port) drive(pins byte, control bool) {
+	if !p.sent || pins != p.pins {
+		p.pins = pins
+		if p.Output != nil {
+			p.Output(pins)
+		}
+	}
+	if !p.sent || control != p.control {
+		p.control = control
+		if p.Control != nil {
+			p.Control(control)
+		}
+	}
+	p.sent = true
+}
@@ -0,0 +1,97 @@
+package machine
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+)
+
+type presetDevice struct {
+	name       string
+	start, end uint16
+}
+
+// Where each preset in machines/ maps its devices
+var presetDevices = map[string][]presetDevice{
+	"apple1.json":          {{"pia", 0xD010, 0xD013}},
+	"beneater.json":        {{"via", 0x6000, 0x7FFF}},
+	"beneater_serial.json": {{"via", 0x6000, 0x7FFF}, {"acia", 0x5000, 0x5FFF}},
+	"functional_test.json": nil,
+}
+
+// loadPreset builds a preset without its ROM images, which are not in the
+// repository, and with serial ports on local TCP listeners instead of the
+// terminal
+func loadPreset(t *testing.T, path string) *Machine {
+	t.Helper()
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range cfg.Memory {
+		cfg.Memory[i].Optional = true
+	}
+	for i, dev := range cfg.Devices {
+		if len(dev.Options) == 0 {
+			continue
+		}
+		var opts map[string]interface{}
+		if err := json.Unmarshal(dev.Options, &opts); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := opts["serial"]; ok {
+			opts["serial"] = "tcp:127.0.0.1:0"
+		}
+		if cfg.Devices[i].Options, err = json.Marshal(opts); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m, err := New(cfg)
+	if err != nil {
+		t.Fatalf("%v: %v", path, err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func TestPresets(t *testing.T) {
+	paths, err := filepath.Glob("../machines/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) != len(presetDevices) {
+		t.Errorf("found %d presets, want %d", len(paths), len(presetDevices))
+	}
+
+	for _, path := range paths {
+		want, exists := presetDevices[filepath.Base(path)]
+		if !exists {
+			t.Errorf("%v: no expected devices for this preset", path)
+			continue
+		}
+		m := loadPreset(t, path)
+		if len(m.Devices) != len(want) {
+			t.Errorf("%v: %d devices, want %d", path, len(m.Devices), len(want))
+		}
+		for _, w := range want {
+			if m.Device(w.name) == nil {
+				t.Errorf("%v: no device %v", path, w.name)
+				continue
+			}
+			for _, addr := range []int{int(w.start) - 1, int(w.start), int(w.end), int(w.end) + 1} {
+				if addr < 0 || addr > 0xFFFF {
+					continue
+				}
+				got := "nothing"
+				if md := m.Bus.devices[addr]; md != nil {
+					got = md.Name
+				}
+				inside := addr >= int(w.start) && addr <= int(w.end)
+				if inside != (got == w.name) {
+					t.Errorf("%v: $%04X maps to %v, want %v only at $%04X-$%04X", path, addr, got, w.name, w.start, w.end)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package machine
+
+import "fmt"
+
+// RIOT register addresses, decoded from A0-A4 the way the chip does
+const (
+	RIOT_DRA  uint16 = 0x00 // Port A data
+	RIOT_DDRA uint16 = 0x01 // Port A data direction, 1 bits are outputs
+	RIOT_DRB  uint16 = 0x02 // Port B data
+	RIOT_DDRB uint16 = 0x03 // Port B data direction
+	RIOT_EDGE uint16 = 0x04 // Written: PA7 edge detect control, A0 for the rising edge, A1 to interrupt
+	RIOT_TIM  uint16 = 0x04 // Read: timer, A3 enables the timer interrupt
+	RIOT_IFR  uint16 = 0x05 // Read: interrupt flags, bit 7 timer and bit 6 PA7
+	RIOT_T1   uint16 = 0x14 // Written: start the timer counting every cycle, A3 enables the interrupt
+	RIOT_T8   uint16 = 0x15 // Every 8 cycles
+	RIOT_T64  uint16 = 0x16 // Every 64 cycles
+	RIOT_T1K  uint16 = 0x17 // Every 1024 cycles
+)
+
+// RIOT interrupt flags
+const (
+	RIOT_INT_PA7   byte = 0x40
+	RIOT_INT_TIMER byte = 0x80
+)
+
+// Timer prescalers selected by A0-A1 of a timer write
+var riotPrescalers = [4]int{1, 8, 64, 1024}
+
+// RIOT emulates the I/O and timer side of a MOS 6532 RAM-I/O-Timer: two 8 bit
+// ports, an interval timer and an interrupt on edges of PA7. The 128 bytes of
+// RAM are a separate device, RIOTRAM, since the chip decodes them apart from
+// the registers.
+type RIOT struct {
+	PortA Port
+	PortB Port
+	RAM   RIOTRAM
+
+	dra, ddra byte
+	drb, ddrb byte
+
+	timer     byte
+	prescaler int
+	divider   int  // Cycles left until the timer next counts
+	timedOut  bool // Counting every cycle since passing zero
+	timerIRQ  bool
+
+	pa7       bool
+	pa7Rising bool
+	pa7IRQ    bool
+	flags     byte
+}
+
+// RIOTRAM is the 128 bytes of RAM in a 6532
+type RIOTRAM [128]byte
+
+func (r *RIOTRAM) Read(reg uint16) byte {
+	return r[reg&0x7F]
+}
+
+func (r *RIOTRAM) Peek(reg uint16) byte {
+	return r[reg&0x7F]
+}
+
+func (r *RIOTRAM) Write(reg uint16, value byte) {
+	r[reg&0x7F] = value
+}
+
+func NewRIOT() *RIOT {
+	r := &RIOT{}
+	r.Reset()
+	return r
+}
+
+// Reset turns the ports into inputs and disables the interrupts. The timer
+// keeps running.
+func (r *RIOT) Reset() {
+	r.dra, r.ddra = 0, 0
+	r.drb, r.ddrb = 0, 0
+	r.timerIRQ = false
+	r.pa7IRQ = false
+	r.pa7Rising = false
+	r.flags = 0
+	if r.prescaler == 0 {
+		r.prescaler, r.divider = 1024, 1024
+	}
+	r.pa7 = r.PortA.read()&0x80 != 0
+	r.PortA.sent, r.PortB.sent = false, false
+	r.outputs()
+}
+
+// IRQ reports whether the RIOT is pulling its IRQ output low
+func (r *RIOT) IRQ() bool {
+	return r.flags&RIOT_INT_TIMER != 0 && r.timerIRQ || r.flags&RIOT_INT_PA7 != 0 && r.pa7IRQ
+}
+
+func (r *RIOT) Read(reg uint16) byte {
+	value := r.Peek(reg)
+	switch {
+	case reg&0x04 == 0:
+	case reg&0x01 != 0:
+		r.flags &^= RIOT_INT_PA7
+	default:
+		// Reading the timer clears its flag and, once it has passed zero, puts
+		// it back on its prescaler
+		r.timerIRQ = reg&0x08 != 0
+		r.flags &^= RIOT_INT_TIMER
+		if r.timedOut {
+			r.timedOut = false
+			r.divider = r.prescaler
+		}
+	}
+	return value
+}
+
+func (r *RIOT) Peek(reg uint16) byte {
+	if reg&0x04 == 0 {
+		switch reg & 0x03 {
+		case RIOT_DRA:
+			return r.dra&r.ddra | r.PortA.read()&^r.ddra
+		case RIOT_DDRA:
+			return r.ddra
+		case RIOT_DRB:
+			return r.drb&r.ddrb | r.PortB.read()&^r.ddrb
+		}
+		return r.ddrb
+	}
+	if reg&0x01 != 0 {
+		return r.flags
+	}
+	return r.timer
+}
+
+func (r *RIOT) Write(reg uint16, value byte) {
+	switch {
+	case reg&0x04 == 0:
+		switch reg & 0x03 {
+		case RIOT_DRA:
+			r.dra = value
+		case RIOT_DDRA:
+			r.ddra = value
+		case RIOT_DRB:
+			r.drb = value
+		default:
+			r.ddrb = value
+		}
+		r.outputs()
+	case reg&0x10 != 0:
+		r.timer = value
+		r.prescaler = riotPrescalers[reg&0x03]
+		r.divider = r.prescaler
+		r.timedOut = false
+		r.timerIRQ = reg&0x08 != 0
+		r.flags &^= RIOT_INT_TIMER
+	default:
+		r.pa7Rising = reg&0x01 != 0
+		r.pa7IRQ = reg&0x02 != 0
+	}
+}
+
+// Tick counts the timer down and watches PA7 for the selected edge
+func (r *RIOT) Tick(cycles int) {
+	for cycles > 0 {
+		if r.timedOut {
+			// Past zero the timer counts every cycle
+			r.timer = byte(int(r.timer) - cycles)
+			break
+		}
+
+		if cycles < r.divider {
+			r.divider -= cycles
+			break
+		}
+		cycles -= r.divider
+		r.divider = r.prescaler
+		r.timer -= 1
+		if r.timer == 0xFF {
+			r.timedOut = true
+			r.flags |= RIOT_INT_TIMER
+		}
+	}
+
+	pa7 := (r.dra&r.ddra|r.PortA.read()&^r.ddra)&0x80 != 0
+	if pa7 != r.pa7 && pa7 == r.pa7Rising {
+		r.flags |= RIOT_INT_PA7
+	}
+	r.pa7 = pa7
+}
+
+func (r *RIOT) outputs() {
+	r.PortA.drive(r.dra|^r.ddra, true)
+	r.PortB.drive(r.drb|^r.ddrb, true)
+}
+
+func newRIOTDevice(m *Machine, cfg DeviceConfig) (Device, error) {
+	var opts struct {
+		RAM *Number `json:"ram"` // Where the 128 bytes of RAM go, left unmapped when missing
+	}
+	if err := decodeOptions(cfg, &opts); err != nil {
+		return nil, err
+	}
+
+	r := NewRIOT()
+	if opts.RAM != nil {
+		if err := checkRange(*opts.RAM, 128); err != nil {
+			return nil, fmt.Errorf("ram: %w", err)
+		}
+		err := m.Map(&MappedDevice{
+			Name:   cfg.Name + ".ram",
+			Type:   cfg.Type,
+			Start:  uint16(*opts.RAM),
+			End:    uint16(*opts.RAM + 127),
+			Device: &r.RAM,
+		}, 128)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,112 @@
+package machine
+
+import "testing"
+
+func TestRIOTPrescaler(t *testing.T) {
+	for i, prescaler := range riotPrescalers {
+		r := NewRIOT()
+		r.Write(RIOT_T1|0x08|uint16(i), 3) // Interrupt enabled
+
+		// The timer counts down once per prescaler period and times out as it passes zero
+		r.Tick(3 * prescaler)
+		if r.Read(RIOT_IFR) != 0 || r.Peek(RIOT_TIM) != 0 {
+			t.Fatalf("/%d: timer $%02X and flags $%02X after 3 periods", prescaler, r.Peek(RIOT_TIM), r.Peek(RIOT_IFR))
+		}
+		r.Tick(prescaler - 1)
+		if r.IRQ() {
+			t.Fatalf("/%d: timed out early", prescaler)
+		}
+		r.Tick(1)
+		if r.Peek(RIOT_TIM) != 0xFF || !r.IRQ() || r.Peek(RIOT_IFR) != RIOT_INT_TIMER {
+			t.Errorf("/%d: timer $%02X, IRQ %v after 4 periods", prescaler, r.Peek(RIOT_TIM), r.IRQ())
+		}
+	}
+}
+
+func TestRIOTAfterZero(t *testing.T) {
+	r := NewRIOT()
+	r.Write(RIOT_T64, 1)
+	r.Tick(2 * 64)
+	if r.Peek(RIOT_TIM) != 0xFF || r.Peek(RIOT_IFR)&RIOT_INT_TIMER == 0 {
+		t.Fatalf("timer $%02X did not time out", r.Peek(RIOT_TIM))
+	}
+
+	// Past zero the timer counts every cycle, however many are given at once
+	r.Tick(10)
+	if got := r.Peek(RIOT_TIM); got != 0xF5 {
+		t.Errorf("timer $%02X 10 cycles past zero, want $F5", got)
+	}
+	r.Tick(300)
+	if got := r.Peek(RIOT_TIM); got != 0xC9 {
+		t.Errorf("timer $%02X after 300 more cycles, want $C9", got)
+	}
+	if r.IRQ() {
+		t.Errorf("IRQ with the timer interrupt disabled")
+	}
+
+	// Reading the timer clears the flag and puts it back on its prescaler
+	if r.Read(RIOT_TIM) != 0xC9 || r.Peek(RIOT_IFR)&RIOT_INT_TIMER != 0 {
+		t.Errorf("reading the timer did not clear its flag")
+	}
+	r.Tick(63)
+	if got := r.Peek(RIOT_TIM); got != 0xC9 {
+		t.Errorf("timer $%02X counted every cycle after being read", got)
+	}
+	r.Tick(1)
+	if got := r.Peek(RIOT_TIM); got != 0xC8 {
+		t.Errorf("timer $%02X after a prescaler period, want $C8", got)
+	}
+}
+
+func TestRIOTPorts(t *testing.T) {
+	r := NewRIOT()
+	in := byte(0x80)
+	var out byte
+	r.PortA.Input = func() byte { return in }
+	r.PortA.Output = func(pins byte) { out = pins }
+
+	// Output bits read back from the data register, input bits from the pins
+	r.Write(RIOT_DDRA, 0x0F)
+	r.Write(RIOT_DRA, 0x35)
+	if got := r.Read(RIOT_DRA); got != 0x85 {
+		t.Errorf("port A read $%02X, want $85", got)
+	}
+	if out != 0xF5 {
+		t.Errorf("port A drove $%02X, want $F5", out)
+	}
+
+	// Negative PA7 edges interrupt when enabled
+	r.Write(RIOT_EDGE|0x02, 0)
+	in = 0x00
+	r.Tick(1)
+	if !r.IRQ() || r.Peek(RIOT_IFR) != RIOT_INT_PA7 {
+		t.Fatalf("PA7 edge gave flags $%02X", r.Peek(RIOT_IFR))
+	}
+	if r.Read(RIOT_IFR) != RIOT_INT_PA7 || r.IRQ() {
+		t.Errorf("reading the flags did not clear PA7")
+	}
+	in = 0x80
+	r.Tick(1)
+	if r.IRQ() {
+		t.Errorf("rising PA7 edge interrupted with the falling edge selected")
+	}
+}
+
+// Looking at the registers from the debugger must not clear the flags
+func TestRIOTPeek(t *testing.T) {
+	r := NewRIOT()
+	r.Write(RIOT_T1|0x08, 0)
+	r.Tick(1)
+	if !r.IRQ() {
+		t.Fatal("timer did not time out")
+	}
+	r.Peek(RIOT_TIM | 0x08)
+	r.Peek(RIOT_IFR)
+	if !r.IRQ() {
+		t.Error("peeking cleared the timer interrupt")
+	}
+	r.Read(RIOT_TIM | 0x08)
+	if r.IRQ() {
+		t.Error("reading the timer did not clear the interrupt")
+	}
+}
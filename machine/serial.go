@@ -0,0 +1,180 @@
+package machine
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	term "izzudinhafiz.com/go-6502/term"
+)
+
+// OpenSerial opens the host side of a serial device:
+//
+//	stdio          the terminal the emulator runs in, in raw mode
+//	pty            a new pseudo terminal for screen, minicom and the like
+//	tcp:HOST:PORT  a TCP listener that serves one client at a time
+//
+// It also returns where other programs can connect, empty for stdio.
+func OpenSerial(spec string) (io.ReadWriteCloser, string, error) {
+	switch {
+	case spec == "stdio":
+		return openStdio(), "", nil
+	case spec == "pty":
+		f, path, err := term.OpenPTY()
+		if err != nil {
+			return nil, "", err
+		}
+		return &ptyPort{f}, path, nil
+	case strings.HasPrefix(spec, "tcp:"):
+		l, err := net.Listen("tcp", spec[len("tcp:"):])
+		if err != nil {
+			return nil, "", err
+		}
+		return newTCPPort(l), l.Addr().String(), nil
+	}
+	return nil, "", fmt.Errorf("unknown serial port %q, expected stdio, pty or tcp:HOST:PORT", spec)
+}
+
+// stdioPort is the emulator's own terminal. Keys go to the program as they
+// are typed, Ctrl-C still interrupts the emulator.
+type stdioPort struct {
+	state *term.State
+}
+
+func openStdio() *stdioPort {
+	p := &stdioPort{}
+	if term.IsTerminal(os.Stdin.Fd()) {
+		p.state, _ = term.MakeCbreak(os.Stdin.Fd())
+	}
+	return p
+}
+
+func (p *stdioPort) Read(buf []byte) (int, error) {
+	return os.Stdin.Read(buf)
+}
+
+func (p *stdioPort) Write(buf []byte) (int, error) {
+	return os.Stdout.Write(buf)
+}
+
+// Close gives the terminal back its previous mode
+func (p *stdioPort) Close() error {
+	if p.state == nil {
+		return nil
+	}
+	err := term.Restore(os.Stdin.Fd(), p.state)
+	p.state = nil
+	return err
+}
+
+// ptyPort is the controlling side of a pseudo terminal. Reads fail while
+// nothing has the terminal open, so they wait for something to open it.
+type ptyPort struct {
+	f *os.File
+}
+
+func (p *ptyPort) Read(buf []byte) (int, error) {
+	for {
+		n, err := p.f.Read(buf)
+		if !errors.Is(err, syscall.EIO) {
+			return n, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// Write drops the data when nothing has the terminal open
+func (p *ptyPort) Write(buf []byte) (int, error) {
+	n, err := p.f.Write(buf)
+	if errors.Is(err, syscall.EIO) {
+		return len(buf), nil
+	}
+	return n, err
+}
+
+func (p *ptyPort) Close() error {
+	return p.f.Close()
+}
+
+// tcpPort accepts one client at a time. Data sent while no client is
+// connected is dropped.
+type tcpPort struct {
+	l     net.Listener
+	mu    sync.Mutex
+	conn  net.Conn
+	conns chan net.Conn
+}
+
+func newTCPPort(l net.Listener) *tcpPort {
+	p := &tcpPort{l: l, conns: make(chan net.Conn)}
+	go p.accept()
+	return p
+}
+
+func (p *tcpPort) accept() {
+	for {
+		conn, err := p.l.Accept()
+		if err != nil {
+			close(p.conns)
+			return
+		}
+		p.conns <- conn
+	}
+}
+
+// Read returns data from the current client, waiting for the next client
+// once it disconnects
+func (p *tcpPort) Read(buf []byte) (int, error) {
+	for {
+		p.mu.Lock()
+		conn := p.conn
+		p.mu.Unlock()
+
+		if conn == nil {
+			var ok bool
+			if conn, ok = <-p.conns; !ok {
+				return 0, io.EOF
+			}
+			p.mu.Lock()
+			p.conn = conn
+			p.mu.Unlock()
+		}
+
+		n, err := conn.Read(buf)
+		if err == nil {
+			return n, nil
+		}
+		conn.Close()
+		p.mu.Lock()
+		p.conn = nil
+		p.mu.Unlock()
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+func (p *tcpPort) Write(buf []byte) (int, error) {
+	p.mu.Lock()
+	conn := p.conn
+	p.mu.Unlock()
+	if conn != nil {
+		conn.Write(buf)
+	}
+	return len(buf), nil
+}
+
+func (p *tcpPort) Close() error {
+	p.mu.Lock()
+	if p.conn != nil {
+		p.conn.Close()
+	}
+	p.mu.Unlock()
+	return p.l.Close()
+}
@@ -0,0 +1,577 @@
+package machine
+
+import "os"
+
+// VIA registers
+const (
+	VIA_ORB    uint16 = iota // Port B output register, input register when read
+	VIA_ORA                  // Port A, with CA1/CA2 handshaking
+	VIA_DDRB                 // Port B data direction, 1 bits are outputs
+	VIA_DDRA                 // Port A data direction
+	VIA_T1CL                 // Timer 1 counter low, writes go to the latch
+	VIA_T1CH                 // Timer 1 counter high, writing starts the timer
+	VIA_T1LL                 // Timer 1 latch low
+	VIA_T1LH                 // Timer 1 latch high
+	VIA_T2CL                 // Timer 2 counter low, writes go to the latch
+	VIA_T2CH                 // Timer 2 counter high, writing starts the timer
+	VIA_SR                   // Shift register
+	VIA_ACR                  // Auxiliary control
+	VIA_PCR                  // Peripheral control
+	VIA_IFR                  // Interrupt flags
+	VIA_IER                  // Interrupt enable
+	VIA_ORA_NH               // Port A without handshaking
+)
+
+// VIA interrupt flag and enable bits
+const (
+	VIA_INT_CA2 byte = 1 << iota
+	VIA_INT_CA1
+	VIA_INT_SR
+	VIA_INT_CB2
+	VIA_INT_CB1
+	VIA_INT_T2
+	VIA_INT_T1
+	VIA_INT_ANY // Set in IFR when any enabled flag is set, in IER writes selects set or clear
+)
+
+// ACR bits
+const (
+	via_acr_pa_latch  = 0x01
+	via_acr_pb_latch  = 0x02
+	via_acr_sr_mode   = 0x1C
+	via_acr_t2_pulses = 0x20 // Timer 2 counts PB6 pulses instead of cycles
+	via_acr_t1_free   = 0x40 // Timer 1 reloads from the latch and keeps interrupting
+	via_acr_t1_pb7    = 0x80 // Timer 1 drives PB7
+)
+
+// Shift register modes, ACR bits 2-4
+const (
+	via_sr_off = iota
+	via_sr_in_t2
+	via_sr_in_clock
+	via_sr_in_cb1
+	via_sr_out_free
+	via_sr_out_t2
+	via_sr_out_clock
+	via_sr_out_cb1
+)
+
+// CA2/CB2 control modes, PCR bits 1-3 and 5-7
+const (
+	via_c2_in_neg = iota
+	via_c2_in_neg_independent
+	via_c2_in_pos
+	via_c2_in_pos_independent
+	via_c2_handshake
+	via_c2_pulse
+	via_c2_low
+	via_c2_high
+)
+
+// VIA emulates a MOS 6522 Versatile Interface Adapter: two 8 bit ports with
+// handshaking, two 16 bit timers and a shift register. It is clocked by Tick,
+// one call per CPU cycle count, so the timers stay in step with the CPU.
+type VIA struct {
+	PortA Port
+	PortB Port
+
+	ora, orb   byte
+	ddra, ddrb byte
+	ira, irb   byte // Input latches, used when latching is enabled in the ACR
+	acr, pcr   byte
+	ifr, ier   byte
+
+	t1, t1Latch uint16
+	t1Armed     bool // Timer 1 interrupts on the next time out
+	t1Reload    bool // The counter reloads from the latch on the next cycle
+	pb7         bool // Timer 1 output on PB7
+
+	t2, t2Latch uint16
+	t2Armed     bool
+	pb6         bool // Last PB6 level, for counting pulses
+
+	sr      byte
+	srCount int  // Bits left to shift, 0 when stopped
+	srClock bool // Level of the shift clock output on CB1
+
+	ca1, ca2, cb1, cb2 bool // Pin levels
+	c2Pulse            int  // CA2 and CB2 pulses to end on the next cycle, bit 0 for CA2 and bit 1 for CB2
+}
+
+func NewVIA() *VIA {
+	v := &VIA{}
+	v.Reset()
+	return v
+}
+
+// Reset clears the registers the reset line clears. The timers and shift
+// register keep their contents but stop interrupting.
+func (v *VIA) Reset() {
+	v.ora, v.orb = 0, 0
+	v.ddra, v.ddrb = 0, 0
+	v.acr, v.pcr = 0, 0
+	v.ifr, v.ier = 0, 0
+	v.t1Armed, v.t2Armed = false, false
+	v.t1Reload = false
+	v.pb7 = true
+	v.srCount = 0
+	v.ca1, v.ca2, v.cb1, v.cb2 = true, true, true, true
+	v.c2Pulse = 0
+	v.PortA.sent, v.PortB.sent = false, false
+	v.outputs()
+}
+
+// IRQ reports whether the VIA is pulling its IRQ output low
+func (v *VIA) IRQ() bool {
+	return v.ifr&v.ier&0x7F != 0
+}
+
+func (v *VIA) Read(reg uint16) byte {
+	switch reg & 0x0F {
+	case VIA_ORB:
+		v.clearPortFlags(VIA_INT_CB1, VIA_INT_CB2, v.pcr>>5)
+	case VIA_ORA:
+		v.clearPortFlags(VIA_INT_CA1, VIA_INT_CA2, v.pcr>>1&7)
+		v.handshakeA()
+	case VIA_T1CL:
+		v.ifr &^= VIA_INT_T1
+	case VIA_T2CL:
+		v.ifr &^= VIA_INT_T2
+	case VIA_SR:
+		v.startShift()
+	}
+	return v.Peek(reg)
+}
+
+func (v *VIA) Peek(reg uint16) byte {
+	switch reg & 0x0F {
+	case VIA_ORB:
+		return v.readPortB()
+	case VIA_ORA, VIA_ORA_NH:
+		return v.readPortA()
+	case VIA_DDRB:
+		return v.ddrb
+	case VIA_DDRA:
+		return v.ddra
+	case VIA_T1CL:
+		return byte(v.t1)
+	case VIA_T1CH:
+		return byte(v.t1 >> 8)
+	case VIA_T1LL:
+		return byte(v.t1Latch)
+	case VIA_T1LH:
+		return byte(v.t1Latch >> 8)
+	case VIA_T2CL:
+		return byte(v.t2)
+	case VIA_T2CH:
+		return byte(v.t2 >> 8)
+	case VIA_SR:
+		return v.sr
+	case VIA_ACR:
+		return v.acr
+	case VIA_PCR:
+		return v.pcr
+	case VIA_IFR:
+		if v.IRQ() {
+			return v.ifr | VIA_INT_ANY
+		}
+		return v.ifr
+	}
+	return v.ier | VIA_INT_ANY
+}
+
+func (v *VIA) Write(reg uint16, value byte) {
+	switch reg & 0x0F {
+	case VIA_ORB:
+		v.orb = value
+		v.clearPortFlags(VIA_INT_CB1, VIA_INT_CB2, v.pcr>>5)
+		v.handshakeB()
+	case VIA_ORA:
+		v.ora = value
+		v.clearPortFlags(VIA_INT_CA1, VIA_INT_CA2, v.pcr>>1&7)
+		v.handshakeA()
+	case VIA_ORA_NH:
+		v.ora = value
+	case VIA_DDRB:
+		v.ddrb = value
+	case VIA_DDRA:
+		v.ddra = value
+	case VIA_T1CL, VIA_T1LL:
+		v.t1Latch = v.t1Latch&0xFF00 | uint16(value)
+	case VIA_T1CH:
+		v.t1Latch = v.t1Latch&0x00FF | uint16(value)<<8
+		v.t1 = v.t1Latch
+		v.t1Armed = true
+		v.t1Reload = false
+		v.ifr &^= VIA_INT_T1
+		if v.acr&via_acr_t1_pb7 != 0 {
+			v.pb7 = false
+		}
+	case VIA_T1LH:
+		v.t1Latch = v.t1Latch&0x00FF | uint16(value)<<8
+		v.ifr &^= VIA_INT_T1
+	case VIA_T2CL:
+		v.t2Latch = v.t2Latch&0xFF00 | uint16(value)
+	case VIA_T2CH:
+		v.t2Latch = v.t2Latch&0x00FF | uint16(value)<<8
+		v.t2 = v.t2Latch
+		v.t2Armed = true
+		v.ifr &^= VIA_INT_T2
+	case VIA_SR:
+		v.sr = value
+		v.startShift()
+	case VIA_ACR:
+		if value&via_acr_t1_pb7 != 0 && v.acr&via_acr_t1_pb7 == 0 {
+			v.pb7 = true
+		}
+		v.acr = value
+		if v.srMode() == via_sr_off {
+			v.srCount = 0
+		}
+	case VIA_PCR:
+		v.pcr = value
+	case VIA_IFR:
+		v.ifr &^= value & 0x7F
+	case VIA_IER:
+		if value&VIA_INT_ANY != 0 {
+			v.ier |= value & 0x7F
+		} else {
+			v.ier &^= value & 0x7F
+		}
+	}
+	v.outputs()
+}
+
+// Tick advances the timers and shift register by a number of CPU cycles
+func (v *VIA) Tick(cycles int) {
+	for i := 0; i < cycles; i++ {
+		v.cycle()
+	}
+	v.outputs()
+}
+
+func (v *VIA) cycle() {
+	if v.c2Pulse != 0 {
+		if v.c2Pulse&1 != 0 {
+			v.ca2 = true
+		}
+		if v.c2Pulse&2 != 0 {
+			v.cb2 = true
+		}
+		v.c2Pulse = 0
+	}
+
+	// Timer 1
+	if v.t1Reload {
+		v.t1 = v.t1Latch
+		v.t1Reload = false
+	} else {
+		v.t1 -= 1
+		if v.t1 == 0xFFFF {
+			v.timer1Out()
+		}
+	}
+
+	// Timer 2, which doubles as the shift clock
+	mode := v.srMode()
+	switch {
+	case mode == via_sr_in_t2 || mode == via_sr_out_t2 || mode == via_sr_out_free:
+		low := byte(v.t2) - 1
+		v.t2 = v.t2&0xFF00 | uint16(low)
+		if low == 0xFF {
+			v.t2 = v.t2&0xFF00 | v.t2Latch&0x00FF
+			v.shiftClock(!v.srClock)
+		}
+	case v.acr&via_acr_t2_pulses != 0:
+		pb6 := v.PortB.read()&0x40 != 0
+		if v.pb6 && !pb6 {
+			v.timer2Count()
+		}
+		v.pb6 = pb6
+	default:
+		v.timer2Count()
+	}
+
+	if mode == via_sr_in_clock || mode == via_sr_out_clock {
+		v.shiftClock(!v.srClock)
+	}
+}
+
+func (v *VIA) timer1Out() {
+	if !v.t1Armed {
+		return
+	}
+	v.ifr |= VIA_INT_T1
+	if v.acr&via_acr_t1_free != 0 {
+		v.t1Reload = true
+		v.pb7 = !v.pb7
+	} else {
+		v.t1Armed = false
+		v.pb7 = true
+	}
+}
+
+func (v *VIA) timer2Count() {
+	v.t2 -= 1
+	if v.t2 == 0xFFFF && v.t2Armed {
+		v.ifr |= VIA_INT_T2
+		v.t2Armed = false
+	}
+}
+
+func (v *VIA) srMode() int {
+	return int(v.acr&via_acr_sr_mode) >> 2
+}
+
+// startShift restarts the shift register after the CPU reads or writes it
+func (v *VIA) startShift() {
+	v.ifr &^= VIA_INT_SR
+	if v.srMode() != via_sr_off {
+		v.srCount = 8
+	}
+}
+
+// shiftClock sets the level of the shift clock on CB1. Bits move on the
+// rising edge, and outgoing bits appear on CB2.
+func (v *VIA) shiftClock(level bool) {
+	rising := level && !v.srClock
+	v.srClock = level
+	if v.srMode() != via_sr_in_cb1 && v.srMode() != via_sr_out_cb1 {
+		v.cb1 = level
+	}
+	if !rising || v.srCount == 0 {
+		return
+	}
+
+	switch v.srMode() {
+	case via_sr_in_t2, via_sr_in_clock, via_sr_in_cb1:
+		in := byte(0)
+		if v.cb2 {
+			in = 1
+		}
+		v.sr = v.sr<<1 | in
+	default:
+		v.cb2 = v.sr&0x80 != 0
+		v.sr = v.sr<<1 | v.sr>>7
+	}
+
+	// Free running output never stops and never interrupts
+	if v.srMode() == via_sr_out_free {
+		return
+	}
+	v.srCount -= 1
+	if v.srCount == 0 {
+		v.ifr |= VIA_INT_SR
+	}
+}
+
+// clearPortFlags clears the flags an access to a port's register clears,
+// which leaves the C2 flag alone when C2 is an independent interrupt input
+func (v *VIA) clearPortFlags(c1 byte, c2 byte, c2Mode byte) {
+	v.ifr &^= c1
+	if c2Mode != via_c2_in_neg_independent && c2Mode != via_c2_in_pos_independent {
+		v.ifr &^= c2
+	}
+}
+
+// handshakeA drops CA2 after a read or write of ORA in the handshake modes
+func (v *VIA) handshakeA() {
+	switch v.pcr >> 1 & 7 {
+	case via_c2_handshake:
+		v.ca2 = false
+	case via_c2_pulse:
+		v.ca2 = false
+		v.c2Pulse |= 1
+	}
+}
+
+// handshakeB drops CB2 after a write of ORB in the handshake modes
+func (v *VIA) handshakeB() {
+	if v.srMode() != via_sr_off {
+		return
+	}
+	switch v.pcr >> 5 & 7 {
+	case via_c2_handshake:
+		v.cb2 = false
+	case via_c2_pulse:
+		v.cb2 = false
+		v.c2Pulse |= 2
+	}
+}
+
+func (v *VIA) readPortA() byte {
+	in := v.PortA.read()
+	if v.acr&via_acr_pa_latch != 0 {
+		in = v.ira
+	}
+	return v.ora&v.ddra | in&^v.ddra
+}
+
+func (v *VIA) readPortB() byte {
+	in := v.PortB.read()
+	if v.acr&via_acr_pb_latch != 0 {
+		in = v.irb
+	}
+	value := v.orb&v.ddrb | in&^v.ddrb
+	if v.acr&via_acr_t1_pb7 != 0 {
+		value &^= 0x80
+		if v.pb7 {
+			value |= 0x80
+		}
+	}
+	return value
+}
+
+// PinsA returns the levels the VIA drives on port A, with input pins high
+func (v *VIA) PinsA() byte {
+	return v.ora | ^v.ddra
+}
+
+// PinsB returns the levels the VIA drives on port B, with input pins high
+func (v *VIA) PinsB() byte {
+	pins := v.orb | ^v.ddrb
+	if v.acr&via_acr_t1_pb7 != 0 {
+		pins &^= 0x80
+		if v.pb7 {
+			pins |= 0x80
+		}
+	}
+	return pins
+}
+
+// outputs tells the ports about levels that changed
+func (v *VIA) outputs() {
+	v.c2Outputs()
+	v.PortA.drive(v.PinsA(), v.ca2)
+	v.PortB.drive(v.PinsB(), v.cb2)
+}
+
+// c2Outputs applies the manual output modes of CA2 and CB2
+func (v *VIA) c2Outputs() {
+	switch v.pcr >> 1 & 7 {
+	case via_c2_low:
+		v.ca2 = false
+	case via_c2_high:
+		v.ca2 = true
+	}
+	if v.srMode() != via_sr_off {
+		return
+	}
+	switch v.pcr >> 5 & 7 {
+	case via_c2_low:
+		v.cb2 = false
+	case via_c2_high:
+		v.cb2 = true
+	}
+}
+
+// activeEdge reports whether a change from old to level is the edge selected
+// by a PCR edge bit, where 1 selects the rising edge
+func activeEdge(old bool, level bool, positive bool) bool {
+	if old == level {
+		return false
+	}
+	return level == positive
+}
+
+// SetCA1 sets the level outside hardware drives on CA1
+func (v *VIA) SetCA1(level bool) {
+	if activeEdge(v.ca1, level, v.pcr&0x01 != 0) {
+		v.ifr |= VIA_INT_CA1
+		v.ira = v.PortA.read()
+		if v.pcr>>1&7 == via_c2_handshake {
+			v.ca2 = true
+		}
+	}
+	v.ca1 = level
+}
+
+// SetCA2 sets the level outside hardware drives on CA2 when it is an input
+func (v *VIA) SetCA2(level bool) {
+	mode := v.pcr >> 1 & 7
+	if mode >= via_c2_handshake {
+		return
+	}
+	if activeEdge(v.ca2, level, mode == via_c2_in_pos || mode == via_c2_in_pos_independent) {
+		v.ifr |= VIA_INT_CA2
+	}
+	v.ca2 = level
+}
+
+// SetCB1 sets the level outside hardware drives on CB1, which is also the
+// shift clock input in the external clock shift modes
+func (v *VIA) SetCB1(level bool) {
+	mode := v.srMode()
+	if mode == via_sr_in_cb1 || mode == via_sr_out_cb1 {
+		v.shiftClock(level)
+	} else if mode != via_sr_off {
+		return // CB1 is the shift clock output
+	}
+
+	if activeEdge(v.cb1, level, v.pcr&0x10 != 0) {
+		v.ifr |= VIA_INT_CB1
+		v.irb = v.PortB.read()
+		if v.pcr>>5&7 == via_c2_handshake {
+			v.cb2 = true
+		}
+	}
+	v.cb1 = level
+}
+
+// SetCB2 sets the level outside hardware drives on CB2 when it is an input,
+// which is also the serial input in the shift in modes
+func (v *VIA) SetCB2(level bool) {
+	switch v.srMode() {
+	case via_sr_in_t2, via_sr_in_clock, via_sr_in_cb1:
+		v.cb2 = level
+		return
+	case via_sr_off:
+	default:
+		return // CB2 is the serial output
+	}
+
+	mode := v.pcr >> 5 & 7
+	if mode >= via_c2_handshake {
+		return
+	}
+	if activeEdge(v.cb2, level, mode == via_c2_in_pos || mode == via_c2_in_pos_independent) {
+		v.ifr |= VIA_INT_CB2
+	}
+	v.cb2 = level
+}
+
+// CA2 returns the level on CA2
+func (v *VIA) CA2() bool {
+	return v.ca2
+}
+
+// CB1 returns the level on CB1, which the VIA drives as the shift clock
+func (v *VIA) CB1() bool {
+	return v.cb1
+}
+
+// CB2 returns the level on CB2, the serial output in the shift out modes
+func (v *VIA) CB2() bool {
+	return v.cb2
+}
+
+func newVIADevice(m *Machine, cfg DeviceConfig) (Device, error) {
+	var opts struct {
+		LCD string `json:"lcd"` // Wiring of a HD44780 LCD on the ports, "8bit", "4bit" or empty
+	}
+	if err := decodeOptions(cfg, &opts); err != nil {
+		return nil, err
+	}
+
+	v := NewVIA()
+	if opts.LCD != "" {
+		lcd := NewHD44780()
+		lcd.Output = os.Stdout
+		lcd.Clock = m.Clock
+		if err := lcd.AttachVIA(v, opts.LCD); err != nil {
+			return nil, err
+		}
+		m.AddTicker(lcd)
+	}
+	return v, nil
+}
@@ -0,0 +1,202 @@
+package machine
+
+import "testing"
+
+// startT1 loads timer 1 with n and starts it
+func startT1(v *VIA, n uint16) {
+	v.Write(VIA_T1CL, byte(n))
+	v.Write(VIA_T1CH, byte(n>>8))
+}
+
+func TestVIATimer1OneShot(t *testing.T) {
+	v := NewVIA()
+	v.Write(VIA_IER, VIA_INT_ANY|VIA_INT_T1)
+	v.Write(VIA_ACR, via_acr_t1_pb7)
+	startT1(v, 10)
+	if v.PinsB()&0x80 != 0 {
+		t.Errorf("PB7 did not go low when T1 started")
+	}
+
+	// The counter passes through zero and interrupts as it rolls over, N+1 cycles after the start
+	v.Tick(10)
+	if v.IRQ() {
+		t.Fatal("T1 timed out early")
+	}
+	v.Tick(1)
+	if !v.IRQ() || v.Read(VIA_IFR) != VIA_INT_ANY|VIA_INT_T1 {
+		t.Fatalf("T1 did not time out after 11 cycles, IFR $%02X", v.Read(VIA_IFR))
+	}
+	if v.PinsB()&0x80 == 0 {
+		t.Errorf("PB7 did not go high when T1 timed out")
+	}
+
+	v.Read(VIA_T1CL)
+	if v.IRQ() {
+		t.Errorf("reading T1CL did not clear the interrupt")
+	}
+	v.Tick(0x20000)
+	if v.IRQ() {
+		t.Errorf("one shot T1 interrupted twice")
+	}
+}
+
+func TestVIATimer1FreeRun(t *testing.T) {
+	v := NewVIA()
+	v.Write(VIA_IER, VIA_INT_ANY|VIA_INT_T1)
+	v.Write(VIA_ACR, via_acr_t1_free|via_acr_t1_pb7)
+	startT1(v, 10)
+
+	// The first time out comes N+1 cycles after the start, then every N+2
+	// cycles as the counter reloads from the latch
+	period := 11
+	pb7 := false
+	for i := 0; i < 4; i++ {
+		v.Tick(period - 1)
+		if v.IRQ() {
+			t.Fatalf("time out %d came early", i)
+		}
+		v.Tick(1)
+		if !v.IRQ() {
+			t.Fatalf("time out %d did not come after %d cycles", i, period)
+		}
+		pb7 = !pb7
+		if got := v.PinsB()&0x80 != 0; got != pb7 {
+			t.Errorf("time out %d: PB7 %v, want %v", i, got, pb7)
+		}
+		v.Read(VIA_T1CL)
+		period = 12
+	}
+}
+
+func TestVIATimer2Pulses(t *testing.T) {
+	v := NewVIA()
+	pb6 := byte(0x40)
+	v.PortB.Input = func() byte { return pb6 | 0xBF }
+	v.Write(VIA_IER, VIA_INT_ANY|VIA_INT_T2)
+	v.Write(VIA_ACR, via_acr_t2_pulses)
+	v.Write(VIA_T2CL, 3)
+	v.Write(VIA_T2CH, 0)
+
+	// Cycles alone do not count
+	v.Tick(100)
+	if v.Read(VIA_T2CL) != 3 {
+		t.Fatalf("T2 counted cycles, it is at %d", v.Read(VIA_T2CL))
+	}
+
+	// Each falling edge on PB6 counts once, and the interrupt comes as the
+	// counter rolls over
+	for i := 1; i <= 4; i++ {
+		pb6 = 0
+		v.Tick(3)
+		pb6 = 0x40
+		v.Tick(3)
+		if v.IRQ() != (i == 4) {
+			t.Errorf("after %d pulses IRQ is %v", i, v.IRQ())
+		}
+	}
+	if v.Read(VIA_T2CL) != 0xFF {
+		t.Errorf("T2 low is $%02X after rolling over", v.Read(VIA_T2CL))
+	}
+	if v.IRQ() {
+		t.Errorf("reading T2CL did not clear the interrupt")
+	}
+}
+
+func TestVIAInterruptRegisters(t *testing.T) {
+	v := NewVIA()
+
+	// IER writes set bits when bit 7 is set and clear them when it is not
+	v.Write(VIA_IER, VIA_INT_ANY|VIA_INT_T1|VIA_INT_CA1)
+	if got := v.Read(VIA_IER); got != VIA_INT_ANY|VIA_INT_T1|VIA_INT_CA1 {
+		t.Errorf("IER $%02X after setting T1 and CA1", got)
+	}
+	v.Write(VIA_IER, VIA_INT_T1)
+	if got := v.Read(VIA_IER); got != VIA_INT_ANY|VIA_INT_CA1 {
+		t.Errorf("IER $%02X after clearing T1", got)
+	}
+
+	// A negative edge on CA1 sets its flag, IFR bit 7 follows the enabled flags
+	v.SetCA1(false)
+	if got := v.Read(VIA_IFR); got != VIA_INT_ANY|VIA_INT_CA1 || !v.IRQ() {
+		t.Errorf("IFR $%02X after an enabled CA1 edge", got)
+	}
+	v.Write(VIA_IER, VIA_INT_CA1)
+	if got := v.Read(VIA_IFR); got != VIA_INT_CA1 || v.IRQ() {
+		t.Errorf("IFR $%02X with CA1 disabled", got)
+	}
+
+	// Writing ones to IFR clears flags, bit 7 cannot be set
+	v.Write(VIA_IFR, VIA_INT_ANY|VIA_INT_CA1)
+	if got := v.Read(VIA_IFR); got != 0 {
+		t.Errorf("IFR $%02X after clearing CA1", got)
+	}
+}
+
+func TestVIAHandshake(t *testing.T) {
+	v := NewVIA()
+	in := byte(0x5A)
+	v.PortA.Input = func() byte { return in }
+	v.Write(VIA_ACR, via_acr_pa_latch)
+	v.Write(VIA_PCR, via_c2_handshake<<1)
+
+	// Reading port A drops CA2 to say the data was taken
+	v.Read(VIA_ORA)
+	if v.CA2() {
+		t.Fatal("CA2 did not drop after reading port A")
+	}
+
+	// Data ready on CA1 latches the input, raises CA2 and sets the flag
+	v.SetCA1(false)
+	if !v.CA2() {
+		t.Errorf("CA2 did not rise on the CA1 edge")
+	}
+	if v.Read(VIA_IFR)&VIA_INT_CA1 == 0 {
+		t.Errorf("CA1 edge did not set its flag")
+	}
+	in = 0x00
+	if got := v.Read(VIA_ORA); got != 0x5A {
+		t.Errorf("port A read $%02X, want the latched $5A", got)
+	}
+	if v.Read(VIA_IFR)&VIA_INT_CA1 != 0 {
+		t.Errorf("reading port A did not clear the CA1 flag")
+	}
+
+	// The rising edge is not the selected one
+	v.SetCA1(true)
+	if v.Read(VIA_IFR)&VIA_INT_CA1 != 0 {
+		t.Errorf("positive CA1 edge set the flag with negative edges selected")
+	}
+
+	// Pulse mode drops CA2 for a cycle
+	v.Write(VIA_PCR, via_c2_pulse<<1)
+	v.Read(VIA_ORA)
+	if v.CA2() {
+		t.Fatal("CA2 did not pulse low")
+	}
+	v.Tick(1)
+	if !v.CA2() {
+		t.Errorf("CA2 pulse lasted more than a cycle")
+	}
+}
+
+// Looking at the registers from the debugger must not clear their flags
+func TestVIAPeek(t *testing.T) {
+	v := NewVIA()
+	v.Write(VIA_IER, VIA_INT_ANY|VIA_INT_T1)
+	startT1(v, 2)
+	v.Tick(10)
+	if !v.IRQ() {
+		t.Fatal("T1 did not time out")
+	}
+
+	for reg := uint16(0); reg < 16; reg++ {
+		v.Peek(reg)
+	}
+	if !v.IRQ() || v.Peek(VIA_IFR)&VIA_INT_T1 == 0 {
+		t.Error("peeking at the registers cleared the interrupt")
+	}
+	v.Read(VIA_T1CL)
+	if v.IRQ() {
+		t.Error("reading T1CL did not clear the interrupt")
+	}
+}
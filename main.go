@@ -1,42 +1,115 @@
 package main
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+)
 
-	cpu6502 "izzudinhafiz.com/go-6502/cpu"
-	debugger "izzudinhafiz.com/go-6502/debugger"
+// Exit statuses
+const (
+	EXIT_OK    = 0
+	EXIT_FAIL  = 1 // The program ran but a test or -success check failed
+	EXIT_USAGE = 2
+	EXIT_ERROR = 3 // The program could not be loaded, run or traced
 )
 
-func main(){
-	f, err := os.Open("6502_functional_test.bin")
+type command struct {
+	name    string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []command{
+	{"run", "run a program until it traps, reaches an address or runs out of cycles", runCommand},
+	{"trace", "run a program, writing a trace of every instruction", traceCommand},
+	{"disasm", "disassemble a program image", disasmCommand},
+	{"asm", "assemble a source file into an object file for link", asmCommand},
+	{"link", "link object files into an image using a memory configuration", linkCommand},
+	{"convert", "convert an image to raw, Intel HEX or S-records", convertCommand},
+	{"test", "run the functional, decimal and interrupt test suites", testCommand},
+	{"debug", "debug a program in the terminal", debugCommand},
+	{"serve", "serve the browser debugger and JSON-RPC API", serveCommand},
+	{"query", "search a binary trace file", queryCommand},
+}
+
+// exitError carries the exit status for a command that did not succeed
+type exitError struct {
+	code int
+	err  error // Printed to stderr unless nil
+}
+
+func (e *exitError) Error() string {
+	if e.err == nil {
+		return fmt.Sprintf("exit status %d", e.code)
+	}
+	return e.err.Error()
+}
+
+func usageError(format string, args ...interface{}) error {
+	return &exitError{EXIT_USAGE, fmt.Errorf("usage: "+format, args...)}
+}
+
+func failed(format string, args ...interface{}) error {
+	return &exitError{EXIT_FAIL, fmt.Errorf(format, args...)}
+}
+
+// parseFlags parses args, the flag package has already explained any error
+func parseFlags(flags *flag.FlagSet, args []string) error {
+	err := flags.Parse(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return &exitError{EXIT_OK, nil}
+	}
 	if err != nil {
-		panic(err)
+		return &exitError{EXIT_USAGE, nil}
+	}
+	return nil
+}
+
+func printUsage() {
+	fmt.Fprintln(os.Stderr, "usage: go6502 COMMAND [FLAGS] [ARGS]")
+	fmt.Fprintln(os.Stderr)
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %v\n", cmd.name, cmd.summary)
 	}
-	stats, statsErr := f.Stat()
-	if statsErr != nil {
-		panic(statsErr)
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run go6502 COMMAND -h for the flags of a command.")
+}
+
+func main(){
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(EXIT_USAGE)
 	}
-	size := stats.Size()
-	readBuffer := make([]byte, size)
-	f.Read(readBuffer)
-	f.Close()
-
-	fmt.Println(len(readBuffer))
-	cpu := cpu6502.New()
-	deb := debugger.New(cpu)
-
-	cpu.WriteMemory(0, readBuffer)
-	fmt.Println(cpu.Memory[0x400 - 10: 0x400+10])
-	cpu.SetResetVector(0x400)
-	cpu.Reset()
-
-	repeat := 1000
-	for i := 0; i < repeat; i++ {
-		deb.Trace()
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "--help" {
+		printUsage()
+		return
 	}
 
-	for i := 0; i < repeat; i++ {
-		fmt.Println(deb.TraceStack[i])
+	for _, cmd := range commands {
+		if cmd.name != name {
+			continue
+		}
+
+		err := cmd.run(os.Args[2:])
+		if err == nil {
+			return
+		}
+		code := EXIT_ERROR
+		var exit *exitError
+		if errors.As(err, &exit) {
+			code, err = exit.code, exit.err
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		os.Exit(code)
 	}
-}
\ No newline at end of file
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	printUsage()
+	os.Exit(EXIT_USAGE)
+}
@@ -0,0 +1,95 @@
+package nes
+
+import (
+	"fmt"
+	"os"
+
+	cpu6502 "izzudinhafiz.com/go-6502/cpu"
+)
+
+// Bus is the NES CPU address space: 2K of internal RAM mirrored up to $1FFF,
+// the PPU and APU/IO registers, and the cartridge from $4020 upwards.
+//
+// There is no PPU or APU emulation. Their registers read back the last value
+// written, except PPUSTATUS which alternates its vblank bit so that the usual
+// "wait for vblank" loops in test ROMs make progress.
+type Bus struct {
+	RAM     [0x800]byte
+	Mapper  Mapper
+	ppuRegs [8]byte
+	ioRegs  [0x20]byte
+	vblank  bool
+}
+
+func NewBus(mapper Mapper) *Bus {
+	return &Bus{Mapper: mapper}
+}
+
+func (b *Bus) Read(addr uint16) byte {
+	if addr >= 0x2000 && addr < 0x4000 && addr&0x07 == 2 {
+		b.vblank = !b.vblank
+	}
+	return b.Peek(addr)
+}
+
+// Peek reads like Read without moving the vblank bit on
+func (b *Bus) Peek(addr uint16) byte {
+	switch {
+	case addr < 0x2000:
+		return b.RAM[addr&0x07FF]
+	case addr < 0x4000:
+		reg := addr & 0x07
+		if reg == 2 {
+			if b.vblank {
+				return b.ppuRegs[reg] | 0x80
+			}
+			return b.ppuRegs[reg] &^ 0x80
+		}
+		return b.ppuRegs[reg]
+	case addr < 0x4020:
+		return b.ioRegs[addr-0x4000]
+	}
+	return b.Mapper.CPURead(addr)
+}
+
+func (b *Bus) Write(addr uint16, value byte) {
+	switch {
+	case addr < 0x2000:
+		b.RAM[addr&0x07FF] = value
+	case addr < 0x4000:
+		b.ppuRegs[addr&0x07] = value
+	case addr < 0x4020:
+		b.ioRegs[addr-0x4000] = value
+	default:
+		b.Mapper.CPUWrite(addr, value)
+	}
+}
+
+// Attach plugs the cartridge into the CPU, switches it to 2A03 mode and resets it
+func Attach(c *cpu6502.Cpu6502, cart *Cartridge) (*Bus, error) {
+	mapper, err := NewMapper(cart)
+	if err != nil {
+		return nil, err
+	}
+
+	bus := NewBus(mapper)
+	c.Bus = bus
+	c.Variant = cpu6502.VARIANT_2A03
+	c.Reset()
+	return bus, nil
+}
+
+// LoadFile parses a .nes file and attaches it to the CPU
+func LoadFile(c *cpu6502.Cpu6502, path string) (*Bus, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	cart, err := ParseINES(f)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+	return Attach(c, cart)
+}
@@ -0,0 +1,143 @@
+// Package nes loads iNES and NES 2.0 cartridges and maps their PRG-ROM into
+// the address space of a Cpu6502 running in 2A03 mode.
+package nes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Nametable mirroring arrangements
+const (
+	MIRROR_HORIZONTAL byte = iota
+	MIRROR_VERTICAL
+	MIRROR_FOUR_SCREEN
+	MIRROR_SINGLE_LOWER
+	MIRROR_SINGLE_UPPER
+)
+
+const (
+	prgBankSize = 16 * 1024
+	chrBankSize = 8 * 1024
+	trainerSize = 512
+	maxRomSize  = 64 * 1024 * 1024 // Larger than any bank count NES 2.0 can express
+)
+
+var inesMagic = []byte{'N', 'E', 'S', 0x1A}
+
+// Cartridge is the parsed contents of a .nes file
+type Cartridge struct {
+	Mapper     int
+	Submapper  int
+	Mirroring  byte
+	Battery    bool
+	NES2       bool
+	Trainer    []byte
+	PRG        []byte
+	CHR        []byte
+	PRGRAMSize int
+	CHRRAMSize int
+}
+
+// IsINES reports whether a file starting with head is an iNES or NES 2.0 file
+func IsINES(head []byte) bool {
+	return bytes.HasPrefix(head, inesMagic)
+}
+
+// ParseINES reads an iNES or NES 2.0 file
+func ParseINES(r io.Reader) (*Cartridge, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, fmt.Errorf("reading iNES header: %w", err)
+	}
+	if !bytes.Equal(header[:4], inesMagic) {
+		return nil, errors.New("not an iNES file")
+	}
+
+	flags6, flags7 := header[6], header[7]
+	cart := &Cartridge{
+		Mapper:  int(flags6>>4) | int(flags7&0xF0),
+		Battery: flags6&0x02 != 0,
+		NES2:    flags7&0x0C == 0x08,
+	}
+
+	switch {
+	case flags6&0x08 != 0:
+		cart.Mirroring = MIRROR_FOUR_SCREEN
+	case flags6&0x01 != 0:
+		cart.Mirroring = MIRROR_VERTICAL
+	default:
+		cart.Mirroring = MIRROR_HORIZONTAL
+	}
+
+	prgSize := int(header[4]) * prgBankSize
+	chrSize := int(header[5]) * chrBankSize
+	cart.PRGRAMSize = 8 * 1024
+
+	if cart.NES2 {
+		cart.Mapper |= int(header[8]&0x0F) << 8
+		cart.Submapper = int(header[8] >> 4)
+		var err error
+		if prgSize, err = nes2RomSize(header[4], header[9]&0x0F, prgBankSize); err != nil {
+			return nil, fmt.Errorf("PRG-ROM: %w", err)
+		}
+		if chrSize, err = nes2RomSize(header[5], header[9]>>4, chrBankSize); err != nil {
+			return nil, fmt.Errorf("CHR-ROM: %w", err)
+		}
+		cart.PRGRAMSize = nes2RamSize(header[10]&0x0F) + nes2RamSize(header[10]>>4)
+		cart.CHRRAMSize = nes2RamSize(header[11]&0x0F) + nes2RamSize(header[11]>>4)
+	} else if !bytes.Equal(header[12:16], []byte{0, 0, 0, 0}) {
+		// Old dumps carry junk like "DiskDude!" in bytes 7-15, which corrupts the upper mapper nibble
+		cart.Mapper &= 0x0F
+	}
+
+	if cart.CHRRAMSize == 0 && chrSize == 0 {
+		cart.CHRRAMSize = chrBankSize
+	}
+
+	if flags6&0x04 != 0 {
+		cart.Trainer = make([]byte, trainerSize)
+		if _, err := io.ReadFull(r, cart.Trainer); err != nil {
+			return nil, fmt.Errorf("reading trainer: %w", err)
+		}
+	}
+
+	if prgSize == 0 {
+		return nil, errors.New("cartridge has no PRG-ROM")
+	}
+	cart.PRG = make([]byte, prgSize)
+	if _, err := io.ReadFull(r, cart.PRG); err != nil {
+		return nil, fmt.Errorf("reading PRG-ROM: %w", err)
+	}
+	cart.CHR = make([]byte, chrSize)
+	if _, err := io.ReadFull(r, cart.CHR); err != nil {
+		return nil, fmt.Errorf("reading CHR-ROM: %w", err)
+	}
+
+	return cart, nil
+}
+
+// nes2RomSize decodes a NES 2.0 ROM size, which is either a bank count or,
+// when the upper nibble is $F, an exponent-multiplier pair. The exponent form
+// can describe sizes up to 7*2^63, so anything past maxRomSize is rejected.
+func nes2RomSize(lsb byte, msb byte, unit int) (int, error) {
+	if msb == 0x0F {
+		exponent := uint(lsb >> 2)
+		multiplier := int(lsb&0x03)*2 + 1
+		if exponent >= 32 || (1<<exponent)*multiplier > maxRomSize {
+			return 0, fmt.Errorf("size 2^%d*%d is too large", exponent, multiplier)
+		}
+		return (1 << exponent) * multiplier, nil
+	}
+	return (int(msb)<<8 | int(lsb)) * unit, nil
+}
+
+// nes2RamSize decodes a NES 2.0 RAM shift count into bytes
+func nes2RamSize(shift byte) int {
+	if shift == 0 {
+		return 0
+	}
+	return 64 << shift
+}
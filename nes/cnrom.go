@@ -0,0 +1,38 @@
+package nes
+
+// CNROM (mapper 3): fixed PRG-ROM like NROM and a switchable 8K CHR-ROM bank
+type CNROM struct {
+	cartMemory
+	chrSelect int
+}
+
+func newCNROM(cart *Cartridge) Mapper {
+	return &CNROM{cartMemory: newCartMemory(cart)}
+}
+
+func (m *CNROM) CPURead(addr uint16) byte {
+	if addr >= 0x8000 {
+		return m.readPRG(0, 0x8000, addr-0x8000)
+	}
+	return m.readRAM(addr)
+}
+
+func (m *CNROM) CPUWrite(addr uint16, value byte) {
+	if addr >= 0x8000 {
+		m.chrSelect = int(value & 0x03)
+		return
+	}
+	m.writeRAM(addr, value)
+}
+
+func (m *CNROM) PPURead(addr uint16) byte {
+	return *m.chrAt(m.chrSelect, chrBankSize, addr)
+}
+
+func (m *CNROM) PPUWrite(addr uint16, value byte) {
+	m.writeCHR(m.chrAt(m.chrSelect, chrBankSize, addr), value)
+}
+
+func (m *CNROM) Mirroring() byte {
+	return m.cart.Mirroring
+}
@@ -0,0 +1,96 @@
+package nes
+
+import "fmt"
+
+// Mapper translates CPU and PPU addresses into cartridge PRG and CHR memory.
+// CPU addresses passed in are always in $4020-$FFFF, PPU addresses in $0000-$1FFF.
+type Mapper interface {
+	CPURead(addr uint16) byte
+	CPUWrite(addr uint16, value byte)
+	PPURead(addr uint16) byte
+	PPUWrite(addr uint16, value byte)
+	Mirroring() byte
+}
+
+type mapperConstructor func(*Cartridge) Mapper
+
+var Mappers = map[int]mapperConstructor{
+	0: newNROM,
+	1: newMMC1,
+	2: newUxROM,
+	3: newCNROM,
+}
+
+// NewMapper builds the mapper the cartridge header asks for
+func NewMapper(cart *Cartridge) (Mapper, error) {
+	constructor, exists := Mappers[cart.Mapper]
+	if !exists {
+		return nil, fmt.Errorf("mapper %d is not supported", cart.Mapper)
+	}
+	return constructor(cart), nil
+}
+
+// cartMemory holds the state every mapper shares: the ROM images, CHR-RAM and PRG-RAM
+type cartMemory struct {
+	cart   *Cartridge
+	chr    []byte
+	prgRAM []byte
+}
+
+func newCartMemory(cart *Cartridge) cartMemory {
+	m := cartMemory{cart: cart, chr: cart.CHR}
+	if len(m.chr) == 0 {
+		m.chr = make([]byte, cart.CHRRAMSize)
+	}
+	if cart.PRGRAMSize > 0 {
+		m.prgRAM = make([]byte, cart.PRGRAMSize)
+	}
+	if cart.Trainer != nil && len(m.prgRAM) >= 0x2000 {
+		copy(m.prgRAM[0x1000:], cart.Trainer)
+	}
+	return m
+}
+
+// readPRG reads from a bank of the given size, wrapping bank numbers past the
+// end of the ROM. A ROM smaller than one bank, like a 16K NROM image in its
+// 32K window, is mirrored through it.
+func (m *cartMemory) readPRG(bank int, size int, offset uint16) byte {
+	banks := len(m.cart.PRG) / size
+	if banks == 0 {
+		return m.cart.PRG[int(offset)%len(m.cart.PRG)]
+	}
+	return m.cart.PRG[(bank%banks)*size+int(offset)%size]
+}
+
+func (m *cartMemory) chrAt(bank int, size int, offset uint16) *byte {
+	banks := len(m.chr) / size
+	if banks == 0 {
+		return &m.chr[int(offset)%len(m.chr)]
+	}
+	return &m.chr[(bank%banks)*size+int(offset)%size]
+}
+
+func (m *cartMemory) readRAM(addr uint16) byte {
+	if addr >= 0x6000 && addr < 0x8000 && len(m.prgRAM) > 0 {
+		return m.prgRAM[int(addr-0x6000)%len(m.prgRAM)]
+	}
+	return 0
+}
+
+func (m *cartMemory) writeRAM(addr uint16, value byte) {
+	if addr >= 0x6000 && addr < 0x8000 && len(m.prgRAM) > 0 {
+		m.prgRAM[int(addr-0x6000)%len(m.prgRAM)] = value
+	}
+}
+
+// writeCHR only succeeds for cartridges with CHR-RAM
+func (m *cartMemory) writeCHR(p *byte, value byte) {
+	if len(m.cart.CHR) == 0 {
+		*p = value
+	}
+}
+
+// PRGRAM exposes the battery backed work RAM so it can be saved
+func (m *cartMemory) PRGRAM() []byte {
+	return m.prgRAM
+}
@@ -0,0 +1,118 @@
+package nes
+
+// MMC1 (mapper 1): registers are loaded one bit at a time through a serial
+// shift register, giving switchable PRG and CHR banks and selectable mirroring.
+type MMC1 struct {
+	cartMemory
+	shift      byte
+	shiftCount int
+	control    byte
+	chrBank0   int
+	chrBank1   int
+	prgBank    int
+	ramDisable bool
+}
+
+func newMMC1(cart *Cartridge) Mapper {
+	// Power on with the last PRG bank fixed at $C000
+	return &MMC1{cartMemory: newCartMemory(cart), control: 0x0C}
+}
+
+func (m *MMC1) CPURead(addr uint16) byte {
+	if addr < 0x8000 {
+		if m.ramDisable {
+			return 0
+		}
+		return m.readRAM(addr)
+	}
+
+	switch (m.control >> 2) & 0x03 {
+	case 0, 1:
+		// 32K mode ignores the low bit of the bank number
+		return m.prgBank32(m.prgBank>>1, addr-0x8000)
+	case 2:
+		if addr < 0xC000 {
+			return m.prgBank16(0, addr-0x8000)
+		}
+		return m.prgBank16(m.prgBank, addr-0xC000)
+	default:
+		if addr < 0xC000 {
+			return m.prgBank16(m.prgBank, addr-0x8000)
+		}
+		return m.prgBank16(len(m.cart.PRG)/prgBankSize-1, addr-0xC000)
+	}
+}
+
+func (m *MMC1) prgBank16(bank int, offset uint16) byte {
+	return m.readPRG(bank, prgBankSize, offset)
+}
+
+func (m *MMC1) prgBank32(bank int, offset uint16) byte {
+	return m.readPRG(bank, 2*prgBankSize, offset)
+}
+
+func (m *MMC1) CPUWrite(addr uint16, value byte) {
+	if addr < 0x8000 {
+		if !m.ramDisable {
+			m.writeRAM(addr, value)
+		}
+		return
+	}
+
+	// Writing a value with bit 7 set resets the shift register
+	if value&0x80 != 0 {
+		m.shift, m.shiftCount = 0, 0
+		m.control |= 0x0C
+		return
+	}
+
+	m.shift |= (value & 0x01) << m.shiftCount
+	m.shiftCount += 1
+	if m.shiftCount < 5 {
+		return
+	}
+
+	switch (addr >> 13) & 0x03 {
+	case 0:
+		m.control = m.shift
+	case 1:
+		m.chrBank0 = int(m.shift)
+	case 2:
+		m.chrBank1 = int(m.shift)
+	case 3:
+		m.prgBank = int(m.shift & 0x0F)
+		m.ramDisable = m.shift&0x10 != 0
+	}
+	m.shift, m.shiftCount = 0, 0
+}
+
+func (m *MMC1) chrAddr(addr uint16) *byte {
+	if m.control&0x10 == 0 {
+		// 8K mode ignores the low bit of the bank number
+		return m.chrAt(m.chrBank0>>1, chrBankSize, addr)
+	}
+	if addr < 0x1000 {
+		return m.chrAt(m.chrBank0, chrBankSize/2, addr)
+	}
+	return m.chrAt(m.chrBank1, chrBankSize/2, addr-0x1000)
+}
+
+func (m *MMC1) PPURead(addr uint16) byte {
+	return *m.chrAddr(addr)
+}
+
+func (m *MMC1) PPUWrite(addr uint16, value byte) {
+	m.writeCHR(m.chrAddr(addr), value)
+}
+
+func (m *MMC1) Mirroring() byte {
+	switch m.control & 0x03 {
+	case 0:
+		return MIRROR_SINGLE_LOWER
+	case 1:
+		return MIRROR_SINGLE_UPPER
+	case 2:
+		return MIRROR_VERTICAL
+	}
+	return MIRROR_HORIZONTAL
+}
@@ -0,0 +1,125 @@
+package nes
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	cpu6502 "izzudinhafiz.com/go-6502/cpu"
+)
+
+// testCart builds an iNES file with banks of 16K PRG-ROM and one 8K CHR-ROM
+// bank. Each PRG byte holds its bank number and the reset vector of the last
+// bank points at $8000 plus the bank count.
+func testCart(banks int, header ...byte) []byte {
+	f := append([]byte{}, inesMagic...)
+	f = append(f, byte(banks), 1)
+	f = append(f, header...)
+	f = append(f, make([]byte, 16-len(f))...)
+
+	prg := make([]byte, banks*prgBankSize)
+	for i := range prg {
+		prg[i] = byte(i / prgBankSize)
+	}
+	prg[len(prg)-4] = byte(banks)
+	prg[len(prg)-3] = 0x80
+	f = append(f, prg...)
+	return append(f, make([]byte, chrBankSize)...)
+}
+
+func attachTestCart(t *testing.T, data []byte) (*cpu6502.Cpu6502, *Bus) {
+	t.Helper()
+	cart, err := ParseINES(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := cpu6502.New()
+	bus, err := Attach(c, cart)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, bus
+}
+
+func TestNROM(t *testing.T) {
+	// 16K is mirrored into $C000, so both halves read bank 0
+	c, bus := attachTestCart(t, testCart(1))
+	if bus.Read(0x8000) != 0 || bus.Read(0xC000) != 0 || bus.Read(0xFFFF) != bus.Read(0xBFFF) {
+		t.Errorf("16K PRG is not mirrored")
+	}
+	if c.Registers.PC != 0x8001 {
+		t.Errorf("16K reset to $%04X, want the mirrored vector $8001", c.Registers.PC)
+	}
+	if c.Variant != cpu6502.VARIANT_2A03 {
+		t.Errorf("cartridge did not switch the CPU to 2A03 mode")
+	}
+
+	c, bus = attachTestCart(t, testCart(2))
+	if bus.Read(0x8000) != 0 || bus.Read(0xC000) != 1 {
+		t.Errorf("32K PRG reads $%02X at $8000 and $%02X at $C000", bus.Read(0x8000), bus.Read(0xC000))
+	}
+	if c.Registers.PC != 0x8002 {
+		t.Errorf("32K reset to $%04X", c.Registers.PC)
+	}
+}
+
+func TestCNROM(t *testing.T) {
+	_, bus := attachTestCart(t, testCart(1, 0x30))
+	if _, ok := bus.Mapper.(*CNROM); !ok {
+		t.Fatalf("mapper 3 gave %T", bus.Mapper)
+	}
+	if bus.Read(0xC000) != 0 || bus.Read(0xFFFC) != 1 {
+		t.Errorf("16K PRG is not mirrored")
+	}
+}
+
+func TestBusMirrors(t *testing.T) {
+	_, bus := attachTestCart(t, testCart(1))
+	bus.Write(0x0001, 0x42)
+	if bus.Read(0x0801) != 0x42 || bus.Read(0x1801) != 0x42 {
+		t.Errorf("internal RAM is not mirrored")
+	}
+	bus.Write(0x2000, 0x80)
+	if bus.Read(0x3FF8) != 0x80 {
+		t.Errorf("PPU registers are not mirrored")
+	}
+	if bus.Read(0x2002)&0x80 == bus.Read(0x2002)&0x80 {
+		t.Errorf("PPUSTATUS vblank does not toggle")
+	}
+
+	// The debugger looks with Peek, which must leave the toggle alone
+	status := bus.Peek(0x2002)
+	if bus.Peek(0x2002) != status || bus.Read(0x2002)&0x80 == status&0x80 {
+		t.Errorf("peeking at PPUSTATUS moved vblank on")
+	}
+}
+
+func TestParseINESErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want string
+	}{
+		{"magic", []byte("NES\x00\x01\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), "not an iNES file"},
+		{"truncated", testCart(2)[:16+prgBankSize], "PRG-ROM"},
+		{"no prg", []byte("NES\x1A\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00"), "no PRG-ROM"},
+		// NES 2.0 exponent-multiplier form claiming 2^63*7 bytes
+		{"huge", []byte("NES\x1A\xFF\x01\x00\x08\x00\x0F\x00\x00\x00\x00\x00\x00"), "too large"},
+	}
+	for _, test := range tests {
+		_, err := ParseINES(bytes.NewReader(test.data))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%v: got error %v, want one containing %q", test.name, err, test.want)
+		}
+	}
+
+	if _, err := NewMapper(&Cartridge{Mapper: 5}); err == nil {
+		t.Error("unsupported mapper was accepted")
+	}
+}
+
+func TestIsINES(t *testing.T) {
+	if !IsINES(testCart(1)) || IsINES([]byte("NES")) {
+		t.Error("IsINES")
+	}
+}
@@ -0,0 +1,33 @@
+package nes
+
+// NROM (mapper 0): 16K or 32K of PRG-ROM, 16K images are mirrored into $C000
+type NROM struct {
+	cartMemory
+}
+
+func newNROM(cart *Cartridge) Mapper {
+	return &NROM{newCartMemory(cart)}
+}
+
+func (m *NROM) CPURead(addr uint16) byte {
+	if addr >= 0x8000 {
+		return m.readPRG(0, 0x8000, addr-0x8000)
+	}
+	return m.readRAM(addr)
+}
+
+func (m *NROM) CPUWrite(addr uint16, value byte) {
+	m.writeRAM(addr, value)
+}
+
+func (m *NROM) PPURead(addr uint16) byte {
+	return *m.chrAt(0, chrBankSize, addr)
+}
+
+func (m *NROM) PPUWrite(addr uint16, value byte) {
+	m.writeCHR(m.chrAt(0, chrBankSize, addr), value)
+}
+
+func (m *NROM) Mirroring() byte {
+	return m.cart.Mirroring
+}
@@ -0,0 +1,41 @@
+package nes
+
+// UxROM (mapper 2): a switchable 16K bank at $8000 and the last bank fixed at $C000
+type UxROM struct {
+	cartMemory
+	bank int
+}
+
+func newUxROM(cart *Cartridge) Mapper {
+	return &UxROM{cartMemory: newCartMemory(cart)}
+}
+
+func (m *UxROM) CPURead(addr uint16) byte {
+	switch {
+	case addr >= 0xC000:
+		return m.readPRG(len(m.cart.PRG)/prgBankSize-1, prgBankSize, addr-0xC000)
+	case addr >= 0x8000:
+		return m.readPRG(m.bank, prgBankSize, addr-0x8000)
+	}
+	return m.readRAM(addr)
+}
+
+func (m *UxROM) CPUWrite(addr uint16, value byte) {
+	if addr >= 0x8000 {
+		m.bank = int(value & 0x0F)
+		return
+	}
+	m.writeRAM(addr, value)
+}
+
+func (m *UxROM) PPURead(addr uint16) byte {
+	return *m.chrAt(0, chrBankSize, addr)
+}
+
+func (m *UxROM) PPUWrite(addr uint16, value byte) {
+	m.writeCHR(m.chrAt(0, chrBankSize, addr), value)
+}
+
+func (m *UxROM) Mirroring() byte {
+	return m.cart.Mirroring
+}
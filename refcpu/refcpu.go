@@ -0,0 +1,371 @@
+// Package refcpu is a deliberately plain 6502 interpreter, written separately
+// from the cpu package so the two can be checked against each other. It favours
+// being obviously correct over being fast or cycle stepped.
+package refcpu
+
+const (
+	FLAG_C byte = 1 << 0
+	FLAG_Z byte = 1 << 1
+	FLAG_I byte = 1 << 2
+	FLAG_D byte = 1 << 3
+	FLAG_B byte = 1 << 4
+	FLAG_U byte = 1 << 5
+	FLAG_V byte = 1 << 6
+	FLAG_N byte = 1 << 7
+)
+
+// CPU is the complete machine state. P never holds B or bit 5, they only exist on the stack.
+type CPU struct {
+	A, X, Y, S, P byte
+	PC            uint16
+	Mem           [0x10000]byte
+	Cycles        int
+	NoDecimal     bool // Ignore the D flag, as the 2A03 does
+}
+
+// Implemented reports whether the reference knows the opcode
+func Implemented(op byte) bool {
+	_, ok := instructions[op]
+	return ok
+}
+
+func (c *CPU) read16(addr uint16) uint16 {
+	return uint16(c.Mem[addr]) | uint16(c.Mem[addr+1])<<8
+}
+
+// read16Wrapped reads a pointer whose high byte comes from the same page as its low byte
+func (c *CPU) read16Wrapped(addr uint16) uint16 {
+	hi := addr&0xFF00 | uint16(byte(addr)+1)
+	return uint16(c.Mem[addr]) | uint16(c.Mem[hi])<<8
+}
+
+func (c *CPU) push(v byte) {
+	c.Mem[0x100|uint16(c.S)] = v
+	c.S--
+}
+
+func (c *CPU) pull() byte {
+	c.S++
+	return c.Mem[0x100|uint16(c.S)]
+}
+
+func (c *CPU) flag(f byte) bool {
+	return c.P&f != 0
+}
+
+func (c *CPU) setFlag(f byte, on bool) {
+	if on {
+		c.P |= f
+	} else {
+		c.P &^= f
+	}
+}
+
+func (c *CPU) setNZ(v byte) byte {
+	c.setFlag(FLAG_Z, v == 0)
+	c.setFlag(FLAG_N, v&0x80 != 0)
+	return v
+}
+
+// Step executes one instruction and returns the cycles it took.
+// It returns false, without changing any state, for an opcode it does not know.
+func (c *CPU) Step() (int, bool) {
+	op := c.Mem[c.PC]
+	ins, ok := instructions[op]
+	if !ok {
+		return 0, false
+	}
+
+	pc := c.PC + 1
+	cycles := ins.cycles
+	var addr uint16
+	crossed := false
+
+	switch ins.mode {
+	case "imm":
+		addr = pc
+		pc++
+	case "zp":
+		addr = uint16(c.Mem[pc])
+		pc++
+	case "zpx":
+		addr = uint16(c.Mem[pc] + c.X)
+		pc++
+	case "zpy":
+		addr = uint16(c.Mem[pc] + c.Y)
+		pc++
+	case "abs":
+		addr = c.read16(pc)
+		pc += 2
+	case "abx", "aby":
+		base := c.read16(pc)
+		index := c.X
+		if ins.mode == "aby" {
+			index = c.Y
+		}
+		addr = base + uint16(index)
+		crossed = addr>>8 != base>>8
+		pc += 2
+	case "ind":
+		addr = c.read16Wrapped(c.read16(pc))
+		pc += 2
+	case "izx":
+		addr = c.read16Wrapped(uint16(c.Mem[pc] + c.X))
+		pc++
+	case "izy":
+		base := c.read16Wrapped(uint16(c.Mem[pc]))
+		addr = base + uint16(c.Y)
+		crossed = addr>>8 != base>>8
+		pc++
+	case "rel":
+		addr = pc + 1 + uint16(int8(c.Mem[pc]))
+		pc++
+	}
+	if crossed && ins.pagePenalty {
+		cycles++
+	}
+	c.PC = pc
+
+	// operand fetches the value an instruction works on, for the accumulator mode as well
+	operand := func() byte {
+		if ins.mode == "acc" {
+			return c.A
+		}
+		return c.Mem[addr]
+	}
+	store := func(v byte) {
+		if ins.mode == "acc" {
+			c.A = v
+		} else {
+			c.Mem[addr] = v
+		}
+	}
+	branch := func(taken bool) {
+		if taken {
+			cycles++
+			if addr>>8 != c.PC>>8 {
+				cycles++
+			}
+			c.PC = addr
+		}
+	}
+	compare := func(reg byte) {
+		v := operand()
+		c.setFlag(FLAG_C, reg >= v)
+		c.setNZ(reg - v)
+	}
+
+	switch ins.name {
+	case "ADC":
+		c.adc(operand())
+	case "SBC":
+		c.sbc(operand())
+	case "AND":
+		c.A = c.setNZ(c.A & operand())
+	case "ORA":
+		c.A = c.setNZ(c.A | operand())
+	case "EOR":
+		c.A = c.setNZ(c.A ^ operand())
+	case "ASL":
+		v := operand()
+		c.setFlag(FLAG_C, v&0x80 != 0)
+		store(c.setNZ(v << 1))
+	case "LSR":
+		v := operand()
+		c.setFlag(FLAG_C, v&0x01 != 0)
+		store(c.setNZ(v >> 1))
+	case "ROL":
+		v := operand()
+		var in byte
+		if c.flag(FLAG_C) {
+			in = 1
+		}
+		c.setFlag(FLAG_C, v&0x80 != 0)
+		store(c.setNZ(v<<1 | in))
+	case "ROR":
+		v := operand()
+		var in byte
+		if c.flag(FLAG_C) {
+			in = 0x80
+		}
+		c.setFlag(FLAG_C, v&0x01 != 0)
+		store(c.setNZ(v>>1 | in))
+	case "BIT":
+		v := operand()
+		c.setFlag(FLAG_Z, c.A&v == 0)
+		c.setFlag(FLAG_N, v&0x80 != 0)
+		c.setFlag(FLAG_V, v&0x40 != 0)
+	case "BPL":
+		branch(!c.flag(FLAG_N))
+	case "BMI":
+		branch(c.flag(FLAG_N))
+	case "BVC":
+		branch(!c.flag(FLAG_V))
+	case "BVS":
+		branch(c.flag(FLAG_V))
+	case "BCC":
+		branch(!c.flag(FLAG_C))
+	case "BCS":
+		branch(c.flag(FLAG_C))
+	case "BNE":
+		branch(!c.flag(FLAG_Z))
+	case "BEQ":
+		branch(c.flag(FLAG_Z))
+	case "BRK":
+		ret := c.PC + 1
+		c.push(byte(ret >> 8))
+		c.push(byte(ret))
+		c.push(c.P | FLAG_B | FLAG_U)
+		c.P |= FLAG_I
+		c.PC = c.read16(0xFFFE)
+	case "CMP":
+		compare(c.A)
+	case "CPX":
+		compare(c.X)
+	case "CPY":
+		compare(c.Y)
+	case "DEC":
+		store(c.setNZ(operand() - 1))
+	case "INC":
+		store(c.setNZ(operand() + 1))
+	case "DEX":
+		c.X = c.setNZ(c.X - 1)
+	case "DEY":
+		c.Y = c.setNZ(c.Y - 1)
+	case "INX":
+		c.X = c.setNZ(c.X + 1)
+	case "INY":
+		c.Y = c.setNZ(c.Y + 1)
+	case "CLC":
+		c.setFlag(FLAG_C, false)
+	case "SEC":
+		c.setFlag(FLAG_C, true)
+	case "CLI":
+		c.setFlag(FLAG_I, false)
+	case "SEI":
+		c.setFlag(FLAG_I, true)
+	case "CLV":
+		c.setFlag(FLAG_V, false)
+	case "CLD":
+		c.setFlag(FLAG_D, false)
+	case "SED":
+		c.setFlag(FLAG_D, true)
+	case "JMP":
+		c.PC = addr
+	case "JSR":
+		ret := c.PC - 1
+		c.push(byte(ret >> 8))
+		c.push(byte(ret))
+		c.PC = addr
+	case "RTS":
+		lo := c.pull()
+		hi := c.pull()
+		c.PC = (uint16(hi)<<8 | uint16(lo)) + 1
+	case "RTI":
+		c.P = c.pull() &^ (FLAG_B | FLAG_U)
+		lo := c.pull()
+		hi := c.pull()
+		c.PC = uint16(hi)<<8 | uint16(lo)
+	case "LDA":
+		c.A = c.setNZ(operand())
+	case "LDX":
+		c.X = c.setNZ(operand())
+	case "LDY":
+		c.Y = c.setNZ(operand())
+	case "STA":
+		store(c.A)
+	case "STX":
+		store(c.X)
+	case "STY":
+		store(c.Y)
+	case "TAX":
+		c.X = c.setNZ(c.A)
+	case "TAY":
+		c.Y = c.setNZ(c.A)
+	case "TXA":
+		c.A = c.setNZ(c.X)
+	case "TYA":
+		c.A = c.setNZ(c.Y)
+	case "TSX":
+		c.X = c.setNZ(c.S)
+	case "TXS":
+		c.S = c.X
+	case "PHA":
+		c.push(c.A)
+	case "PLA":
+		c.A = c.setNZ(c.pull())
+	case "PHP":
+		c.push(c.P | FLAG_B | FLAG_U)
+	case "PLP":
+		c.P = c.pull() &^ (FLAG_B | FLAG_U)
+	case "NOP":
+	}
+
+	c.Cycles += cycles
+	return cycles, true
+}
+
+func (c *CPU) adc(v byte) {
+	var carry byte
+	if c.flag(FLAG_C) {
+		carry = 1
+	}
+
+	if !c.flag(FLAG_D) || c.NoDecimal {
+		sum := uint16(c.A) + uint16(v) + uint16(carry)
+		result := byte(sum)
+		c.setFlag(FLAG_V, (c.A^result)&(v^result)&0x80 != 0)
+		c.setFlag(FLAG_C, sum > 0xFF)
+		c.A = c.setNZ(result)
+		return
+	}
+
+	// Decimal mode worked nibble by nibble, the way the MAME core does it
+	lo := c.A&0x0F + v&0x0F + carry
+	if lo > 9 {
+		lo += 6
+	}
+	hi := c.A>>4 + v>>4
+	if lo > 0x0F {
+		hi++
+	}
+	c.setFlag(FLAG_Z, c.A+v+carry == 0)
+	c.setFlag(FLAG_N, hi&0x08 != 0)
+	c.setFlag(FLAG_V, ^(c.A^v)&(c.A^(hi<<4))&0x80 != 0)
+	if hi > 9 {
+		hi += 6
+	}
+	c.setFlag(FLAG_C, hi > 0x0F)
+	c.A = lo&0x0F | hi<<4
+}
+
+func (c *CPU) sbc(v byte) {
+	var borrow byte = 1
+	if c.flag(FLAG_C) {
+		borrow = 0
+	}
+
+	diff := uint16(c.A) - uint16(v) - uint16(borrow)
+	result := byte(diff)
+	overflow := (c.A^v)&(c.A^result)&0x80 != 0
+
+	if c.flag(FLAG_D) && !c.NoDecimal {
+		lo := int(c.A&0x0F) - int(v&0x0F) - int(borrow)
+		hi := int(c.A>>4) - int(v>>4)
+		if lo < 0 {
+			lo -= 6
+			hi--
+		}
+		if hi < 0 {
+			hi -= 6
+		}
+		c.A = byte(lo&0x0F) | byte(hi<<4)
+	} else {
+		c.A = result
+	}
+
+	// The flags always come from the binary subtraction
+	c.setFlag(FLAG_V, overflow)
+	c.setFlag(FLAG_C, diff < 0x100)
+	c.setNZ(result)
+}
@@ -0,0 +1,78 @@
+package remote
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// checkAccess refuses requests from other web pages and requests without
+// the session's token, writing the error response itself
+func (s *Session) checkAccess(w http.ResponseWriter, r *http.Request) bool {
+	if !s.originAllowed(r) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return false
+	}
+	if !s.tokenValid(r) {
+		http.Error(w, "missing or wrong token", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+// originAllowed accepts requests without an Origin, which browsers always
+// send for WebSockets and cross origin requests, requests from pages served
+// by this host, and origins listed in AllowOrigins. A page is only trusted
+// to be this host's when the Host it asked for is one of ours, otherwise a
+// DNS rebinding page would match its own Origin.
+func (s *Session) originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range s.AllowOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host) && s.hostAllowed(r.Host)
+}
+
+// hostAllowed accepts loopback names and addresses and the names in Hosts
+func (s *Session) hostAllowed(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return true
+	}
+	for _, allowed := range s.Hosts {
+		if strings.EqualFold(allowed, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// tokenValid checks the token given as a bearer token or in the token query
+// parameter, which is the only way a browser can send one with a WebSocket
+func (s *Session) tokenValid(r *http.Request) bool {
+	if s.Token == "" {
+		return true
+	}
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.Token)) == 1
+}
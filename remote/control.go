@@ -0,0 +1,242 @@
+package remote
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	debugger "izzudinhafiz.com/go-6502/debugger"
+	loader "izzudinhafiz.com/go-6502/loader"
+)
+
+// loadMethod loads a program image from base64 data, or from a path within
+// the session's LoadDir
+func loadMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Path   string   `json:"path"`
+		Data   string   `json:"data"`
+		Format string   `json:"format"`
+		Addr   *Address `json:"addr"`  // Load address for raw images
+		Start  *Address `json:"start"` // Overrides the image's own start address
+		Reset  bool     `json:"reset"` // Reset the CPU after loading, starting from the reset vector
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if s.running {
+		return nil, errRunning
+	}
+
+	format, err := loader.ParseFormat(p.Format)
+	if err != nil {
+		return nil, err
+	}
+	opts := loader.Options{Format: format}
+	if p.Addr != nil {
+		addr, err := s.resolve(*p.Addr)
+		if err != nil {
+			return nil, err
+		}
+		opts.Addr = int(addr)
+	}
+
+	var img *loader.Image
+	switch {
+	case p.Path != "" && p.Data != "":
+		return nil, fmt.Errorf("give either path or data, not both")
+	case p.Path != "":
+		var path string
+		if path, err = s.loadPath(p.Path); err == nil {
+			img, err = loader.LoadFile(path, opts)
+		}
+	case p.Data != "":
+		var content []byte
+		if content, err = base64.StdEncoding.DecodeString(p.Data); err != nil {
+			return nil, fmt.Errorf("data: %w", err)
+		}
+		img, err = loader.Load("", content, opts)
+	default:
+		return nil, fmt.Errorf("missing path or data")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := img.LoadInto(s.c); err != nil {
+		return nil, err
+	}
+
+	if p.Reset {
+		s.c.Reset()
+	}
+	switch {
+	case p.Start != nil:
+		start, err := s.resolve(*p.Start)
+		if err != nil {
+			return nil, err
+		}
+		s.c.Registers.PC = start
+	case img.HasStart && !p.Reset:
+		s.c.Registers.PC = uint16(img.Start)
+	}
+
+	s.d.Calls.Reset()
+	s.trace.Reset()
+	s.status = "loaded"
+
+	segments := make([]map[string]int, len(img.Segments))
+	for i, seg := range img.Segments {
+		segments[i] = map[string]int{"addr": seg.Addr, "length": len(seg.Data)}
+	}
+	return map[string]interface{}{"segments": segments, "state": s.state()}, nil
+}
+
+// loadPath resolves a path given to loadMethod, refusing paths that lead
+// outside LoadDir, including through symbolic links
+func (s *Session) loadPath(path string) (string, error) {
+	if s.LoadDir == "" {
+		return "", fmt.Errorf("loading files is disabled, send the image as data")
+	}
+	if filepath.IsAbs(path) {
+		return "", fmt.Errorf("%v: path must be relative to the load directory", path)
+	}
+	dir, err := filepath.EvalSymlinks(s.LoadDir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(dir, path))
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(dir, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%v: path is outside the load directory", path)
+	}
+	return resolved, nil
+}
+
+func registersSetMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		PC *Address `json:"pc"`
+		A  *byte    `json:"a"`
+		X  *byte    `json:"x"`
+		Y  *byte    `json:"y"`
+		SP *byte    `json:"sp"`
+		P  *byte    `json:"p"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if s.running {
+		return nil, errRunning
+	}
+
+	r := &s.c.Registers
+	if p.PC != nil {
+		pc, err := s.resolve(*p.PC)
+		if err != nil {
+			return nil, err
+		}
+		r.PC = pc
+	}
+	if p.A != nil {
+		r.A = *p.A
+	}
+	if p.X != nil {
+		r.X = *p.X
+	}
+	if p.Y != nil {
+		r.Y = *p.Y
+	}
+	if p.SP != nil {
+		r.SP = *p.SP
+	}
+	if p.P != nil {
+		f := &s.c.Flags
+		f.C = *p.P & 1
+		f.Z = *p.P >> 1 & 1
+		f.I = *p.P >> 2 & 1
+		f.D = *p.P >> 3 & 1
+		f.B = *p.P >> 4 & 1
+		f.V = *p.P >> 6 & 1
+		f.N = *p.P >> 7 & 1
+	}
+	return s.state(), nil
+}
+
+func memoryWriteMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Addr  Address `json:"addr"`
+		Data  []byte  `json:"data"` // Base64, as encoding/json encodes byte slices
+		Bytes []int   `json:"bytes"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	addr, err := s.resolve(p.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	data := p.Data
+	for _, b := range p.Bytes {
+		if b < 0 || b > 0xFF {
+			return nil, fmt.Errorf("byte value %d out of range", b)
+		}
+		data = append(data, byte(b))
+	}
+	s.d.WriteMemory(addr, data)
+	return map[string]int{"written": len(data)}, nil
+}
+
+type stopResult struct {
+	Reason       string `json:"reason"`
+	PC           uint16 `json:"pc"`
+	Instructions int    `json:"instructions"`
+	Cycles       int    `json:"cycles"`
+	Message      string `json:"message"`
+}
+
+// runMethod runs for at most the given number of cycles, or until a breakpoint
+// or the until address is reached, and returns once the CPU has stopped
+func runMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Cycles int      `json:"cycles"`
+		Until  *Address `json:"until"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if p.Cycles <= 0 {
+		return nil, fmt.Errorf("cycles must be positive")
+	}
+	if s.running {
+		return nil, errRunning
+	}
+
+	if p.Until != nil {
+		until, err := s.resolve(*p.Until)
+		if err != nil {
+			return nil, err
+		}
+		if !s.hasBreakpoint(until) {
+			s.d.AddBreakpoint(until)
+			s.tempBreakpoints[until] = true
+		}
+	}
+
+	stop := s.d.RunFor(p.Cycles)
+	if stop.Reason == debugger.STOP_BREAKPOINT && s.tempBreakpoints[stop.PC] {
+		stop.Reason = debugger.STOP_TARGET
+		stop.Breakpoint = nil
+	}
+	s.stopped(stop)
+
+	result := stopResult{stop.ReasonName(), stop.PC, stop.Instructions, stop.Cycles, stop.String()}
+	return map[string]interface{}{"stop": result, "state": s.state()}, nil
+}
+
+func traceClearMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	s.trace.Reset()
+	return nil, nil
+}
@@ -0,0 +1,303 @@
+package remote
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	debugger "izzudinhafiz.com/go-6502/debugger"
+)
+
+// A method runs with the session locked
+type method func(s *Session, params json.RawMessage) (interface{}, error)
+
+var errRunning = errors.New("the CPU is running, pause it first")
+
+// Methods available to clients, by name
+var methods = map[string]method{
+	"state":             stateMethod,
+	"step":              stepMethod((*debugger.Debugger6502).Step),
+	"stepOver":          stepMethod((*debugger.Debugger6502).StepOver),
+	"stepOut":           stepMethod((*debugger.Debugger6502).StepOut),
+	"continue":          continueMethod,
+	"pause":             pauseMethod,
+	"runTo":             runToMethod,
+	"reset":             resetMethod,
+	"breakpoint.set":    breakpointSetMethod,
+	"breakpoint.remove": breakpointRemoveMethod,
+	"watch.add":         watchAddMethod,
+	"watch.remove":      watchRemoveMethod,
+	"memory.read":       memoryReadMethod,
+	"disassemble":       disassembleMethod,
+	"trace":             traceMethod,
+	"eval":              evalMethod,
+	"load":              loadMethod,
+	"registers.set":     registersSetMethod,
+	"memory.write":      memoryWriteMethod,
+	"run":               runMethod,
+	"trace.clear":       traceClearMethod,
+}
+
+// paramsError reports params that could not be decoded
+type paramsError struct {
+	err error
+}
+
+func (e *paramsError) Error() string {
+	return "bad params: " + e.err.Error()
+}
+
+func decode(params json.RawMessage, v interface{}) error {
+	if err := json.Unmarshal(params, v); err != nil {
+		return &paramsError{err}
+	}
+	return nil
+}
+
+func stateMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	return s.state(), nil
+}
+
+func stepMethod(step func(d *debugger.Debugger6502) debugger.Stop) method {
+	return func(s *Session, params json.RawMessage) (interface{}, error) {
+		if s.running {
+			return nil, errRunning
+		}
+		s.stopped(step(s.d))
+		return s.state(), nil
+	}
+}
+
+func continueMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	s.startRunning()
+	return s.state(), nil
+}
+
+func pauseMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	if s.running {
+		s.stopped(debugger.Stop{Reason: debugger.STOP_PAUSED, PC: s.c.Registers.PC})
+		s.status = fmt.Sprintf("paused at $%04X", s.c.Registers.PC)
+	}
+	return s.state(), nil
+}
+
+func runToMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Addr Address `json:"addr"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	addr, err := s.resolve(p.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if s.running {
+		return nil, errRunning
+	}
+
+	if !s.hasBreakpoint(addr) {
+		s.d.AddBreakpoint(addr)
+		s.tempBreakpoints[addr] = true
+	}
+	s.startRunning()
+	return s.state(), nil
+}
+
+func resetMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	s.stopped(debugger.Stop{Reason: debugger.STOP_PAUSED, PC: s.c.Registers.PC})
+	s.c.Reset()
+	s.d.Calls.Reset()
+	s.trace.Reset()
+	s.status = "reset"
+	return s.state(), nil
+}
+
+func breakpointSetMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Addr      Address `json:"addr"`
+		Condition string  `json:"condition"`
+		Enabled   *bool   `json:"enabled"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	addr, err := s.resolve(p.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	bp := s.d.AddBreakpoint(addr)
+	delete(s.tempBreakpoints, addr)
+	if err := bp.SetCondition(p.Condition); err != nil {
+		return nil, err
+	}
+	if p.Enabled != nil {
+		bp.Enabled = *p.Enabled
+	}
+	return s.state(), nil
+}
+
+func breakpointRemoveMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Addr Address `json:"addr"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	addr, err := s.resolve(p.Addr)
+	if err != nil {
+		return nil, err
+	}
+	s.d.RemoveBreakpoint(addr)
+	delete(s.tempBreakpoints, addr)
+	return s.state(), nil
+}
+
+func watchAddMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Expr string `json:"expr"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	if _, err := s.d.AddWatch(p.Expr); err != nil {
+		return nil, err
+	}
+	return s.state(), nil
+}
+
+func watchRemoveMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Expr string `json:"expr"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	for _, w := range s.d.Watches {
+		if w.Expr.String() == p.Expr {
+			s.d.RemoveWatch(w)
+			break
+		}
+	}
+	return s.state(), nil
+}
+
+func memoryReadMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Addr   Address `json:"addr"`
+		Length int     `json:"length"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	addr, err := s.resolve(p.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if p.Length < 0 || p.Length > 0x10000 {
+		return nil, fmt.Errorf("length must be between 0 and 65536")
+	}
+
+	data := s.d.ReadMemory(addr, p.Length)
+	values := make([]int, len(data))
+	for i, b := range data {
+		values[i] = int(b)
+	}
+	return map[string]interface{}{"addr": addr, "data": values}, nil
+}
+
+type instructionResult struct {
+	Addr  uint16 `json:"addr"`
+	Bytes []int  `json:"bytes"`
+	Text  string `json:"text"`
+	Label string `json:"label,omitempty"`
+}
+
+func disassembleMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Addr   Address `json:"addr"`
+		Count  int     `json:"count"`
+		Before int     `json:"before"` // Instructions to show before addr
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	addr, err := s.resolve(p.Addr)
+	if err != nil {
+		return nil, err
+	}
+	if p.Before > 0 {
+		addr = s.d.DisassemblyStart(addr, p.Before)
+	}
+	if p.Count <= 0 || p.Count > 1000 {
+		return nil, fmt.Errorf("count must be between 1 and 1000")
+	}
+
+	lines := make([]instructionResult, p.Count)
+	for i := range lines {
+		ins := s.d.Disassemble(addr)
+		bytes := make([]int, len(ins.Bytes))
+		for j, b := range ins.Bytes {
+			bytes[j] = int(b)
+		}
+		label, _ := s.d.Symbols.Name(addr)
+		lines[i] = instructionResult{addr, bytes, ins.Text, label}
+		addr += uint16(len(ins.Bytes))
+	}
+	return lines, nil
+}
+
+type traceResult struct {
+	N     int    `json:"n"`
+	PC    uint16 `json:"pc"`
+	Op    string `json:"op"`
+	A     byte   `json:"a"`
+	X     byte   `json:"x"`
+	Y     byte   `json:"y"`
+	SP    byte   `json:"sp"`
+	Cycle int    `json:"cycle"`
+}
+
+func traceMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Count int  `json:"count"`
+		From  *int `json:"from"` // First instruction number wanted, else the most recent count
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+
+	traces := s.trace.Traces()
+	if p.From != nil {
+		first := 0
+		for first < len(traces) && traces[first].NumOperations < *p.From {
+			first += 1
+		}
+		traces = traces[first:]
+		if p.Count > 0 && p.Count < len(traces) {
+			traces = traces[:p.Count]
+		}
+	} else if p.Count > 0 && p.Count < len(traces) {
+		traces = traces[len(traces)-p.Count:]
+	}
+	results := make([]traceResult, len(traces))
+	for i, t := range traces {
+		results[i] = traceResult{t.NumOperations, t.PC, t.Op, t.Registers.A, t.Registers.X, t.Registers.Y, t.Registers.SP, t.Clock}
+	}
+	return results, nil
+}
+
+func evalMethod(s *Session, params json.RawMessage) (interface{}, error) {
+	var p struct {
+		Expr string `json:"expr"`
+	}
+	if err := decode(params, &p); err != nil {
+		return nil, err
+	}
+	value, err := s.d.Evaluate(p.Expr)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]int{"value": value}, nil
+}
@@ -0,0 +1,131 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// JSON-RPC 2.0 error codes
+const (
+	RPC_PARSE_ERROR      = -32700
+	RPC_INVALID_REQUEST  = -32600
+	RPC_METHOD_NOT_FOUND = -32601
+	RPC_INVALID_PARAMS   = -32602
+	RPC_SERVER_ERROR     = -32000
+)
+
+type rpcRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// serveRPC answers JSON-RPC 2.0 calls, single or batched, POSTed to /rpc.
+// Requests without an id are notifications and get no response. Requiring
+// the JSON content type keeps other web pages from posting calls with a
+// plain form, which browsers send without asking the server first.
+func (s *Session) serveRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "JSON-RPC requests must be POSTed", http.StatusMethodNotAllowed)
+		return
+	}
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		http.Error(w, "JSON-RPC requests must be sent as application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+	if !s.checkAccess(w, r) {
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, WS_MAX_MESSAGE*16))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var result interface{}
+	body = bytes.TrimSpace(body)
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil || len(batch) == 0 {
+			result = rpcFailure(nil, RPC_INVALID_REQUEST, "invalid batch")
+		} else {
+			responses := []rpcResponse{}
+			for _, message := range batch {
+				if resp, ok := s.handleRPC(message); ok {
+					responses = append(responses, resp)
+				}
+			}
+			if len(responses) > 0 {
+				result = responses
+			}
+		}
+	} else if resp, ok := s.handleRPC(body); ok {
+		result = resp
+	}
+
+	if result == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleRPC runs one call, reporting false for notifications
+func (s *Session) handleRPC(message json.RawMessage) (rpcResponse, bool) {
+	var req rpcRequest
+	if err := json.Unmarshal(message, &req); err != nil {
+		var syntax *json.SyntaxError
+		if errors.As(err, &syntax) {
+			return rpcFailure(nil, RPC_PARSE_ERROR, err.Error()), true
+		}
+		return rpcFailure(nil, RPC_INVALID_REQUEST, err.Error()), true
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return rpcFailure(req.ID, RPC_INVALID_REQUEST, "expected a JSON-RPC 2.0 request"), true
+	}
+
+	if _, exists := methods[req.Method]; !exists {
+		return rpcFailure(req.ID, RPC_METHOD_NOT_FOUND, "unknown method "+req.Method), req.ID != nil
+	}
+
+	result, err := s.Call(req.Method, req.Params)
+	if req.ID == nil {
+		return rpcResponse{}, false
+	}
+	if err != nil {
+		code := RPC_SERVER_ERROR
+		var params *paramsError
+		if errors.As(err, &params) {
+			code = RPC_INVALID_PARAMS
+		}
+		return rpcFailure(req.ID, code, err.Error()), true
+	}
+	return rpcResponse{JSONRPC: "2.0", ID: req.ID, Result: result}, true
+}
+
+func rpcFailure(id json.RawMessage, code int, message string) rpcResponse {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return rpcResponse{JSONRPC: "2.0", ID: id, Error: &rpcError{code, message}}
+}
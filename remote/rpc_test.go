@@ -0,0 +1,91 @@
+package remote
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+	debugger "izzudinhafiz.com/go-6502/debugger"
+)
+
+const testRPCCall = `{"jsonrpc": "2.0", "id": 1, "method": "state"}`
+
+// postRPC posts a call and returns the response status
+func postRPC(t *testing.T, url string, header http.Header) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(testRPCCall))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = header
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestRPCRejections(t *testing.T) {
+	server := newTestServer(t, func(s *Session) { s.Token = "secret" })
+	jsonType := "application/json"
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"allowed", http.Header{"Content-Type": {jsonType}, "Authorization": {"Bearer secret"}}, http.StatusOK},
+		{"with a charset", http.Header{"Content-Type": {jsonType + "; charset=utf-8"}, "Authorization": {"Bearer secret"}}, http.StatusOK},
+		{"no content type", http.Header{"Authorization": {"Bearer secret"}}, http.StatusUnsupportedMediaType},
+		{"form", http.Header{"Content-Type": {"text/plain"}, "Authorization": {"Bearer secret"}}, http.StatusUnsupportedMediaType},
+		{"other origin", http.Header{"Content-Type": {jsonType}, "Authorization": {"Bearer secret"}, "Origin": {"http://evil.example"}}, http.StatusForbidden},
+		{"no token", http.Header{"Content-Type": {jsonType}}, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := postRPC(t, server.URL+"/rpc", tt.header); got != tt.status {
+			t.Errorf("%v: status %d, want %d", tt.name, got, tt.status)
+		}
+	}
+}
+
+func TestLoadPath(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "prog.bin"), []byte{0xEA}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	outside := filepath.Join(t.TempDir(), "secret.bin")
+	if err := os.WriteFile(outside, []byte{0x00}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dir, "link.bin")); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func(s *Session, path string) error {
+		params, _ := json.Marshal(map[string]interface{}{"path": path, "format": "raw", "addr": 0x0200})
+		_, err := s.Call("load", params)
+		return err
+	}
+
+	s := NewSession(debugger.New(cpu.New()))
+	if err := load(s, filepath.Join(dir, "prog.bin")); err == nil {
+		t.Errorf("loaded a file without a load directory")
+	}
+
+	s.LoadDir = dir
+	if err := load(s, "prog.bin"); err != nil {
+		t.Errorf("loading from the load directory: %v", err)
+	} else if s.c.Memory[0x0200] != 0xEA {
+		t.Errorf("load wrote $%02X", s.c.Memory[0x0200])
+	}
+	for _, path := range []string{outside, "../" + filepath.Base(filepath.Dir(outside)) + "/secret.bin", "link.bin"} {
+		if err := load(s, path); err == nil {
+			t.Errorf("loaded %v from outside the load directory", path)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package remote
+
+import (
+	"embed"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+)
+
+//go:embed static
+var static embed.FS
+
+// request is a call from a client
+type request struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params,omitempty"`
+}
+
+// response answers a request
+type response struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Result interface{}     `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// event is pushed to WebSocket clients whenever the session changes
+type event struct {
+	Event string      `json:"event"`
+	Data  interface{} `json:"data"`
+}
+
+// Handler serves the browser UI at /, its WebSocket at /ws and JSON-RPC at /rpc.
+// Only the UI's static files are served without the access checks.
+func (s *Session) Handler() http.Handler {
+	mux := http.NewServeMux()
+	files, _ := fs.Sub(static, "static")
+	mux.Handle("/", http.FileServer(http.FS(files)))
+	mux.HandleFunc("/ws", s.serveWebSocket)
+	mux.HandleFunc("/rpc", s.serveRPC)
+	return mux
+}
+
+func (s *Session) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.checkAccess(w, r) {
+		return
+	}
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer ws.Close()
+
+	changes := s.subscribe()
+	defer s.unsubscribe(changes)
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-changes:
+				s.mu.Lock()
+				st := s.state()
+				s.mu.Unlock()
+				if err := ws.writeJSON(event{"state", st}); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	// The initial state, sent through the same path as every later change
+	changes <- struct{}{}
+
+	for {
+		opcode, message, err := ws.ReadMessage()
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("websocket %v: %v", r.RemoteAddr, err)
+			}
+			return
+		}
+		if opcode != WS_TEXT {
+			continue
+		}
+
+		if err := ws.writeJSON(s.handleRequest(message)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Session) handleRequest(message []byte) response {
+	var req request
+	if err := json.Unmarshal(message, &req); err != nil {
+		return response{Error: "bad request: " + err.Error()}
+	}
+
+	result, err := s.Call(req.Method, req.Params)
+	if err != nil {
+		return response{ID: req.ID, Error: err.Error()}
+	}
+	return response{ID: req.ID, Result: result}
+}
+
+func (ws *wsConn) writeJSON(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ws.WriteMessage(WS_TEXT, data)
+}
@@ -0,0 +1,129 @@
+package remote
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+	debugger "izzudinhafiz.com/go-6502/debugger"
+)
+
+func newTestServer(t *testing.T, configure func(s *Session)) *httptest.Server {
+	t.Helper()
+	s := NewSession(debugger.New(cpu.New()))
+	if configure != nil {
+		configure(s)
+	}
+	server := httptest.NewServer(s.Handler())
+	t.Cleanup(server.Close)
+	return server
+}
+
+// dialWebSocket sends an opening handshake and returns the response status
+func dialWebSocket(t *testing.T, server *httptest.Server, path string, header http.Header) int {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, server.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", "dGhlIHNhbXBsZSBub25jZQ==")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if host := header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	resp, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	server := newTestServer(t, nil)
+
+	tests := []struct {
+		origin string
+		status int
+	}{
+		{"", http.StatusSwitchingProtocols},
+		{server.URL, http.StatusSwitchingProtocols},
+		{"http://evil.example", http.StatusForbidden},
+		{"null", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		header := http.Header{}
+		if tt.origin != "" {
+			header.Set("Origin", tt.origin)
+		}
+		if got := dialWebSocket(t, server, "/ws", header); got != tt.status {
+			t.Errorf("origin %q: status %d, want %d", tt.origin, got, tt.status)
+		}
+	}
+
+	allowing := newTestServer(t, func(s *Session) { s.AllowOrigins = []string{"http://tools.example"} })
+	header := http.Header{"Origin": {"http://tools.example"}}
+	if got := dialWebSocket(t, allowing, "/ws", header); got != http.StatusSwitchingProtocols {
+		t.Errorf("allowed origin: status %d", got)
+	}
+	header.Set("Origin", "http://evil.example")
+	if got := dialWebSocket(t, allowing, "/ws", header); got != http.StatusForbidden {
+		t.Errorf("other origin with an allow list: status %d", got)
+	}
+}
+
+// A page on another name that resolves to this host is not trusted just
+// because its Origin matches the Host it asked for
+func TestWebSocketRebinding(t *testing.T) {
+	server := newTestServer(t, nil)
+	header := http.Header{"Host": {"evil.example:6502"}, "Origin": {"http://evil.example:6502"}}
+	if got := dialWebSocket(t, server, "/ws", header); got != http.StatusForbidden {
+		t.Errorf("rebound host: status %d, want %d", got, http.StatusForbidden)
+	}
+	header = http.Header{"Host": {"localhost:6502"}, "Origin": {"http://localhost:6502"}}
+	if got := dialWebSocket(t, server, "/ws", header); got != http.StatusSwitchingProtocols {
+		t.Errorf("localhost: status %d, want %d", got, http.StatusSwitchingProtocols)
+	}
+
+	listening := newTestServer(t, func(s *Session) { s.Hosts = []string{"debugger.lan"} })
+	header = http.Header{"Host": {"debugger.lan:6502"}, "Origin": {"http://debugger.lan:6502"}}
+	if got := dialWebSocket(t, listening, "/ws", header); got != http.StatusSwitchingProtocols {
+		t.Errorf("listen host: status %d, want %d", got, http.StatusSwitchingProtocols)
+	}
+}
+
+func TestWebSocketToken(t *testing.T) {
+	server := newTestServer(t, func(s *Session) { s.Token = "secret" })
+
+	tests := []struct {
+		path   string
+		header http.Header
+		status int
+	}{
+		{"/ws", nil, http.StatusUnauthorized},
+		{"/ws?token=wrong", nil, http.StatusUnauthorized},
+		{"/ws?token=secret", nil, http.StatusSwitchingProtocols},
+		{"/ws", http.Header{"Authorization": {"Bearer secret"}}, http.StatusSwitchingProtocols},
+	}
+	for _, tt := range tests {
+		if got := dialWebSocket(t, server, tt.path, tt.header); got != tt.status {
+			t.Errorf("%v %v: status %d, want %d", tt.path, tt.header, got, tt.status)
+		}
+	}
+
+	// The UI's files are served to anyone, it reads the token from its own URL
+	resp, err := server.Client().Get(server.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("UI status %d without a token", resp.StatusCode)
+	}
+}
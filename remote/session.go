@@ -0,0 +1,283 @@
+// Package remote exposes a debugging session over the network: a browser UI
+// talking to the session over a WebSocket, and a JSON-RPC 2.0 endpoint for
+// scripts and test orchestration in other languages. Both share one set of
+// methods, listed in the methods map.
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+	debugger "izzudinhafiz.com/go-6502/debugger"
+)
+
+const (
+	TRACE_SIZE = 1024
+
+	// Cycles run while holding the session lock, between checks for requests
+	RUN_SLICE = 20000
+
+	// Minimum time between state updates pushed to clients while running
+	NOTIFY_INTERVAL = 100 * time.Millisecond
+)
+
+// Session owns a debugger and serialises access to it, so any number of
+// clients can inspect and control the same running CPU
+type Session struct {
+	AllowOrigins []string // Origins of other web pages that may connect, "*" for any
+	Token        string   // When set, clients must present it, see checkAccess
+	Hosts        []string // Host names besides loopback ones that pages served here are reached by
+	LoadDir      string   // Directory the load method may read files from, files cannot be loaded when empty
+
+	mu      sync.Mutex
+	d       *debugger.Debugger6502
+	c       *cpu.Cpu6502
+	trace   *debugger.RingBuffer
+	running bool
+	status  string
+
+	tempBreakpoints map[uint16]bool // Set by runTo, removed when execution stops
+
+	listenMu   sync.Mutex
+	listeners  map[chan struct{}]bool
+	lastNotify time.Time
+}
+
+func NewSession(d *debugger.Debugger6502) *Session {
+	s := &Session{
+		d:         d,
+		c:         d.CPU(),
+		trace:     debugger.NewRingBuffer(TRACE_SIZE),
+		status:    "stopped",
+		listeners: map[chan struct{}]bool{},
+
+		tempBreakpoints: map[uint16]bool{},
+	}
+	d.AddSink(s.trace)
+	return s
+}
+
+// Call runs a method by name with JSON encoded params
+func (s *Session) Call(method string, params json.RawMessage) (interface{}, error) {
+	m, exists := methods[method]
+	if !exists {
+		return nil, fmt.Errorf("unknown method %q", method)
+	}
+	if len(params) == 0 {
+		params = json.RawMessage("{}")
+	}
+
+	s.mu.Lock()
+	result, err := m(s, params)
+	s.mu.Unlock()
+
+	s.notify(true)
+	return result, err
+}
+
+// subscribe returns a channel that receives a value whenever the state changes
+func (s *Session) subscribe() chan struct{} {
+	ch := make(chan struct{}, 1)
+	s.listenMu.Lock()
+	s.listeners[ch] = true
+	s.listenMu.Unlock()
+	return ch
+}
+
+func (s *Session) unsubscribe(ch chan struct{}) {
+	s.listenMu.Lock()
+	delete(s.listeners, ch)
+	s.listenMu.Unlock()
+}
+
+// notify wakes the listeners, at most once per NOTIFY_INTERVAL unless forced
+func (s *Session) notify(force bool) {
+	s.listenMu.Lock()
+	defer s.listenMu.Unlock()
+	if !force && time.Since(s.lastNotify) < NOTIFY_INTERVAL {
+		return
+	}
+	s.lastNotify = time.Now()
+	for ch := range s.listeners {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// startRunning runs the CPU in the background until a breakpoint or pause
+func (s *Session) startRunning() {
+	if s.running {
+		return
+	}
+	// Step off a breakpoint first, the slices would stop on it straight away
+	if stop := s.d.Step(); stop.Reason != debugger.STOP_STEP {
+		s.stopped(stop)
+		return
+	}
+	if bp := s.d.CheckBreakpoint(); bp != nil {
+		s.stopped(debugger.Stop{Reason: debugger.STOP_BREAKPOINT, PC: s.c.Registers.PC, Instructions: 1, Breakpoint: bp})
+		return
+	}
+	s.running = true
+	s.status = "running"
+	go s.run()
+}
+
+func (s *Session) run() {
+	for {
+		s.mu.Lock()
+		if !s.running {
+			s.mu.Unlock()
+			s.notify(true)
+			return
+		}
+
+		stop := s.d.RunFor(RUN_SLICE)
+		if stop.Reason != debugger.STOP_CYCLES {
+			s.stopped(stop)
+		} else if bp := s.d.CheckBreakpoint(); bp != nil {
+			s.stopped(debugger.Stop{Reason: debugger.STOP_BREAKPOINT, PC: s.c.Registers.PC, Breakpoint: bp})
+		}
+		s.mu.Unlock()
+		s.notify(false)
+	}
+}
+
+func (s *Session) stopped(stop debugger.Stop) {
+	s.running = false
+	s.status = stop.String()
+	for addr := range s.tempBreakpoints {
+		s.d.RemoveBreakpoint(addr)
+		delete(s.tempBreakpoints, addr)
+	}
+}
+
+func (s *Session) hasBreakpoint(addr uint16) bool {
+	for _, bp := range s.d.Breakpoints() {
+		if bp.Addr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// State is a snapshot of the session pushed to clients
+type State struct {
+	Running      bool              `json:"running"`
+	Status       string            `json:"status"`
+	PC           uint16            `json:"pc"`
+	A            byte              `json:"a"`
+	X            byte              `json:"x"`
+	Y            byte              `json:"y"`
+	SP           byte              `json:"sp"`
+	P            byte              `json:"p"`
+	Cycle        int               `json:"cycle"`
+	Instructions int               `json:"instructions"`
+	Breakpoints  []BreakpointState `json:"breakpoints"`
+	Calls        []FrameState      `json:"calls"`
+	Watches      []WatchState      `json:"watches"`
+}
+
+type BreakpointState struct {
+	Addr      uint16 `json:"addr"`
+	Enabled   bool   `json:"enabled"`
+	Condition string `json:"condition,omitempty"`
+	Hits      int    `json:"hits"`
+}
+
+type FrameState struct {
+	Kind   string `json:"kind"`
+	Caller uint16 `json:"caller"`
+	Target uint16 `json:"target"`
+	Label  string `json:"label"`
+}
+
+type WatchState struct {
+	Expr  string `json:"expr"`
+	Value int    `json:"value"`
+	Error string `json:"error,omitempty"`
+}
+
+var frameKinds = [...]string{"JSR", "IRQ", "NMI", "BRK"}
+
+// state must be called with the session locked
+func (s *Session) state() State {
+	c := s.c
+	f := c.Flags
+	st := State{
+		Running:      s.running,
+		Status:       s.status,
+		PC:           c.Registers.PC,
+		A:            c.Registers.A,
+		X:            c.Registers.X,
+		Y:            c.Registers.Y,
+		SP:           c.Registers.SP,
+		P:            f.C | f.Z<<1 | f.I<<2 | f.D<<3 | f.B<<4 | 1<<5 | f.V<<6 | f.N<<7,
+		Cycle:        c.Tick,
+		Instructions: s.d.NumOperations,
+		Breakpoints:  []BreakpointState{},
+		Calls:        []FrameState{},
+		Watches:      []WatchState{},
+	}
+
+	for _, bp := range s.d.Breakpoints() {
+		b := BreakpointState{Addr: bp.Addr, Enabled: bp.Enabled, Hits: bp.Hits}
+		if bp.Condition != nil {
+			b.Condition = bp.Condition.String()
+		}
+		st.Breakpoints = append(st.Breakpoints, b)
+	}
+	for _, frame := range s.d.Calls.Frames {
+		st.Calls = append(st.Calls, FrameState{frameKinds[frame.Kind], frame.Caller, frame.Target, s.d.Symbols.Format(frame.Target)})
+	}
+	for _, w := range s.d.Watches {
+		ws := WatchState{Expr: w.Expr.String(), Value: w.Value}
+		if w.Err != nil {
+			ws.Error = w.Err.Error()
+		}
+		st.Watches = append(st.Watches, ws)
+	}
+	return st
+}
+
+// Address is a method parameter holding an address, given either as a JSON
+// number or as a debugger expression string such as "$0200" or "w[$FFFC]"
+type Address struct {
+	raw json.RawMessage
+}
+
+func (a *Address) UnmarshalJSON(data []byte) error {
+	a.raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// resolve must be called with the session locked
+func (s *Session) resolve(a Address) (uint16, error) {
+	if len(a.raw) == 0 {
+		return 0, fmt.Errorf("missing address")
+	}
+
+	var text string
+	if a.raw[0] == '"' {
+		if err := json.Unmarshal(a.raw, &text); err != nil {
+			return 0, err
+		}
+		value, err := s.d.Evaluate(text)
+		if err != nil {
+			return 0, err
+		}
+		return uint16(value), nil
+	}
+
+	value, err := strconv.ParseInt(string(a.raw), 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("bad address %v", string(a.raw))
+	}
+	return uint16(value), nil
+}
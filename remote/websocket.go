@@ -0,0 +1,206 @@
+package remote
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// WebSocket opcodes, RFC 6455 section 5.2
+const (
+	WS_CONTINUATION byte = 0x0
+	WS_TEXT         byte = 0x1
+	WS_BINARY       byte = 0x2
+	WS_CLOSE        byte = 0x8
+	WS_PING         byte = 0x9
+	WS_PONG         byte = 0xA
+)
+
+const (
+	wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	// Largest message accepted from a client
+	WS_MAX_MESSAGE = 1 << 20
+)
+
+var errMessageTooBig = errors.New("websocket: message too big")
+
+// wsConn is the server side of a WebSocket connection
+type wsConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	writeMu sync.Mutex
+}
+
+// upgradeWebSocket performs the opening handshake on an HTTP request
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return nil, errors.New("websocket: not an upgrade request")
+	}
+	if r.Header.Get("Sec-Websocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: unsupported version")
+	}
+	key := r.Header.Get("Sec-Websocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("websocket: missing key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "connection cannot be upgraded", http.StatusInternalServerError)
+		return nil, errors.New("websocket: response does not support hijacking")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha1.Sum([]byte(key + wsGUID))
+	accept := base64.StdEncoding.EncodeToString(sum[:])
+	rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: " + accept + "\r\n\r\n")
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+func headerContains(h http.Header, name string, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message, answering pings and
+// joining fragments along the way. A close frame is answered and reported as io.EOF.
+func (ws *wsConn) ReadMessage() (byte, []byte, error) {
+	var message []byte
+	var messageType byte
+	for {
+		fin, opcode, payload, err := ws.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch opcode {
+		case WS_PING:
+			if err := ws.writeFrame(WS_PONG, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case WS_PONG:
+			continue
+		case WS_CLOSE:
+			ws.writeFrame(WS_CLOSE, payload)
+			return 0, nil, io.EOF
+		case WS_TEXT, WS_BINARY:
+			messageType = opcode
+			message = payload
+		case WS_CONTINUATION:
+			if messageType == 0 {
+				return 0, nil, errors.New("websocket: continuation without a message")
+			}
+			if len(message)+len(payload) > WS_MAX_MESSAGE {
+				return 0, nil, errMessageTooBig
+			}
+			message = append(message, payload...)
+		default:
+			return 0, nil, errors.New("websocket: unknown opcode")
+		}
+
+		if fin {
+			return messageType, message, nil
+		}
+	}
+}
+
+func (ws *wsConn) readFrame() (bool, byte, []byte, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(ws.r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin := header[0]&0x80 != 0
+	opcode := header[0] & 0x0F
+	masked := header[1]&0x80 != 0
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(ws.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > WS_MAX_MESSAGE {
+		return false, 0, nil, errMessageTooBig
+	}
+	if !masked {
+		return false, 0, nil, errors.New("websocket: client frames must be masked")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.r, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(ws.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteMessage sends payload as a single unfragmented frame, it is safe for concurrent use
+func (ws *wsConn) WriteMessage(opcode byte, payload []byte) error {
+	return ws.writeFrame(opcode, payload)
+}
+
+func (ws *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch {
+	case len(payload) < 126:
+		header = append(header, byte(len(payload)))
+	case len(payload) <= 0xFFFF:
+		header = append(header, 126, byte(len(payload)>>8), byte(len(payload)))
+	default:
+		var ext [8]byte
+		binary.BigEndian.PutUint64(ext[:], uint64(len(payload)))
+		header = append(append(header, 127), ext[:]...)
+	}
+
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	if _, err := ws.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (ws *wsConn) Close() error {
+	return ws.conn.Close()
+}
@@ -0,0 +1,507 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+	debugger "izzudinhafiz.com/go-6502/debugger"
+	loader "izzudinhafiz.com/go-6502/loader"
+	machine "izzudinhafiz.com/go-6502/machine"
+	nes "izzudinhafiz.com/go-6502/nes"
+	tracefile "izzudinhafiz.com/go-6502/tracefile"
+)
+
+// Trace output formats
+var traceFormats = []string{"text", "nestest", "binary"}
+
+// programFlags are the flags shared by every command that loads an image
+type programFlags struct {
+	machine string
+	addr    string
+	start   string
+	as      string
+	variant string
+	symbols string
+}
+
+func addProgramFlags(flags *flag.FlagSet) *programFlags {
+	p := &programFlags{}
+	flags.StringVar(&p.machine, "machine", "", "machine config file, plain 64K of RAM when empty")
+	flags.StringVar(&p.addr, "addr", "0", "load address for raw images")
+	flags.StringVar(&p.start, "start", "", "start address, else the image's own, else the reset vector")
+	flags.StringVar(&p.as, "as", "auto", "image format: auto, raw, ihex, srec, prg, o65 or nes")
+	flags.StringVar(&p.variant, "variant", "", "CPU variant: nmos, 2a03 or 65c02, else the machine's, else nmos")
+	flags.StringVar(&p.symbols, "symbols", "", "label file to load")
+	return p
+}
+
+// image returns the image argument, which may be left out when a machine
+// config provides the program in ROM
+func (p *programFlags) image(flags *flag.FlagSet, usage string) (string, error) {
+	if flags.NArg() == 1 {
+		return flags.Arg(0), nil
+	}
+	if flags.NArg() == 0 && p.machine != "" {
+		return "", nil
+	}
+	return "", usageError(usage)
+}
+
+// load builds the machine, or a CPU with plain memory, and loads the image
+// into it with a debugger attached. Raw images are placed at -addr, and
+// execution starts at -start when given, else at the image's own start
+// address, else at the reset vector, and an image with none of these on
+// plain memory is refused. NES cartridges replace the memory with
+// the cartridge's mapper and run in 2A03 mode, and return no image.
+func (p *programFlags) load(path string) (*debugger.Debugger6502, *loader.Image, error) {
+	c, err := p.newCPU()
+	if err != nil {
+		return nil, nil, err
+	}
+	m := machineOf(c)
+
+	var img *loader.Image
+	if path != "" && p.isCartridge(path) {
+		if m != nil {
+			return nil, nil, usageError("-machine cannot be used with an NES cartridge")
+		}
+		if _, err := nes.LoadFile(c, path); err != nil {
+			return nil, nil, err
+		}
+	} else if path != "" {
+		loadAddr, err := parseNumber(p.addr)
+		if err != nil {
+			return nil, nil, err
+		}
+		format, err := loader.ParseFormat(p.as)
+		if err != nil {
+			return nil, nil, err
+		}
+		if img, err = loader.LoadFile(path, loader.Options{Format: format, Addr: int(loadAddr)}); err != nil {
+			return nil, nil, err
+		}
+		// Plain memory has no reset vector of its own to fall back on
+		if m == nil && p.start == "" && !img.HasStart && !(img.Contains(0xFFFC) && img.Contains(0xFFFD)) {
+			return nil, nil, usageError("%v has no start address or reset vector, give -start", path)
+		}
+
+		if m != nil {
+			err = m.Load(img)
+		} else {
+			err = img.LoadInto(c)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if m != nil {
+			m.Reset()
+		} else {
+			c.Reset()
+		}
+	}
+
+	if p.start != "" {
+		pc, err := parseNumber(p.start)
+		if err != nil || pc > 0xFFFF {
+			return nil, nil, usageError("bad -start %q", p.start)
+		}
+		c.Registers.PC = uint16(pc)
+	} else if img != nil && img.HasStart {
+		c.Registers.PC = uint16(img.Start)
+	}
+
+	d := debugger.New(c)
+	if m != nil {
+		for _, path := range m.Symbols {
+			if err := loadSymbols(d, path); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	if err := loadSymbols(d, p.symbols); err != nil {
+		return nil, nil, err
+	}
+	return d, img, nil
+}
+
+// isCartridge reports whether path is an NES cartridge, by -as or, when it
+// is auto, by extension or header
+func (p *programFlags) isCartridge(path string) bool {
+	if p.as != "" && !strings.EqualFold(p.as, "auto") {
+		return strings.EqualFold(p.as, "nes")
+	}
+	if strings.EqualFold(filepath.Ext(path), ".nes") {
+		return true
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, 4)
+	n, _ := io.ReadFull(f, head)
+	return nes.IsINES(head[:n])
+}
+
+// newCPU builds the machine from -machine, else a bare CPU of -variant
+func (p *programFlags) newCPU() (*cpu.Cpu6502, error) {
+	if p.machine != "" {
+		cfg, err := machine.LoadConfig(p.machine)
+		if err != nil {
+			return nil, err
+		}
+		if p.variant != "" {
+			cfg.CPU.Variant = p.variant
+		}
+		m, err := machine.New(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %w", p.machine, err)
+		}
+		return m.CPU, nil
+	}
+
+	variant, err := cpu.ParseVariant(p.variant)
+	if err != nil {
+		return nil, err
+	}
+	c := cpu.New()
+	c.Variant = variant
+	return c, nil
+}
+
+// machineOf returns the machine a CPU was built into, or nil for a bare CPU
+func machineOf(c *cpu.Cpu6502) *machine.Machine {
+	if bus, ok := c.Bus.(*machine.Bus); ok {
+		return bus.Machine()
+	}
+	return nil
+}
+
+// closeMachine returns a function that closes the host connections of the
+// machine the CPU belongs to, if any, such as a terminal put in raw mode for
+// a serial port. Interrupting the emulator closes them too.
+func closeMachine(c *cpu.Cpu6502) func() {
+	m := machineOf(c)
+	if m == nil {
+		return func() {}
+	}
+
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	go func() {
+		if _, ok := <-interrupts; ok {
+			m.Close()
+			os.Exit(130)
+		}
+	}()
+	return func() {
+		signal.Stop(interrupts)
+		close(interrupts)
+		m.Close()
+	}
+}
+
+// address evaluates a command line address, which may use the loaded symbols
+func address(d *debugger.Debugger6502, s string) (uint16, error) {
+	value, err := d.Evaluate(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad address %q: %w", s, err)
+	}
+	return uint16(value), nil
+}
+
+// run [program flags] [-cycles N] [-until ADDR] [-success ADDR] [-trace FILE] [-format F] IMAGE
+func runCommand(args []string) error {
+	return execute("run", args, "")
+}
+
+// trace [program flags] [-cycles N] [-until ADDR] [-success ADDR] [-o FILE] [-format F] IMAGE
+func traceCommand(args []string) error {
+	return execute("trace", args, "-")
+}
+
+// execute runs an image for the run and trace commands, which only differ in
+// where the trace goes by default
+func execute(name string, args []string, defaultTrace string) error {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	program := addProgramFlags(flags)
+	cycles := flags.Int("cycles", 0, "stop after this many cycles, 0 runs until a trap, or forever on machines with devices")
+	until := flags.String("until", "", "stop when PC reaches this address")
+	success := flags.String("success", "", "exit with status 1 unless the run stops at this address")
+	format := flags.String("format", "text", "trace format: text, nestest or binary")
+	compare := flags.String("compare", "", "check the nestest trace against a reference log such as nestest.log")
+	var output *string
+	if name == "trace" {
+		output = flags.String("o", defaultTrace, "trace output file, - for stdout")
+	} else {
+		output = flags.String("trace", defaultTrace, "write a trace to this file, - for stdout")
+	}
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	path, err := program.image(flags, name+" [flags] IMAGE")
+	if err != nil {
+		return err
+	}
+	if !validTraceFormat(*format) {
+		return usageError("-format must be one of %v", traceFormats)
+	}
+	if *compare != "" && *format != "nestest" {
+		return usageError("-compare needs -format nestest")
+	}
+
+	d, _, err := program.load(path)
+	if err != nil {
+		return err
+	}
+	c := d.CPU()
+	defer closeMachine(c)()
+	if *until != "" {
+		addr, err := address(d, *until)
+		if err != nil {
+			return err
+		}
+		d.AddBreakpoint(addr)
+	}
+
+	// The summary goes to stderr when the trace has stdout
+	summary := io.Writer(os.Stdout)
+	var finish func() error
+	var trace bytes.Buffer
+	if *output != "" || *compare != "" {
+		out := io.Discard
+		switch *output {
+		case "":
+		case "-":
+			out = os.Stdout
+			summary = os.Stderr
+		default:
+			f, err := os.Create(*output)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			out = f
+		}
+		if *compare != "" {
+			out = io.MultiWriter(out, &trace)
+		}
+		if finish, err = startTrace(d, out, *format); err != nil {
+			return err
+		}
+	}
+
+	var stop debugger.Stop
+	if m := machineOf(c); m != nil && len(m.Devices) > 0 {
+		// Devices can interrupt a program idling in a loop, so jumping to
+		// itself doesn't end the run
+		stop = d.RunFor(*cycles)
+	} else {
+		stop = d.RunUntilTrap(*cycles)
+	}
+	if finish != nil {
+		if err := finish(); err != nil {
+			return err
+		}
+	}
+
+	r := c.Registers
+	fmt.Fprintln(summary, stop)
+	fmt.Fprintf(summary, "A:%02X X:%02X Y:%02X SP:%02X PC:%04X cycles %d\n", r.A, r.X, r.Y, r.SP, r.PC, c.Tick)
+
+	if *compare != "" {
+		if err := compareNestest(summary, &trace, *compare); err != nil {
+			return err
+		}
+	}
+
+	if stop.Reason == debugger.STOP_UNKNOWN_OPCODE {
+		fmt.Fprint(summary, d.Backtrace())
+		return &exitError{EXIT_ERROR, nil}
+	}
+	if *success != "" {
+		want, err := address(d, *success)
+		if err != nil {
+			return err
+		}
+		stoppedThere := stop.Reason == debugger.STOP_TRAP || stop.Reason == debugger.STOP_BREAKPOINT
+		if !stoppedThere || stop.PC != want {
+			fmt.Fprint(summary, d.Backtrace())
+			return failed("failed: expected to stop at $%04X", want)
+		}
+	}
+	return nil
+}
+
+// compareNestest checks a nestest trace against a reference log. Registers,
+// instruction bytes and cycle counts must match; the disassembly text is not
+// compared because nestest.log annotates some operands differently.
+func compareNestest(summary io.Writer, trace io.Reader, reference string) error {
+	f, err := os.Open(reference)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	divergence, err := debugger.CompareNestest(trace, f, debugger.CompareOptions{Cycles: true, PPU: true, Context: 5})
+	if err != nil {
+		return fmt.Errorf("%v: %w", reference, err)
+	}
+	if divergence != nil {
+		fmt.Fprint(summary, divergence)
+		return failed("trace differs from %v", reference)
+	}
+	fmt.Fprintf(summary, "trace matches %v\n", reference)
+	return nil
+}
+
+func validTraceFormat(format string) bool {
+	for _, f := range traceFormats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// startTrace attaches a writer for format to d. The returned function flushes
+// it once the run is over and reports any write error.
+func startTrace(d *debugger.Debugger6502, out io.Writer, format string) (func() error, error) {
+	switch format {
+	case "nestest":
+		s := &nestestSink{d: d, w: bufio.NewWriter(out)}
+		s.line()
+		d.AddSink(s)
+		return s.flush, nil
+
+	case "binary":
+		bw := bufio.NewWriter(out)
+		w, err := tracefile.NewWriter(bw)
+		if err != nil {
+			return nil, err
+		}
+		recorder := tracefile.NewRecorder(d.CPU(), w)
+		return func() error {
+			if err := recorder.Stop(); err != nil {
+				return err
+			}
+			if err := w.Close(); err != nil {
+				return err
+			}
+			return bw.Flush()
+		}, nil
+	}
+
+	tw := debugger.NewTraceWriter(out)
+	d.AddSink(tw)
+	return tw.Flush, nil
+}
+
+// nestestSink writes a nestest.log line for each instruction before it runs.
+// The state one instruction leaves behind is the state the next one starts
+// from, so each trace prints the line for the following instruction, and the
+// last line is where the run stopped.
+type nestestSink struct {
+	d   *debugger.Debugger6502
+	w   *bufio.Writer
+	err error
+}
+
+func (s *nestestSink) Record(t debugger.Trace) {
+	s.line()
+}
+
+func (s *nestestSink) line() {
+	if s.err != nil {
+		return
+	}
+	_, s.err = fmt.Fprintln(s.w, s.d.NestestLine())
+}
+
+func (s *nestestSink) flush() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.w.Flush()
+}
+
+// disasm [program flags] [-from ADDR] [-to ADDR] [-count N] IMAGE
+func disasmCommand(args []string) error {
+	flags := flag.NewFlagSet("disasm", flag.ContinueOnError)
+	program := addProgramFlags(flags)
+	from := flags.String("from", "", "first address, the start of the image when empty")
+	to := flags.String("to", "", "last address, the end of the image's first segment when empty")
+	count := flags.Int("count", 0, "number of instructions, overrides -to")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+	path, err := program.image(flags, "disasm [flags] IMAGE")
+	if err != nil {
+		return err
+	}
+
+	d, img, err := program.load(path)
+	if err != nil {
+		return err
+	}
+
+	// Without an image, disassemble from PC
+	addr, last := d.CPU().Registers.PC, uint16(0xFFFF)
+	if img != nil {
+		if len(img.Segments) == 0 {
+			return fmt.Errorf("%v: image is empty", path)
+		}
+		first := img.Segments[0]
+		last = uint16(first.Addr + len(first.Data) - 1)
+		if program.start == "" && !img.HasStart {
+			addr = uint16(first.Addr)
+		}
+	} else if *count <= 0 && *to == "" {
+		*count = 32
+	}
+	if *from != "" {
+		if addr, err = address(d, *from); err != nil {
+			return err
+		}
+	}
+	if *to != "" {
+		if last, err = address(d, *to); err != nil {
+			return err
+		}
+	}
+
+	w := bufio.NewWriter(os.Stdout)
+	for n := 0; ; n++ {
+		if *count > 0 && n == *count {
+			break
+		}
+		if *count <= 0 && addr > last {
+			break
+		}
+
+		if label, ok := d.Symbols.Name(addr); ok {
+			fmt.Fprintf(w, "%v:\n", label)
+		}
+		ins := d.Disassemble(addr)
+		hex := ""
+		for _, b := range ins.Bytes {
+			hex += fmt.Sprintf("%02X ", b)
+		}
+		fmt.Fprintf(w, "$%04X  %-9s  %v\n", addr, hex, ins.Text)
+
+		next := addr + uint16(len(ins.Bytes))
+		if next < addr {
+			break
+		}
+		addr = next
+	}
+	return w.Flush()
+}
@@ -0,0 +1,34 @@
+package term
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// OpenPTY creates a pseudo terminal in raw mode. It returns the controlling
+// side and the path other programs, such as screen or minicom, open to talk
+// to it.
+func OpenPTY() (*os.File, string, error) {
+	f, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var unlock int32
+	if err := ioctl(f.Fd(), syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		f.Close()
+		return nil, "", err
+	}
+	var n uint32
+	if err := ioctl(f.Fd(), syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		f.Close()
+		return nil, "", err
+	}
+	if _, err := MakeRaw(f.Fd()); err != nil {
+		f.Close()
+		return nil, "", err
+	}
+	return f, fmt.Sprintf("/dev/pts/%d", n), nil
+}
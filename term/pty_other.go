@@ -0,0 +1,12 @@
+//go:build !linux
+
+package term
+
+import (
+	"errors"
+	"os"
+)
+
+func OpenPTY() (*os.File, string, error) {
+	return nil, "", errors.New("term: pseudo terminals are only supported on Linux")
+}
@@ -0,0 +1,31 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd
+
+// Package term switches terminals between cooked and raw input and opens
+// pseudo terminals, using ioctls directly so no extra modules are needed.
+package term
+
+import "errors"
+
+type State struct{}
+
+var errUnsupported = errors.New("term: raw terminal mode is not supported on this platform")
+
+func MakeRaw(fd uintptr) (*State, error) {
+	return nil, errUnsupported
+}
+
+func MakeCbreak(fd uintptr) (*State, error) {
+	return nil, errUnsupported
+}
+
+func Restore(fd uintptr, state *State) error {
+	return errUnsupported
+}
+
+func IsTerminal(fd uintptr) bool {
+	return false
+}
+
+func Size(fd uintptr) (int, int, error) {
+	return 0, 0, errUnsupported
+}
@@ -0,0 +1,77 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+// Package term switches terminals between cooked and raw input and opens
+// pseudo terminals, using ioctls directly so no extra modules are needed.
+package term
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// State is a terminal's mode, to give back to Restore
+type State struct {
+	termios syscall.Termios
+}
+
+func ioctl(fd uintptr, request uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, request, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// MakeRaw turns off line buffering, echo and signal keys on the terminal,
+// returning the previous state for Restore
+func MakeRaw(fd uintptr) (*State, error) {
+	return makeRaw(fd, false)
+}
+
+// MakeCbreak is MakeRaw except that keys such as Ctrl-C still send signals
+func MakeCbreak(fd uintptr) (*State, error) {
+	return makeRaw(fd, true)
+}
+
+func makeRaw(fd uintptr, signals bool) (*State, error) {
+	var old State
+	if err := ioctl(fd, ioctlGetTermios, unsafe.Pointer(&old.termios)); err != nil {
+		return nil, err
+	}
+
+	raw := old.termios
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP | syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	if signals {
+		raw.Lflag |= syscall.ISIG
+	}
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := ioctl(fd, ioctlSetTermios, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+	return &old, nil
+}
+
+func Restore(fd uintptr, state *State) error {
+	return ioctl(fd, ioctlSetTermios, unsafe.Pointer(&state.termios))
+}
+
+// IsTerminal reports whether fd is a terminal
+func IsTerminal(fd uintptr) bool {
+	var termios syscall.Termios
+	return ioctl(fd, ioctlGetTermios, unsafe.Pointer(&termios)) == nil
+}
+
+// Size returns the width and height of the terminal
+func Size(fd uintptr) (int, int, error) {
+	var ws struct {
+		Row, Col, Xpixel, Ypixel uint16
+	}
+	if err := ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return 0, 0, err
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
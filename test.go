@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	debugger "izzudinhafiz.com/go-6502/debugger"
+	harness "izzudinhafiz.com/go-6502/harness"
+)
+
+var suiteNames = []string{"functional", "decimal", "interrupt"}
+
+// test [-functional FILE] [-decimal FILE] [-interrupt FILE] [SUITE...]
+func testCommand(args []string) error {
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	functional := flags.String("functional", harness.DefaultFunctionalTest.Path, "6502_functional_test image")
+	decimal := flags.String("decimal", harness.DefaultDecimalTest.Path, "6502_decimal_test image")
+	interrupt := flags.String("interrupt", harness.DefaultInterruptTest.Path, "6502_interrupt_test image")
+	if err := parseFlags(flags, args); err != nil {
+		return err
+	}
+
+	suites := flags.Args()
+	if len(suites) == 0 {
+		suites = []string{"functional"}
+	}
+	if len(suites) == 1 && suites[0] == "all" {
+		suites = suiteNames
+	}
+
+	failures := 0
+	for _, suite := range suites {
+		var passed bool
+		var result fmt.Stringer
+		var err error
+
+		switch suite {
+		case "functional":
+			passed, result, err = runFunctionalTest(*functional)
+		case "decimal":
+			t := harness.DefaultDecimalTest
+			t.Path = *decimal
+			var r harness.DecimalResult
+			r, err = t.Run()
+			passed, result = r.Passed, r
+		case "interrupt":
+			t := harness.DefaultInterruptTest
+			t.Path = *interrupt
+			var r harness.Result
+			r, err = t.Run()
+			passed, result = r.Passed, r
+		default:
+			return usageError("test [flags] [functional|decimal|interrupt|all]...")
+		}
+
+		if err != nil {
+			return fmt.Errorf("%v: %w", suite, err)
+		}
+		fmt.Printf("%-10s %v\n", suite, result)
+		if !passed {
+			failures += 1
+		}
+	}
+
+	if failures > 0 {
+		return failed("%d of %d suites failed", failures, len(suites))
+	}
+	return nil
+}
+
+// runFunctionalTest runs the functional test with a debugger attached, so a
+// failure can show the subroutines the failing test was in
+func runFunctionalTest(path string) (bool, fmt.Stringer, error) {
+	t := harness.DefaultFunctionalTest
+	t.Path = path
+	c, err := t.Load()
+	if err != nil {
+		return false, nil, err
+	}
+
+	d := debugger.New(c)
+	result := t.RunOn(c)
+	if !result.Passed {
+		fmt.Fprint(os.Stderr, d.Backtrace())
+	}
+	return result.Passed, result, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	tracefile "izzudinhafiz.com/go-6502/tracefile"
+)
+
+// query FILE info
+// query FILE pc ADDR
+// query FILE writes ADDR[-ADDR] [FROM [TO]]
+func queryCommand(args []string) error {
+	usage := usageError("query FILE info | pc ADDR | writes ADDR[-ADDR] [FROM [TO]]")
+	if len(args) < 2 {
+		return usage
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	tr, err := tracefile.NewReader(f, info.Size())
+	if err != nil {
+		return err
+	}
+
+	switch args[1] {
+	case "info":
+		fmt.Printf("%d records in %d blocks\n", tr.Records, len(tr.Blocks))
+		if len(tr.Blocks) > 0 {
+			// A reset takes the cycle count back, so any block can hold the lowest or highest
+			lo, hi := tr.Blocks[0].MinCycle, tr.Blocks[0].MaxCycle
+			for _, b := range tr.Blocks[1:] {
+				if b.MinCycle < lo {
+					lo = b.MinCycle
+				}
+				if b.MaxCycle > hi {
+					hi = b.MaxCycle
+				}
+			}
+			fmt.Printf("cycles %d to %d\n", lo, hi)
+		}
+
+	case "pc":
+		if len(args) != 3 {
+			return usage
+		}
+		pc, err := parseNumber(args[2])
+		if err != nil || pc > 0xFFFF {
+			return usageError("bad address %q", args[2])
+		}
+		r, ok, err := tr.FirstPC(uint16(pc))
+		if err != nil {
+			return err
+		}
+		if !ok {
+			fmt.Printf("PC never reached $%04X\n", pc)
+			return nil
+		}
+		fmt.Printf("PC first reached $%04X at cycle %d, record %d\n", pc, r.Cycle, r.Index)
+
+	case "writes":
+		if len(args) < 3 || len(args) > 5 {
+			return usage
+		}
+		lo, hi, err := parseRange(args[2])
+		if err != nil {
+			return err
+		}
+		from, to := uint64(0), ^uint64(0)
+		if len(args) > 3 {
+			if from, err = parseNumber(args[3]); err != nil {
+				return err
+			}
+		}
+		if len(args) > 4 {
+			if to, err = parseNumber(args[4]); err != nil {
+				return err
+			}
+		}
+
+		accesses, err := tr.Writes(lo, hi, from, to)
+		if err != nil {
+			return err
+		}
+		for _, a := range accesses {
+			fmt.Printf("cycle %d  PC $%04X  $%04X <- $%02X\n", a.Cycle, a.PC, a.Addr, a.Value)
+		}
+
+	default:
+		return usage
+	}
+	return nil
+}
+
+// parseNumber accepts decimal, $hex and 0xhex
+func parseNumber(s string) (uint64, error) {
+	if strings.HasPrefix(s, "$") {
+		return strconv.ParseUint(s[1:], 16, 64)
+	}
+	return strconv.ParseUint(s, 0, 64)
+}
+
+func parseRange(s string) (uint16, uint16, error) {
+	parts := strings.SplitN(s, "-", 2)
+	lo, err := parseNumber(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	hi := lo
+	if len(parts) == 2 {
+		if hi, err = parseNumber(parts[1]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if lo > 0xFFFF || hi > 0xFFFF || hi < lo {
+		return 0, 0, fmt.Errorf("bad address range %q", s)
+	}
+	return uint16(lo), uint16(hi), nil
+}
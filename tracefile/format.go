@@ -0,0 +1,95 @@
+// Package tracefile stores long execution traces in a compact binary form.
+//
+// A trace file is a header, a sequence of flate compressed blocks and an index
+// of those blocks followed by a fixed size footer:
+//
+//	"G65T" version
+//	block*            uvarint length, compressed records
+//	index             uvarint count, per block: offset, first record, count, lowest cycle, highest cycle
+//	footer            uint64 little endian index offset, "G65T"
+//
+// Each record holds the CPU state at the start of an instruction (or of an
+// interrupt entry) and the memory writes it made. Records are delta encoded
+// against the previous record in the same block, so every block can be decoded
+// on its own and the index lets readers skip straight to a range of cycles.
+// Cycles go back to 0 when the CPU is reset, so they only grow between resets
+// and a block's lowest and highest cycles are not always its first and last.
+package tracefile
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	MAGIC   = "G65T"
+	VERSION = 2 // Version 1 stored cycle deltas unsigned
+
+	// Records per block unless Writer.BlockSize says otherwise
+	DEFAULT_BLOCK_SIZE = 16384
+)
+
+// Record kinds
+const (
+	KIND_INSTRUCTION byte = iota
+	KIND_IRQ
+	KIND_NMI
+)
+
+// Bits of the record header byte
+const (
+	rec_a byte = 1 << iota
+	rec_x
+	rec_y
+	rec_sp
+	rec_p
+	rec_writes
+	rec_kind_shift = 6
+)
+
+const footerSize = 12
+
+// The smallest encoded record: header byte, cycle delta and PC delta
+const minRecordSize = 3
+
+var ErrFormat = errors.New("tracefile: not a trace file")
+
+// Record is one step of the trace
+type Record struct {
+	Kind   byte
+	Index  uint64 // Position of the record in the trace, counting from 0
+	Cycle  uint64 // CPU tick the step started on
+	PC     uint16 // Address of the instruction, or the return address of an interrupt
+	A      byte
+	X      byte
+	Y      byte
+	SP     byte
+	P      byte
+	Writes []Write
+}
+
+type Write struct {
+	Addr  uint16
+	Value byte
+}
+
+// BlockInfo is an index entry
+type BlockInfo struct {
+	Offset      int64
+	FirstRecord uint64
+	Count       int
+	MinCycle    uint64
+	MaxCycle    uint64
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
+
+func appendVarint(buf []byte, v int64) []byte {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(tmp[:], v)
+	return append(buf, tmp[:n]...)
+}
@@ -0,0 +1,255 @@
+package tracefile
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Reader gives random access to the blocks of a trace file
+type Reader struct {
+	Blocks  []BlockInfo
+	Records uint64
+
+	r           io.ReaderAt
+	indexOffset int64 // Where the blocks end
+}
+
+// NewReader reads the header and index of a trace file of the given size
+func NewReader(r io.ReaderAt, size int64) (*Reader, error) {
+	if size < int64(len(MAGIC)+1+footerSize) {
+		return nil, ErrFormat
+	}
+
+	header := make([]byte, len(MAGIC)+1)
+	if _, err := r.ReadAt(header, 0); err != nil {
+		return nil, err
+	}
+	if string(header[:len(MAGIC)]) != MAGIC {
+		return nil, ErrFormat
+	}
+	if header[len(MAGIC)] != VERSION {
+		return nil, fmt.Errorf("tracefile: unsupported version %d", header[len(MAGIC)])
+	}
+
+	footer := make([]byte, footerSize)
+	if _, err := r.ReadAt(footer, size-footerSize); err != nil {
+		return nil, err
+	}
+	if string(footer[8:]) != MAGIC {
+		return nil, errors.New("tracefile: missing index, the file was not closed")
+	}
+
+	indexOffset := int64(binary.LittleEndian.Uint64(footer[:8]))
+	if indexOffset < int64(len(header)) || indexOffset > size-footerSize {
+		return nil, ErrFormat
+	}
+	br := bufio.NewReader(io.NewSectionReader(r, indexOffset, size-footerSize-indexOffset))
+
+	count, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	// Every block takes at least a byte of the index, and every record a few bytes of a block
+	if count > uint64(size-footerSize-indexOffset) {
+		return nil, fmt.Errorf("tracefile: corrupt index: %d blocks", count)
+	}
+
+	tr := &Reader{r: r, indexOffset: indexOffset}
+	prevOffset := int64(len(header)) - 1
+	for i := uint64(0); i < count; i++ {
+		var fields [5]uint64
+		for j := range fields {
+			if fields[j], err = binary.ReadUvarint(br); err != nil {
+				return nil, fmt.Errorf("tracefile: corrupt index: %w", err)
+			}
+		}
+		info := BlockInfo{int64(fields[0]), fields[1], int(fields[2]), fields[3], fields[4]}
+		switch {
+		case fields[0] > uint64(indexOffset) || info.Offset <= prevOffset:
+			return nil, fmt.Errorf("tracefile: corrupt index: block %d at offset %d", i, fields[0])
+		case fields[2] == 0 || fields[2] > uint64(indexOffset-info.Offset)*1032/minRecordSize:
+			// flate expands data by 1032 times at most
+			return nil, fmt.Errorf("tracefile: corrupt index: block %d has %d records", i, fields[2])
+		case info.MinCycle > info.MaxCycle:
+			return nil, fmt.Errorf("tracefile: corrupt index: block %d cycles %d to %d", i, info.MinCycle, info.MaxCycle)
+		}
+		tr.Blocks = append(tr.Blocks, info)
+		tr.Records += fields[2]
+		prevOffset = info.Offset
+	}
+	return tr, nil
+}
+
+// Block decodes all records of block i
+func (tr *Reader) Block(i int) ([]Record, error) {
+	info := tr.Blocks[i]
+	end := tr.indexOffset
+	if i+1 < len(tr.Blocks) {
+		end = tr.Blocks[i+1].Offset
+	}
+	br := bufio.NewReader(io.NewSectionReader(tr.r, info.Offset, end-info.Offset))
+	length, err := binary.ReadUvarint(br)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(end-info.Offset) {
+		return nil, fmt.Errorf("tracefile: block %d is %d bytes, longer than its place in the file", i, length)
+	}
+
+	compressed := make([]byte, length)
+	if _, err := io.ReadFull(br, compressed); err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(flate.NewReader(bytes.NewReader(compressed)))
+	if err != nil {
+		return nil, err
+	}
+	if info.Count > len(data)/minRecordSize {
+		return nil, fmt.Errorf("tracefile: block %d is too short for %d records", i, info.Count)
+	}
+
+	records := make([]Record, info.Count)
+	var prev Record
+	pos := 0
+	for n := range records {
+		r := &records[n]
+		if pos, err = decodeRecord(data, pos, &prev, r); err != nil {
+			return nil, fmt.Errorf("tracefile: block %d record %d: %w", i, n, err)
+		}
+		r.Index = info.FirstRecord + uint64(n)
+		prev = *r
+	}
+	return records, nil
+}
+
+// Scan calls fn for every record that started between cycles from and to
+// inclusive, in order, until fn returns false
+func (tr *Reader) Scan(from uint64, to uint64, fn func(r *Record) bool) error {
+	for i, info := range tr.Blocks {
+		if info.MaxCycle < from || info.MinCycle > to {
+			continue
+		}
+
+		records, err := tr.Block(i)
+		if err != nil {
+			return err
+		}
+		for n := range records {
+			r := &records[n]
+			if r.Cycle < from || r.Cycle > to {
+				continue
+			}
+			if !fn(r) {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// FirstPC finds the first record with the given program counter
+func (tr *Reader) FirstPC(pc uint16) (Record, bool, error) {
+	var found Record
+	ok := false
+	err := tr.Scan(0, ^uint64(0), func(r *Record) bool {
+		if r.PC == pc {
+			found, ok = *r, true
+			return false
+		}
+		return true
+	})
+	return found, ok, err
+}
+
+// Access is a memory write located in the trace
+type Access struct {
+	Cycle  uint64
+	Record uint64
+	PC     uint16
+	Write
+}
+
+// Writes lists every write to addresses lo to hi inclusive between cycles from and to
+func (tr *Reader) Writes(lo uint16, hi uint16, from uint64, to uint64) ([]Access, error) {
+	var accesses []Access
+	err := tr.Scan(from, to, func(r *Record) bool {
+		for _, w := range r.Writes {
+			if w.Addr >= lo && w.Addr <= hi {
+				accesses = append(accesses, Access{r.Cycle, r.Index, r.PC, w})
+			}
+		}
+		return true
+	})
+	return accesses, err
+}
+
+func decodeRecord(data []byte, pos int, prev *Record, r *Record) (int, error) {
+	if pos >= len(data) {
+		return pos, io.ErrUnexpectedEOF
+	}
+	header := data[pos]
+	pos += 1
+
+	cycleDelta, n := binary.Varint(data[pos:])
+	if n <= 0 {
+		return pos, io.ErrUnexpectedEOF
+	}
+	pos += n
+	pcDelta, n := binary.Varint(data[pos:])
+	if n <= 0 {
+		return pos, io.ErrUnexpectedEOF
+	}
+	pos += n
+
+	*r = Record{
+		Kind:  header >> rec_kind_shift,
+		Cycle: prev.Cycle + uint64(cycleDelta),
+		PC:    uint16(int64(prev.PC) + pcDelta),
+		A:     prev.A,
+		X:     prev.X,
+		Y:     prev.Y,
+		SP:    prev.SP,
+		P:     prev.P,
+	}
+
+	for _, reg := range []struct {
+		bit byte
+		dst *byte
+	}{{rec_a, &r.A}, {rec_x, &r.X}, {rec_y, &r.Y}, {rec_sp, &r.SP}, {rec_p, &r.P}} {
+		if header&reg.bit == 0 {
+			continue
+		}
+		if pos >= len(data) {
+			return pos, io.ErrUnexpectedEOF
+		}
+		*reg.dst = data[pos]
+		pos += 1
+	}
+
+	if header&rec_writes != 0 {
+		count, n := binary.Uvarint(data[pos:])
+		if n <= 0 || count > uint64(len(data)) {
+			return pos, io.ErrUnexpectedEOF
+		}
+		pos += n
+
+		r.Writes = make([]Write, count)
+		last := int64(0)
+		for i := range r.Writes {
+			delta, n := binary.Varint(data[pos:])
+			if n <= 0 || pos+n >= len(data) {
+				return pos, io.ErrUnexpectedEOF
+			}
+			pos += n
+			last += delta
+			r.Writes[i] = Write{uint16(last), data[pos]}
+			pos += 1
+		}
+	}
+	return pos, nil
+}
@@ -0,0 +1,235 @@
+package tracefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+)
+
+// writeTrace encodes records with the given block size and opens the result
+func writeTrace(t *testing.T, blockSize int, records []Record) (*Reader, []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.BlockSize = blockSize
+	for _, r := range records {
+		if err := w.Write(r); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr, buf.Bytes()
+}
+
+// readAll decodes every block of a trace
+func readAll(t *testing.T, tr *Reader) []Record {
+	t.Helper()
+	var records []Record
+	for i := range tr.Blocks {
+		block, err := tr.Block(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, block...)
+	}
+	return records
+}
+
+// A trace with a reset between the third and fourth records, which takes the
+// cycle count back to 0
+var resetTrace = []Record{
+	{Kind: KIND_INSTRUCTION, Cycle: 100, PC: 0x8000, A: 0x01, SP: 0xFD, P: 0x24},
+	{Kind: KIND_INSTRUCTION, Cycle: 102, PC: 0x8002, A: 0x01, SP: 0xFD, P: 0x24, Writes: []Write{{0x0200, 0x01}, {0x01FD, 0x80}, {0x01FC, 0x04}}},
+	{Kind: KIND_IRQ, Cycle: 108, PC: 0x8004, A: 0x01, SP: 0xFB, P: 0x20},
+	{Kind: KIND_INSTRUCTION, Cycle: 7, PC: 0x8000, SP: 0xFD, P: 0x24},
+	{Kind: KIND_NMI, Cycle: 9, PC: 0x8002, X: 0xFF, SP: 0xFD, P: 0xA4, Writes: []Write{{0x01FD, 0x80}}},
+	{Kind: KIND_INSTRUCTION, Cycle: 16, PC: 0x9000, X: 0xFF, Y: 0x10, SP: 0xFA, P: 0x24},
+	{Kind: KIND_INSTRUCTION, Cycle: 200000, PC: 0x9003, X: 0xFF, Y: 0x10, SP: 0xFA, P: 0x24},
+}
+
+func TestRoundTrip(t *testing.T) {
+	tr, _ := writeTrace(t, 2, resetTrace)
+
+	want := make([]Record, len(resetTrace))
+	for i, r := range resetTrace {
+		want[i] = r
+		want[i].Index = uint64(i)
+	}
+	if got := readAll(t, tr); !reflect.DeepEqual(got, want) {
+		t.Errorf("read back\n%+v\nwant\n%+v", got, want)
+	}
+
+	// The lowest and highest cycles of the block with the reset are not its first and last
+	wantBlocks := []BlockInfo{
+		{FirstRecord: 0, Count: 2, MinCycle: 100, MaxCycle: 102},
+		{FirstRecord: 2, Count: 2, MinCycle: 7, MaxCycle: 108},
+		{FirstRecord: 4, Count: 2, MinCycle: 9, MaxCycle: 16},
+		{FirstRecord: 6, Count: 1, MinCycle: 200000, MaxCycle: 200000},
+	}
+	if len(tr.Blocks) != len(wantBlocks) || tr.Records != uint64(len(resetTrace)) {
+		t.Fatalf("%d records in %d blocks, want %d in %d", tr.Records, len(tr.Blocks), len(resetTrace), len(wantBlocks))
+	}
+	for i, b := range tr.Blocks {
+		want := wantBlocks[i]
+		want.Offset = b.Offset
+		if b != want || i > 0 && b.Offset <= tr.Blocks[i-1].Offset {
+			t.Errorf("block %d is %+v, want %+v", i, b, want)
+		}
+	}
+}
+
+func TestScanAcrossReset(t *testing.T) {
+	tr, _ := writeTrace(t, 2, resetTrace)
+
+	var got []uint64
+	err := tr.Scan(5, 20, func(r *Record) bool {
+		got = append(got, r.Index)
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Cycle 7 is in the same block as cycle 108, which starts after the range
+	if want := []uint64{3, 4, 5}; !reflect.DeepEqual(got, want) {
+		t.Errorf("records %v between cycles 5 and 20, want %v", got, want)
+	}
+
+	r, ok, err := tr.FirstPC(0x8002)
+	if err != nil || !ok || r.Index != 1 {
+		t.Errorf("FirstPC($8002) = record %d, %v, %v, want record 1", r.Index, ok, err)
+	}
+
+	writes, err := tr.Writes(0x01FC, 0x01FF, 0, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Access{
+		{102, 1, 0x8002, Write{0x01FD, 0x80}},
+		{102, 1, 0x8002, Write{0x01FC, 0x04}},
+		{9, 4, 0x8002, Write{0x01FD, 0x80}},
+	}
+	if !reflect.DeepEqual(writes, want) {
+		t.Errorf("stack writes %+v, want %+v", writes, want)
+	}
+}
+
+// The recorder follows the CPU through a reset
+func TestRecorderReset(t *testing.T) {
+	c := cpu.New()
+	// LDA #$42; STA $0200; JMP $8000
+	c.WriteMemory(0x8000, []byte{0xA9, 0x42, 0x8D, 0x00, 0x02, 0x4C, 0x00, 0x80})
+	c.SetResetVector(0x8000)
+	c.Reset()
+
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := NewRecorder(c, w)
+	for i := 0; i < 4; i++ {
+		c.SingleOperation()
+	}
+	c.Reset()
+	for i := 0; i < 2; i++ {
+		c.SingleOperation()
+	}
+	if err := rec.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pcs []uint16
+	var cycles []uint64
+	for _, r := range readAll(t, tr) {
+		pcs = append(pcs, r.PC)
+		cycles = append(cycles, r.Cycle)
+	}
+	if want := []uint16{0x8000, 0x8002, 0x8005, 0x8000, 0x8000, 0x8002}; !reflect.DeepEqual(pcs, want) {
+		t.Errorf("PCs %04X, want %04X", pcs, want)
+	}
+	if want := []uint64{1, 3, 7, 10, 1, 3}; !reflect.DeepEqual(cycles, want) {
+		t.Errorf("cycles %v, want %v", cycles, want)
+	}
+}
+
+// buildTrace assembles a file around hand made blocks and index entries
+func buildTrace(blocks [][]byte, index [][5]uint64) []byte {
+	buf := append([]byte(MAGIC), VERSION)
+	for _, b := range blocks {
+		buf = append(buf, b...)
+	}
+	indexOffset := len(buf)
+	buf = appendUvarint(buf, uint64(len(index)))
+	for _, entry := range index {
+		for _, field := range entry {
+			buf = appendUvarint(buf, field)
+		}
+	}
+	var footer [footerSize]byte
+	binary.LittleEndian.PutUint64(footer[:8], uint64(indexOffset))
+	copy(footer[8:], MAGIC)
+	return append(buf, footer[:]...)
+}
+
+// Sizes in a damaged file are checked before anything is allocated from them
+func TestCorruptFiles(t *testing.T) {
+	_, valid := writeTrace(t, 2, resetTrace)
+	huge := uint64(1) << 40
+
+	tests := []struct {
+		name  string
+		data  []byte
+		block bool // Whether the index reads and the error comes from the block
+		want  string
+	}{
+		{name: "empty", data: nil, want: "not a trace file"},
+		{name: "not closed", data: valid[:len(valid)-footerSize], want: "missing index"},
+		{name: "old version", data: append([]byte(MAGIC), 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0), want: "unsupported version 1"},
+		{name: "many blocks", data: func() []byte {
+			// The index of an empty trace with its count of 0 replaced by a huge one
+			d := buildTrace(nil, nil)
+			at := len(MAGIC) + 1
+			return append(append(d[:at:at], appendUvarint(nil, huge)...), d[at+1:]...)
+		}(), want: "corrupt index"},
+		{name: "many records", data: buildTrace([][]byte{{1, 0}}, [][5]uint64{{5, 0, huge, 0, 0}}), want: "has 1099511627776 records"},
+		{name: "offset past the blocks", data: buildTrace([][]byte{{1, 0}}, [][5]uint64{{huge, 0, 1, 0, 0}}), want: "block 0 at offset"},
+		{name: "offsets out of order", data: buildTrace([][]byte{{1, 0}, {1, 0}}, [][5]uint64{{7, 0, 1, 0, 0}, {5, 1, 1, 0, 0}}), want: "block 1 at offset 5"},
+		{name: "cycles reversed", data: buildTrace([][]byte{{1, 0}}, [][5]uint64{{5, 0, 1, 9, 8}}), want: "cycles 9 to 8"},
+		{name: "block length", data: buildTrace([][]byte{appendUvarint(nil, huge)}, [][5]uint64{{5, 0, 1, 0, 0}}), block: true, want: "longer than its place in the file"},
+	}
+
+	for _, tt := range tests {
+		tr, err := NewReader(bytes.NewReader(tt.data), int64(len(tt.data)))
+		if tt.block {
+			if err != nil {
+				t.Errorf("%v: %v", tt.name, err)
+				continue
+			}
+			_, err = tr.Block(0)
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%v: error %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package tracefile
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+)
+
+// Writer encodes records into a trace file
+type Writer struct {
+	BlockSize int // Records per block, set before the first Write
+
+	w       io.Writer
+	offset  int64
+	block   []byte
+	prev    Record
+	count   int
+	minimum uint64 // Lowest and highest cycles in the block
+	maximum uint64
+	total   uint64
+	index   []BlockInfo
+	scratch bytes.Buffer
+	flate   *flate.Writer
+	closed  bool
+}
+
+// NewWriter writes the file header to w
+func NewWriter(w io.Writer) (*Writer, error) {
+	header := append([]byte(MAGIC), VERSION)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	fw, err := flate.NewWriter(nil, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{BlockSize: DEFAULT_BLOCK_SIZE, w: w, offset: int64(len(header)), flate: fw}, nil
+}
+
+// Write appends a record, its Index is assigned by the writer
+func (tw *Writer) Write(r Record) error {
+	if tw.closed {
+		return errors.New("tracefile: write to closed writer")
+	}
+
+	if tw.count == 0 {
+		tw.prev = Record{}
+		tw.minimum, tw.maximum = r.Cycle, r.Cycle
+	}
+	if r.Cycle < tw.minimum {
+		tw.minimum = r.Cycle
+	}
+	if r.Cycle > tw.maximum {
+		tw.maximum = r.Cycle
+	}
+	tw.block = encodeRecord(tw.block, &tw.prev, &r)
+	tw.prev = r
+	tw.prev.Writes = nil
+	tw.count += 1
+	tw.total += 1
+
+	if tw.count >= tw.BlockSize {
+		return tw.flushBlock()
+	}
+	return nil
+}
+
+func (tw *Writer) flushBlock() error {
+	if tw.count == 0 {
+		return nil
+	}
+
+	tw.scratch.Reset()
+	tw.flate.Reset(&tw.scratch)
+	if _, err := tw.flate.Write(tw.block); err != nil {
+		return err
+	}
+	if err := tw.flate.Close(); err != nil {
+		return err
+	}
+
+	buf := appendUvarint(nil, uint64(tw.scratch.Len()))
+	buf = append(buf, tw.scratch.Bytes()...)
+	if _, err := tw.w.Write(buf); err != nil {
+		return err
+	}
+
+	tw.index = append(tw.index, BlockInfo{
+		Offset:      tw.offset,
+		FirstRecord: tw.total - uint64(tw.count),
+		Count:       tw.count,
+		MinCycle:    tw.minimum,
+		MaxCycle:    tw.maximum,
+	})
+	tw.offset += int64(len(buf))
+	tw.block = tw.block[:0]
+	tw.count = 0
+	return nil
+}
+
+// Close flushes the last block and writes the index. It does not close the
+// underlying writer.
+func (tw *Writer) Close() error {
+	if tw.closed {
+		return nil
+	}
+	if err := tw.flushBlock(); err != nil {
+		return err
+	}
+	tw.closed = true
+
+	buf := appendUvarint(nil, uint64(len(tw.index)))
+	for _, b := range tw.index {
+		buf = appendUvarint(buf, uint64(b.Offset))
+		buf = appendUvarint(buf, b.FirstRecord)
+		buf = appendUvarint(buf, uint64(b.Count))
+		buf = appendUvarint(buf, b.MinCycle)
+		buf = appendUvarint(buf, b.MaxCycle)
+	}
+
+	var footer [footerSize]byte
+	binary.LittleEndian.PutUint64(footer[:8], uint64(tw.offset))
+	copy(footer[8:], MAGIC)
+	buf = append(buf, footer[:]...)
+
+	_, err := tw.w.Write(buf)
+	return err
+}
+
+func encodeRecord(buf []byte, prev *Record, r *Record) []byte {
+	header := r.Kind << rec_kind_shift
+	if r.A != prev.A {
+		header |= rec_a
+	}
+	if r.X != prev.X {
+		header |= rec_x
+	}
+	if r.Y != prev.Y {
+		header |= rec_y
+	}
+	if r.SP != prev.SP {
+		header |= rec_sp
+	}
+	if r.P != prev.P {
+		header |= rec_p
+	}
+	if len(r.Writes) > 0 {
+		header |= rec_writes
+	}
+
+	buf = append(buf, header)
+	// Signed, as a reset takes the cycle back to 0
+	buf = appendVarint(buf, int64(r.Cycle-prev.Cycle))
+	buf = appendVarint(buf, int64(r.PC)-int64(prev.PC))
+	if header&rec_a != 0 {
+		buf = append(buf, r.A)
+	}
+	if header&rec_x != 0 {
+		buf = append(buf, r.X)
+	}
+	if header&rec_y != 0 {
+		buf = append(buf, r.Y)
+	}
+	if header&rec_sp != 0 {
+		buf = append(buf, r.SP)
+	}
+	if header&rec_p != 0 {
+		buf = append(buf, r.P)
+	}
+
+	if len(r.Writes) > 0 {
+		buf = appendUvarint(buf, uint64(len(r.Writes)))
+		last := int64(0)
+		for _, w := range r.Writes {
+			buf = appendVarint(buf, int64(w.Addr)-last)
+			buf = append(buf, w.Value)
+			last = int64(w.Addr)
+		}
+	}
+	return buf
+}
+
+// Recorder writes everything a CPU does to a trace file through its hooks
+type Recorder struct {
+	c       *cpu.Cpu6502
+	w       *Writer
+	hooks   cpu.Hooks
+	pending Record
+	active  bool
+	err     error
+}
+
+// NewRecorder starts recording c into w
+func NewRecorder(c *cpu.Cpu6502, w *Writer) *Recorder {
+	r := &Recorder{c: c, w: w}
+	r.hooks = cpu.Hooks{
+		BeforeInstruction: func(c *cpu.Cpu6502, pc uint16, opcode byte) {
+			r.begin(KIND_INSTRUCTION, pc)
+		},
+		Interrupt: func(c *cpu.Cpu6502, kind byte, returnAddr uint16) {
+			if kind == cpu.INTERRUPT_NMI {
+				r.begin(KIND_NMI, returnAddr)
+			} else {
+				r.begin(KIND_IRQ, returnAddr)
+			}
+		},
+		MemoryWrite: func(c *cpu.Cpu6502, addr uint16, value byte, cycle int) {
+			if r.active {
+				r.pending.Writes = append(r.pending.Writes, Write{addr, value})
+			}
+		},
+	}
+	c.AddHooks(&r.hooks)
+	return r
+}
+
+func (r *Recorder) begin(kind byte, pc uint16) {
+	r.finish()
+
+	c := r.c
+	f := c.Flags
+	r.pending = Record{
+		Kind:   kind,
+		Cycle:  uint64(c.Tick),
+		PC:     pc,
+		A:      c.Registers.A,
+		X:      c.Registers.X,
+		Y:      c.Registers.Y,
+		SP:     c.Registers.SP,
+		P:      f.C | f.Z<<1 | f.I<<2 | f.D<<3 | 1<<5 | f.V<<6 | f.N<<7,
+		Writes: r.pending.Writes[:0],
+	}
+	r.active = true
+}
+
+func (r *Recorder) finish() {
+	if !r.active || r.err != nil {
+		return
+	}
+	r.err = r.w.Write(r.pending)
+	r.active = false
+}
+
+// Stop detaches the recorder from the CPU, writes the last record and reports
+// the first error met while recording. The Writer still has to be closed.
+func (r *Recorder) Stop() error {
+	r.c.RemoveHooks(&r.hooks)
+	r.finish()
+	return r.err
+}
@@ -0,0 +1,199 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	term "izzudinhafiz.com/go-6502/term"
+)
+
+func (a *App) draw() {
+	a.width, a.height = 100, 32
+	if w, h, err := term.Size(a.in.Fd()); err == nil && w > 0 && h > 0 {
+		a.width, a.height = w, h
+	}
+	s := newScreen(a.width, a.height)
+	if a.follow {
+		a.cursor = a.c.Registers.PC
+	}
+
+	mode := "stopped"
+	if a.running {
+		mode = "running"
+	}
+	s.textf(0, 0, a.width, ATTR_HIGHLIGHT, " go6502  %-8v %v", mode, a.status)
+	s.fill(0, 0, a.width, ATTR_HIGHLIGHT)
+
+	left := LEFT_WIDTH
+	if left > a.width/2+10 {
+		left = a.width / 2
+	}
+	right := a.width - left - 1
+	body := a.height - 2
+	disasmHeight := body * 3 / 5
+
+	a.drawDisassembly(s, 0, 1, left, disasmHeight)
+	a.drawTrace(s, 0, 1+disasmHeight, left, body-disasmHeight)
+
+	y := 1
+	y = a.drawRegisters(s, left+1, y, right)
+	y = a.drawStack(s, left+1, y, right)
+	y = a.drawBreakpoints(s, left+1, y, right)
+	a.drawMemory(s, left+1, y, right, a.height-1-y)
+
+	if a.prompt != nil {
+		s.textf(0, a.height-1, a.width, ATTR_NORMAL, "%v: %v█", a.prompt.label, a.prompt.text)
+	} else {
+		s.text(0, a.height-1, a.width, ATTR_DIM, help)
+	}
+	s.flush(a.out)
+}
+
+func (a *App) drawDisassembly(s *screen, x int, y int, width int, height int) {
+	s.title(x, y, width, "Disassembly")
+	rows := height - 1
+	if rows <= 0 {
+		return
+	}
+
+	breakpoints := map[uint16]bool{}
+	for _, bp := range a.d.Breakpoints() {
+		breakpoints[bp.Addr] = bp.Enabled
+	}
+
+	pc := a.c.Registers.PC
+	addr := a.d.DisassemblyStart(a.cursor, rows/3)
+	for row := 0; row < rows; row++ {
+		ins := a.d.Disassemble(addr)
+		hex := make([]string, len(ins.Bytes))
+		for i, b := range ins.Bytes {
+			hex[i] = fmt.Sprintf("%02X", b)
+		}
+
+		marker := "  "
+		attr := ATTR_NORMAL
+		if enabled, exists := breakpoints[addr]; exists {
+			marker = "o "
+			if enabled {
+				marker = "● "
+			}
+			attr = ATTR_BREAKPOINT
+		}
+		if addr == pc {
+			marker = marker[:len(marker)-1] + ">"
+		}
+
+		label := ""
+		if name, ok := a.d.Symbols.Name(addr); ok {
+			label = name + ":"
+		}
+		s.textf(x, y+1+row, width, attr, "%v$%04X  %-9v %-10v %v", marker, addr, strings.Join(hex, " "), label, ins.Text)
+		if addr == a.cursor {
+			s.fill(x, y+1+row, width, ATTR_HIGHLIGHT)
+		}
+		addr += uint16(len(ins.Bytes))
+	}
+}
+
+func (a *App) drawTrace(s *screen, x int, y int, width int, height int) {
+	s.title(x, y, width, "Trace")
+	rows := height - 1
+	traces := a.trace.Traces()
+	if len(traces) > rows {
+		traces = traces[len(traces)-rows:]
+	}
+	for i, t := range traces {
+		s.textf(x, y+1+i, width, ATTR_NORMAL, "%8d $%04X  %-16v A:%02X X:%02X Y:%02X", t.NumOperations, t.PC, t.Op, t.Registers.A, t.Registers.X, t.Registers.Y)
+	}
+}
+
+func (a *App) drawRegisters(s *screen, x int, y int, width int) int {
+	c := a.c
+	s.title(x, y, width, "Registers")
+	s.textf(x, y+1, width, ATTR_NORMAL, "PC $%04X  A $%02X  X $%02X  Y $%02X  SP $%02X", c.Registers.PC, c.Registers.A, c.Registers.X, c.Registers.Y, c.Registers.SP)
+
+	flags := []struct {
+		name  string
+		value byte
+	}{{"N", c.Flags.N}, {"V", c.Flags.V}, {"-", 1}, {"B", c.Flags.B}, {"D", c.Flags.D}, {"I", c.Flags.I}, {"Z", c.Flags.Z}, {"C", c.Flags.C}}
+	for i, f := range flags {
+		attr := ATTR_DIM
+		if f.value != 0 {
+			attr = ATTR_TITLE
+		}
+		s.text(x+i, y+2, 1, attr, f.name)
+	}
+	s.textf(x+10, y+2, width-10, ATTR_NORMAL, "cycle %d  instr %d", c.Tick, a.d.NumOperations)
+
+	y += 3
+	for _, w := range a.d.Watches {
+		if w.Err != nil {
+			s.textf(x, y, width, ATTR_BREAKPOINT, "%v: %v", w.Expr, w.Err)
+		} else {
+			s.textf(x, y, width, ATTR_NORMAL, "%v = %d ($%X)", w.Expr, w.Value, w.Value)
+		}
+		y += 1
+	}
+	return y
+}
+
+func (a *App) drawStack(s *screen, x int, y int, width int) int {
+	s.title(x, y, width, "Stack")
+	sp := a.c.Registers.SP
+	count := 0xFF - int(sp)
+	if count > 8 {
+		count = 8
+	}
+	data := a.d.ReadMemory(0x0100+uint16(sp)+1, count)
+	hex := make([]string, len(data))
+	for i, b := range data {
+		hex[i] = fmt.Sprintf("%02X", b)
+	}
+	s.textf(x, y+1, width, ATTR_NORMAL, "$%04X  %v", 0x0100+int(sp)+1, strings.Join(hex, " "))
+
+	frames := a.d.Calls.Frames
+	y += 2
+	for i := len(frames) - 1; i >= 0 && i >= len(frames)-4; i-- {
+		f := frames[i]
+		s.textf(x, y, width, ATTR_NORMAL, "%v from %v", a.d.Symbols.Format(f.Target), a.d.Symbols.Format(f.Caller))
+		y += 1
+	}
+	return y
+}
+
+func (a *App) drawBreakpoints(s *screen, x int, y int, width int) int {
+	s.title(x, y, width, "Breakpoints")
+	y += 1
+	for _, bp := range a.d.Breakpoints() {
+		state := "on "
+		if !bp.Enabled {
+			state = "off"
+		}
+		cond := ""
+		if bp.Condition != nil {
+			cond = " if " + bp.Condition.String()
+		}
+		s.textf(x, y, width, ATTR_NORMAL, "%v $%04X %-16v hits %d%v", state, bp.Addr, a.d.Symbols.Format(bp.Addr), bp.Hits, cond)
+		y += 1
+	}
+	return y
+}
+
+func (a *App) drawMemory(s *screen, x int, y int, width int, height int) {
+	s.title(x, y, width, "Memory")
+	for row := 0; row < height-1; row++ {
+		addr := a.memAddr + uint16(row*MEMORY_COLUMNS)
+		data := a.d.ReadMemory(addr, MEMORY_COLUMNS)
+
+		var hex, text strings.Builder
+		for _, b := range data {
+			fmt.Fprintf(&hex, "%02X ", b)
+			if b >= 0x20 && b < 0x7F {
+				text.WriteByte(b)
+			} else {
+				text.WriteByte('.')
+			}
+		}
+		s.textf(x, y+1+row, width, ATTR_NORMAL, "$%04X  %v %v", addr, hex.String(), text.String())
+	}
+}
@@ -0,0 +1,101 @@
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"unicode/utf8"
+)
+
+// Cell attributes
+const (
+	ATTR_NORMAL byte = iota
+	ATTR_TITLE
+	ATTR_HIGHLIGHT
+	ATTR_BREAKPOINT
+	ATTR_DIM
+)
+
+var attrCodes = [...]string{"\x1b[0m", "\x1b[0;1;36m", "\x1b[0;7m", "\x1b[0;31m", "\x1b[0;2m"}
+
+type cell struct {
+	ch   rune
+	attr byte
+}
+
+// screen is an off screen grid of cells, drawn in one go to avoid flicker
+type screen struct {
+	width  int
+	height int
+	cells  []cell
+}
+
+func newScreen(width int, height int) *screen {
+	s := &screen{width: width, height: height, cells: make([]cell, width*height)}
+	s.clear()
+	return s
+}
+
+func (s *screen) clear() {
+	for i := range s.cells {
+		s.cells[i] = cell{' ', ATTR_NORMAL}
+	}
+}
+
+// text writes str at x, y clipped to at most width cells
+func (s *screen) text(x int, y int, width int, attr byte, str string) {
+	if y < 0 || y >= s.height {
+		return
+	}
+	for _, ch := range str {
+		if width == 0 || x >= s.width {
+			return
+		}
+		if x >= 0 {
+			s.cells[y*s.width+x] = cell{ch, attr}
+		}
+		x += 1
+		width -= 1
+	}
+}
+
+// textf is text with formatting
+func (s *screen) textf(x int, y int, width int, attr byte, format string, args ...interface{}) {
+	s.text(x, y, width, attr, fmt.Sprintf(format, args...))
+}
+
+// fill sets the attribute of a run of cells, for highlighted lines
+func (s *screen) fill(x int, y int, width int, attr byte) {
+	if y < 0 || y >= s.height {
+		return
+	}
+	for i := x; i < x+width && i < s.width; i++ {
+		s.cells[y*s.width+i].attr = attr
+	}
+}
+
+// title draws a pane title across its width
+func (s *screen) title(x int, y int, width int, str string) {
+	line := "─ " + str + " "
+	for utf8.RuneCountInString(line) < width {
+		line += "─"
+	}
+	s.text(x, y, width, ATTR_TITLE, line)
+}
+
+func (s *screen) flush(w *bufio.Writer) error {
+	w.WriteString("\x1b[H")
+	attr := byte(255)
+	for y := 0; y < s.height; y++ {
+		fmt.Fprintf(w, "\x1b[%d;1H", y+1)
+		for x := 0; x < s.width; x++ {
+			c := s.cells[y*s.width+x]
+			if c.attr != attr {
+				attr = c.attr
+				w.WriteString(attrCodes[attr])
+			}
+			w.WriteRune(c.ch)
+		}
+	}
+	w.WriteString(attrCodes[ATTR_NORMAL])
+	return w.Flush()
+}
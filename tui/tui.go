@@ -0,0 +1,334 @@
+// Package tui is a full screen terminal front end for the debugger. It only
+// needs an ANSI terminal and drives it directly, without curses.
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+	debugger "izzudinhafiz.com/go-6502/debugger"
+	term "izzudinhafiz.com/go-6502/term"
+)
+
+const (
+	TRACE_SIZE = 256
+
+	// Cycles run between checks for keys and breakpoints while running
+	RUN_SLICE = 20000
+	FRAME     = 50 * time.Millisecond
+
+	MEMORY_COLUMNS = 8
+	LEFT_WIDTH     = 52
+)
+
+var help = "s step  n over  u out  c run/pause  r run to cursor  b breakpoint  ↑↓ cursor  g memory  w watch  : eval  R reset  q quit"
+
+// App is the debugger front end
+type App struct {
+	d      *debugger.Debugger6502
+	c      *cpu.Cpu6502
+	trace  *debugger.RingBuffer
+	in     *os.File
+	out    *bufio.Writer
+	keys   chan string
+	width  int
+	height int
+
+	cursor  uint16 // Disassembly line the b and r keys act on
+	follow  bool   // Whether the cursor tracks PC
+	memAddr uint16
+	running bool
+	status  string
+	prompt  *prompt
+	quit    bool
+}
+
+type prompt struct {
+	label  string
+	text   string
+	submit func(text string)
+}
+
+// New returns a front end for d, reading keys from in and drawing to out
+func New(d *debugger.Debugger6502, in *os.File, out io.Writer) *App {
+	a := &App{
+		d:      d,
+		c:      d.CPU(),
+		trace:  debugger.NewRingBuffer(TRACE_SIZE),
+		in:     in,
+		out:    bufio.NewWriterSize(out, 1<<16),
+		keys:   make(chan string, 16),
+		follow: true,
+		status: "stopped",
+	}
+	a.cursor = a.c.Registers.PC
+	d.AddSink(a.trace)
+	return a
+}
+
+// Run takes over the terminal until the user quits
+func (a *App) Run() error {
+	fd := a.in.Fd()
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+
+	a.out.WriteString("\x1b[?1049h\x1b[?25l")
+	defer func() {
+		a.out.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+		a.out.Flush()
+	}()
+
+	go a.readKeys()
+
+	for !a.quit {
+		if !a.running {
+			a.draw()
+			key, ok := <-a.keys
+			if !ok {
+				return nil
+			}
+			a.handleKey(key)
+			continue
+		}
+
+		a.runFrame()
+		a.draw()
+		select {
+		case key, ok := <-a.keys:
+			if !ok {
+				return nil
+			}
+			a.handleKey(key)
+		default:
+		}
+	}
+	return nil
+}
+
+// runFrame runs the CPU in slices for one frame, stopping at breakpoints
+func (a *App) runFrame() {
+	deadline := time.Now().Add(FRAME)
+	for a.running && time.Now().Before(deadline) {
+		stop := a.d.RunFor(RUN_SLICE)
+		if stop.Reason != debugger.STOP_CYCLES {
+			a.stopped(stop)
+			return
+		}
+		if bp := a.d.CheckBreakpoint(); bp != nil {
+			a.stopped(debugger.Stop{Reason: debugger.STOP_BREAKPOINT, PC: a.c.Registers.PC, Breakpoint: bp})
+			return
+		}
+	}
+	a.follow = true
+}
+
+func (a *App) stopped(stop debugger.Stop) {
+	a.running = false
+	a.status = stop.String()
+	a.follow = true
+}
+
+func (a *App) readKeys() {
+	buf := make([]byte, 64)
+	for {
+		n, err := a.in.Read(buf)
+		if err != nil {
+			close(a.keys)
+			return
+		}
+		for _, key := range decodeKeys(buf[:n]) {
+			a.keys <- key
+		}
+	}
+}
+
+var escapeKeys = map[string]string{
+	"\x1b[A": "up", "\x1b[B": "down", "\x1b[C": "right", "\x1b[D": "left",
+	"\x1b[5~": "pgup", "\x1b[6~": "pgdn", "\x1bOA": "up", "\x1bOB": "down",
+}
+
+// decodeKeys splits raw terminal input into key names, single characters
+// stand for themselves
+func decodeKeys(input []byte) []string {
+	var keys []string
+	s := string(input)
+	for len(s) > 0 {
+		if s[0] == 0x1b {
+			matched := false
+			for seq, name := range escapeKeys {
+				if strings.HasPrefix(s, seq) {
+					keys = append(keys, name)
+					s = s[len(seq):]
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				keys = append(keys, "esc")
+				s = s[1:]
+			}
+			continue
+		}
+
+		switch s[0] {
+		case '\r', '\n':
+			keys = append(keys, "enter")
+		case 0x7f, 0x08:
+			keys = append(keys, "backspace")
+		case 0x03:
+			keys = append(keys, "ctrl-c")
+		default:
+			keys = append(keys, s[:1])
+		}
+		s = s[1:]
+	}
+	return keys
+}
+
+func (a *App) handleKey(key string) {
+	if a.prompt != nil {
+		a.editPrompt(key)
+		return
+	}
+
+	if a.running {
+		switch key {
+		case "c", " ", "esc":
+			a.running = false
+			a.status = fmt.Sprintf("paused at $%04X", a.c.Registers.PC)
+		case "q", "ctrl-c":
+			a.quit = true
+		}
+		return
+	}
+
+	switch key {
+	case "q", "ctrl-c":
+		a.quit = true
+	case "s":
+		a.stopped(a.d.Step())
+	case "n":
+		a.stopped(a.d.StepOver())
+	case "u":
+		a.stopped(a.d.StepOut())
+	case "c":
+		a.running = true
+		a.status = "running"
+		// Step off a breakpoint first, slices would stop on it straight away
+		if stop := a.d.Step(); stop.Reason != debugger.STOP_STEP {
+			a.stopped(stop)
+		}
+	case "r":
+		a.stopped(a.d.RunTo(a.cursor))
+	case "b":
+		a.toggleBreakpoint(a.cursor)
+	case "up":
+		a.follow = false
+		a.cursor = a.previousInstruction(a.cursor)
+	case "down":
+		a.follow = false
+		a.cursor += uint16(len(a.d.Disassemble(a.cursor).Bytes))
+	case "pgup":
+		a.memAddr -= MEMORY_COLUMNS * 8
+	case "pgdn":
+		a.memAddr += MEMORY_COLUMNS * 8
+	case "g":
+		a.ask("memory at", func(text string) {
+			if addr, ok := a.evaluate(text); ok {
+				a.memAddr = uint16(addr)
+			}
+		})
+	case "w":
+		a.ask("watch", func(text string) {
+			if _, err := a.d.AddWatch(text); err != nil {
+				a.status = err.Error()
+			}
+		})
+	case ":":
+		a.ask("eval", func(text string) {
+			if value, ok := a.evaluate(text); ok {
+				a.status = fmt.Sprintf("%v = %d = $%X", text, value, value)
+			}
+		})
+	case "R":
+		a.c.Reset()
+		a.d.Calls.Reset()
+		a.trace.Reset()
+		a.follow = true
+		a.status = "reset"
+	}
+
+}
+
+func (a *App) evaluate(text string) (int, bool) {
+	value, err := a.d.Evaluate(text)
+	if err != nil {
+		a.status = err.Error()
+		return 0, false
+	}
+	return value, true
+}
+
+func (a *App) toggleBreakpoint(addr uint16) {
+	for _, bp := range a.d.Breakpoints() {
+		if bp.Addr == addr {
+			a.d.RemoveBreakpoint(addr)
+			a.status = fmt.Sprintf("removed breakpoint at $%04X", addr)
+			return
+		}
+	}
+
+	a.d.AddBreakpoint(addr)
+	a.status = fmt.Sprintf("breakpoint at $%04X", addr)
+	a.ask("condition", func(text string) {
+		for _, bp := range a.d.Breakpoints() {
+			if bp.Addr == addr {
+				if err := bp.SetCondition(text); err != nil {
+					a.status = err.Error()
+				}
+			}
+		}
+	})
+}
+
+func (a *App) ask(label string, submit func(text string)) {
+	a.prompt = &prompt{label: label, submit: submit}
+}
+
+func (a *App) editPrompt(key string) {
+	p := a.prompt
+	switch key {
+	case "enter":
+		a.prompt = nil
+		p.submit(p.text)
+	case "esc", "ctrl-c":
+		a.prompt = nil
+	case "backspace":
+		if len(p.text) > 0 {
+			p.text = p.text[:len(p.text)-1]
+		}
+	default:
+		if len(key) == 1 && key[0] >= ' ' {
+			p.text += key
+		}
+	}
+}
+
+// previousInstruction guesses where the instruction before addr starts,
+// preferring a one byte step when no longer instruction ends exactly at addr
+func (a *App) previousInstruction(addr uint16) uint16 {
+	for size := uint16(3); size > 1; size-- {
+		if len(a.d.Disassemble(addr-size).Bytes) == int(size) {
+			return addr - size
+		}
+	}
+	return addr - 1
+}
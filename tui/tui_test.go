@@ -0,0 +1,139 @@
+package tui
+
+import (
+	"bytes"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	cpu "izzudinhafiz.com/go-6502/cpu"
+	debugger "izzudinhafiz.com/go-6502/debugger"
+)
+
+func TestDecodeKeys(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"s", []string{"s"}},
+		{"sn:", []string{"s", "n", ":"}},
+		{"\r\n", []string{"enter", "enter"}},
+		{"\x7f\x08", []string{"backspace", "backspace"}},
+		{"\x03", []string{"ctrl-c"}},
+		{"\x1b[A\x1b[B", []string{"up", "down"}},
+		{"\x1bOA\x1bOB", []string{"up", "down"}},
+		{"\x1b[5~g\x1b[6~", []string{"pgup", "g", "pgdn"}},
+		{"\x1b", []string{"esc"}},
+		{"\x1bq", []string{"esc", "q"}},
+		{"\x1b[Z", []string{"esc", "[", "Z"}}, // Not a sequence the debugger knows
+		{"\x1b[5", []string{"esc", "[", "5"}}, // Cut short
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		if got := decodeKeys([]byte(tt.input)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodeKeys(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+// decodeKeys tries the sequences in map order, which only works while none
+// is a prefix of another
+func TestEscapeKeys(t *testing.T) {
+	for seq, name := range escapeKeys {
+		if got := decodeKeys([]byte(seq)); !reflect.DeepEqual(got, []string{name}) {
+			t.Errorf("%q decoded to %q, want %v", seq, got, name)
+		}
+		for other := range escapeKeys {
+			if other != seq && strings.HasPrefix(other, seq) {
+				t.Errorf("%q is a prefix of %q", seq, other)
+			}
+		}
+	}
+}
+
+var (
+	attrPattern = regexp.MustCompile("\x1b\\[[0-9;]*m")
+	rowPattern  = regexp.MustCompile("\x1b\\[[0-9]+;1H")
+)
+
+// renderedRows splits a drawn screen into its rows with the attributes taken out
+func renderedRows(out string) [][]rune {
+	out = attrPattern.ReplaceAllString(strings.TrimPrefix(out, "\x1b[H"), "")
+	var rows [][]rune
+	for _, row := range rowPattern.Split(out, -1)[1:] {
+		rows = append(rows, []rune(row))
+	}
+	return rows
+}
+
+func TestRender(t *testing.T) {
+	c := cpu.New()
+	// LDA #$42; STA $10; JMP $0200
+	c.WriteMemory(0x0200, []byte{0xA9, 0x42, 0x85, 0x10, 0x4C, 0x00, 0x02})
+	c.Registers.PC, c.Registers.SP = 0x0200, 0xFD
+	d := debugger.New(c)
+	d.Symbols.Add("loop", 0x0200)
+	d.AddBreakpoint(0x0204)
+	c.Memory[0x0012] = 'A'
+
+	// A pipe is not a terminal, so the screen is drawn at its default size
+	in, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer in.Close()
+	defer w.Close()
+	var out bytes.Buffer
+	a := New(d, in, &out)
+	d.Step()
+	a.draw()
+
+	rows := renderedRows(out.String())
+	if len(rows) != 32 {
+		t.Fatalf("drew %d rows, want 32", len(rows))
+	}
+	for y, row := range rows {
+		if len(row) != 100 {
+			t.Errorf("row %d is %d cells wide, want 100", y, len(row))
+		}
+	}
+
+	// The disassembly and trace take the left 52 columns, the other panes start after a gap
+	tests := []struct {
+		x, y int
+		want string
+	}{
+		{0, 0, " go6502  stopped  stopped "},
+		{0, 1, "─ Disassembly ─"},
+		{0, 6, "  $0200  A9 42     loop:      LDA #$42"},
+		{0, 7, " >$0202  85 10                STA $10"},
+		{0, 8, "● $0204  4C 00 02             JMP loop"},
+		{0, 19, "─ Trace ─"},
+		{0, 20, "       1 $0200  LDA #$42         A:42 X:00 Y:00"},
+		{53, 1, "─ Registers ─"},
+		{53, 2, "PC $0202  A $42  X $00  Y $00  SP $FD"},
+		{53, 3, "NV-BDIZC  cycle 2  instr 1"},
+		{53, 4, "─ Stack ─"},
+		{53, 5, "$01FE  00 00"},
+		{53, 6, "─ Breakpoints ─"},
+		{53, 7, "on  $0204 loop+$4          hits 0"},
+		{53, 8, "─ Memory ─"},
+		{53, 9, "$0000  00 00 00 00 00 00 00 00  ........"},
+		{53, 11, "$0010  00 00 41 00 00 00 00 00  ..A....."},
+		{0, 31, "s step  n over"},
+	}
+	for _, tt := range tests {
+		got := string(rows[tt.y][tt.x:])
+		if !strings.HasPrefix(got, tt.want) {
+			t.Errorf("row %d column %d is %q, want %q", tt.y, tt.x, got, tt.want)
+		}
+	}
+
+	// The cursor follows PC and is highlighted
+	if !strings.Contains(out.String(), "\x1b[0;7m >$0202") {
+		t.Errorf("the line at PC is not highlighted")
+	}
+}